@@ -0,0 +1,54 @@
+// Command export writes the stats samples added since the last run to
+// Parquet files for the analytics warehouse. It is meant for nightly jobs:
+//
+//	export -dir /data/warehouse
+//
+// Run it from the directory holding video_stats.db.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"video-stats-tracker/internal/repository"
+	"video-stats-tracker/internal/service"
+)
+
+func main() {
+    dir := flag.String("dir", getEnv("EXPORT_DIR", "exports"), "directory the partitions are written to")
+    name := flag.String("name", service.DefaultExportName, "export whose watermark is used and advanced")
+    full := flag.Bool("full", false, "export every sample instead of those since the watermark")
+    flag.Parse()
+
+    repo, err := repository.NewSQLiteRepository()
+    if err != nil {
+        log.Fatalf("Failed to connect to database: %v", err)
+    }
+
+    // Only the repository is used; no platform credentials are needed
+    svc := service.NewService(repo, "", "", "", service.WithExportDir(*dir))
+    export, err := svc.ExportParquet(context.Background(), *name, *full)
+    if err != nil {
+        log.Fatalf("Export failed: %v", err)
+    }
+
+    if export.Rows == 0 {
+        log.Printf("Nothing to export after change %d", export.FromSeq)
+    } else {
+        log.Printf("Exported %d rows (changes %d-%d) to %d files in %s",
+            export.Rows, export.FromSeq+1, export.ToSeq, len(export.Files), export.Dir)
+    }
+    encoder := json.NewEncoder(os.Stdout)
+    encoder.SetIndent("", "  ")
+    encoder.Encode(export)
+}
+
+func getEnv(key, defaultValue string) string {
+    if value := os.Getenv(key); value != "" {
+        return value
+    }
+    return defaultValue
+}
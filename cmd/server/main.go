@@ -6,6 +6,9 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -14,6 +17,8 @@ import (
 	"video-stats-tracker/internal/service"
 	httpTransport "video-stats-tracker/internal/transport/http"
 	"video-stats-tracker/internal/worker"
+
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
 )
 
 func main() {
@@ -22,15 +27,44 @@ func main() {
     instagramToken := getEnv("INSTAGRAM_TOKEN", "EAALI2aRc08wBPnURGNzA5dS0pJkvkWZBKDLLN4W3aJGZCuua5d9fOJ3Uw5RFhuOij1yRKwNn3BL9RlL0jV5ERZA3ebEbzQLKMEUZAJKGOFXQcD754USCDYFKpLZB4AOZATkPJJAntGUzrhQa48FqOZAc9sraH3eUCrEvlqyntNew05CGlNfpIiRn7MPwl6VSB7VBmSfXxvUQrzEjLiSmg8nsYtKZBSnzMJG2uaggJEBkH9pzQwZDZD")
     instagramID := getEnv("INSTAGRAM_ID", "17841477784603001")
     httpPort := getEnv("HTTP_PORT", "8080")
+    // Retention deletes raw history, so it only runs once configured
+    retention := repository.RetentionPolicy{
+        RawFor:    getEnvDays("RETENTION_RAW_DAYS", 0),
+        HourlyFor: getEnvDays("RETENTION_HOURLY_DAYS", 0),
+        Horizon:   getEnvDays("RETENTION_HORIZON_DAYS", 0),
+    }
+
+    // Operational metrics, served at /metrics
+    videoGauges := getEnvBool("METRICS_VIDEO_GAUGES", false)
+    metrics := newInstrumentation(videoGauges)
+
+    storageMode := getEnv("STATS_STORAGE_MODE", service.StorageAll)
+    if !service.ValidStorageMode(storageMode) {
+        log.Fatalf("Invalid STATS_STORAGE_MODE %q: use %s or %s", storageMode, service.StorageAll, service.StorageChanges)
+    }
 
     // Initialize repository - Using SQLite
     repo, err := repository.NewSQLiteRepository()
     if err != nil {
         log.Fatalf("Failed to connect to database: %v", err)
     }
+    repo = repository.NewInstrumentingRepository(repo, metrics.dbDuration)
+    if videoGauges {
+        stdprometheus.MustRegister(newVideoTagsCollector(repo))
+    }
 
     // Initialize service
-    svc := service.NewService(repo, youtubeAPIKey, instagramToken, instagramID)
+    svc := service.NewService(repo, youtubeAPIKey, instagramToken, instagramID,
+        service.WithRetention(retention),
+        service.WithWebhookRetention(getEnvDays("WEBHOOK_DELIVERY_RETENTION_DAYS", 30)),
+        service.WithStorageMode(storageMode),
+        service.WithMilestones(
+            getEnvInts("MILESTONES_VIEWS", service.ViewMilestones),
+            getEnvInts("MILESTONES_LIKES", service.LikeMilestones),
+        ),
+        service.WithExportDir(getEnv("EXPORT_DIR", "exports")),
+        service.WithInstrumentation(metrics.service),
+    )
 
     // Initialize endpoints
     endpoints := endpoint.MakeEndpoints(svc)
@@ -39,7 +73,7 @@ func main() {
     handler := httpTransport.NewHTTPHandler(endpoints)
 
     // Initialize polling worker
-    poller := worker.NewPoller(svc)
+    poller := worker.NewPoller(svc, worker.WithInstrumentation(metrics.pollDuration, metrics.service.QueueDepth))
     poller.Start()
     defer poller.Stop()
 
@@ -83,4 +117,45 @@ func getEnv(key, defaultValue string) string {
         return value
     }
     return defaultValue
-}
\ No newline at end of file
+}
+
+// getEnvDays reads a number of days, falling back to the default when the
+// variable is unset or invalid
+func getEnvDays(key string, defaultDays int) time.Duration {
+    days, err := strconv.Atoi(os.Getenv(key))
+    if err != nil {
+        days = defaultDays
+    }
+    return time.Duration(days) * 24 * time.Hour
+}
+
+// getEnvBool reads a boolean such as true or 1, falling back to the default
+// when the variable is unset or invalid
+func getEnvBool(key string, defaultValue bool) bool {
+    value, err := strconv.ParseBool(os.Getenv(key))
+    if err != nil {
+        return defaultValue
+    }
+    return value
+}
+
+// getEnvInts parses a comma-separated list of positive integers, sorted
+// ascending, falling back to the default when unset or invalid
+func getEnvInts(key string, defaultValues []int) []int {
+    value := os.Getenv(key)
+    if value == "" {
+        return defaultValues
+    }
+
+    var values []int
+    for _, field := range strings.Split(value, ",") {
+        n, err := strconv.Atoi(strings.TrimSpace(field))
+        if err != nil || n <= 0 {
+            log.Printf("Ignoring invalid %s=%q", key, value)
+            return defaultValues
+        }
+        values = append(values, n)
+    }
+    sort.Ints(values)
+    return values
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"video-stats-tracker/internal/platform"
+	"video-stats-tracker/internal/repository"
+	"video-stats-tracker/internal/service"
+
+	"github.com/go-kit/kit/metrics"
+	kitprometheus "github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+)
+
+// metricsNamespace prefixes every metric name
+const metricsNamespace = "video_stats"
+
+// instrumentation is the set of Prometheus metrics served at /metrics
+type instrumentation struct {
+    service      service.Instrumentation
+    pollDuration metrics.Histogram
+    dbDuration   metrics.Histogram
+}
+
+// newInstrumentation creates the metrics in the default registry. The
+// per-video gauges are only created when videoGauges is set, as they add
+// three series per tracked video.
+func newInstrumentation(videoGauges bool) *instrumentation {
+    m := &instrumentation{
+        service: service.Instrumentation{
+            Platform: platform.Metrics{
+                Duration: kitprometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+                    Namespace: metricsNamespace,
+                    Subsystem: "platform",
+                    Name:      "request_duration_seconds",
+                    Help:      "Duration of platform API requests until the response headers.",
+                    Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+                }, []string{"platform", "operation", "status"}),
+                Errors: kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+                    Namespace: metricsNamespace,
+                    Subsystem: "platform",
+                    Name:      "request_errors_total",
+                    Help:      "Platform API requests that failed or were answered with a non-2xx status.",
+                }, []string{"platform", "operation", "status"}),
+                QuotaUnits: kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+                    Namespace: metricsNamespace,
+                    Subsystem: "youtube",
+                    Name:      "quota_units_total",
+                    Help:      "YouTube Data API quota units spent.",
+                }, []string{"operation"}),
+                QuotaUsed: kitprometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+                    Namespace: metricsNamespace,
+                    Subsystem: "youtube",
+                    Name:      "quota_used_units",
+                    Help:      "YouTube Data API quota units spent since midnight Pacific time.",
+                }, []string{}),
+                AppUsage: kitprometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+                    Namespace: metricsNamespace,
+                    Subsystem: "instagram",
+                    Name:      "app_usage_percent",
+                    Help:      "Graph API rate limit usage reported in X-App-Usage.",
+                }, []string{"kind"}),
+            },
+            QueueDepth: kitprometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+                Namespace: metricsNamespace,
+                Name:      "queue_depth",
+                Help:      "Items waiting in the poll, retry and webhook queues.",
+            }, []string{"queue"}),
+        },
+        pollDuration: kitprometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+            Namespace: metricsNamespace,
+            Subsystem: "poller",
+            Name:      "job_duration_seconds",
+            Help:      "Duration of the polling worker's job runs.",
+            Buckets:   []float64{0.1, 0.5, 1, 5, 15, 30, 60, 120, 300, 600},
+        }, []string{"job"}),
+        dbDuration: kitprometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+            Namespace: metricsNamespace,
+            Subsystem: "db",
+            Name:      "query_duration_seconds",
+            Help:      "Duration of repository calls.",
+            Buckets:   []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5},
+        }, []string{"method", "success"}),
+    }
+
+    if videoGauges {
+        labels := []string{"video_id", "platform"}
+        gauge := func(name, help string) metrics.Gauge {
+            return kitprometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+                Namespace: metricsNamespace,
+                Subsystem: "video",
+                Name:      name,
+                Help:      help,
+            }, labels)
+        }
+        m.service.Videos = &service.VideoGauges{
+            Views:    gauge("views", "Latest view count of a tracked video."),
+            Likes:    gauge("likes", "Latest like count of a tracked video."),
+            Comments: gauge("comments", "Latest comment count of a tracked video."),
+        }
+    }
+    return m
+}
+
+// videoTagsCollector exports video_stats_video_tag_info, one series per tag
+// of every polled video, read from the database on each scrape so removed
+// tags and videos disappear at once. Join it with the per-video gauges on
+// video_id to filter or group them by tag.
+type videoTagsCollector struct {
+    repo repository.Repository
+    desc *stdprometheus.Desc
+}
+
+func newVideoTagsCollector(repo repository.Repository) *videoTagsCollector {
+    return &videoTagsCollector{
+        repo: repo,
+        desc: stdprometheus.NewDesc(
+            stdprometheus.BuildFQName(metricsNamespace, "video", "tag_info"),
+            "Tags of a tracked video, one series per tag with the value 1.",
+            []string{"video_id", "platform", "tag"}, nil,
+        ),
+    }
+}
+
+func (c *videoTagsCollector) Describe(ch chan<- *stdprometheus.Desc) {
+    ch <- c.desc
+}
+
+func (c *videoTagsCollector) Collect(ch chan<- stdprometheus.Metric) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    videos, err := c.repo.GetAllVideos(ctx)
+    if err != nil {
+        log.Printf("Error loading video tags for metrics: %v", err)
+        ch <- stdprometheus.NewInvalidMetric(c.desc, err)
+        return
+    }
+    for _, video := range videos {
+        for _, tag := range video.Tags {
+            ch <- stdprometheus.MustNewConstMetric(c.desc, stdprometheus.GaugeValue, 1, video.VideoID, video.Platform, tag)
+        }
+    }
+}
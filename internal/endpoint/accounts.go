@@ -0,0 +1,111 @@
+package endpoint
+
+import (
+    "context"
+    "net/http"
+    "time"
+
+    "github.com/go-kit/kit/endpoint"
+    "video-stats-tracker/internal/repository"
+    "video-stats-tracker/internal/service"
+)
+
+type TrackChannelRequest struct {
+    Channel      string `json:"channel"`
+    Tag          string `json:"tag,omitempty"`
+    LookbackDays int    `json:"lookback_days,omitempty"`
+}
+
+type TrackAccountRequest struct {
+    Username     string `json:"username"`
+    Tag          string `json:"tag,omitempty"`
+    MediaType    string `json:"media_type,omitempty"`
+    LookbackDays int    `json:"lookback_days,omitempty"`
+}
+
+type TrackAccountResponse struct {
+    Account    *repository.TrackedAccount `json:"account,omitempty"`
+    Registered int                        `json:"registered"`
+    // SyncError is set when the account was stored but registering its
+    // existing uploads failed
+    SyncError string `json:"sync_error,omitempty"`
+    Err       error  `json:"-"`
+}
+
+func (r TrackAccountResponse) Failed() error { return r.Err }
+
+// StatusCode reports 201 Created once the account is stored, even if the
+// initial sync of existing uploads failed
+func (r TrackAccountResponse) StatusCode() int { return http.StatusCreated }
+
+// trackAccountResponse keeps an account that was stored before its initial
+// sync failed a success, so clients do not retry into a duplicate error
+func trackAccountResponse(account *repository.TrackedAccount, registered int, err error) TrackAccountResponse {
+    if err != nil && account != nil {
+        return TrackAccountResponse{Account: account, Registered: registered, SyncError: err.Error()}
+    }
+    return TrackAccountResponse{Account: account, Registered: registered, Err: err}
+}
+
+type GetAccountsResponse struct {
+    Accounts []repository.TrackedAccount `json:"accounts"`
+    Err      error                       `json:"-"`
+}
+
+func (r GetAccountsResponse) Failed() error { return r.Err }
+
+func makeTrackChannelEndpoint(s service.Service) endpoint.Endpoint {
+    return func(ctx context.Context, request interface{}) (interface{}, error) {
+        req := request.(TrackChannelRequest)
+        lookback := time.Duration(req.LookbackDays) * 24 * time.Hour
+        account, registered, err := s.TrackChannel(ctx, req.Channel, req.Tag, lookback)
+        return trackAccountResponse(account, registered, err), nil
+    }
+}
+
+func makeTrackAccountEndpoint(s service.Service) endpoint.Endpoint {
+    return func(ctx context.Context, request interface{}) (interface{}, error) {
+        req := request.(TrackAccountRequest)
+        lookback := time.Duration(req.LookbackDays) * 24 * time.Hour
+        account, registered, err := s.TrackInstagramAccount(ctx, req.Username, req.Tag, req.MediaType, lookback)
+        return trackAccountResponse(account, registered, err), nil
+    }
+}
+
+func makeGetAccountsEndpoint(s service.Service) endpoint.Endpoint {
+    return func(ctx context.Context, request interface{}) (interface{}, error) {
+        accounts, err := s.GetTrackedAccounts(ctx)
+        if err != nil {
+            return GetAccountsResponse{Err: err}, nil
+        }
+        return GetAccountsResponse{Accounts: accounts}, nil
+    }
+}
+
+type GetAccountStatsRequest struct {
+    AccountID string    `json:"account_id"`
+    From      time.Time `json:"from"`
+    To        time.Time `json:"to"`
+}
+
+type GetAccountStatsResponse struct {
+    Account *repository.TrackedAccount `json:"account,omitempty"`
+    Stats   []repository.AccountStats  `json:"stats"`
+    Err     error                      `json:"-"`
+}
+
+func (r GetAccountStatsResponse) Failed() error { return r.Err }
+
+func makeGetAccountStatsEndpoint(s service.Service) endpoint.Endpoint {
+    return func(ctx context.Context, request interface{}) (interface{}, error) {
+        req := request.(GetAccountStatsRequest)
+        account, stats, err := s.GetAccountStats(ctx, req.AccountID, req.From, req.To)
+        if err != nil {
+            return GetAccountStatsResponse{Err: err}, nil
+        }
+        if stats == nil {
+            stats = []repository.AccountStats{}
+        }
+        return GetAccountStatsResponse{Account: account, Stats: stats}, nil
+    }
+}
@@ -0,0 +1,117 @@
+package endpoint
+
+import (
+    "context"
+    "net/http"
+
+    "github.com/go-kit/kit/endpoint"
+    "video-stats-tracker/internal/repository"
+    "video-stats-tracker/internal/service"
+)
+
+type CreateAlertRuleRequest struct {
+    Name       string   `json:"name,omitempty"`
+    ScopeType  string   `json:"scope_type,omitempty"`
+    ScopeValue string   `json:"scope_value,omitempty"`
+    Kind       string   `json:"kind"`
+    Metric     string   `json:"metric"`
+    Operator   string   `json:"operator,omitempty"`
+    Value      float64  `json:"value,omitempty"`
+    Window     string   `json:"window,omitempty"`
+    MinAge     string   `json:"min_age,omitempty"`
+    Notifiers  []string `json:"notifiers,omitempty"`
+}
+
+// CreateAlertRuleResponse encodes as the created rule
+type CreateAlertRuleResponse struct {
+    *repository.AlertRule
+    Err error `json:"-"`
+}
+
+func (r CreateAlertRuleResponse) Failed() error { return r.Err }
+
+func (r CreateAlertRuleResponse) StatusCode() int { return http.StatusCreated }
+
+type GetAlertRulesResponse struct {
+    Rules []repository.AlertRule `json:"rules"`
+    Err   error                  `json:"-"`
+}
+
+func (r GetAlertRulesResponse) Failed() error { return r.Err }
+
+type DeleteAlertRuleRequest struct {
+    ID string `json:"id"`
+}
+
+type DeleteAlertRuleResponse struct {
+    ID      string `json:"id"`
+    Deleted bool   `json:"deleted"`
+    Err     error  `json:"-"`
+}
+
+func (r DeleteAlertRuleResponse) Failed() error { return r.Err }
+
+type GetAlertsRequest struct {
+    State string `json:"state,omitempty"`
+    Limit int    `json:"limit,omitempty"`
+}
+
+type GetAlertsResponse struct {
+    Alerts []repository.Alert `json:"alerts"`
+    Err    error              `json:"-"`
+}
+
+func (r GetAlertsResponse) Failed() error { return r.Err }
+
+func makeCreateAlertRuleEndpoint(s service.Service) endpoint.Endpoint {
+    return func(ctx context.Context, request interface{}) (interface{}, error) {
+        req := request.(CreateAlertRuleRequest)
+        rule := repository.AlertRule{
+            Name:       req.Name,
+            ScopeType:  req.ScopeType,
+            ScopeValue: req.ScopeValue,
+            Kind:       req.Kind,
+            Metric:     req.Metric,
+            Operator:   req.Operator,
+            Value:      req.Value,
+            Window:     req.Window,
+            MinAge:     req.MinAge,
+            Notifiers:  req.Notifiers,
+        }
+        if err := s.CreateAlertRule(ctx, &rule); err != nil {
+            return CreateAlertRuleResponse{Err: err}, nil
+        }
+        return CreateAlertRuleResponse{AlertRule: &rule}, nil
+    }
+}
+
+func makeGetAlertRulesEndpoint(s service.Service) endpoint.Endpoint {
+    return func(ctx context.Context, _ interface{}) (interface{}, error) {
+        rules, err := s.GetAlertRules(ctx)
+        if rules == nil {
+            rules = []repository.AlertRule{}
+        }
+        return GetAlertRulesResponse{Rules: rules, Err: err}, nil
+    }
+}
+
+func makeDeleteAlertRuleEndpoint(s service.Service) endpoint.Endpoint {
+    return func(ctx context.Context, request interface{}) (interface{}, error) {
+        req := request.(DeleteAlertRuleRequest)
+        if err := s.DeleteAlertRule(ctx, req.ID); err != nil {
+            return DeleteAlertRuleResponse{Err: err}, nil
+        }
+        return DeleteAlertRuleResponse{ID: req.ID, Deleted: true}, nil
+    }
+}
+
+func makeGetAlertsEndpoint(s service.Service) endpoint.Endpoint {
+    return func(ctx context.Context, request interface{}) (interface{}, error) {
+        req := request.(GetAlertsRequest)
+        alerts, err := s.GetAlerts(ctx, req.State, req.Limit)
+        if alerts == nil {
+            alerts = []repository.Alert{}
+        }
+        return GetAlertsResponse{Alerts: alerts, Err: err}, nil
+    }
+}
@@ -0,0 +1,32 @@
+package endpoint
+
+import (
+    "context"
+
+    "github.com/go-kit/kit/endpoint"
+    "video-stats-tracker/internal/repository"
+    "video-stats-tracker/internal/service"
+)
+
+type GetAnomaliesRequest struct {
+    VideoID string `json:"video_id,omitempty"`
+    Limit   int    `json:"limit,omitempty"`
+}
+
+type GetAnomaliesResponse struct {
+    Anomalies []repository.Anomaly `json:"anomalies"`
+    Err       error                `json:"-"`
+}
+
+func (r GetAnomaliesResponse) Failed() error { return r.Err }
+
+func makeGetAnomaliesEndpoint(s service.Service) endpoint.Endpoint {
+    return func(ctx context.Context, request interface{}) (interface{}, error) {
+        req := request.(GetAnomaliesRequest)
+        anomalies, err := s.GetAnomalies(ctx, req.VideoID, req.Limit)
+        if anomalies == nil {
+            anomalies = []repository.Anomaly{}
+        }
+        return GetAnomaliesResponse{Anomalies: anomalies, Err: err}, nil
+    }
+}
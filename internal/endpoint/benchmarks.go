@@ -0,0 +1,57 @@
+package endpoint
+
+import (
+    "context"
+    "time"
+
+    "github.com/go-kit/kit/endpoint"
+    "video-stats-tracker/internal/repository"
+    "video-stats-tracker/internal/service"
+)
+
+type ListVideosRequest struct {
+    Filter    repository.VideoFilter `json:"filter"`
+    Benchmark string                 `json:"benchmark,omitempty"`
+    Metric    string                 `json:"metric,omitempty"`
+}
+
+type ListVideosResponse struct {
+    Videos []service.VideoListing `json:"videos"`
+    Err    error                  `json:"-"`
+}
+
+func (r ListVideosResponse) Failed() error { return r.Err }
+
+func makeListVideosEndpoint(s service.Service) endpoint.Endpoint {
+    return func(ctx context.Context, request interface{}) (interface{}, error) {
+        req := request.(ListVideosRequest)
+        videos, err := s.ListVideos(ctx, req.Filter, req.Benchmark, req.Metric)
+        if videos == nil {
+            videos = []service.VideoListing{}
+        }
+        return ListVideosResponse{Videos: videos, Err: err}, nil
+    }
+}
+
+type GetBenchmarkRequest struct {
+    Cohort repository.VideoFilter `json:"cohort"`
+    Metric string                 `json:"metric,omitempty"`
+    Step   time.Duration          `json:"step,omitempty"`
+    MaxAge time.Duration          `json:"max_age,omitempty"`
+}
+
+// GetBenchmarkResponse encodes as the cohort curve
+type GetBenchmarkResponse struct {
+    *service.Benchmark
+    Err error `json:"-"`
+}
+
+func (r GetBenchmarkResponse) Failed() error { return r.Err }
+
+func makeGetBenchmarkEndpoint(s service.Service) endpoint.Endpoint {
+    return func(ctx context.Context, request interface{}) (interface{}, error) {
+        req := request.(GetBenchmarkRequest)
+        benchmark, err := s.GetBenchmark(ctx, req.Cohort, req.Metric, req.Step, req.MaxAge)
+        return GetBenchmarkResponse{Benchmark: benchmark, Err: err}, nil
+    }
+}
@@ -0,0 +1,149 @@
+package endpoint
+
+import (
+    "context"
+    "net/http"
+    "time"
+
+    "github.com/go-kit/kit/endpoint"
+    "video-stats-tracker/internal/repository"
+    "video-stats-tracker/internal/service"
+)
+
+type CreateCampaignRequest struct {
+    Name             string    `json:"name"`
+    StartsAt         time.Time `json:"starts_at"`
+    EndsAt           time.Time `json:"ends_at"`
+    TargetViews      int       `json:"target_views,omitempty"`
+    TargetEngagement int       `json:"target_engagement,omitempty"`
+    Videos           []string  `json:"videos,omitempty"`
+}
+
+// CreateCampaignResponse encodes as the created campaign and its videos
+type CreateCampaignResponse struct {
+    *repository.Campaign
+    Videos []string `json:"videos"`
+    Err    error    `json:"-"`
+}
+
+func (r CreateCampaignResponse) Failed() error { return r.Err }
+
+func (r CreateCampaignResponse) StatusCode() int { return http.StatusCreated }
+
+type GetCampaignsResponse struct {
+    Campaigns []repository.Campaign `json:"campaigns"`
+    Err       error                 `json:"-"`
+}
+
+func (r GetCampaignsResponse) Failed() error { return r.Err }
+
+type CampaignRequest struct {
+    ID       string `json:"id"`
+    Interval string `json:"interval,omitempty"`
+    VideoID  string `json:"video_id,omitempty"`
+}
+
+// GetCampaignResponse encodes as the campaign report
+type GetCampaignResponse struct {
+    *service.CampaignReport
+    Err error `json:"-"`
+}
+
+func (r GetCampaignResponse) Failed() error { return r.Err }
+
+type DeleteCampaignResponse struct {
+    ID      string `json:"id"`
+    Deleted bool   `json:"deleted"`
+    Err     error  `json:"-"`
+}
+
+func (r DeleteCampaignResponse) Failed() error { return r.Err }
+
+type AddCampaignVideosRequest struct {
+    ID     string   `json:"id"`
+    Videos []string `json:"videos"`
+}
+
+type AddCampaignVideosResponse struct {
+    ID    string `json:"id"`
+    Added int    `json:"added"`
+    Err   error  `json:"-"`
+}
+
+func (r AddCampaignVideosResponse) Failed() error { return r.Err }
+
+type RemoveCampaignVideoResponse struct {
+    ID      string `json:"id"`
+    VideoID string `json:"video_id"`
+    Removed bool   `json:"removed"`
+    Err     error  `json:"-"`
+}
+
+func (r RemoveCampaignVideoResponse) Failed() error { return r.Err }
+
+func makeCreateCampaignEndpoint(s service.Service) endpoint.Endpoint {
+    return func(ctx context.Context, request interface{}) (interface{}, error) {
+        req := request.(CreateCampaignRequest)
+        campaign := repository.Campaign{
+            Name:             req.Name,
+            StartsAt:         req.StartsAt,
+            EndsAt:           req.EndsAt,
+            TargetViews:      req.TargetViews,
+            TargetEngagement: req.TargetEngagement,
+        }
+        videos, err := s.CreateCampaign(ctx, &campaign, req.Videos)
+        if err != nil {
+            return CreateCampaignResponse{Err: err}, nil
+        }
+        if videos == nil {
+            videos = []string{}
+        }
+        return CreateCampaignResponse{Campaign: &campaign, Videos: videos}, nil
+    }
+}
+
+func makeGetCampaignsEndpoint(s service.Service) endpoint.Endpoint {
+    return func(ctx context.Context, _ interface{}) (interface{}, error) {
+        campaigns, err := s.GetCampaigns(ctx)
+        if campaigns == nil {
+            campaigns = []repository.Campaign{}
+        }
+        return GetCampaignsResponse{Campaigns: campaigns, Err: err}, nil
+    }
+}
+
+func makeGetCampaignEndpoint(s service.Service) endpoint.Endpoint {
+    return func(ctx context.Context, request interface{}) (interface{}, error) {
+        req := request.(CampaignRequest)
+        report, err := s.GetCampaignReport(ctx, req.ID, req.Interval)
+        return GetCampaignResponse{CampaignReport: report, Err: err}, nil
+    }
+}
+
+func makeDeleteCampaignEndpoint(s service.Service) endpoint.Endpoint {
+    return func(ctx context.Context, request interface{}) (interface{}, error) {
+        req := request.(CampaignRequest)
+        if err := s.DeleteCampaign(ctx, req.ID); err != nil {
+            return DeleteCampaignResponse{Err: err}, nil
+        }
+        return DeleteCampaignResponse{ID: req.ID, Deleted: true}, nil
+    }
+}
+
+func makeAddCampaignVideosEndpoint(s service.Service) endpoint.Endpoint {
+    return func(ctx context.Context, request interface{}) (interface{}, error) {
+        req := request.(AddCampaignVideosRequest)
+        added, err := s.AddCampaignVideos(ctx, req.ID, req.Videos)
+        return AddCampaignVideosResponse{ID: req.ID, Added: added, Err: err}, nil
+    }
+}
+
+func makeRemoveCampaignVideoEndpoint(s service.Service) endpoint.Endpoint {
+    return func(ctx context.Context, request interface{}) (interface{}, error) {
+        req := request.(CampaignRequest)
+        if err := s.RemoveCampaignVideo(ctx, req.ID, req.VideoID); err != nil {
+            return RemoveCampaignVideoResponse{Err: err}, nil
+        }
+        return RemoveCampaignVideoResponse{ID: req.ID, VideoID: req.VideoID, Removed: true}, nil
+    }
+}
@@ -0,0 +1,29 @@
+package endpoint
+
+import (
+    "context"
+
+    "github.com/go-kit/kit/endpoint"
+    "video-stats-tracker/internal/service"
+)
+
+type CompareVideosRequest struct {
+    VideoIDs []string               `json:"videos"`
+    Options  service.CompareOptions `json:"options"`
+}
+
+// CompareVideosResponse encodes as the aligned comparison
+type CompareVideosResponse struct {
+    *service.Comparison
+    Err error `json:"-"`
+}
+
+func (r CompareVideosResponse) Failed() error { return r.Err }
+
+func makeCompareVideosEndpoint(s service.Service) endpoint.Endpoint {
+    return func(ctx context.Context, request interface{}) (interface{}, error) {
+        req := request.(CompareVideosRequest)
+        comparison, err := s.CompareVideos(ctx, req.VideoIDs, req.Options)
+        return CompareVideosResponse{Comparison: comparison, Err: err}, nil
+    }
+}
@@ -2,72 +2,254 @@ package endpoint
 
 import (
     "context"
+    "net/http"
     "time"
 
     "github.com/go-kit/kit/endpoint"
+    "video-stats-tracker/internal/repository"
     "video-stats-tracker/internal/service"
 )
 
 type Endpoints struct {
-    RegisterVideo endpoint.Endpoint
-    GetStats      endpoint.Endpoint
+    RegisterVideo  endpoint.Endpoint
+    RegisterVideos endpoint.Endpoint
+    GetStats       endpoint.Endpoint
+    TrackChannel   endpoint.Endpoint
+    TrackAccount   endpoint.Endpoint
+    GetAccounts    endpoint.Endpoint
+    GetAccountStats endpoint.Endpoint
+    Retention      endpoint.Endpoint
+    GetMetadata    endpoint.Endpoint
+    GetMilestones  endpoint.Endpoint
+    GetForecast    endpoint.Endpoint
+    GetStateHistory endpoint.Endpoint
+    CreateWebhook  endpoint.Endpoint
+    GetWebhooks    endpoint.Endpoint
+    DeleteWebhook  endpoint.Endpoint
+    GetDeliveries  endpoint.Endpoint
+    CreateAlertRule endpoint.Endpoint
+    GetAlertRules  endpoint.Endpoint
+    DeleteAlertRule endpoint.Endpoint
+    GetAlerts      endpoint.Endpoint
+    GetAnomalies   endpoint.Endpoint
+    CreateCampaign endpoint.Endpoint
+    GetCampaigns   endpoint.Endpoint
+    GetCampaign    endpoint.Endpoint
+    DeleteCampaign endpoint.Endpoint
+    AddCampaignVideos   endpoint.Endpoint
+    RemoveCampaignVideo endpoint.Endpoint
+    AddVideoTags   endpoint.Endpoint
+    RemoveVideoTag endpoint.Endpoint
+    GetTags        endpoint.Endpoint
+    GetTagStats    endpoint.Endpoint
+    GetLeaderboard endpoint.Endpoint
+    CompareVideos  endpoint.Endpoint
+    ListVideos     endpoint.Endpoint
+    GetBenchmark   endpoint.Endpoint
+    ExportParquet  endpoint.Endpoint
 }
 
 type RegisterVideoRequest struct {
-    Platform string `json:"platform"`
-    VideoID  string `json:"video_id"`
+    Platform string `json:"platform,omitempty"`
+    VideoID  string `json:"video_id,omitempty"`
+    URL      string `json:"url,omitempty"`
     Username  string `json:"username,omitempty"`
     Tag      string `json:"tag,omitempty"`
 }
 
+// RegisterVideoResponse encodes as the created video record
 type RegisterVideoResponse struct {
-    ID    string `json:"id,omitempty"`
-    Error string `json:"error,omitempty"`
+    *repository.Video
+    Err error `json:"-"`
 }
 
+func (r RegisterVideoResponse) Failed() error { return r.Err }
+
+// StatusCode reports 201 Created for a successful registration
+func (r RegisterVideoResponse) StatusCode() int { return http.StatusCreated }
+
+type RegisterVideosRequest struct {
+    Videos []service.VideoRegistration `json:"videos"`
+}
+
+type RegisterVideosResponse struct {
+    Results []service.RegistrationResult `json:"results"`
+    Summary map[string]int               `json:"summary"`
+    Err     error                        `json:"-"`
+}
+
+func (r RegisterVideosResponse) Failed() error { return r.Err }
+
 type GetStatsRequest struct {
     VideoID string    `json:"video_id"`
     From    time.Time `json:"from"`
     To      time.Time `json:"to"`
+    Metrics []string  `json:"metrics,omitempty"`
+    Interval string   `json:"interval,omitempty"`
+    Agg      string   `json:"agg,omitempty"`
+    Fill     bool     `json:"fill,omitempty"`
+    Expand   time.Duration `json:"expand,omitempty"`
+    ExcludeFlagged bool   `json:"exclude_flagged,omitempty"`
+    // Stream is set for exports; raw samples are then read as they are
+    // written and video_id may be left out to export every video
+    Stream bool `json:"-"`
 }
 
 type GetStatsResponse struct {
-    Stats []interface{} `json:"stats"` // Using interface{} for flexibility
-    Error string        `json:"error,omitempty"`
+    Stats   []interface{}           `json:"stats"` // Using interface{} for flexibility
+    Buckets []repository.StatsBucket `json:"buckets,omitempty"`
+    Metrics *service.DerivedMetrics `json:"metrics,omitempty"`
+    Err     error                   `json:"-"`
+
+    stream func(ctx context.Context, fn func(*repository.VideoStats) error) error
 }
 
+func (r GetStatsResponse) Failed() error { return r.Err }
+
 func MakeEndpoints(s service.Service) Endpoints {
     return Endpoints{
-        RegisterVideo: makeRegisterVideoEndpoint(s),
-        GetStats:      makeGetStatsEndpoint(s),
+        RegisterVideo:  makeRegisterVideoEndpoint(s),
+        RegisterVideos: makeRegisterVideosEndpoint(s),
+        GetStats:       makeGetStatsEndpoint(s),
+        TrackChannel:   makeTrackChannelEndpoint(s),
+        TrackAccount:   makeTrackAccountEndpoint(s),
+        GetAccounts:    makeGetAccountsEndpoint(s),
+        GetAccountStats: makeGetAccountStatsEndpoint(s),
+        Retention:      makeRetentionEndpoint(s),
+        GetMetadata:    makeGetMetadataEndpoint(s),
+        GetMilestones:  makeGetMilestonesEndpoint(s),
+        GetForecast:    makeGetForecastEndpoint(s),
+        GetStateHistory: makeGetStateHistoryEndpoint(s),
+        CreateWebhook:  makeCreateWebhookEndpoint(s),
+        GetWebhooks:    makeGetWebhooksEndpoint(s),
+        DeleteWebhook:  makeDeleteWebhookEndpoint(s),
+        GetDeliveries:  makeGetDeliveriesEndpoint(s),
+        CreateAlertRule: makeCreateAlertRuleEndpoint(s),
+        GetAlertRules:  makeGetAlertRulesEndpoint(s),
+        DeleteAlertRule: makeDeleteAlertRuleEndpoint(s),
+        GetAlerts:      makeGetAlertsEndpoint(s),
+        GetAnomalies:   makeGetAnomaliesEndpoint(s),
+        CreateCampaign: makeCreateCampaignEndpoint(s),
+        GetCampaigns:   makeGetCampaignsEndpoint(s),
+        GetCampaign:    makeGetCampaignEndpoint(s),
+        DeleteCampaign: makeDeleteCampaignEndpoint(s),
+        AddCampaignVideos:   makeAddCampaignVideosEndpoint(s),
+        RemoveCampaignVideo: makeRemoveCampaignVideoEndpoint(s),
+        AddVideoTags:   makeAddVideoTagsEndpoint(s),
+        RemoveVideoTag: makeRemoveVideoTagEndpoint(s),
+        GetTags:        makeGetTagsEndpoint(s),
+        GetTagStats:    makeGetTagStatsEndpoint(s),
+        GetLeaderboard: makeGetLeaderboardEndpoint(s),
+        CompareVideos:  makeCompareVideosEndpoint(s),
+        ListVideos:     makeListVideosEndpoint(s),
+        GetBenchmark:   makeGetBenchmarkEndpoint(s),
+        ExportParquet:  makeExportParquetEndpoint(s),
     }
 }
 
 func makeRegisterVideoEndpoint(s service.Service) endpoint.Endpoint {
     return func(ctx context.Context, request interface{}) (interface{}, error) {
         req := request.(RegisterVideoRequest)
-        err := s.RegisterVideo(ctx, req.Platform, req.VideoID, req.Username, req.Tag)
+
+        // A link replaces platform, video_id and (when present) username
+        if req.VideoID == "" && req.URL != "" {
+            resolved, err := s.ResolveVideoURL(ctx, req.URL, req.Username)
+            if err != nil {
+                return RegisterVideoResponse{Err: err}, nil
+            }
+            req.Platform, req.VideoID, req.Username = resolved.Platform, resolved.VideoID, resolved.Username
+        }
+
+        video, err := s.RegisterVideo(ctx, req.Platform, req.VideoID, req.Username, req.Tag)
+        if err != nil {
+            return RegisterVideoResponse{Err: err}, nil
+        }
+        return RegisterVideoResponse{Video: video}, nil
+    }
+}
+
+func makeRegisterVideosEndpoint(s service.Service) endpoint.Endpoint {
+    return func(ctx context.Context, request interface{}) (interface{}, error) {
+        req := request.(RegisterVideosRequest)
+        results, err := s.RegisterVideos(ctx, req.Videos)
         if err != nil {
-            return RegisterVideoResponse{Error: err.Error()}, nil
+            return RegisterVideosResponse{Err: err}, nil
         }
-        return RegisterVideoResponse{}, nil
+
+        // Count rows per status so large imports can be checked at a glance
+        summary := make(map[string]int)
+        for _, result := range results {
+            summary[result.Status]++
+        }
+
+        return RegisterVideosResponse{Results: results, Summary: summary}, nil
     }
 }
 
 func makeGetStatsEndpoint(s service.Service) endpoint.Endpoint {
     return func(ctx context.Context, request interface{}) (interface{}, error) {
         req := request.(GetStatsRequest)
-        stats, err := s.GetVideoStats(ctx, req.VideoID, req.From, req.To)
+        var resp GetStatsResponse
+
+        // With interval= the bucketed series replaces the raw rows
+        if req.Interval != "" {
+            buckets, err := s.GetStatsBuckets(ctx, req.VideoID, req.From, req.To, req.Interval, req.Agg, req.Fill, req.ExcludeFlagged)
+            if err != nil {
+                return GetStatsResponse{Err: err}, nil
+            }
+            resp.Buckets = buckets
+            if len(req.Metrics) == 0 {
+                return resp, nil
+            }
+        }
+
+        // Exports of raw rows are streamed when the response is written
+        if req.Stream && len(req.Metrics) == 0 && req.Expand <= 0 {
+            return GetStatsResponse{stream: func(ctx context.Context, fn func(*repository.VideoStats) error) error {
+                return s.StreamVideoStats(ctx, req.VideoID, req.From, req.To, req.ExcludeFlagged, fn)
+            }}, nil
+        }
+
+        // Without metrics= only the raw rows are returned
+        if len(req.Metrics) == 0 {
+            stats, err := s.GetVideoStats(ctx, req.VideoID, req.From, req.To)
+            if err != nil {
+                return GetStatsResponse{Err: err}, nil
+            }
+            if req.ExcludeFlagged {
+                stats = service.WithoutFlagged(stats)
+            }
+            return GetStatsResponse{Stats: toInterfaces(expandStats(stats, req))}, nil
+        }
+
+        stats, metrics, err := s.GetStatsWithMetrics(ctx, req.VideoID, req.From, req.To, req.Metrics, req.ExcludeFlagged)
         if err != nil {
-            return GetStatsResponse{Error: err.Error()}, nil
+            return GetStatsResponse{Err: err}, nil
         }
-        
-        // Convert to interface slice for JSON marshaling
-        interfaceStats := make([]interface{}, len(stats))
-        for i, stat := range stats {
-            interfaceStats[i] = stat
+
+        resp.Metrics = metrics
+        for _, kind := range req.Metrics {
+            if kind == service.MetricRaw {
+                resp.Stats = toInterfaces(expandStats(stats, req))
+            }
         }
-        
-        return GetStatsResponse{Stats: interfaceStats}, nil
+        return resp, nil
+    }
+}
+
+// expandStats regularizes the raw rows when expand= was given
+func expandStats(stats []repository.VideoStats, req GetStatsRequest) []repository.VideoStats {
+    if req.Expand <= 0 {
+        return stats
     }
-}
\ No newline at end of file
+    return service.ExpandStats(stats, req.Expand, req.From, req.To)
+}
+
+// toInterfaces converts to an interface slice for JSON marshaling
+func toInterfaces(stats []repository.VideoStats) []interface{} {
+    interfaceStats := make([]interface{}, len(stats))
+    for i, stat := range stats {
+        interfaceStats[i] = stat
+    }
+    return interfaceStats
+}
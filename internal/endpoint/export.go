@@ -0,0 +1,173 @@
+package endpoint
+
+import (
+    "context"
+    "strings"
+
+    "video-stats-tracker/internal/repository"
+)
+
+// Table is implemented by responses that can also be exported row by row as
+// CSV, NDJSON or a spreadsheet. Cells are strings, numbers, bools, times or
+// nil; Rows stops at the first error fn returns.
+type Table interface {
+    Columns() []string
+    Rows(ctx context.Context, fn func(row []interface{}) error) error
+}
+
+var statsColumns = []string{"id", "video_id", "timestamp", "views", "likes", "comments", "last_seen_at", "flagged"}
+
+func statsRow(s *repository.VideoStats) []interface{} {
+    return []interface{}{s.ID, s.VideoID, s.Timestamp, s.Views, s.Likes, s.Comments, s.LastSeenAt, s.Flagged}
+}
+
+var bucketColumns = []string{"bucket", "samples", "views", "likes", "comments", "filled"}
+
+func bucketRow(b *repository.StatsBucket) []interface{} {
+    return []interface{}{b.Bucket, b.Samples, b.Views, b.Likes, b.Comments, b.Filled}
+}
+
+// Columns of /stats: the buckets when an interval was given, otherwise the
+// raw samples. Derived metrics are only available as JSON.
+func (r GetStatsResponse) Columns() []string {
+    if r.Buckets != nil {
+        return bucketColumns
+    }
+    return statsColumns
+}
+
+func (r GetStatsResponse) Rows(ctx context.Context, fn func(row []interface{}) error) error {
+    if r.Buckets != nil {
+        for i := range r.Buckets {
+            if err := fn(bucketRow(&r.Buckets[i])); err != nil {
+                return err
+            }
+        }
+        return nil
+    }
+    if r.stream != nil {
+        return r.stream(ctx, func(s *repository.VideoStats) error { return fn(statsRow(s)) })
+    }
+    for _, item := range r.Stats {
+        if s, ok := item.(repository.VideoStats); ok {
+            if err := fn(statsRow(&s)); err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
+
+func (r GetAccountStatsResponse) Columns() []string {
+    return []string{"account_id", "timestamp", "followers", "media_count", "views"}
+}
+
+func (r GetAccountStatsResponse) Rows(_ context.Context, fn func(row []interface{}) error) error {
+    for _, s := range r.Stats {
+        if err := fn([]interface{}{s.AccountID, s.Timestamp, s.Followers, s.MediaCount, s.Views}); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (r GetTagStatsResponse) Columns() []string { return bucketColumns }
+
+func (r GetTagStatsResponse) Rows(_ context.Context, fn func(row []interface{}) error) error {
+    if r.TagStats == nil {
+        return nil
+    }
+    for i := range r.Series {
+        if err := fn(bucketRow(&r.Series[i])); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (r GetTagsResponse) Columns() []string { return []string{"tag", "videos"} }
+
+func (r GetTagsResponse) Rows(_ context.Context, fn func(row []interface{}) error) error {
+    for _, t := range r.Tags {
+        if err := fn([]interface{}{t.Tag, t.Videos}); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// Columns of /videos flatten the latest sample and the benchmark
+func (r ListVideosResponse) Columns() []string {
+    return []string{
+        "video_id", "platform", "instagram_username", "state", "tags", "account_id", "published_at", "created_at",
+        "latest_at", "views", "likes", "comments",
+        "benchmark_cohort", "benchmark_cohort_value", "benchmark_metric", "benchmark_percentile", "benchmark_median", "benchmark_peers", "benchmark_performance",
+    }
+}
+
+func (r ListVideosResponse) Rows(_ context.Context, fn func(row []interface{}) error) error {
+    for _, v := range r.Videos {
+        row := []interface{}{v.VideoID, v.Platform, v.InstagramUsername, v.State, strings.Join(v.Tags, ","), v.AccountID, v.PublishedAt, v.CreatedAt}
+        if v.Latest != nil {
+            row = append(row, v.Latest.Timestamp, v.Latest.Views, v.Latest.Likes, v.Latest.Comments)
+        } else {
+            row = append(row, nil, nil, nil, nil)
+        }
+        if b := v.Benchmark; b != nil {
+            row = append(row, b.Cohort, b.CohortValue, b.Metric, b.Percentile, b.Median, b.Peers, b.Performance)
+        } else {
+            row = append(row, nil, nil, nil, nil, nil, nil, nil)
+        }
+        if err := fn(row); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (r GetLeaderboardResponse) Columns() []string {
+    return []string{"rank", "video_id", "platform", "username", "start_at", "end_at", "start_value", "end_value", "delta", "growth_percent", "views"}
+}
+
+func (r GetLeaderboardResponse) Rows(_ context.Context, fn func(row []interface{}) error) error {
+    if r.Leaderboard == nil {
+        return nil
+    }
+    for _, e := range r.Entries {
+        row := []interface{}{e.Rank, e.VideoID, e.Platform, e.Username, e.StartAt, e.EndAt, e.StartValue, e.EndValue, e.Delta, e.Growth, e.Views}
+        if err := fn(row); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (r GetBenchmarkResponse) Columns() []string {
+    return []string{"age_hours", "videos", "p10", "p25", "median", "p75", "p90"}
+}
+
+func (r GetBenchmarkResponse) Rows(_ context.Context, fn func(row []interface{}) error) error {
+    if r.Benchmark == nil {
+        return nil
+    }
+    for _, p := range r.Curve {
+        if err := fn([]interface{}{p.AgeHours, p.Videos, p.P10, p.P25, p.Median, p.P75, p.P90}); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (r GetAnomaliesResponse) Columns() []string {
+    return []string{"id", "video_id", "sample_id", "kind", "metric", "value", "expected", "flagged_samples", "message", "detected_at"}
+}
+
+func (r GetAnomaliesResponse) Rows(_ context.Context, fn func(row []interface{}) error) error {
+    for _, a := range r.Anomalies {
+        row := []interface{}{a.ID, a.VideoID, a.SampleID, a.Kind, a.Metric, a.Value, a.Expected, a.Flagged, a.Message, a.DetectedAt}
+        if err := fn(row); err != nil {
+            return err
+        }
+    }
+    return nil
+}
@@ -0,0 +1,28 @@
+package endpoint
+
+import (
+    "context"
+
+    "github.com/go-kit/kit/endpoint"
+    "video-stats-tracker/internal/service"
+)
+
+type GetForecastRequest struct {
+    VideoID string                  `json:"video_id"`
+    Target  *service.ForecastTarget `json:"target,omitempty"`
+}
+
+type GetForecastResponse struct {
+    *service.Forecast
+    Err error `json:"-"`
+}
+
+func (r GetForecastResponse) Failed() error { return r.Err }
+
+func makeGetForecastEndpoint(s service.Service) endpoint.Endpoint {
+    return func(ctx context.Context, request interface{}) (interface{}, error) {
+        req := request.(GetForecastRequest)
+        forecast, err := s.GetForecast(ctx, req.VideoID, req.Target)
+        return GetForecastResponse{Forecast: forecast, Err: err}, nil
+    }
+}
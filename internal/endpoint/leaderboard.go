@@ -0,0 +1,35 @@
+package endpoint
+
+import (
+    "context"
+    "time"
+
+    "github.com/go-kit/kit/endpoint"
+    "video-stats-tracker/internal/service"
+)
+
+type GetLeaderboardRequest struct {
+    Metric   string        `json:"metric,omitempty"`
+    Window   time.Duration `json:"window,omitempty"`
+    To       time.Time     `json:"to,omitempty"`
+    Platform string        `json:"platform,omitempty"`
+    Tag      string        `json:"tag,omitempty"`
+    MinViews int           `json:"min_views,omitempty"`
+    Limit    int           `json:"limit,omitempty"`
+}
+
+// GetLeaderboardResponse encodes as the ranking
+type GetLeaderboardResponse struct {
+    *service.Leaderboard
+    Err error `json:"-"`
+}
+
+func (r GetLeaderboardResponse) Failed() error { return r.Err }
+
+func makeGetLeaderboardEndpoint(s service.Service) endpoint.Endpoint {
+    return func(ctx context.Context, request interface{}) (interface{}, error) {
+        req := request.(GetLeaderboardRequest)
+        board, err := s.GetLeaderboard(ctx, req.Metric, req.Window, req.To, req.Platform, req.Tag, req.MinViews, req.Limit)
+        return GetLeaderboardResponse{Leaderboard: board, Err: err}, nil
+    }
+}
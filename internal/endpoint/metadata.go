@@ -0,0 +1,33 @@
+package endpoint
+
+import (
+    "context"
+    "time"
+
+    "github.com/go-kit/kit/endpoint"
+    "video-stats-tracker/internal/repository"
+    "video-stats-tracker/internal/service"
+)
+
+type GetMetadataRequest struct {
+    VideoID string     `json:"video_id"`
+    At      *time.Time `json:"at,omitempty"`
+}
+
+type GetMetadataResponse struct {
+    Metadata []repository.VideoMetadata `json:"metadata"`
+    Err      error                      `json:"-"`
+}
+
+func (r GetMetadataResponse) Failed() error { return r.Err }
+
+func makeGetMetadataEndpoint(s service.Service) endpoint.Endpoint {
+    return func(ctx context.Context, request interface{}) (interface{}, error) {
+        req := request.(GetMetadataRequest)
+        metadata, err := s.GetVideoMetadata(ctx, req.VideoID, req.At)
+        if metadata == nil {
+            metadata = []repository.VideoMetadata{}
+        }
+        return GetMetadataResponse{Metadata: metadata, Err: err}, nil
+    }
+}
@@ -0,0 +1,31 @@
+package endpoint
+
+import (
+    "context"
+
+    "github.com/go-kit/kit/endpoint"
+    "video-stats-tracker/internal/repository"
+    "video-stats-tracker/internal/service"
+)
+
+type GetMilestonesRequest struct {
+    VideoID string `json:"video_id"`
+}
+
+type GetMilestonesResponse struct {
+    Milestones []repository.VideoMilestone `json:"milestones"`
+    Err        error                       `json:"-"`
+}
+
+func (r GetMilestonesResponse) Failed() error { return r.Err }
+
+func makeGetMilestonesEndpoint(s service.Service) endpoint.Endpoint {
+    return func(ctx context.Context, request interface{}) (interface{}, error) {
+        req := request.(GetMilestonesRequest)
+        milestones, err := s.GetMilestones(ctx, req.VideoID)
+        if milestones == nil {
+            milestones = []repository.VideoMilestone{}
+        }
+        return GetMilestonesResponse{Milestones: milestones, Err: err}, nil
+    }
+}
@@ -0,0 +1,29 @@
+package endpoint
+
+import (
+    "context"
+
+    "github.com/go-kit/kit/endpoint"
+    "video-stats-tracker/internal/service"
+)
+
+type ExportParquetRequest struct {
+    Name string `json:"name,omitempty"`
+    Full bool   `json:"full,omitempty"`
+}
+
+// ExportParquetResponse encodes as the export report
+type ExportParquetResponse struct {
+    *service.ParquetExport
+    Err error `json:"-"`
+}
+
+func (r ExportParquetResponse) Failed() error { return r.Err }
+
+func makeExportParquetEndpoint(s service.Service) endpoint.Endpoint {
+    return func(ctx context.Context, request interface{}) (interface{}, error) {
+        req := request.(ExportParquetRequest)
+        export, err := s.ExportParquet(ctx, req.Name, req.Full)
+        return ExportParquetResponse{ParquetExport: export, Err: err}, nil
+    }
+}
@@ -0,0 +1,28 @@
+package endpoint
+
+import (
+    "context"
+
+    "github.com/go-kit/kit/endpoint"
+    "video-stats-tracker/internal/repository"
+    "video-stats-tracker/internal/service"
+)
+
+type RetentionRequest struct {
+    DryRun bool `json:"dry_run"`
+}
+
+type RetentionResponse struct {
+    *repository.RetentionReport
+    Err error `json:"-"`
+}
+
+func (r RetentionResponse) Failed() error { return r.Err }
+
+func makeRetentionEndpoint(s service.Service) endpoint.Endpoint {
+    return func(ctx context.Context, request interface{}) (interface{}, error) {
+        req := request.(RetentionRequest)
+        report, err := s.ApplyRetention(ctx, req.DryRun)
+        return RetentionResponse{RetentionReport: report, Err: err}, nil
+    }
+}
@@ -0,0 +1,36 @@
+package endpoint
+
+import (
+    "context"
+
+    "github.com/go-kit/kit/endpoint"
+    "video-stats-tracker/internal/repository"
+    "video-stats-tracker/internal/service"
+)
+
+type GetStateHistoryRequest struct {
+    VideoID string `json:"video_id"`
+}
+
+type GetStateHistoryResponse struct {
+    VideoID string                       `json:"video_id,omitempty"`
+    State   string                       `json:"state,omitempty"`
+    History []repository.StateTransition `json:"history"`
+    Err     error                        `json:"-"`
+}
+
+func (r GetStateHistoryResponse) Failed() error { return r.Err }
+
+func makeGetStateHistoryEndpoint(s service.Service) endpoint.Endpoint {
+    return func(ctx context.Context, request interface{}) (interface{}, error) {
+        req := request.(GetStateHistoryRequest)
+        video, history, err := s.GetVideoStateHistory(ctx, req.VideoID)
+        if err != nil {
+            return GetStateHistoryResponse{Err: err}, nil
+        }
+        if history == nil {
+            history = []repository.StateTransition{}
+        }
+        return GetStateHistoryResponse{VideoID: video.VideoID, State: video.State, History: history}, nil
+    }
+}
@@ -0,0 +1,92 @@
+package endpoint
+
+import (
+    "context"
+    "time"
+
+    "github.com/go-kit/kit/endpoint"
+    "video-stats-tracker/internal/repository"
+    "video-stats-tracker/internal/service"
+)
+
+type VideoTagsRequest struct {
+    VideoID string   `json:"video_id"`
+    Tags    []string `json:"tags,omitempty"`
+    Tag     string   `json:"tag,omitempty"`
+}
+
+type VideoTagsResponse struct {
+    VideoID string   `json:"video_id"`
+    Tags    []string `json:"tags"`
+    Err     error    `json:"-"`
+}
+
+func (r VideoTagsResponse) Failed() error { return r.Err }
+
+type GetTagsResponse struct {
+    Tags []repository.TagSummary `json:"tags"`
+    Err  error                   `json:"-"`
+}
+
+func (r GetTagsResponse) Failed() error { return r.Err }
+
+type GetTagStatsRequest struct {
+    Tag            string    `json:"tag"`
+    From           time.Time `json:"from"`
+    To             time.Time `json:"to"`
+    Interval       string    `json:"interval,omitempty"`
+    Agg            string    `json:"agg,omitempty"`
+    ExcludeFlagged bool      `json:"exclude_flagged,omitempty"`
+}
+
+// GetTagStatsResponse encodes as the tag's summed series
+type GetTagStatsResponse struct {
+    *service.TagStats
+    Err error `json:"-"`
+}
+
+func (r GetTagStatsResponse) Failed() error { return r.Err }
+
+func makeAddVideoTagsEndpoint(s service.Service) endpoint.Endpoint {
+    return func(ctx context.Context, request interface{}) (interface{}, error) {
+        req := request.(VideoTagsRequest)
+        tags, err := s.AddVideoTags(ctx, req.VideoID, req.Tags)
+        return videoTagsResponse(req.VideoID, tags, err), nil
+    }
+}
+
+func makeRemoveVideoTagEndpoint(s service.Service) endpoint.Endpoint {
+    return func(ctx context.Context, request interface{}) (interface{}, error) {
+        req := request.(VideoTagsRequest)
+        tags, err := s.RemoveVideoTag(ctx, req.VideoID, req.Tag)
+        return videoTagsResponse(req.VideoID, tags, err), nil
+    }
+}
+
+func videoTagsResponse(videoID string, tags []string, err error) VideoTagsResponse {
+    if err != nil {
+        return VideoTagsResponse{Err: err}
+    }
+    if tags == nil {
+        tags = []string{}
+    }
+    return VideoTagsResponse{VideoID: videoID, Tags: tags}
+}
+
+func makeGetTagsEndpoint(s service.Service) endpoint.Endpoint {
+    return func(ctx context.Context, _ interface{}) (interface{}, error) {
+        tags, err := s.GetTags(ctx)
+        if tags == nil {
+            tags = []repository.TagSummary{}
+        }
+        return GetTagsResponse{Tags: tags, Err: err}, nil
+    }
+}
+
+func makeGetTagStatsEndpoint(s service.Service) endpoint.Endpoint {
+    return func(ctx context.Context, request interface{}) (interface{}, error) {
+        req := request.(GetTagStatsRequest)
+        stats, err := s.GetTagStats(ctx, req.Tag, req.From, req.To, req.Interval, req.Agg, req.ExcludeFlagged)
+        return GetTagStatsResponse{TagStats: stats, Err: err}, nil
+    }
+}
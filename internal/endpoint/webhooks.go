@@ -0,0 +1,92 @@
+package endpoint
+
+import (
+    "context"
+    "net/http"
+
+    "github.com/go-kit/kit/endpoint"
+    "video-stats-tracker/internal/repository"
+    "video-stats-tracker/internal/service"
+)
+
+type CreateWebhookRequest struct {
+    URL    string   `json:"url"`
+    Secret string   `json:"secret,omitempty"`
+    Events []string `json:"events,omitempty"`
+}
+
+// CreateWebhookResponse encodes as the created webhook, including its secret
+type CreateWebhookResponse struct {
+    *repository.Webhook
+    Err error `json:"-"`
+}
+
+func (r CreateWebhookResponse) Failed() error { return r.Err }
+
+func (r CreateWebhookResponse) StatusCode() int { return http.StatusCreated }
+
+type GetWebhooksResponse struct {
+    Webhooks []repository.Webhook `json:"webhooks"`
+    Err      error                `json:"-"`
+}
+
+func (r GetWebhooksResponse) Failed() error { return r.Err }
+
+type WebhookRequest struct {
+    ID    string `json:"id"`
+    Limit int    `json:"limit,omitempty"`
+}
+
+type DeleteWebhookResponse struct {
+    ID      string `json:"id"`
+    Deleted bool   `json:"deleted"`
+    Err     error  `json:"-"`
+}
+
+func (r DeleteWebhookResponse) Failed() error { return r.Err }
+
+type GetDeliveriesResponse struct {
+    Deliveries []repository.WebhookDelivery `json:"deliveries"`
+    Err        error                        `json:"-"`
+}
+
+func (r GetDeliveriesResponse) Failed() error { return r.Err }
+
+func makeCreateWebhookEndpoint(s service.Service) endpoint.Endpoint {
+    return func(ctx context.Context, request interface{}) (interface{}, error) {
+        req := request.(CreateWebhookRequest)
+        hook, err := s.CreateWebhook(ctx, req.URL, req.Secret, req.Events)
+        return CreateWebhookResponse{Webhook: hook, Err: err}, nil
+    }
+}
+
+func makeGetWebhooksEndpoint(s service.Service) endpoint.Endpoint {
+    return func(ctx context.Context, _ interface{}) (interface{}, error) {
+        hooks, err := s.GetWebhooks(ctx)
+        if hooks == nil {
+            hooks = []repository.Webhook{}
+        }
+        return GetWebhooksResponse{Webhooks: hooks, Err: err}, nil
+    }
+}
+
+func makeDeleteWebhookEndpoint(s service.Service) endpoint.Endpoint {
+    return func(ctx context.Context, request interface{}) (interface{}, error) {
+        req := request.(WebhookRequest)
+        if err := s.DeleteWebhook(ctx, req.ID); err != nil {
+            return DeleteWebhookResponse{Err: err}, nil
+        }
+        return DeleteWebhookResponse{ID: req.ID, Deleted: true}, nil
+    }
+}
+
+func makeGetDeliveriesEndpoint(s service.Service) endpoint.Endpoint {
+    return func(ctx context.Context, request interface{}) (interface{}, error) {
+        req := request.(WebhookRequest)
+        deliveries, err := s.GetWebhookDeliveries(ctx, req.ID, req.Limit)
+        if deliveries == nil {
+            deliveries = []repository.WebhookDelivery{}
+        }
+        return GetDeliveriesResponse{Deliveries: deliveries, Err: err}, nil
+    }
+}
@@ -0,0 +1,29 @@
+package platform
+
+import (
+    "errors"
+    "fmt"
+    "net/http"
+)
+
+// Content errors returned by the stats clients. Callers match them with
+// errors.Is; the wrapped message carries the platform's explanation.
+var (
+    // ErrContentDeleted means the video or post was removed
+    ErrContentDeleted = errors.New("content deleted")
+    // ErrContentPrivate means the content exists but can no longer be read
+    ErrContentPrivate = errors.New("content private")
+    // ErrContentUnavailable is a transient failure worth retrying later
+    ErrContentUnavailable = errors.New("content temporarily unavailable")
+)
+
+// transientStatus reports whether an HTTP status is likely to clear up on
+// its own (rate limits, quota and server errors)
+func transientStatus(code int) bool {
+    return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
+// unavailable wraps a network or transient API failure
+func unavailable(err error) error {
+    return fmt.Errorf("%w: %v", ErrContentUnavailable, err)
+}
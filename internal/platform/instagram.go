@@ -2,11 +2,13 @@ package platform
 
 import (
 	"context"
-    "database/sql"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 	"video-stats-tracker/internal/repository"
 )
 
@@ -76,108 +78,268 @@ type InstagramMedia struct {
     Timestamp     string `json:"timestamp"`
     Permalink     string `json:"permalink"`
     MediaType     string `json:"media_type"`
+    MediaProductType string `json:"media_product_type"`
 }
 // BusinessDiscoveryResponse represents the full API response
 type BusinessDiscoveryResponse struct {
     BusinessDiscovery struct {
         Media struct {
-            Data []InstagramMedia `json:"data"`
+            Data   []InstagramMedia `json:"data"`
+            Paging struct {
+                Cursors struct {
+                    After string `json:"after"`
+                } `json:"cursors"`
+                Next string `json:"next"`
+            } `json:"paging"`
         } `json:"media"`
     } `json:"business_discovery"`
 }
 
-func (i *InstagramClient) GetVideoStats(ctx context.Context, username, videoID string) (*repository.VideoStats, error) {
-    // Get ALL media from the configured Instagram account
-    allMedia, err := i.getAllUserMedia(ctx, username)
-    if err != nil {
-        return nil, fmt.Errorf("failed to get user media: %v", err)
-    }
+// maxMediaPages bounds how far back an account's media is paged looking for
+// a post
+const maxMediaPages = 40
 
-    // Find the specific media we're looking for
-    for _, media := range allMedia {
+// GetVideoStats returns the current counts of a post together with its
+// descriptive metadata. The account's media is listed newest first, so
+// pages are followed until the post is found, the listing ends or it
+// reaches back past publishedAt; only then is a missing post deleted.
+// Pages are shared through the context's media cache, if any.
+func (i *InstagramClient) GetVideoStats(ctx context.Context, username, videoID string, publishedAt *time.Time) (*repository.VideoStats, *repository.VideoMetadata, error) {
+    var found *InstagramMedia
+    passed := false
+    ended, err := i.walkMedia(ctx, username, func(media InstagramMedia) bool {
         if media.ID == videoID {
-            fmt.Printf("✅ Found Instagram post - User: %s, Post: %s, Likes: %d, Comments: %d\n", 
-                username,media.ID, media.LikeCount, media.CommentsCount)
-
-            // For Instagram, we can use various metrics as views proxy
-            // Using likes + comments as engagement metric for views
-            engagement := media.LikeCount + media.CommentsCount
-            if engagement == 0 {
-                engagement = 1 // Minimum engagement to show activity
-            }
-
-            return &repository.VideoStats{
-                VideoID: videoID,
-                Views:   engagement, // Using engagement as proxy for views
-                Likes:   media.LikeCount,
-                Comments:           media.CommentsCount,
-                Caption:            toNullString(media.Caption),
-                Permalink:          toNullString(media.Permalink),
-                MediaType:          toNullString(media.MediaType),
-                MediaURL:           toNullString(media.MediaURL),
-            }, nil
+            found = &media
+            return false
+        }
+        if published := media.PublishedAt(); publishedAt != nil && published != nil && published.Before(*publishedAt) {
+            passed = true
+            return false
         }
+        return true
+    })
+    if err != nil {
+        return nil, nil, fmt.Errorf("failed to get user media: %w", err)
     }
 
-    return nil, fmt.Errorf("instagram post not found: %s for user %s", videoID, username)
+    switch {
+    case found != nil:
+        return mediaStats(username, *found)
+    case ended || passed:
+        return nil, nil, fmt.Errorf("%w: instagram post %s no longer listed for user %s", ErrContentDeleted, videoID, username)
+    }
+    return nil, nil, fmt.Errorf("%w: instagram post %s not in the latest %d pages of media of %s", ErrContentUnavailable, videoID, maxMediaPages, username)
 }
 
-// Helper function to convert string to sql.NullString
-func toNullString(s string) sql.NullString {
-    if s == "" {
-        return sql.NullString{Valid: false}
+// FindMedia pages through a user's media, newest first, for the first post
+// match accepts. It returns nil when none is among the latest maxMediaPages
+// pages.
+func (i *InstagramClient) FindMedia(ctx context.Context, username string, match func(InstagramMedia) bool) (*InstagramMedia, error) {
+    var found *InstagramMedia
+    _, err := i.walkMedia(ctx, username, func(media InstagramMedia) bool {
+        if match(media) {
+            found = &media
+            return false
+        }
+        return true
+    })
+    return found, err
+}
+
+func mediaStats(username string, media InstagramMedia) (*repository.VideoStats, *repository.VideoMetadata, error) {
+    fmt.Printf("✅ Found Instagram post - User: %s, Post: %s, Likes: %d, Comments: %d\n", 
+        username,media.ID, media.LikeCount, media.CommentsCount)
+
+    // For Instagram, we can use various metrics as views proxy
+    // Using likes + comments as engagement metric for views
+    engagement := media.LikeCount + media.CommentsCount
+    if engagement == 0 {
+        engagement = 1 // Minimum engagement to show activity
     }
-    return sql.NullString{String: s, Valid: true}
+
+    stats := &repository.VideoStats{
+        VideoID: media.ID,
+        Views:   engagement, // Using engagement as proxy for views
+        Likes:   media.LikeCount,
+        Comments: media.CommentsCount,
+    }
+    meta := &repository.VideoMetadata{
+        VideoID:   media.ID,
+        Caption:   media.Caption,
+        Permalink: media.Permalink,
+        MediaType: media.MediaType,
+        MediaURL:  media.MediaURL,
+    }
+    return stats, meta, nil
 }
-// getAllUserMedia fetches all media for the configured user
-func (i *InstagramClient) getAllUserMedia(ctx context.Context, username string) ([]InstagramMedia, error) {
-    url := fmt.Sprintf(
-        "https://graph.facebook.com/v23.0/%s?fields=business_discovery.username(%s){media{id,like_count,comments_count,caption,media_url,timestamp,permalink,media_type}}&access_token=%s",
-        i.instagramID, username, i.accessToken,
+
+// fetchMediaPage returns a page of a user's media, the first one without a
+// cursor, and the cursor of the next page, empty on the last one
+func (i *InstagramClient) fetchMediaPage(ctx context.Context, username, cursor string) ([]InstagramMedia, string, error) {
+    edge := "media"
+    if cursor != "" {
+        edge = "media.after(" + url.QueryEscape(cursor) + ")"
+    }
+    endpoint := fmt.Sprintf(
+        "https://graph.facebook.com/v23.0/%s?fields=business_discovery.username(%s){%s{id,like_count,comments_count,caption,media_url,timestamp,permalink,media_type,media_product_type}}&access_token=%s",
+        i.instagramID, username, edge, i.accessToken,
     )
 
     fmt.Printf("📡 Calling Instagram Business Discovery API for user: %s\n", username)
 
-    req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+    req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
     if err != nil {
-        return nil, err
+        return nil, "", err
     }
 
     resp, err := i.client.Do(req)
     if err != nil {
-        return nil, err
+        return nil, "", unavailable(err)
     }
     defer resp.Body.Close()
 
     body, _ := io.ReadAll(resp.Body)
     
     if resp.StatusCode != http.StatusOK {
-        return nil, fmt.Errorf("instagram API error %d: %s", resp.StatusCode, string(body))
+        return nil, "", instagramAPIError(resp.StatusCode, body)
     }
 
     var discoveryResp BusinessDiscoveryResponse
     if err := json.Unmarshal(body, &discoveryResp); err != nil {
-        return nil, fmt.Errorf("failed to parse Instagram response: %v", err)
+        return nil, "", fmt.Errorf("failed to parse Instagram response: %v", err)
     }
 
     fmt.Printf("✅ Found %d media posts for Instagram user: %s\n", 
         len(discoveryResp.BusinessDiscovery.Media.Data), username)
 
-    return discoveryResp.BusinessDiscovery.Media.Data, nil
+    media := discoveryResp.BusinessDiscovery.Media
+    if media.Paging.Next == "" {
+        return media.Data, "", nil
+    }
+    return media.Data, media.Paging.Cursors.After, nil
+}
+
+// Graph API error codes that clear up on their own: API too many calls,
+// user request limit, rate limit reached and call volume limits
+var instagramTransientCodes = map[int]bool{4: true, 17: true, 32: true, 613: true}
+
+// instagramAPIError classifies a Graph API error response. business_discovery
+// fails with code 110 or subcode 2207013 once an account is private, deleted
+// or no longer a business/creator account, which hides all of its posts.
+func instagramAPIError(status int, body []byte) error {
+    var apiErr struct {
+        Error struct {
+            Message      string `json:"message"`
+            Code         int    `json:"code"`
+            ErrorSubcode int    `json:"error_subcode"`
+        } `json:"error"`
+    }
+    json.Unmarshal(body, &apiErr)
+
+    err := fmt.Errorf("instagram API error %d: %s", status, string(body))
+    switch {
+    case apiErr.Error.Code == 110 || apiErr.Error.ErrorSubcode == 2207013:
+        return fmt.Errorf("%w: %s", ErrContentPrivate, apiErr.Error.Message)
+    case transientStatus(status) || instagramTransientCodes[apiErr.Error.Code]:
+        return unavailable(err)
+    }
+    return err
+}
+
+// instagramTimeLayout is the format of media timestamps in Graph API responses
+const instagramTimeLayout = "2006-01-02T15:04:05-0700"
+
+// PublishedAt parses the media timestamp, returning nil when it is missing
+func (m InstagramMedia) PublishedAt() *time.Time {
+    t, err := time.Parse(instagramTimeLayout, m.Timestamp)
+    if err != nil {
+        return nil
+    }
+    return &t
+}
+
+// MatchesType reports whether the media is of the given type, compared
+// against both media_type (IMAGE, VIDEO, CAROUSEL_ALBUM) and
+// media_product_type (FEED, REELS)
+func (m InstagramMedia) MatchesType(mediaType string) bool {
+    return strings.EqualFold(m.MediaType, mediaType) || strings.EqualFold(m.MediaProductType, mediaType)
+}
+
+// maxPinnedMedia is how many posts Instagram lets an account pin above its
+// newer ones
+const maxPinnedMedia = 3
+
+// RecentMedia returns a user's media published after since, newest first,
+// paging until the listing reaches back past since. Pinned posts may be
+// older than the ones below them, so paging stops at the first post older
+// than since beyond the pinned ones. A zero since returns the first page.
+func (i *InstagramClient) RecentMedia(ctx context.Context, username string, since time.Time) ([]InstagramMedia, error) {
+    if since.IsZero() {
+        media, _, err := i.fetchMediaPage(ctx, username, "")
+        return media, err
+    }
+
+    var recent []InstagramMedia
+    older := 0
+    _, err := i.walkMedia(ctx, username, func(media InstagramMedia) bool {
+        if published := media.PublishedAt(); published != nil && published.Before(since) {
+            older++
+            return older <= maxPinnedMedia
+        }
+        recent = append(recent, media)
+        return true
+    })
+    return recent, err
 }
 
 // GetMediaDetails returns full media details for a specific post
-func (i *InstagramClient) GetMediaDetails(ctx context.Context, username,videoID string) (*InstagramMedia, error) {
-    allMedia, err := i.getAllUserMedia(ctx, username)
+func (i *InstagramClient) GetMediaDetails(ctx context.Context, username, videoID string) (*InstagramMedia, error) {
+    media, err := i.FindMedia(ctx, username, func(m InstagramMedia) bool { return m.ID == videoID })
     if err != nil {
         return nil, err
     }
+    if media == nil {
+        return nil, fmt.Errorf("media not found: %s for user %s", videoID, username)
+    }
+    return media, nil
+}
 
-    for _, media := range allMedia {
-        if media.ID == videoID {
-            return &media, nil
-        }
+// InstagramAccountStats holds the audience counters of a business account
+type InstagramAccountStats struct {
+    FollowersCount int `json:"followers_count"`
+    MediaCount     int `json:"media_count"`
+}
+
+// GetAccountStats fetches followers_count and media_count via business_discovery
+func (i *InstagramClient) GetAccountStats(ctx context.Context, username string) (*InstagramAccountStats, error) {
+    url := fmt.Sprintf(
+        "https://graph.facebook.com/v23.0/%s?fields=business_discovery.username(%s){followers_count,media_count}&access_token=%s",
+        i.instagramID, username, i.accessToken,
+    )
+
+    req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+    if err != nil {
+        return nil, err
     }
 
-    return nil, fmt.Errorf("media not found: %s for user %s", videoID, username)
-}
\ No newline at end of file
+    resp, err := i.client.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+
+    body, _ := io.ReadAll(resp.Body)
+
+    if resp.StatusCode != http.StatusOK {
+        return nil, fmt.Errorf("instagram API error %d: %s", resp.StatusCode, string(body))
+    }
+
+    var statsResp struct {
+        BusinessDiscovery InstagramAccountStats `json:"business_discovery"`
+    }
+    if err := json.Unmarshal(body, &statsResp); err != nil {
+        return nil, fmt.Errorf("failed to parse Instagram response: %v", err)
+    }
+
+    return &statsResp.BusinessDiscovery, nil
+}
@@ -0,0 +1,167 @@
+package platform
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+)
+
+// mediaPages serves a business discovery listing split into pages of two
+// posts; post i was published i days before the first
+type mediaPages struct {
+    posts    int
+    requests int
+}
+
+func (m *mediaPages) RoundTrip(req *http.Request) (*http.Response, error) {
+    m.requests++
+    start := 0
+    fields := req.URL.Query().Get("fields")
+    if i := strings.Index(fields, "media.after("); i >= 0 {
+        cursor := fields[i+len("media.after("):]
+        start, _ = strconv.Atoi(cursor[:strings.Index(cursor, ")")])
+    }
+
+    var page BusinessDiscoveryResponse
+    first := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+    for i := start; i < start+2 && i < m.posts; i++ {
+        page.BusinessDiscovery.Media.Data = append(page.BusinessDiscovery.Media.Data, InstagramMedia{
+            ID:        fmt.Sprintf("post%d", i),
+            LikeCount: 10 * i,
+            Timestamp: first.AddDate(0, 0, -i).Format(instagramTimeLayout),
+        })
+    }
+    if start+2 < m.posts {
+        page.BusinessDiscovery.Media.Paging.Cursors.After = strconv.Itoa(start + 2)
+        page.BusinessDiscovery.Media.Paging.Next = "https://graph.facebook.com/next"
+    }
+    body, _ := json.Marshal(page)
+    return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(string(body)))}, nil
+}
+
+func TestInstagramGetVideoStatsPaging(t *testing.T) {
+    first := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+    daysAgo := func(days int) *time.Time {
+        t := first.AddDate(0, 0, -days)
+        return &t
+    }
+
+    tests := []struct {
+        name        string
+        posts       int
+        videoID     string
+        publishedAt *time.Time
+        likes       int
+        err         error
+        requests    int
+    }{
+        {"first page", 6, "post1", daysAgo(1), 10, nil, 1},
+        {"older page", 6, "post5", daysAgo(5), 50, nil, 3},
+        {"listing ends", 6, "post9", nil, 0, ErrContentDeleted, 3},
+        {"paged past publication", 20, "gone", daysAgo(2), 0, ErrContentDeleted, 2},
+        {"unknown publication pages to the limit", 1000, "gone", nil, 0, ErrContentUnavailable, maxMediaPages},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            pages := &mediaPages{posts: tt.posts}
+            client := NewInstagramClient("token", "id")
+            client.client.Transport = pages
+
+            stats, _, err := client.GetVideoStats(context.Background(), "someone", tt.videoID, tt.publishedAt)
+            if tt.err != nil {
+                if !errors.Is(err, tt.err) {
+                    t.Fatalf("err = %v, want %v", err, tt.err)
+                }
+            } else if err != nil {
+                t.Fatal(err)
+            } else if stats.Likes != tt.likes || stats.VideoID != tt.videoID {
+                t.Errorf("stats = %+v, want %d likes of %s", stats, tt.likes, tt.videoID)
+            }
+            if pages.requests != tt.requests {
+                t.Errorf("fetched %d pages, want %d", pages.requests, tt.requests)
+            }
+        })
+    }
+}
+
+func TestInstagramMediaCacheSharesPages(t *testing.T) {
+    pages := &mediaPages{posts: 6}
+    client := NewInstagramClient("token", "id")
+    client.client.Transport = pages
+
+    ctx := WithMediaCache(context.Background())
+    for _, videoID := range []string{"post1", "post5", "post3", "post0"} {
+        if _, _, err := client.GetVideoStats(ctx, "someone", videoID, nil); err != nil {
+            t.Fatalf("%s: %v", videoID, err)
+        }
+    }
+    if pages.requests != 3 {
+        t.Errorf("fetched %d pages, want each of the 3 once", pages.requests)
+    }
+
+    media, err := client.FindMedia(ctx, "someone", func(m InstagramMedia) bool { return m.LikeCount == 40 })
+    if err != nil || media == nil || media.ID != "post4" {
+        t.Errorf("FindMedia = %+v, %v, want post4", media, err)
+    }
+    if _, _, err := client.GetVideoStats(ctx, "someone", "gone", nil); !errors.Is(err, ErrContentDeleted) {
+        t.Errorf("err = %v, want the cached listing to end", err)
+    }
+    if pages.requests != 3 {
+        t.Errorf("fetched %d pages, want no more from the cache", pages.requests)
+    }
+
+    // Without a cache every call reads the listing again
+    client.GetVideoStats(context.Background(), "someone", "post1", nil)
+    if pages.requests != 4 {
+        t.Errorf("fetched %d pages, want 4", pages.requests)
+    }
+}
+
+func TestInstagramRecentMedia(t *testing.T) {
+    first := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+
+    tests := []struct {
+        name     string
+        listing  int
+        since    time.Time
+        posts    int
+        requests int
+    }{
+        {"first page without since", 6, time.Time{}, 2, 1},
+        {"pages back to since", 20, first.Add(-108 * time.Hour), 5, 5},
+        {"listing ends first", 6, first.AddDate(0, 0, -30), 6, 3},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            pages := &mediaPages{posts: tt.listing}
+            client := NewInstagramClient("token", "id")
+            client.client.Transport = pages
+
+            media, err := client.RecentMedia(context.Background(), "someone", tt.since)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if len(media) != tt.posts {
+                t.Errorf("got %d posts, want %d", len(media), tt.posts)
+            }
+            for _, m := range media {
+                if published := m.PublishedAt(); !tt.since.IsZero() && published.Before(tt.since) {
+                    t.Errorf("%s published %v, before %v", m.ID, published, tt.since)
+                }
+            }
+            // Up to maxPinnedMedia older posts are read past since
+            if pages.requests != tt.requests {
+                t.Errorf("fetched %d pages, want %d", pages.requests, tt.requests)
+            }
+        })
+    }
+}
@@ -0,0 +1,88 @@
+package platform
+
+import (
+	"context"
+	"sync"
+)
+
+// MediaCache shares the media pages of Instagram accounts between the calls
+// made with one context, so a poll run reads each account's listing once
+// however many of its posts are tracked
+type MediaCache struct {
+    mu       sync.Mutex
+    listings map[string]*mediaListing
+}
+
+// mediaListing holds the pages of one account's media read so far, newest
+// first. A failed page is kept too, so later calls of the run don't retry
+// an account that is rate limited or gone.
+type mediaListing struct {
+    mu     sync.Mutex
+    media  []InstagramMedia
+    pages  int
+    cursor string
+    ended  bool
+    err    error
+}
+
+type mediaCacheKey struct{}
+
+// WithMediaCache returns a context whose Instagram calls share a new media
+// cache. It lives as long as the context is used, typically one poll run or
+// one request.
+func WithMediaCache(ctx context.Context) context.Context {
+    return context.WithValue(ctx, mediaCacheKey{}, &MediaCache{listings: make(map[string]*mediaListing)})
+}
+
+// listing returns the cached listing of a username, or a fresh one when
+// the context carries no cache
+func (i *InstagramClient) listing(ctx context.Context, username string) *mediaListing {
+    cache, _ := ctx.Value(mediaCacheKey{}).(*MediaCache)
+    if cache == nil {
+        return &mediaListing{}
+    }
+    cache.mu.Lock()
+    defer cache.mu.Unlock()
+    listing := cache.listings[username]
+    if listing == nil {
+        listing = &mediaListing{}
+        cache.listings[username] = listing
+    }
+    return listing
+}
+
+// walkMedia calls fn with a user's media, newest first, reading further
+// pages only once the cached ones are used up, until fn returns false, the
+// listing ends or maxMediaPages pages were read. It reports whether the
+// whole listing was walked.
+func (i *InstagramClient) walkMedia(ctx context.Context, username string, fn func(InstagramMedia) bool) (bool, error) {
+    listing := i.listing(ctx, username)
+    listing.mu.Lock()
+    defer listing.mu.Unlock()
+
+    for n := 0; ; n++ {
+        for n == len(listing.media) {
+            if listing.ended {
+                return true, nil
+            }
+            if listing.err != nil {
+                return false, listing.err
+            }
+            if listing.pages == maxMediaPages {
+                return false, nil
+            }
+            media, next, err := i.fetchMediaPage(ctx, username, listing.cursor)
+            if err != nil {
+                listing.err = err
+                return false, err
+            }
+            listing.media = append(listing.media, media...)
+            listing.pages++
+            listing.cursor = next
+            listing.ended = next == ""
+        }
+        if !fn(listing.media[n]) {
+            return false, nil
+        }
+    }
+}
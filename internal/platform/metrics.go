@@ -0,0 +1,186 @@
+package platform
+
+import (
+    "encoding/json"
+    "net/http"
+    "path"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+    _ "time/tzdata" // the quota day is kept in Pacific time
+    "video-stats-tracker/internal/repository"
+
+    "github.com/go-kit/kit/metrics"
+    "github.com/go-kit/kit/metrics/discard"
+)
+
+// Metrics instruments the requests the clients make to the platform APIs.
+// Nil metrics are not recorded.
+type Metrics struct {
+    // Duration of requests until the response headers, labeled by platform,
+    // operation and status
+    Duration metrics.Histogram
+    // Errors counts transport failures and non-2xx answers with the same
+    // labels; the status of a transport failure is "error"
+    Errors metrics.Counter
+    // QuotaUnits counts the YouTube Data API units spent, by operation
+    QuotaUnits metrics.Counter
+    // QuotaUsed is the YouTube units spent since the daily reset at
+    // midnight Pacific time, or since the process started
+    QuotaUsed metrics.Gauge
+    // AppUsage is the Graph API rate limit usage in percent reported in
+    // X-App-Usage, labeled by kind (call_count, total_time, total_cputime)
+    AppUsage metrics.Gauge
+}
+
+func (m Metrics) withDefaults() Metrics {
+    if m.Duration == nil {
+        m.Duration = discard.NewHistogram()
+    }
+    if m.Errors == nil {
+        m.Errors = discard.NewCounter()
+    }
+    if m.QuotaUnits == nil {
+        m.QuotaUnits = discard.NewCounter()
+    }
+    if m.QuotaUsed == nil {
+        m.QuotaUsed = discard.NewGauge()
+    }
+    if m.AppUsage == nil {
+        m.AppUsage = discard.NewGauge()
+    }
+    return m
+}
+
+// Instrument records the client's requests in m
+func (y *YouTubeClient) Instrument(m Metrics) {
+    m = m.withDefaults()
+    quota := &youTubeQuota{metrics: m}
+    y.client.Transport = &instrumentedTransport{
+        platform:  repository.PlatformYouTube,
+        operation: youTubeOperation,
+        metrics:   m,
+        answered:  quota.spend,
+        next:      transportOf(y.client),
+    }
+}
+
+// Instrument records the client's requests in m
+func (i *InstagramClient) Instrument(m Metrics) {
+    m = m.withDefaults()
+    i.client.Transport = &instrumentedTransport{
+        platform:  repository.PlatformInstagram,
+        operation: instagramOperation,
+        metrics:   m,
+        answered:  func(_ *http.Request, resp *http.Response) { recordAppUsage(m.AppUsage, resp) },
+        next:      transportOf(i.client),
+    }
+}
+
+func transportOf(client *http.Client) http.RoundTripper {
+    if client.Transport != nil {
+        return client.Transport
+    }
+    return http.DefaultTransport
+}
+
+// instrumentedTransport times the requests of one platform's client
+type instrumentedTransport struct {
+    platform  string
+    operation func(*http.Request) string
+    metrics   Metrics
+    // answered is called for every request that got a response
+    answered func(*http.Request, *http.Response)
+    next     http.RoundTripper
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+    begin := time.Now()
+    resp, err := t.next.RoundTrip(req)
+
+    status := "error"
+    if err == nil {
+        status = strconv.Itoa(resp.StatusCode)
+    }
+    labels := []string{"platform", t.platform, "operation", t.operation(req), "status", status}
+    t.metrics.Duration.With(labels...).Observe(time.Since(begin).Seconds())
+    if err != nil || resp.StatusCode < 200 || resp.StatusCode > 299 {
+        t.metrics.Errors.With(labels...).Add(1)
+    }
+    if err == nil {
+        t.answered(req, resp)
+    }
+    return resp, err
+}
+
+// youTubeOperation names a request after the API resource it reads:
+// videos, channels, playlistItems or oembed
+func youTubeOperation(req *http.Request) string {
+    return path.Base(req.URL.Path)
+}
+
+// instagramOperation tells the business discovery media and account
+// lookups apart
+func instagramOperation(req *http.Request) string {
+    fields := req.URL.Query().Get("fields")
+    switch {
+    case strings.Contains(fields, "{media"):
+        return "business_discovery_media"
+    case strings.HasPrefix(fields, "business_discovery"):
+        return "business_discovery_account"
+    }
+    return "graph"
+}
+
+// pacific is where the YouTube quota day starts
+var pacific = mustLoadLocation("America/Los_Angeles")
+
+func mustLoadLocation(name string) *time.Location {
+    location, err := time.LoadLocation(name)
+    if err != nil {
+        panic(err)
+    }
+    return location
+}
+
+// youTubeQuota adds up the Data API units spent today. Every call this
+// client makes costs one unit, rejected ones included; the oEmbed lookups
+// are not part of the Data API and are free.
+type youTubeQuota struct {
+    mu      sync.Mutex
+    day     string
+    used    int
+    metrics Metrics
+}
+
+func (q *youTubeQuota) spend(req *http.Request, _ *http.Response) {
+    if req.URL.Host != "www.googleapis.com" {
+        return
+    }
+    q.metrics.QuotaUnits.With("operation", youTubeOperation(req)).Add(1)
+
+    q.mu.Lock()
+    defer q.mu.Unlock()
+    if day := time.Now().In(pacific).Format("2006-01-02"); day != q.day {
+        q.day, q.used = day, 0
+    }
+    q.used++
+    q.metrics.QuotaUsed.Set(float64(q.used))
+}
+
+// recordAppUsage reads the Graph API's X-App-Usage header, a JSON object of
+// percentages such as {"call_count":28,"total_time":25,"total_cputime":25}
+func recordAppUsage(gauge metrics.Gauge, resp *http.Response) {
+    header := resp.Header.Get("X-App-Usage")
+    if header == "" {
+        return
+    }
+    var usage map[string]float64
+    if err := json.Unmarshal([]byte(header), &usage); err != nil {
+        return
+    }
+    for kind, percent := range usage {
+        gauge.With("kind", kind).Set(percent)
+    }
+}
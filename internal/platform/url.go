@@ -0,0 +1,121 @@
+package platform
+
+import (
+    "fmt"
+    "net/url"
+    "regexp"
+    "strings"
+    "video-stats-tracker/internal/repository"
+)
+
+// VideoURL is the result of parsing a YouTube or Instagram link. Instagram
+// links carry a shortcode that still has to be resolved to a media ID.
+type VideoURL struct {
+    Platform  string
+    VideoID   string
+    Shortcode string
+    Username  string
+}
+
+var (
+    youtubeIDPattern   = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+    shortcodePattern   = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+    igUsernamePattern  = regexp.MustCompile(`^[A-Za-z0-9._]{1,30}$`)
+    instagramPostPaths = map[string]bool{"p": true, "reel": true, "reels": true, "tv": true}
+)
+
+// ParseVideoURL recognizes YouTube links (watch?v=, youtu.be, shorts/,
+// embed/, live/) and Instagram permalinks (/p/, /reel/, /tv/, optionally
+// prefixed with the username) and infers the platform from the host
+func ParseVideoURL(raw string) (*VideoURL, error) {
+    raw = strings.TrimSpace(raw)
+    if !strings.Contains(raw, "://") {
+        raw = "https://" + raw
+    }
+
+    u, err := url.Parse(raw)
+    if err != nil {
+        return nil, fmt.Errorf("invalid URL: %v", err)
+    }
+
+    host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+    host = strings.TrimPrefix(host, "m.")
+    segments := splitPath(u.Path)
+
+    switch host {
+    case "youtube.com", "music.youtube.com", "youtube-nocookie.com":
+        return parseYouTubePath(u, segments)
+    case "youtu.be":
+        if len(segments) > 0 && youtubeIDPattern.MatchString(segments[0]) {
+            return &VideoURL{Platform: repository.PlatformYouTube, VideoID: segments[0]}, nil
+        }
+    case "instagram.com", "instagr.am":
+        return parseInstagramPath(segments)
+    default:
+        return nil, fmt.Errorf("unsupported URL host: %s", u.Hostname())
+    }
+
+    return nil, fmt.Errorf("could not find a video in URL: %s", raw)
+}
+
+func parseYouTubePath(u *url.URL, segments []string) (*VideoURL, error) {
+    if len(segments) == 1 && segments[0] == "watch" {
+        if id := u.Query().Get("v"); youtubeIDPattern.MatchString(id) {
+            return &VideoURL{Platform: repository.PlatformYouTube, VideoID: id}, nil
+        }
+    }
+
+    if len(segments) >= 2 {
+        switch segments[0] {
+        case "shorts", "embed", "live", "v":
+            if youtubeIDPattern.MatchString(segments[1]) {
+                return &VideoURL{Platform: repository.PlatformYouTube, VideoID: segments[1]}, nil
+            }
+        }
+    }
+
+    return nil, fmt.Errorf("could not find a YouTube video ID in URL: %s", u.String())
+}
+
+func parseInstagramPath(segments []string) (*VideoURL, error) {
+    // instagram.com/p/{shortcode} or instagram.com/{username}/reel/{shortcode}
+    var username string
+    if len(segments) >= 3 && instagramPostPaths[segments[1]] && igUsernamePattern.MatchString(segments[0]) {
+        username = segments[0]
+        segments = segments[1:]
+    }
+
+    if len(segments) >= 2 && instagramPostPaths[segments[0]] && shortcodePattern.MatchString(segments[1]) {
+        return &VideoURL{
+            Platform:  repository.PlatformInstagram,
+            Shortcode: segments[1],
+            Username:  username,
+        }, nil
+    }
+
+    return nil, fmt.Errorf("could not find an Instagram post shortcode in URL")
+}
+
+// PermalinkShortcode extracts the shortcode from a media permalink such as
+// https://www.instagram.com/reel/Cx1abc/
+func PermalinkShortcode(permalink string) string {
+    u, err := url.Parse(permalink)
+    if err != nil {
+        return ""
+    }
+    parsed, err := parseInstagramPath(splitPath(u.Path))
+    if err != nil {
+        return ""
+    }
+    return parsed.Shortcode
+}
+
+func splitPath(path string) []string {
+    var segments []string
+    for _, segment := range strings.Split(path, "/") {
+        if segment != "" {
+            segments = append(segments, segment)
+        }
+    }
+    return segments
+}
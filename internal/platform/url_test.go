@@ -0,0 +1,67 @@
+package platform
+
+import (
+    "testing"
+    "video-stats-tracker/internal/repository"
+)
+
+func TestParseVideoURL(t *testing.T) {
+    tests := []struct {
+        name string
+        url  string
+        want *VideoURL
+    }{
+        {"watch", "https://www.youtube.com/watch?v=dQw4w9WgXcQ&t=42s", &VideoURL{Platform: repository.PlatformYouTube, VideoID: "dQw4w9WgXcQ"}},
+        {"no scheme", "youtube.com/watch?v=dQw4w9WgXcQ", &VideoURL{Platform: repository.PlatformYouTube, VideoID: "dQw4w9WgXcQ"}},
+        {"mobile", "https://m.youtube.com/watch?v=dQw4w9WgXcQ", &VideoURL{Platform: repository.PlatformYouTube, VideoID: "dQw4w9WgXcQ"}},
+        {"short link", "https://youtu.be/dQw4w9WgXcQ?si=abc", &VideoURL{Platform: repository.PlatformYouTube, VideoID: "dQw4w9WgXcQ"}},
+        {"shorts", "https://youtube.com/shorts/dQw4w9WgXcQ", &VideoURL{Platform: repository.PlatformYouTube, VideoID: "dQw4w9WgXcQ"}},
+        {"embed", "https://www.youtube-nocookie.com/embed/dQw4w9WgXcQ", &VideoURL{Platform: repository.PlatformYouTube, VideoID: "dQw4w9WgXcQ"}},
+        {"live", "https://www.youtube.com/live/dQw4w9WgXcQ", &VideoURL{Platform: repository.PlatformYouTube, VideoID: "dQw4w9WgXcQ"}},
+        {"post", "https://www.instagram.com/p/Cx1abc_-9/", &VideoURL{Platform: repository.PlatformInstagram, Shortcode: "Cx1abc_-9"}},
+        {"reel", "instagram.com/reel/Cx1abc", &VideoURL{Platform: repository.PlatformInstagram, Shortcode: "Cx1abc"}},
+        {"reels", "https://www.instagram.com/reels/Cx1abc/", &VideoURL{Platform: repository.PlatformInstagram, Shortcode: "Cx1abc"}},
+        {"with username", "https://www.instagram.com/blue.bottle/reel/Cx1abc/?igsh=x", &VideoURL{Platform: repository.PlatformInstagram, Shortcode: "Cx1abc", Username: "blue.bottle"}},
+        {"tv", "https://instagr.am/tv/Cx1abc", &VideoURL{Platform: repository.PlatformInstagram, Shortcode: "Cx1abc"}},
+        {"unsupported host", "https://vimeo.com/123456", nil},
+        {"short ID", "https://www.youtube.com/watch?v=abc", nil},
+        {"channel", "https://www.youtube.com/@someone", nil},
+        {"short link without ID", "https://youtu.be/", nil},
+        {"profile", "https://www.instagram.com/blue.bottle/", nil},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, err := ParseVideoURL(tt.url)
+            if tt.want == nil {
+                if err == nil {
+                    t.Fatalf("ParseVideoURL(%q) = %+v, want an error", tt.url, got)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatalf("ParseVideoURL(%q): %v", tt.url, err)
+            }
+            if *got != *tt.want {
+                t.Errorf("ParseVideoURL(%q) = %+v, want %+v", tt.url, got, tt.want)
+            }
+        })
+    }
+}
+
+func TestPermalinkShortcode(t *testing.T) {
+    tests := []struct {
+        permalink string
+        want      string
+    }{
+        {"https://www.instagram.com/reel/Cx1abc/", "Cx1abc"},
+        {"https://www.instagram.com/p/Dy2def/", "Dy2def"},
+        {"https://www.instagram.com/blue.bottle/", ""},
+        {"::", ""},
+    }
+    for _, tt := range tests {
+        if got := PermalinkShortcode(tt.permalink); got != tt.want {
+            t.Errorf("PermalinkShortcode(%q) = %q, want %q", tt.permalink, got, tt.want)
+        }
+    }
+}
@@ -4,11 +4,18 @@ import (
     "context"
     "encoding/json"
     "fmt"
+    "errors"
     "net/http"
+    "net/url"
     "strconv"
+    "strings"
+    "time"
     "video-stats-tracker/internal/repository"
 )
 
+// ErrChannelNotFound is returned when a channel ID or handle does not exist
+var ErrChannelNotFound = errors.New("youtube channel not found")
+
 type YouTubeClient struct {
     apiKey string
     client *http.Client
@@ -24,15 +31,23 @@ func NewYouTubeClient(apiKey string) *YouTubeClient {
 type YouTubeResponse struct {
     Items []struct {
         Statistics struct {
-            ViewCount string `json:"viewCount"`
-            LikeCount string `json:"likeCount"`
+            ViewCount    string `json:"viewCount"`
+            LikeCount    string `json:"likeCount"`
+            CommentCount string `json:"commentCount"`
         } `json:"statistics"`
+        Status struct {
+            UploadStatus  string `json:"uploadStatus"`
+            PrivacyStatus string `json:"privacyStatus"`
+        } `json:"status"`
     } `json:"items"`
 }
 
+// GetVideoStats returns the current counts of a video. Removed and private
+// videos are reported as ErrContentDeleted and ErrContentPrivate; quota,
+// rate limit and server errors as ErrContentUnavailable.
 func (y *YouTubeClient) GetVideoStats(ctx context.Context, videoID string) (*repository.VideoStats, error) {
     url := fmt.Sprintf(
-        "https://www.googleapis.com/youtube/v3/videos?part=statistics&id=%s&key=%s",
+        "https://www.googleapis.com/youtube/v3/videos?part=statistics,status&id=%s&key=%s",
         videoID, y.apiKey,
     )
 
@@ -43,17 +58,32 @@ func (y *YouTubeClient) GetVideoStats(ctx context.Context, videoID string) (*rep
 
     resp, err := y.client.Do(req)
     if err != nil {
-        return nil, err
+        return nil, unavailable(err)
     }
     defer resp.Body.Close()
 
+    // Quota exhaustion is reported as 403 and resets daily
+    if transientStatus(resp.StatusCode) || resp.StatusCode == http.StatusForbidden {
+        return nil, unavailable(fmt.Errorf("youtube API error: %s", resp.Status))
+    }
+    if resp.StatusCode != http.StatusOK {
+        return nil, fmt.Errorf("youtube API error: %s", resp.Status)
+    }
+
     var ytResp YouTubeResponse
     if err := json.NewDecoder(resp.Body).Decode(&ytResp); err != nil {
         return nil, err
     }
 
     if len(ytResp.Items) == 0 {
-        return nil, fmt.Errorf("video not found: %s", videoID)
+        return nil, y.missingVideoError(ctx, videoID)
+    }
+
+    switch status := ytResp.Items[0].Status; {
+    case status.UploadStatus == "deleted" || status.UploadStatus == "rejected":
+        return nil, fmt.Errorf("%w: youtube video %s is %s", ErrContentDeleted, videoID, status.UploadStatus)
+    case status.PrivacyStatus == "private":
+        return nil, fmt.Errorf("%w: youtube video %s is private", ErrContentPrivate, videoID)
     }
 
     stats := ytResp.Items[0].Statistics
@@ -61,10 +91,272 @@ func (y *YouTubeClient) GetVideoStats(ctx context.Context, videoID string) (*rep
     // Convert string counts to integers
     views, _ := strconv.Atoi(stats.ViewCount)
     likes, _ := strconv.Atoi(stats.LikeCount)
+    comments, _ := strconv.Atoi(stats.CommentCount)
 
     return &repository.VideoStats{
-        VideoID: videoID,
-        Views:   views,
-        Likes:   likes,
+        VideoID:  videoID,
+        Views:    views,
+        Likes:    likes,
+        Comments: comments,
+    }, nil
+}
+// missingVideoError tells deleted and private videos apart, which
+// videos.list does not: it omits both. The oEmbed endpoint answers 401 or 403
+// for private videos and 404 for removed ones.
+func (y *YouTubeClient) missingVideoError(ctx context.Context, videoID string) error {
+    endpoint := "https://www.youtube.com/oembed?format=json&url=" +
+        url.QueryEscape("https://www.youtube.com/watch?v="+videoID)
+
+    req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+    if err != nil {
+        return err
+    }
+
+    resp, err := y.client.Do(req)
+    if err != nil {
+        return unavailable(err)
+    }
+    resp.Body.Close()
+
+    switch {
+    case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+        return fmt.Errorf("%w: youtube video %s is private", ErrContentPrivate, videoID)
+    case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusBadRequest:
+        return fmt.Errorf("%w: youtube video %s no longer exists", ErrContentDeleted, videoID)
+    case resp.StatusCode == http.StatusOK:
+        // Embeddable but missing from the API: likely a propagation delay
+        return unavailable(fmt.Errorf("youtube video %s not returned by the API", videoID))
+    }
+    return unavailable(fmt.Errorf("youtube oEmbed error: %s", resp.Status))
+}
+
+type youTubeIDsResponse struct {
+    Items []struct {
+        ID string `json:"id"`
+    } `json:"items"`
+}
+
+// maxYouTubeIDsPerRequest is the videos.list limit for the id parameter
+const maxYouTubeIDsPerRequest = 50
+
+// FindVideos checks which of the given video IDs exist, batching the lookups
+// so a bulk registration costs one quota unit per 50 videos
+func (y *YouTubeClient) FindVideos(ctx context.Context, videoIDs []string) (map[string]bool, error) {
+    found := make(map[string]bool, len(videoIDs))
+
+    for start := 0; start < len(videoIDs); start += maxYouTubeIDsPerRequest {
+        end := start + maxYouTubeIDsPerRequest
+        if end > len(videoIDs) {
+            end = len(videoIDs)
+        }
+
+        url := fmt.Sprintf(
+            "https://www.googleapis.com/youtube/v3/videos?part=id&id=%s&key=%s",
+            strings.Join(videoIDs[start:end], ","), y.apiKey,
+        )
+
+        req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+        if err != nil {
+            return nil, err
+        }
+
+        resp, err := y.client.Do(req)
+        if err != nil {
+            return nil, err
+        }
+
+        if resp.StatusCode != http.StatusOK {
+            resp.Body.Close()
+            return nil, fmt.Errorf("youtube API error: %s", resp.Status)
+        }
+
+        var idsResp youTubeIDsResponse
+        err = json.NewDecoder(resp.Body).Decode(&idsResp)
+        resp.Body.Close()
+        if err != nil {
+            return nil, err
+        }
+
+        for _, item := range idsResp.Items {
+            found[item.ID] = true
+        }
+    }
+
+    return found, nil
+}
+
+// YouTubeChannel is the subset of channels.list we need to follow uploads
+type YouTubeChannel struct {
+    ID                string
+    Title             string
+    Handle            string
+    UploadsPlaylistID string
+}
+
+type youTubeChannelsResponse struct {
+    Items []struct {
+        ID      string `json:"id"`
+        Snippet struct {
+            Title     string `json:"title"`
+            CustomURL string `json:"customUrl"`
+        } `json:"snippet"`
+        ContentDetails struct {
+            RelatedPlaylists struct {
+                Uploads string `json:"uploads"`
+            } `json:"relatedPlaylists"`
+        } `json:"contentDetails"`
+    } `json:"items"`
+}
+
+// GetChannel looks a channel up by its ID (UC...) or @handle
+func (y *YouTubeClient) GetChannel(ctx context.Context, channel string) (*YouTubeChannel, error) {
+    filter := "id=" + url.QueryEscape(channel)
+    if strings.HasPrefix(channel, "@") {
+        filter = "forHandle=" + url.QueryEscape(channel)
+    }
+
+    endpoint := fmt.Sprintf(
+        "https://www.googleapis.com/youtube/v3/channels?part=snippet,contentDetails&%s&key=%s",
+        filter, y.apiKey,
+    )
+
+    var channelsResp youTubeChannelsResponse
+    if err := y.getJSON(ctx, endpoint, &channelsResp); err != nil {
+        return nil, err
+    }
+
+    if len(channelsResp.Items) == 0 {
+        return nil, ErrChannelNotFound
+    }
+
+    item := channelsResp.Items[0]
+    return &YouTubeChannel{
+        ID:                item.ID,
+        Title:             item.Snippet.Title,
+        Handle:            item.Snippet.CustomURL,
+        UploadsPlaylistID: item.ContentDetails.RelatedPlaylists.Uploads,
     }, nil
-}
\ No newline at end of file
+}
+
+// YouTubeUpload is a video from a channel's uploads playlist
+type YouTubeUpload struct {
+    VideoID     string
+    PublishedAt time.Time
+}
+
+type youTubePlaylistItemsResponse struct {
+    NextPageToken string `json:"nextPageToken"`
+    Items         []struct {
+        ContentDetails struct {
+            VideoID          string `json:"videoId"`
+            VideoPublishedAt string `json:"videoPublishedAt"`
+        } `json:"contentDetails"`
+    } `json:"items"`
+}
+
+// MaxUploadPages bounds how many playlist pages (50 videos each) a single
+// uploads listing may read
+const MaxUploadPages = 10
+
+// GetUploads lists a channel's uploads published after since, newest first.
+// A zero since reads up to MaxUploadPages pages.
+func (y *YouTubeClient) GetUploads(ctx context.Context, playlistID string, since time.Time) ([]YouTubeUpload, error) {
+    var uploads []YouTubeUpload
+    pageToken := ""
+
+    for page := 0; page < MaxUploadPages; page++ {
+        endpoint := fmt.Sprintf(
+            "https://www.googleapis.com/youtube/v3/playlistItems?part=contentDetails&maxResults=50&playlistId=%s&pageToken=%s&key=%s",
+            url.QueryEscape(playlistID), url.QueryEscape(pageToken), y.apiKey,
+        )
+
+        var itemsResp youTubePlaylistItemsResponse
+        if err := y.getJSON(ctx, endpoint, &itemsResp); err != nil {
+            return nil, err
+        }
+
+        for _, item := range itemsResp.Items {
+            publishedAt, _ := time.Parse(time.RFC3339, item.ContentDetails.VideoPublishedAt)
+            // The uploads playlist is ordered newest first
+            if !since.IsZero() && !publishedAt.IsZero() && publishedAt.Before(since) {
+                return uploads, nil
+            }
+            uploads = append(uploads, YouTubeUpload{
+                VideoID:     item.ContentDetails.VideoID,
+                PublishedAt: publishedAt,
+            })
+        }
+
+        if itemsResp.NextPageToken == "" {
+            break
+        }
+        pageToken = itemsResp.NextPageToken
+    }
+
+    return uploads, nil
+}
+
+// getJSON performs a GET against the Data API and decodes the response
+func (y *YouTubeClient) getJSON(ctx context.Context, endpoint string, out interface{}) error {
+    req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+    if err != nil {
+        return err
+    }
+
+    resp, err := y.client.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode == http.StatusNotFound {
+        return ErrChannelNotFound
+    }
+    if resp.StatusCode != http.StatusOK {
+        return fmt.Errorf("youtube API error: %s", resp.Status)
+    }
+
+    return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// YouTubeChannelStats holds the public counters of a channel. Subscribers is
+// 0 when the channel hides its subscriber count.
+type YouTubeChannelStats struct {
+    Subscribers int
+    Views       int
+    Videos      int
+}
+
+type youTubeChannelStatsResponse struct {
+    Items []struct {
+        Statistics struct {
+            ViewCount       string `json:"viewCount"`
+            SubscriberCount string `json:"subscriberCount"`
+            VideoCount      string `json:"videoCount"`
+        } `json:"statistics"`
+    } `json:"items"`
+}
+
+// GetChannelStats fetches subscriber, view and video counts of a channel
+func (y *YouTubeClient) GetChannelStats(ctx context.Context, channelID string) (*YouTubeChannelStats, error) {
+    endpoint := fmt.Sprintf(
+        "https://www.googleapis.com/youtube/v3/channels?part=statistics&id=%s&key=%s",
+        url.QueryEscape(channelID), y.apiKey,
+    )
+
+    var statsResp youTubeChannelStatsResponse
+    if err := y.getJSON(ctx, endpoint, &statsResp); err != nil {
+        return nil, err
+    }
+
+    if len(statsResp.Items) == 0 {
+        return nil, ErrChannelNotFound
+    }
+
+    stats := statsResp.Items[0].Statistics
+    subscribers, _ := strconv.Atoi(stats.SubscriberCount)
+    views, _ := strconv.Atoi(stats.ViewCount)
+    videos, _ := strconv.Atoi(stats.VideoCount)
+
+    return &YouTubeChannelStats{Subscribers: subscribers, Views: views, Videos: videos}, nil
+}
@@ -0,0 +1,42 @@
+package platform
+
+import (
+    "context"
+    "io"
+    "net/http"
+    "strings"
+    "testing"
+)
+
+// videosList answers videos.list with a fixed body
+type videosList string
+
+func (v videosList) RoundTrip(req *http.Request) (*http.Response, error) {
+    return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(string(v)))}, nil
+}
+
+func TestYouTubeGetVideoStats(t *testing.T) {
+    client := NewYouTubeClient("key")
+    client.client.Transport = videosList(`{"items":[{
+        "statistics":{"viewCount":"1520","likeCount":"87","commentCount":"12"},
+        "status":{"uploadStatus":"processed","privacyStatus":"public"}
+    }]}`)
+
+    stats, err := client.GetVideoStats(context.Background(), "dQw4w9WgXcQ")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if stats.VideoID != "dQw4w9WgXcQ" || stats.Views != 1520 || stats.Likes != 87 || stats.Comments != 12 {
+        t.Errorf("stats = %+v, want 1520 views, 87 likes and 12 comments", stats)
+    }
+
+    // Videos with comments disabled omit the count
+    client.client.Transport = videosList(`{"items":[{"statistics":{"viewCount":"3","likeCount":"1"},"status":{"privacyStatus":"public"}}]}`)
+    stats, err = client.GetVideoStats(context.Background(), "quiet")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if stats.Comments != 0 || stats.Views != 3 {
+        t.Errorf("stats = %+v, want 3 views and no comments", stats)
+    }
+}
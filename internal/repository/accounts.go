@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Tracked account states
+const (
+    AccountActive = "active"
+    AccountPaused = "paused"
+)
+
+func (r *sqliteRepository) CreateTrackedAccount(ctx context.Context, account *TrackedAccount) error {
+    query := `
+    INSERT INTO tracked_accounts (platform, account_id, handle, title, uploads_playlist_id, tag, media_type, state)
+    VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+
+    result, err := r.db.ExecContext(ctx, query, account.Platform, account.AccountID, account.Handle,
+        account.Title, account.UploadsPlaylistID, account.Tag, account.MediaType, account.State)
+    if err != nil {
+        return err
+    }
+
+    id, err := result.LastInsertId()
+    if err != nil {
+        return err
+    }
+
+    account.ID = fmt.Sprintf("%d", id)
+    account.CreatedAt = time.Now()
+    return nil
+}
+
+func (r *sqliteRepository) GetTrackedAccount(ctx context.Context, platform, accountID string) (*TrackedAccount, error) {
+    var account TrackedAccount
+    query := `SELECT * FROM tracked_accounts WHERE platform = ? AND account_id = ?`
+    err := r.db.GetContext(ctx, &account, query, platform, accountID)
+    if err == sql.ErrNoRows {
+        return nil, nil
+    }
+    return &account, err
+}
+
+func (r *sqliteRepository) GetTrackedAccountByID(ctx context.Context, id string) (*TrackedAccount, error) {
+    var account TrackedAccount
+    query := `SELECT * FROM tracked_accounts WHERE id = ?`
+    err := r.db.GetContext(ctx, &account, query, id)
+    if err == sql.ErrNoRows {
+        return nil, nil
+    }
+    return &account, err
+}
+
+func (r *sqliteRepository) GetTrackedAccounts(ctx context.Context) ([]TrackedAccount, error) {
+    var accounts []TrackedAccount
+    query := `SELECT * FROM tracked_accounts ORDER BY id`
+    err := r.db.SelectContext(ctx, &accounts, query)
+    return accounts, err
+}
+
+func (r *sqliteRepository) UpdateAccountSyncedAt(ctx context.Context, id string, syncedAt time.Time) error {
+    query := `UPDATE tracked_accounts SET last_synced_at = ? WHERE id = ?`
+    _, err := r.db.ExecContext(ctx, query, syncedAt.UTC(), id)
+    return err
+}
+
+func (r *sqliteRepository) CreateAccountStats(ctx context.Context, stats *AccountStats) error {
+    query := `
+    INSERT INTO account_stats (account_id, timestamp, followers, media_count, views)
+    VALUES (?, ?, ?, ?, ?)`
+
+    result, err := r.db.ExecContext(ctx, query, stats.AccountID, stats.Timestamp.UTC(), stats.Followers, stats.MediaCount, stats.Views)
+    if err != nil {
+        return err
+    }
+
+    id, err := result.LastInsertId()
+    if err != nil {
+        return err
+    }
+
+    stats.ID = fmt.Sprintf("%d", id)
+    return nil
+}
+
+func (r *sqliteRepository) GetAccountStats(ctx context.Context, accountID string, from, to time.Time) ([]AccountStats, error) {
+    var stats []AccountStats
+    query := `SELECT * FROM account_stats WHERE account_id = ? AND timestamp BETWEEN ? AND ? ORDER BY timestamp`
+    err := r.db.SelectContext(ctx, &stats, query, accountID, from.UTC(), to.UTC())
+    return stats, err
+}
+
+func (r *sqliteRepository) GetLatestAccountStats(ctx context.Context, accountID string) (*AccountStats, error) {
+    var stats AccountStats
+    query := `SELECT * FROM account_stats WHERE account_id = ? ORDER BY timestamp DESC LIMIT 1`
+    err := r.db.GetContext(ctx, &stats, query, accountID)
+    if err == sql.ErrNoRows {
+        return nil, nil
+    }
+    return &stats, err
+}
@@ -0,0 +1,171 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Bucket intervals for aggregated stats queries
+const (
+    IntervalHour = "1h"
+    IntervalDay  = "1d"
+    IntervalWeek = "1w"
+)
+
+// Aggregations applied to the samples of a bucket
+const (
+    AggLast  = "last"
+    AggMax   = "max"
+    AggDelta = "delta"
+)
+
+// StatsBucket is one time bucket of an aggregated stats series. Filled
+// buckets had no samples and were carried forward from the previous one.
+type StatsBucket struct {
+    Bucket   time.Time `json:"bucket"`
+    Samples  int       `json:"samples"`
+    Views    int       `json:"views"`
+    Likes    int       `json:"likes"`
+    Comments int       `json:"comments"`
+    Filled   bool      `json:"filled,omitempty"`
+}
+
+// bucketExpr returns the SQL expression truncating timestamp to the start of
+// its bucket, formatted as RFC3339 in UTC. Weeks start on Monday.
+func bucketExpr(driver, interval string) (string, error) {
+    if driver == "postgres" || driver == "pgx" {
+        unit := map[string]string{IntervalHour: "hour", IntervalDay: "day", IntervalWeek: "week"}[interval]
+        if unit == "" {
+            return "", fmt.Errorf("unsupported interval: %s", interval)
+        }
+        return fmt.Sprintf(`to_char(date_trunc('%s', timestamp AT TIME ZONE 'UTC'), 'YYYY-MM-DD"T"HH24:MI:SS"Z"')`, unit), nil
+    }
+
+    switch interval {
+    case IntervalHour:
+        return `strftime('%Y-%m-%dT%H:00:00Z', timestamp)`, nil
+    case IntervalDay:
+        return `strftime('%Y-%m-%dT00:00:00Z', timestamp)`, nil
+    case IntervalWeek:
+        return `strftime('%Y-%m-%dT00:00:00Z', timestamp, 'weekday 0', '-6 days')`, nil
+    }
+    return "", fmt.Errorf("unsupported interval: %s", interval)
+}
+
+// aggColumns selects the bucket values for an aggregation. Delta is the
+// growth since the video's previous bucket, or since the first sample of its
+// first bucket.
+func aggColumns(agg string) (string, error) {
+    switch agg {
+    case AggLast:
+        return `last_views, last_likes, last_comments`, nil
+    case AggMax:
+        return `max_views, max_likes, max_comments`, nil
+    case AggDelta:
+        return `
+        last_views - COALESCE(LAG(last_views) OVER (PARTITION BY video_id ORDER BY bucket), first_views),
+        last_likes - COALESCE(LAG(last_likes) OVER (PARTITION BY video_id ORDER BY bucket), first_likes),
+        last_comments - COALESCE(LAG(last_comments) OVER (PARTITION BY video_id ORDER BY bucket), first_comments)`, nil
+    }
+    return "", fmt.Errorf("unsupported aggregation: %s", agg)
+}
+
+// bucketQuery groups the samples of the videos matching videoWhere, which
+// takes one argument, into time buckets per video. The query selects
+// video_id, bucket, samples and the aggregated counts without ordering them;
+// its arguments are from and to, then the videoWhere argument three times.
+// A collapsed sample stored before from but still seen in the range counts
+// as taken at from, in the range's first bucket.
+func bucketQuery(driver, videoWhere, interval, agg string, excludeFlagged bool) (string, error) {
+    bucket, err := bucketExpr(driver, interval)
+    if err != nil {
+        return "", err
+    }
+    columns, err := aggColumns(agg)
+    if err != nil {
+        return "", err
+    }
+
+    rawFilter := ""
+    if excludeFlagged {
+        rawFilter = "AND flagged = 0"
+    }
+
+    // Rolled up history is read alongside the raw samples so buckets stay
+    // continuous once retention has run
+    return fmt.Sprintf(`
+    WITH bounds AS (SELECT ? AS from_at, ? AS to_at),
+    samples AS (
+        SELECT video_id, CASE WHEN timestamp < from_at THEN from_at ELSE timestamp END AS timestamp,
+            1 AS samples, views, likes, comments
+        FROM video_stats, bounds
+        WHERE %[1]s AND timestamp <= to_at AND COALESCE(last_seen_at, timestamp) >= from_at %[2]s
+        UNION ALL
+        SELECT video_id, bucket, samples, views, likes, comments
+        FROM video_stats_hourly, bounds WHERE %[1]s AND bucket BETWEEN from_at AND to_at
+        UNION ALL
+        SELECT video_id, bucket, samples, views, likes, comments
+        FROM video_stats_daily, bounds WHERE %[1]s AND bucket BETWEEN from_at AND to_at
+    ),
+    ranked AS (
+        SELECT video_id, %[3]s AS bucket, samples, views, likes, comments,
+            ROW_NUMBER() OVER (PARTITION BY video_id, %[3]s ORDER BY timestamp DESC) AS last_rank,
+            ROW_NUMBER() OVER (PARTITION BY video_id, %[3]s ORDER BY timestamp) AS first_rank
+        FROM samples
+    ),
+    buckets AS (
+        SELECT video_id, bucket, SUM(samples) AS samples,
+            MAX(views) AS max_views, MAX(likes) AS max_likes, MAX(comments) AS max_comments,
+            MAX(CASE WHEN last_rank = 1 THEN views END) AS last_views,
+            MAX(CASE WHEN last_rank = 1 THEN likes END) AS last_likes,
+            MAX(CASE WHEN last_rank = 1 THEN comments END) AS last_comments,
+            MAX(CASE WHEN first_rank = 1 THEN views END) AS first_views,
+            MAX(CASE WHEN first_rank = 1 THEN likes END) AS first_likes,
+            MAX(CASE WHEN first_rank = 1 THEN comments END) AS first_comments
+        FROM ranked
+        GROUP BY video_id, bucket
+    )
+    SELECT video_id, bucket, samples, %[4]s
+    FROM buckets`, videoWhere, rawFilter, bucket, columns), nil
+}
+
+// GetStatsBuckets groups the samples of a video into time buckets and
+// aggregates each bucket in SQL. With excludeFlagged, raw samples marked by
+// the anomaly detector are left out.
+func (r *sqliteRepository) GetStatsBuckets(ctx context.Context, videoID string, from, to time.Time, interval, agg string, excludeFlagged bool) ([]StatsBucket, error) {
+    query, err := bucketQuery(r.db.DriverName(), "video_id = ?", interval, agg, excludeFlagged)
+    if err != nil {
+        return nil, err
+    }
+
+    from, to = from.UTC(), to.UTC()
+    rows, err := r.db.QueryContext(ctx, r.db.Rebind(query+` ORDER BY bucket`), from, to, videoID, videoID, videoID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var buckets []StatsBucket
+    for rows.Next() {
+        var b StatsBucket
+        var id, start string
+        if err := rows.Scan(&id, &start, &b.Samples, &b.Views, &b.Likes, &b.Comments); err != nil {
+            return nil, err
+        }
+        if b.Bucket, err = parseBucket(start); err != nil {
+            return nil, err
+        }
+        buckets = append(buckets, b)
+    }
+    return buckets, rows.Err()
+}
+
+// parseBucket reads a bucket start formatted by bucketExpr
+func parseBucket(start string) (time.Time, error) {
+    t, err := time.Parse(time.RFC3339, start)
+    if err != nil {
+        return t, fmt.Errorf("invalid bucket %q: %v", start, err)
+    }
+    return t, nil
+}
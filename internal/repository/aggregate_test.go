@@ -0,0 +1,120 @@
+package repository
+
+import (
+    "context"
+    "testing"
+    "time"
+)
+
+func TestGetStatsBuckets(t *testing.T) {
+    repo := newTestRepository(t)
+    base := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC) // a Monday
+
+    addVideo(t, repo, Video{VideoID: "v1"})
+    addStats(t, repo, "v1", base.Add(5*time.Minute), 100, 10, 1)
+    addStats(t, repo, "v1", base.Add(40*time.Minute), 150, 12, 2)
+    addStats(t, repo, "v1", base.Add(3*time.Hour+10*time.Minute), 400, 30, 5)
+    addStats(t, repo, "v1", base.Add(26*time.Hour), 900, 60, 9)
+
+    type bucket struct {
+        start   time.Time
+        samples int
+        views   int
+    }
+    tests := []struct {
+        name     string
+        interval string
+        agg      string
+        want     []bucket
+    }{
+        {"hourly last", IntervalHour, AggLast, []bucket{
+            {base, 2, 150}, {base.Add(3 * time.Hour), 1, 400}, {base.Add(26 * time.Hour), 1, 900},
+        }},
+        {"hourly delta starts from the first sample", IntervalHour, AggDelta, []bucket{
+            {base, 2, 50}, {base.Add(3 * time.Hour), 1, 250}, {base.Add(26 * time.Hour), 1, 500},
+        }},
+        {"daily max", IntervalDay, AggMax, []bucket{
+            {base.Truncate(24 * time.Hour), 3, 400}, {base.Truncate(24 * time.Hour).Add(24 * time.Hour), 1, 900},
+        }},
+        {"weekly buckets start on Monday", IntervalWeek, AggLast, []bucket{
+            {time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC), 4, 900},
+        }},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, err := repo.GetStatsBuckets(context.Background(), "v1", base, base.Add(48*time.Hour), tt.interval, tt.agg, false)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if len(got) != len(tt.want) {
+                t.Fatalf("got %d buckets %+v, want %d", len(got), got, len(tt.want))
+            }
+            for i, want := range tt.want {
+                if !got[i].Bucket.Equal(want.start) || got[i].Samples != want.samples || got[i].Views != want.views {
+                    t.Errorf("bucket %d = %s samples=%d views=%d, want %s samples=%d views=%d",
+                        i, got[i].Bucket, got[i].Samples, got[i].Views, want.start, want.samples, want.views)
+                }
+            }
+        })
+    }
+}
+
+func TestGetStatsBucketsRange(t *testing.T) {
+    repo := newTestRepository(t)
+    base := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+
+    addVideo(t, repo, Video{VideoID: "v1"})
+    addVideo(t, repo, Video{VideoID: "v2"})
+    addStats(t, repo, "v1", base.Add(-time.Hour), 10, 0, 0)
+    addStats(t, repo, "v1", base.Add(time.Minute), 20, 0, 0)
+    addStats(t, repo, "v2", base.Add(time.Minute), 99, 0, 0)
+
+    got, err := repo.GetStatsBuckets(context.Background(), "v1", base, base.Add(time.Hour), IntervalHour, AggLast, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(got) != 1 || got[0].Views != 20 {
+        t.Errorf("got %+v, want one bucket of v1 within the range", got)
+    }
+}
+
+func TestGetStatsBucketsInvalid(t *testing.T) {
+    repo := newTestRepository(t)
+    if _, err := repo.GetStatsBuckets(context.Background(), "v1", time.Time{}, time.Now(), "5m", AggLast, false); err == nil {
+        t.Error("unsupported interval accepted")
+    }
+    if _, err := repo.GetStatsBuckets(context.Background(), "v1", time.Time{}, time.Now(), IntervalHour, "avg", false); err == nil {
+        t.Error("unsupported aggregation accepted")
+    }
+}
+
+func TestGetStatsBucketsChangeOnly(t *testing.T) {
+    repo := newTestRepository(t)
+    ctx := context.Background()
+    base := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+
+    // In change-only mode a sample is kept while its counts stay the same
+    addVideo(t, repo, Video{VideoID: "v1"})
+    stale := addStats(t, repo, "v1", base.Add(-3*time.Hour), 100, 10, 1)
+    if err := repo.TouchVideoStats(ctx, stale.ID, base.Add(2*time.Hour)); err != nil {
+        t.Fatal(err)
+    }
+
+    got, err := repo.GetStatsBuckets(ctx, "v1", base, base.Add(4*time.Hour), IntervalHour, AggLast, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(got) != 1 || !got[0].Bucket.Equal(base) || got[0].Views != 100 {
+        t.Errorf("got %+v, want the unchanged counts in the first bucket", got)
+    }
+
+    addStats(t, repo, "v1", base.Add(3*time.Hour+10*time.Minute), 160, 12, 1)
+    got, err = repo.GetStatsBuckets(ctx, "v1", base, base.Add(4*time.Hour), IntervalHour, AggDelta, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(got) != 2 || got[0].Views != 0 || !got[1].Bucket.Equal(base.Add(3*time.Hour)) || got[1].Views != 60 {
+        t.Errorf("got %+v, want no growth in the first bucket and 60 views later", got)
+    }
+}
@@ -0,0 +1,225 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Alert rule kinds
+const (
+    RuleThreshold = "threshold" // metric compared with value once the video is older than min_age
+    RuleGrowth    = "growth"    // percentage growth of metric over window compared with value
+    RuleStalled   = "stalled"   // metric unchanged for window
+)
+
+// Alert rule scopes
+const (
+    ScopeAll      = "all"
+    ScopeVideo    = "video"
+    ScopeTag      = "tag"
+    ScopePlatform = "platform"
+)
+
+// Alert states
+const (
+    AlertFiring   = "firing"
+    AlertResolved = "resolved"
+)
+
+// AlertRule is a user-defined condition evaluated after every poll.
+// Durations are stored in Go duration syntax (e.g. 24h).
+type AlertRule struct {
+    ID         string     `db:"id" json:"id"`
+    Name       string     `db:"name" json:"name"`
+    ScopeType  string     `db:"scope_type" json:"scope_type"`
+    ScopeValue string     `db:"scope_value" json:"scope_value,omitempty"`
+    Kind       string     `db:"kind" json:"kind"`
+    Metric     string     `db:"metric" json:"metric"`
+    Operator   string     `db:"operator" json:"operator,omitempty"`
+    Value      float64    `db:"value" json:"value"`
+    Window     string     `db:"window_for" json:"window,omitempty"`
+    MinAge     string     `db:"min_age" json:"min_age,omitempty"`
+    Notifiers  StringList `db:"notifiers" json:"notifiers"`
+    CreatedAt  time.Time  `db:"created_at" json:"created_at"`
+}
+
+// Matches reports whether the rule applies to a video
+func (r *AlertRule) Matches(video *Video) bool {
+    switch r.ScopeType {
+    case ScopeVideo:
+        return video.VideoID == r.ScopeValue
+    case ScopeTag:
+        return video.HasTag(r.ScopeValue)
+    case ScopePlatform:
+        return video.Platform == r.ScopeValue
+    }
+    return true
+}
+
+// Alert is the state of one rule for one video. At most one alert per rule
+// and video is firing at a time.
+type Alert struct {
+    ID         string     `db:"id" json:"id"`
+    RuleID     string     `db:"rule_id" json:"rule_id"`
+    VideoID    string     `db:"video_id" json:"video_id"`
+    State      string     `db:"state" json:"state"`
+    Value      float64    `db:"value" json:"value"`
+    Message    string     `db:"message" json:"message"`
+    FiredAt    time.Time  `db:"fired_at" json:"fired_at"`
+    ResolvedAt *time.Time `db:"resolved_at" json:"resolved_at,omitempty"`
+}
+
+func createAlertTables(db *sqlx.DB) error {
+    _, err := db.Exec(`
+    CREATE TABLE IF NOT EXISTS alert_rules (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        name TEXT NOT NULL DEFAULT '',
+        scope_type VARCHAR(20) NOT NULL DEFAULT 'all',
+        scope_value VARCHAR(100) NOT NULL DEFAULT '',
+        kind VARCHAR(20) NOT NULL,
+        metric VARCHAR(20) NOT NULL,
+        operator VARCHAR(2) NOT NULL DEFAULT '',
+        value REAL NOT NULL DEFAULT 0,
+        window_for VARCHAR(20) NOT NULL DEFAULT '',
+        min_age VARCHAR(20) NOT NULL DEFAULT '',
+        notifiers TEXT NOT NULL DEFAULT '',
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+    )`)
+    if err != nil {
+        return err
+    }
+
+    _, err = db.Exec(`
+    CREATE TABLE IF NOT EXISTS alerts (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        rule_id VARCHAR(100) NOT NULL,
+        video_id VARCHAR(100) NOT NULL,
+        state VARCHAR(20) NOT NULL,
+        value REAL NOT NULL DEFAULT 0,
+        message TEXT NOT NULL DEFAULT '',
+        fired_at DATETIME NOT NULL,
+        resolved_at DATETIME
+    )`)
+    if err != nil {
+        return err
+    }
+
+    // Deduplication: a rule fires at most once per video until resolved
+    _, err = db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_alerts_firing ON alerts(rule_id, video_id) WHERE state = 'firing'`)
+    return err
+}
+
+func (r *sqliteRepository) CreateAlertRule(ctx context.Context, rule *AlertRule) error {
+    rule.CreatedAt = time.Now()
+    query := `
+    INSERT INTO alert_rules (name, scope_type, scope_value, kind, metric, operator, value, window_for, min_age, notifiers, created_at)
+    VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+    result, err := r.db.ExecContext(ctx, query, rule.Name, rule.ScopeType, rule.ScopeValue, rule.Kind, rule.Metric,
+        rule.Operator, rule.Value, rule.Window, rule.MinAge, rule.Notifiers, rule.CreatedAt.UTC())
+    if err != nil {
+        return err
+    }
+
+    id, err := result.LastInsertId()
+    if err != nil {
+        return err
+    }
+
+    rule.ID = fmt.Sprintf("%d", id)
+    return nil
+}
+
+func (r *sqliteRepository) GetAlertRules(ctx context.Context) ([]AlertRule, error) {
+    var rules []AlertRule
+    err := r.db.SelectContext(ctx, &rules, `SELECT * FROM alert_rules ORDER BY id`)
+    return rules, err
+}
+
+// DeleteAlertRule removes a rule together with its alert history
+func (r *sqliteRepository) DeleteAlertRule(ctx context.Context, id string) (bool, error) {
+    result, err := r.db.ExecContext(ctx, `DELETE FROM alert_rules WHERE id = ?`, id)
+    if err != nil {
+        return false, err
+    }
+    deleted, err := result.RowsAffected()
+    if err != nil || deleted == 0 {
+        return false, err
+    }
+
+    _, err = r.db.ExecContext(ctx, `DELETE FROM alerts WHERE rule_id = ?`, id)
+    return true, err
+}
+
+func (r *sqliteRepository) GetFiringAlert(ctx context.Context, ruleID, videoID string) (*Alert, error) {
+    var alert Alert
+    query := `SELECT * FROM alerts WHERE rule_id = ? AND video_id = ? AND state = ?`
+    err := r.db.GetContext(ctx, &alert, query, ruleID, videoID, AlertFiring)
+    if err == sql.ErrNoRows {
+        return nil, nil
+    }
+    return &alert, err
+}
+
+// CreateAlert opens a firing alert. A concurrent evaluation that already
+// opened one for the same rule and video makes this a no-op reported as
+// false.
+func (r *sqliteRepository) CreateAlert(ctx context.Context, alert *Alert) (bool, error) {
+    query := `
+    INSERT INTO alerts (rule_id, video_id, state, value, message, fired_at)
+    VALUES (?, ?, ?, ?, ?, ?)`
+
+    result, err := r.db.ExecContext(ctx, query, alert.RuleID, alert.VideoID, alert.State, alert.Value,
+        alert.Message, alert.FiredAt.UTC())
+    if IsUniqueViolation(err) {
+        return false, nil
+    }
+    if err != nil {
+        return false, err
+    }
+
+    id, err := result.LastInsertId()
+    if err != nil {
+        return false, err
+    }
+
+    alert.ID = fmt.Sprintf("%d", id)
+    return true, nil
+}
+
+// ResolveAlert closes a firing alert with the value that cleared it
+func (r *sqliteRepository) ResolveAlert(ctx context.Context, id string, value float64, message string, at time.Time) error {
+    query := `UPDATE alerts SET state = ?, value = ?, message = ?, resolved_at = ? WHERE id = ?`
+    _, err := r.db.ExecContext(ctx, query, AlertResolved, value, message, at.UTC(), id)
+    return err
+}
+
+// GetAlerts returns alerts newest first, optionally filtered by state
+func (r *sqliteRepository) GetAlerts(ctx context.Context, state string, limit int) ([]Alert, error) {
+    var alerts []Alert
+    query := `SELECT * FROM alerts WHERE (? = '' OR state = ?) ORDER BY fired_at DESC, id DESC LIMIT ?`
+    err := r.db.SelectContext(ctx, &alerts, query, state, state, limit)
+    return alerts, err
+}
+
+// GetStatsAt returns the last unflagged sample taken at or before at, or nil
+// if the video had no sample yet. Rolled up history answers for times
+// before the raw samples.
+func (r *sqliteRepository) GetStatsAt(ctx context.Context, videoID string, at time.Time) (*VideoStats, error) {
+    var stats VideoStats
+    // Only buckets that ended by at are known to hold counts seen before it
+    query := `SELECT * FROM (` + withRollups(
+        `SELECT `+statsColumns+` FROM video_stats WHERE video_id = ? AND timestamp <= ? AND flagged = 0`,
+        `AND bucket <= ?`, `AND bucket <= ?`,
+    ) + `) ORDER BY timestamp DESC LIMIT 1`
+    at = at.UTC()
+    err := r.db.GetContext(ctx, &stats, query, videoID, at, videoID, at.Add(-time.Hour), videoID, at.AddDate(0, 0, -1))
+    if err == sql.ErrNoRows {
+        return nil, nil
+    }
+    return &stats, err
+}
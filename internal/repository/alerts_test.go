@@ -0,0 +1,28 @@
+package repository
+
+import (
+    "context"
+    "testing"
+    "time"
+)
+
+func TestGetStatsAtSkipsFlaggedSamples(t *testing.T) {
+    repo := newTestRepository(t)
+    ctx := context.Background()
+    start := time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC)
+    video := addVideo(t, repo, Video{VideoID: "dQw4w9WgXcQ"})
+
+    addStats(t, repo, video.ID, start, 400, 10, 1)
+    spike := addStats(t, repo, video.ID, start.Add(10*time.Minute), 90000, 10, 1)
+    if err := repo.FlagVideoStats(ctx, []string{spike.ID}); err != nil {
+        t.Fatal(err)
+    }
+
+    latest, err := repo.GetStatsAt(ctx, video.ID, start.Add(20*time.Minute))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if latest == nil || latest.Views != 400 {
+        t.Errorf("latest = %+v, want the 400 views sample before the flagged spike", latest)
+    }
+}
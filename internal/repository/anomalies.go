@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Anomaly kinds
+const (
+    AnomalySpike = "spike" // implausible jump between two samples
+    AnomalyDrop  = "drop"  // a cumulative counter went down
+    AnomalyRatio = "ratio" // like/view ratio far outside the cohort
+)
+
+// Anomaly is a suspicious sample found by the detector. Value is what was
+// observed and Expected the baseline it was compared against: the increase
+// for spikes, the previous count for drops and the like/view ratio for
+// ratio anomalies.
+type Anomaly struct {
+    ID         string    `db:"id" json:"id"`
+    VideoID    string    `db:"video_id" json:"video_id"`
+    SampleID   string    `db:"sample_id" json:"sample_id"`
+    Kind       string    `db:"kind" json:"kind"`
+    Metric     string    `db:"metric" json:"metric"`
+    Value      float64   `db:"value" json:"value"`
+    Expected   float64   `db:"expected" json:"expected"`
+    Flagged    int       `db:"flagged" json:"flagged_samples"`
+    Message    string    `db:"message" json:"message"`
+    DetectedAt time.Time `db:"detected_at" json:"detected_at"`
+}
+
+func createAnomaliesTable(db *sqlx.DB) error {
+    _, err := db.Exec(`
+    CREATE TABLE IF NOT EXISTS video_anomalies (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        video_id VARCHAR(100) NOT NULL,
+        sample_id VARCHAR(100) NOT NULL,
+        kind VARCHAR(20) NOT NULL,
+        metric VARCHAR(20) NOT NULL,
+        value REAL NOT NULL DEFAULT 0,
+        expected REAL NOT NULL DEFAULT 0,
+        flagged INTEGER NOT NULL DEFAULT 0,
+        message TEXT NOT NULL DEFAULT '',
+        detected_at DATETIME NOT NULL,
+        UNIQUE(sample_id, kind, metric)
+    )`)
+    if err != nil {
+        return err
+    }
+    _, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_video_anomalies_detected ON video_anomalies(detected_at)`)
+    return err
+}
+
+// CreateAnomaly stores an anomaly unless the same sample was already reported
+// for that kind and metric, and reports whether it was new
+func (r *sqliteRepository) CreateAnomaly(ctx context.Context, anomaly *Anomaly) (bool, error) {
+    query := `
+    INSERT INTO video_anomalies (video_id, sample_id, kind, metric, value, expected, flagged, message, detected_at)
+    VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+    result, err := r.db.ExecContext(ctx, query, anomaly.VideoID, anomaly.SampleID, anomaly.Kind, anomaly.Metric,
+        anomaly.Value, anomaly.Expected, anomaly.Flagged, anomaly.Message, anomaly.DetectedAt.UTC())
+    if IsUniqueViolation(err) {
+        return false, nil
+    }
+    if err != nil {
+        return false, err
+    }
+
+    id, err := result.LastInsertId()
+    if err != nil {
+        return false, err
+    }
+
+    anomaly.ID = fmt.Sprintf("%d", id)
+    return true, nil
+}
+
+// GetLatestAnomaly returns the most recent anomaly of a kind for a video, or
+// nil if there is none
+func (r *sqliteRepository) GetLatestAnomaly(ctx context.Context, videoID, kind string) (*Anomaly, error) {
+    var anomalies []Anomaly
+    query := `SELECT * FROM video_anomalies WHERE video_id = ? AND kind = ? ORDER BY detected_at DESC LIMIT 1`
+    if err := r.db.SelectContext(ctx, &anomalies, query, videoID, kind); err != nil || len(anomalies) == 0 {
+        return nil, err
+    }
+    return &anomalies[0], nil
+}
+
+// GetAnomalies returns the newest anomalies first, optionally for one video
+func (r *sqliteRepository) GetAnomalies(ctx context.Context, videoID string, limit int) ([]Anomaly, error) {
+    var anomalies []Anomaly
+    query := `
+    SELECT * FROM video_anomalies
+    WHERE (? = '' OR video_id = ?)
+    ORDER BY detected_at DESC, id DESC
+    LIMIT ?`
+    err := r.db.SelectContext(ctx, &anomalies, query, videoID, videoID, limit)
+    return anomalies, err
+}
+
+// FlagVideoStats marks samples as suspicious so reports can leave them out
+func (r *sqliteRepository) FlagVideoStats(ctx context.Context, ids []string) error {
+    if len(ids) == 0 {
+        return nil
+    }
+    query, args, err := sqlx.In(`UPDATE video_stats SET flagged = 1 WHERE id IN (?)`, ids)
+    if err != nil {
+        return err
+    }
+    _, err = r.db.ExecContext(ctx, r.db.Rebind(query), args...)
+    return err
+}
+
+// GetLikeRatios returns the like/view ratio of the latest unflagged sample of
+// every video on a platform with at least minViews views, by video ID
+func (r *sqliteRepository) GetLikeRatios(ctx context.Context, platform string, minViews int) (map[string]float64, error) {
+    var rows []struct {
+        VideoID string  `db:"video_id"`
+        Ratio   float64 `db:"ratio"`
+    }
+    query := `
+    SELECT s.video_id, CAST(s.likes AS REAL) / s.views AS ratio
+    FROM video_stats s
+    JOIN (
+        SELECT video_id, MAX(timestamp) AS latest
+        FROM video_stats WHERE flagged = 0
+        GROUP BY video_id
+    ) l ON l.video_id = s.video_id AND l.latest = s.timestamp
+    WHERE s.flagged = 0 AND s.views >= ?
+        AND s.video_id IN (SELECT video_id FROM videos WHERE platform = ?)`
+    if err := r.db.SelectContext(ctx, &rows, query, minViews, platform); err != nil {
+        return nil, err
+    }
+    ratios := make(map[string]float64, len(rows))
+    for _, row := range rows {
+        ratios[row.VideoID] = row.Ratio
+    }
+    return ratios, nil
+}
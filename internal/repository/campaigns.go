@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Campaign groups videos from any platform under shared goals. Targets of 0
+// mean no goal was set for that KPI; engagement counts likes plus comments.
+type Campaign struct {
+    ID               string    `db:"id" json:"id"`
+    Name             string    `db:"name" json:"name"`
+    StartsAt         time.Time `db:"starts_at" json:"starts_at"`
+    EndsAt           time.Time `db:"ends_at" json:"ends_at"`
+    TargetViews      int       `db:"target_views" json:"target_views,omitempty"`
+    TargetEngagement int       `db:"target_engagement" json:"target_engagement,omitempty"`
+    CreatedAt        time.Time `db:"created_at" json:"created_at"`
+}
+
+func createCampaignTables(db *sqlx.DB) error {
+    _, err := db.Exec(`
+    CREATE TABLE IF NOT EXISTS campaigns (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        name TEXT NOT NULL,
+        starts_at DATETIME NOT NULL,
+        ends_at DATETIME NOT NULL,
+        target_views INTEGER NOT NULL DEFAULT 0,
+        target_engagement INTEGER NOT NULL DEFAULT 0,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+    )`)
+    if err != nil {
+        return err
+    }
+
+    _, err = db.Exec(`
+    CREATE TABLE IF NOT EXISTS campaign_videos (
+        campaign_id VARCHAR(100) NOT NULL,
+        video_id VARCHAR(100) NOT NULL,
+        added_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (campaign_id, video_id)
+    )`)
+    return err
+}
+
+func (r *sqliteRepository) CreateCampaign(ctx context.Context, campaign *Campaign) error {
+    campaign.CreatedAt = time.Now()
+    query := `
+    INSERT INTO campaigns (name, starts_at, ends_at, target_views, target_engagement, created_at)
+    VALUES (?, ?, ?, ?, ?, ?)`
+
+    result, err := r.db.ExecContext(ctx, query, campaign.Name, campaign.StartsAt.UTC(), campaign.EndsAt.UTC(),
+        campaign.TargetViews, campaign.TargetEngagement, campaign.CreatedAt.UTC())
+    if err != nil {
+        return err
+    }
+
+    id, err := result.LastInsertId()
+    if err != nil {
+        return err
+    }
+
+    campaign.ID = fmt.Sprintf("%d", id)
+    return nil
+}
+
+func (r *sqliteRepository) GetCampaign(ctx context.Context, id string) (*Campaign, error) {
+    var campaign Campaign
+    err := r.db.GetContext(ctx, &campaign, `SELECT * FROM campaigns WHERE id = ?`, id)
+    if err == sql.ErrNoRows {
+        return nil, nil
+    }
+    return &campaign, err
+}
+
+func (r *sqliteRepository) GetCampaigns(ctx context.Context) ([]Campaign, error) {
+    var campaigns []Campaign
+    err := r.db.SelectContext(ctx, &campaigns, `SELECT * FROM campaigns ORDER BY starts_at DESC, id`)
+    return campaigns, err
+}
+
+// DeleteCampaign removes a campaign and its memberships; the videos stay
+// tracked
+func (r *sqliteRepository) DeleteCampaign(ctx context.Context, id string) (bool, error) {
+    tx, err := r.db.BeginTxx(ctx, nil)
+    if err != nil {
+        return false, err
+    }
+    defer tx.Rollback()
+
+    result, err := tx.ExecContext(ctx, `DELETE FROM campaigns WHERE id = ?`, id)
+    if err != nil {
+        return false, err
+    }
+    deleted, err := result.RowsAffected()
+    if err != nil || deleted == 0 {
+        return false, err
+    }
+
+    if _, err := tx.ExecContext(ctx, `DELETE FROM campaign_videos WHERE campaign_id = ?`, id); err != nil {
+        return false, err
+    }
+    return true, tx.Commit()
+}
+
+// AddCampaignVideos adds videos to a campaign, skipping ones already in it,
+// and returns how many were added
+func (r *sqliteRepository) AddCampaignVideos(ctx context.Context, campaignID string, videoIDs []string) (int, error) {
+    tx, err := r.db.BeginTxx(ctx, nil)
+    if err != nil {
+        return 0, err
+    }
+    defer tx.Rollback()
+
+    added := 0
+    now := time.Now().UTC()
+    for _, videoID := range videoIDs {
+        result, err := tx.ExecContext(ctx, `
+        INSERT INTO campaign_videos (campaign_id, video_id, added_at) VALUES (?, ?, ?)
+        ON CONFLICT (campaign_id, video_id) DO NOTHING`, campaignID, videoID, now)
+        if err != nil {
+            return 0, err
+        }
+        n, err := result.RowsAffected()
+        if err != nil {
+            return 0, err
+        }
+        added += int(n)
+    }
+    return added, tx.Commit()
+}
+
+func (r *sqliteRepository) RemoveCampaignVideo(ctx context.Context, campaignID, videoID string) (bool, error) {
+    result, err := r.db.ExecContext(ctx, `DELETE FROM campaign_videos WHERE campaign_id = ? AND video_id = ?`, campaignID, videoID)
+    if err != nil {
+        return false, err
+    }
+    removed, err := result.RowsAffected()
+    return removed > 0, err
+}
+
+// GetCampaignVideos returns the tracked videos of a campaign
+func (r *sqliteRepository) GetCampaignVideos(ctx context.Context, campaignID string) ([]Video, error) {
+    var videos []Video
+    query := `
+    SELECT v.* FROM videos v
+    JOIN campaign_videos c ON c.video_id = v.video_id
+    WHERE c.campaign_id = ?
+    ORDER BY v.platform, v.video_id`
+    err := r.db.SelectContext(ctx, &videos, query, campaignID)
+    return videos, err
+}
@@ -15,13 +15,96 @@ type Repository interface {
     CreateVideo(ctx context.Context, video *Video) error
     GetVideo(ctx context.Context, platform, videoID string) (*Video, error)
     GetVideoWithUsername(ctx context.Context, platform, videoID, username string) (*Video, error)
+    GetVideoByVideoID(ctx context.Context, videoID string) (*Video, error)
     GetAllVideos(ctx context.Context) ([]Video, error)
+    GetVideos(ctx context.Context, filter VideoFilter) ([]Video, error)
     UpdateVideoState(ctx context.Context, videoID, state string) error
+    TransitionVideoState(ctx context.Context, videoID, from, to, reason string, at time.Time) error
+    GetVideoStateHistory(ctx context.Context, videoID string) ([]StateTransition, error)
+
+    // Tracked account operations
+    CreateTrackedAccount(ctx context.Context, account *TrackedAccount) error
+    GetTrackedAccount(ctx context.Context, platform, accountID string) (*TrackedAccount, error)
+    GetTrackedAccounts(ctx context.Context) ([]TrackedAccount, error)
+    GetTrackedAccountByID(ctx context.Context, id string) (*TrackedAccount, error)
+    UpdateAccountSyncedAt(ctx context.Context, id string, syncedAt time.Time) error
+    CreateAccountStats(ctx context.Context, stats *AccountStats) error
+    GetAccountStats(ctx context.Context, accountID string, from, to time.Time) ([]AccountStats, error)
+    GetLatestAccountStats(ctx context.Context, accountID string) (*AccountStats, error)
     
     // Stats operations
     CreateVideoStats(ctx context.Context, stats *VideoStats) error
     GetVideoStats(ctx context.Context, videoID string, from, to time.Time) ([]VideoStats, error)
+    StreamVideoStats(ctx context.Context, videoID string, from, to time.Time, excludeFlagged bool, fn func(*VideoStats) error) error
     GetLatestStats(ctx context.Context, videoID string) (*VideoStats, error)
+    TouchVideoStats(ctx context.Context, id string, seenAt time.Time) error
+    // Alerts
+    CreateAlertRule(ctx context.Context, rule *AlertRule) error
+    GetAlertRules(ctx context.Context) ([]AlertRule, error)
+    DeleteAlertRule(ctx context.Context, id string) (bool, error)
+    GetFiringAlert(ctx context.Context, ruleID, videoID string) (*Alert, error)
+    CreateAlert(ctx context.Context, alert *Alert) (bool, error)
+    ResolveAlert(ctx context.Context, id string, value float64, message string, at time.Time) error
+    GetAlerts(ctx context.Context, state string, limit int) ([]Alert, error)
+    GetStatsAt(ctx context.Context, videoID string, at time.Time) (*VideoStats, error)
+
+    // Webhooks
+    CreateWebhook(ctx context.Context, hook *Webhook) error
+    GetWebhook(ctx context.Context, id string) (*Webhook, error)
+    GetWebhooks(ctx context.Context) ([]Webhook, error)
+    DeleteWebhook(ctx context.Context, id string) (bool, error)
+    CreateWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) error
+    GetDueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]WebhookDelivery, error)
+    CountDueWebhookDeliveries(ctx context.Context, now time.Time) (int, error)
+    UpdateWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) error
+    GetWebhookDeliveries(ctx context.Context, webhookID string, limit int) ([]WebhookDelivery, error)
+    PurgeWebhookDeliveries(ctx context.Context, before time.Time) (int64, error)
+
+    // Metadata operations
+    SaveVideoMetadata(ctx context.Context, meta *VideoMetadata) (bool, error)
+    GetLatestVideoMetadata(ctx context.Context, videoID string) (*VideoMetadata, error)
+    GetVideoMetadataAt(ctx context.Context, videoID string, at time.Time) (*VideoMetadata, error)
+    GetVideoMetadataHistory(ctx context.Context, videoID string) ([]VideoMetadata, error)
+
+    GetStatsBuckets(ctx context.Context, videoID string, from, to time.Time, interval, agg string, excludeFlagged bool) ([]StatsBucket, error)
+    ApplyRetention(ctx context.Context, policy RetentionPolicy, now time.Time, dryRun bool) (*RetentionReport, error)
+    FirstStatsSampleReaching(ctx context.Context, videoID, metric string, threshold int) (*VideoStats, error)
+    CreateMilestone(ctx context.Context, milestone *VideoMilestone) (bool, error)
+    GetMilestones(ctx context.Context, videoID string) ([]VideoMilestone, error)
+
+    // Anomalies
+    CreateAnomaly(ctx context.Context, anomaly *Anomaly) (bool, error)
+    GetLatestAnomaly(ctx context.Context, videoID, kind string) (*Anomaly, error)
+    GetAnomalies(ctx context.Context, videoID string, limit int) ([]Anomaly, error)
+    FlagVideoStats(ctx context.Context, ids []string) error
+    GetLikeRatios(ctx context.Context, platform string, minViews int) (map[string]float64, error)
+
+    // Campaigns
+    CreateCampaign(ctx context.Context, campaign *Campaign) error
+    GetCampaign(ctx context.Context, id string) (*Campaign, error)
+    GetCampaigns(ctx context.Context) ([]Campaign, error)
+    DeleteCampaign(ctx context.Context, id string) (bool, error)
+    AddCampaignVideos(ctx context.Context, campaignID string, videoIDs []string) (int, error)
+    RemoveCampaignVideo(ctx context.Context, campaignID, videoID string) (bool, error)
+    GetCampaignVideos(ctx context.Context, campaignID string) ([]Video, error)
+
+    // Tags
+    AddVideoTags(ctx context.Context, videoID string, tags []string) error
+    RemoveVideoTag(ctx context.Context, videoID, tag string) (bool, error)
+    GetVideoTags(ctx context.Context, videoID string) ([]string, error)
+    GetTags(ctx context.Context) ([]TagSummary, error)
+    GetVideosByTag(ctx context.Context, tag string) ([]Video, error)
+    GetTagStatsBuckets(ctx context.Context, tag string, from, to time.Time, interval, agg string, excludeFlagged bool) ([]TagBucket, error)
+
+    GetLeaderboard(ctx context.Context, query LeaderboardQuery) ([]LeaderboardEntry, error)
+
+    // Warehouse exports
+    GetExportWatermark(ctx context.Context, name string) (*ExportWatermark, error)
+    SetExportWatermark(ctx context.Context, watermark *ExportWatermark) error
+    GetMaxStatsChangeSeq(ctx context.Context) (int64, error)
+    StreamExportRows(ctx context.Context, afterSeq, upToSeq int64, fn func(*ExportRow) error) error
+    ClaimExportRun(ctx context.Context, token string, staleBefore time.Time) (bool, error)
+    ReleaseExportRun(ctx context.Context, token string) error
 }
 
 type sqliteRepository struct {
@@ -30,7 +113,17 @@ type sqliteRepository struct {
 
 // NewSQLiteRepository creates a new SQLite repository
 func NewSQLiteRepository() (Repository, error) {
-    db, err := sqlx.Open("sqlite", "./video_stats.db")  // 👈 Changed to "sqlite" (no 3)
+    return openSQLite("./video_stats.db")
+}
+
+// openSQLite opens the database file at path, creating and migrating the
+// schema as needed
+func openSQLite(path string) (*sqliteRepository, error) {
+    // _time_format=sqlite stores times in a format SQLite's date functions
+    // understand, which time bucketing relies on. WAL lets long exports read
+    // while the poller writes, and busy_timeout makes writers wait for a
+    // lock instead of failing with SQLITE_BUSY.
+    db, err := sqlx.Open("sqlite", path+"?_time_format=sqlite&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")  // 👈 Changed to "sqlite" (no 3)
     if err != nil {
         return nil, err
     }
@@ -60,9 +153,37 @@ func createTables(db *sqlx.DB) error {
         state VARCHAR(20) DEFAULT 'registered',
         created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
         tag VARCHAR(100),
+        account_id VARCHAR(100) NOT NULL DEFAULT '',
+        published_at DATETIME,
         UNIQUE(platform, video_id, instagram_username)
     )`
 
+    accountsTable := `
+    CREATE TABLE IF NOT EXISTS tracked_accounts (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        platform VARCHAR(20) NOT NULL,
+        account_id VARCHAR(100) NOT NULL,
+        handle VARCHAR(100) NOT NULL DEFAULT '',
+        title TEXT NOT NULL DEFAULT '',
+        uploads_playlist_id VARCHAR(100) NOT NULL DEFAULT '',
+        tag VARCHAR(100) NOT NULL DEFAULT '',
+        media_type VARCHAR(100) NOT NULL DEFAULT '',
+        state VARCHAR(20) NOT NULL DEFAULT 'active',
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        last_synced_at DATETIME,
+        UNIQUE(platform, account_id)
+    )`
+
+    accountStatsTable := `
+    CREATE TABLE IF NOT EXISTS account_stats (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        account_id VARCHAR(100) NOT NULL,
+        timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+        followers INTEGER NOT NULL DEFAULT 0,
+        media_count INTEGER NOT NULL DEFAULT 0,
+        views INTEGER NOT NULL DEFAULT 0
+    )`
+
     statsTable := `
     CREATE TABLE IF NOT EXISTS video_stats (
         id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -71,10 +192,9 @@ func createTables(db *sqlx.DB) error {
         views INTEGER NOT NULL DEFAULT 0,
         likes INTEGER NOT NULL DEFAULT 0,
         comments INTEGER NOT NULL DEFAULT 0,
-        caption TEXT,
-        permalink TEXT,
-        media_type TEXT,
-        media_url TEXT
+        last_seen_at DATETIME,
+        flagged INTEGER NOT NULL DEFAULT 0,
+        change_seq INTEGER
     )`
 
     _, err := db.Exec(videosTable)
@@ -83,7 +203,62 @@ func createTables(db *sqlx.DB) error {
     }
 
     _, err = db.Exec(statsTable)
-    return err
+    if err != nil {
+        return err
+    }
+
+    _, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_video_stats_video_time ON video_stats(video_id, timestamp)`)
+    if err != nil {
+        return err
+    }
+
+    _, err = db.Exec(accountsTable)
+    if err != nil {
+        return err
+    }
+
+    _, err = db.Exec(accountStatsTable)
+    if err != nil {
+        return err
+    }
+
+    if err := createMilestonesTable(db); err != nil {
+        return err
+    }
+
+    if err := createAlertTables(db); err != nil {
+        return err
+    }
+
+    if err := createWebhookTables(db); err != nil {
+        return err
+    }
+
+    if err := createStateHistoryTable(db); err != nil {
+        return err
+    }
+
+    if err := createMetadataTable(db); err != nil {
+        return err
+    }
+
+    if err := createAnomaliesTable(db); err != nil {
+        return err
+    }
+
+    if err := createCampaignTables(db); err != nil {
+        return err
+    }
+
+    if err := createTagsTable(db); err != nil {
+        return err
+    }
+
+    if err := createExportWatermarksTable(db); err != nil {
+        return err
+    }
+
+    return createRollupTables(db)
 }
 
 func (r *sqliteRepository) CreateVideo(ctx context.Context, video *Video) error {
@@ -92,10 +267,10 @@ func (r *sqliteRepository) CreateVideo(ctx context.Context, video *Video) error
         return fmt.Errorf("instagram_username is required for Instagram videos")
     }
     query := `
-    INSERT INTO videos (platform, video_id, instagram_username, state, tag) 
-    VALUES (?, ?, ?, ?, ?)`
+    INSERT INTO videos (platform, video_id, instagram_username, state, tag, account_id, published_at) 
+    VALUES (?, ?, ?, ?, ?, ?, ?)`
     
-    result, err := r.db.ExecContext(ctx, query, video.Platform, video.VideoID, video.InstagramUsername, video.State, video.Tag)
+    result, err := r.db.ExecContext(ctx, query, video.Platform, video.VideoID, video.InstagramUsername, video.State, video.Tag, video.AccountID, utcPtr(video.PublishedAt))
     if err != nil {
         return err
     }
@@ -107,7 +282,12 @@ func (r *sqliteRepository) CreateVideo(ctx context.Context, video *Video) error
     
     video.ID = fmt.Sprintf("%d", id)
     video.CreatedAt = time.Now()
-    return nil
+
+    if video.Tag == "" {
+        return nil
+    }
+    video.Tags = []string{video.Tag}
+    return r.AddVideoTags(ctx, video.VideoID, video.Tags)
 }
 
 func (r *sqliteRepository) GetVideo(ctx context.Context, platform, videoID string) (*Video, error) {
@@ -130,11 +310,51 @@ func (r *sqliteRepository) GetVideoWithUsername(ctx context.Context, platform, v
     }
     return &video, err
 }
+// GetVideoByVideoID looks a video up by its platform ID alone, as the stats
+// table does
+func (r *sqliteRepository) GetVideoByVideoID(ctx context.Context, videoID string) (*Video, error) {
+    var video Video
+    query := `SELECT * FROM videos WHERE video_id = ? ORDER BY id LIMIT 1`
+    err := r.db.GetContext(ctx, &video, query, videoID)
+    if err == sql.ErrNoRows {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    video.Tags, err = r.GetVideoTags(ctx, videoID)
+    return &video, err
+}
+
 func (r *sqliteRepository) GetAllVideos(ctx context.Context) ([]Video, error) {
     var videos []Video
-    query := `SELECT * FROM videos WHERE state = 'registered'`
-    err := r.db.SelectContext(ctx, &videos, query)
-    return videos, err
+    // Private and unavailable videos stay in the polling set so they can
+    // recover; the service decides when to retry them
+    query := `SELECT * FROM videos WHERE state IN (?, ?, ?)`
+    if err := r.db.SelectContext(ctx, &videos, query, StateRegistered, StatePrivate, StateUnavailable); err != nil {
+        return nil, err
+    }
+    return videos, r.attachTags(ctx, videos)
+}
+
+// GetVideos returns the videos matching every set field of the filter, in
+// any state unless one is given, newest first
+func (r *sqliteRepository) GetVideos(ctx context.Context, filter VideoFilter) ([]Video, error) {
+    var videos []Video
+    query := `
+    SELECT * FROM videos
+    WHERE (? = '' OR platform = ?)
+        AND (? = '' OR state = ?)
+        AND (? = '' OR account_id = ?)
+        AND (? = '' OR video_id IN (SELECT video_id FROM video_tags WHERE tag = ?))
+    ORDER BY created_at DESC, id DESC`
+    err := r.db.SelectContext(ctx, &videos, query,
+        filter.Platform, filter.Platform, filter.State, filter.State,
+        filter.AccountID, filter.AccountID, filter.Tag, filter.Tag)
+    if err != nil {
+        return nil, err
+    }
+    return videos, r.attachTags(ctx, videos)
 }
 
 func (r *sqliteRepository) UpdateVideoState(ctx context.Context, videoID, state string) error {
@@ -145,10 +365,10 @@ func (r *sqliteRepository) UpdateVideoState(ctx context.Context, videoID, state
 
 func (r *sqliteRepository) CreateVideoStats(ctx context.Context, stats *VideoStats) error {
     query := `
-    INSERT INTO video_stats (video_id, timestamp, views, likes, comments, caption, permalink, media_type, media_url) 
-    VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+    INSERT INTO video_stats (video_id, timestamp, views, likes, comments) 
+    VALUES (?, ?, ?, ?, ?)`
 
-    result, err := r.db.ExecContext(ctx, query, stats.VideoID, stats.Timestamp, stats.Views, stats.Likes, stats.Comments, stats.Caption, stats.Permalink, stats.MediaType, stats.MediaURL)
+    result, err := r.db.ExecContext(ctx, query, stats.VideoID, stats.Timestamp.UTC(), stats.Views, stats.Likes, stats.Comments)
     if err != nil {
         return err
     }
@@ -162,13 +382,45 @@ func (r *sqliteRepository) CreateVideoStats(ctx context.Context, stats *VideoSta
     return nil
 }
 
+// GetVideoStats returns the samples overlapping the range, including
+// collapsed samples that started before from but were still seen after it
 func (r *sqliteRepository) GetVideoStats(ctx context.Context, videoID string, from, to time.Time) ([]VideoStats, error) {
     var stats []VideoStats
-    query := `SELECT * FROM video_stats WHERE video_id = ? AND timestamp BETWEEN ? AND ? ORDER BY timestamp`
-    err := r.db.SelectContext(ctx, &stats, query, videoID, from, to)
+    query := `
+    SELECT * FROM video_stats
+    WHERE video_id = ? AND timestamp <= ? AND COALESCE(last_seen_at, timestamp) >= ?
+    ORDER BY timestamp`
+    err := r.db.SelectContext(ctx, &stats, query, videoID, to.UTC(), from.UTC())
     return stats, err
 }
 
+// StreamVideoStats calls fn for each sample in the range, one row at a time
+// so exports never hold the whole range in memory. An empty videoID streams
+// every video, ordered by video and time.
+func (r *sqliteRepository) StreamVideoStats(ctx context.Context, videoID string, from, to time.Time, excludeFlagged bool, fn func(*VideoStats) error) error {
+    query := `
+    SELECT * FROM video_stats
+    WHERE (? = '' OR video_id = ?) AND timestamp <= ? AND COALESCE(last_seen_at, timestamp) >= ?
+        AND (? = 0 OR flagged = 0)
+    ORDER BY video_id, timestamp`
+    rows, err := r.db.QueryxContext(ctx, query, videoID, videoID, to.UTC(), from.UTC(), excludeFlagged)
+    if err != nil {
+        return err
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        var stats VideoStats
+        if err := rows.StructScan(&stats); err != nil {
+            return err
+        }
+        if err := fn(&stats); err != nil {
+            return err
+        }
+    }
+    return rows.Err()
+}
+
 func (r *sqliteRepository) GetLatestStats(ctx context.Context, videoID string) (*VideoStats, error) {
     var stats VideoStats
     query := `SELECT * FROM video_stats WHERE video_id = ? ORDER BY timestamp DESC LIMIT 1`
@@ -179,14 +431,26 @@ func (r *sqliteRepository) GetLatestStats(ctx context.Context, videoID string) (
     return &stats, err
 }
 
+// TouchVideoStats records that a sample's counts were seen again
+func (r *sqliteRepository) TouchVideoStats(ctx context.Context, id string, seenAt time.Time) error {
+    _, err := r.db.ExecContext(ctx, `UPDATE video_stats SET last_seen_at = ? WHERE id = ?`, seenAt.UTC(), id)
+    return err
+}
+
+// statsMetricColumns whitelists the counters that may be used in queries
+// built from caller input
+var statsMetricColumns = map[string]bool{"views": true, "likes": true, "comments": true}
+
 func migrateDatabase(db *sqlx.DB) error {
     // Check if new columns exist, if not add them
     alterQueries := []string{
         `ALTER TABLE video_stats ADD COLUMN comments INTEGER DEFAULT 0`,
-        `ALTER TABLE video_stats ADD COLUMN caption TEXT`,
-        `ALTER TABLE video_stats ADD COLUMN permalink TEXT`,
-        `ALTER TABLE video_stats ADD COLUMN media_type TEXT`,
-        `ALTER TABLE video_stats ADD COLUMN media_url TEXT`,
+        `ALTER TABLE video_stats ADD COLUMN last_seen_at DATETIME`,
+        `ALTER TABLE video_stats ADD COLUMN flagged INTEGER NOT NULL DEFAULT 0`,
+        `ALTER TABLE video_stats ADD COLUMN change_seq INTEGER`,
+        `ALTER TABLE videos ADD COLUMN account_id VARCHAR(100) NOT NULL DEFAULT ''`,
+        `ALTER TABLE videos ADD COLUMN published_at DATETIME`,
+        `ALTER TABLE tracked_accounts ADD COLUMN media_type VARCHAR(100) NOT NULL DEFAULT ''`,
     }
 
     for _, query := range alterQueries {
@@ -203,9 +467,66 @@ func migrateDatabase(db *sqlx.DB) error {
     if err != nil {
         fmt.Printf("Migration update warning: %v\n", err)
     }
+
+    if err := normalizeTimestamps(db); err != nil {
+        fmt.Printf("Migration timestamp warning: %v\n", err)
+    }
+
+    // Media metadata used to be repeated in every stats row
+    if err := moveStatsMetadata(db); err != nil {
+        return fmt.Errorf("moving media metadata out of video_stats: %v", err)
+    }
+
+    if err := trackStatsChanges(db); err != nil {
+        return fmt.Errorf("numbering stats changes: %v", err)
+    }
     return nil
 }
 
+// normalizeTimestamps rewrites times stored in Go's default format
+// ("2006-01-02 15:04:05 -0700 MST", which SQLite cannot parse) as UTC
+func normalizeTimestamps(db *sqlx.DB) error {
+    columns := []struct{ table, column string }{
+        {"video_stats", "timestamp"},
+        {"account_stats", "timestamp"},
+        {"tracked_accounts", "last_synced_at"},
+        {"videos", "published_at"},
+    }
+
+    for _, c := range columns {
+        var rows []struct {
+            ID    int64     `db:"id"`
+            Value time.Time `db:"value"`
+        }
+        query := fmt.Sprintf(`SELECT id, %s AS value FROM %s WHERE %s LIKE '%% %% %%'`, c.column, c.table, c.column)
+        if err := db.Select(&rows, query); err != nil {
+            return err
+        }
+
+        update := fmt.Sprintf(`UPDATE %s SET %s = ? WHERE id = ?`, c.table, c.column)
+        for _, row := range rows {
+            if _, err := db.Exec(update, row.Value.UTC(), row.ID); err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
+
+// utcPtr converts an optional time to UTC before it is stored
+func utcPtr(t *time.Time) *time.Time {
+    if t == nil {
+        return nil
+    }
+    utc := t.UTC()
+    return &utc
+}
+
+// IsUniqueViolation reports whether err comes from a UNIQUE constraint
+func IsUniqueViolation(err error) bool {
+    return err != nil && contains(err.Error(), "UNIQUE constraint failed")
+}
+
 func contains(s, substr string) bool {
     return len(s) >= len(substr) && (s == substr || len(s) > len(substr) && (s[0:len(substr)] == substr || contains(s[1:], substr)))
 }
\ No newline at end of file
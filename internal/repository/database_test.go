@@ -0,0 +1,57 @@
+package repository
+
+import (
+    "context"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+// newTestRepository opens an empty database in a temporary directory
+func newTestRepository(t *testing.T) *sqliteRepository {
+    t.Helper()
+    repo, err := openSQLite(filepath.Join(t.TempDir(), "test.db"))
+    if err != nil {
+        t.Fatalf("opening database: %v", err)
+    }
+    t.Cleanup(func() { repo.db.Close() })
+    return repo
+}
+
+func addVideo(t *testing.T, repo *sqliteRepository, video Video) *Video {
+    t.Helper()
+    if video.Platform == "" {
+        video.Platform = PlatformYouTube
+    }
+    if video.State == "" {
+        video.State = StateRegistered
+    }
+    if err := repo.CreateVideo(context.Background(), &video); err != nil {
+        t.Fatalf("creating video %s: %v", video.VideoID, err)
+    }
+    return &video
+}
+
+func addStats(t *testing.T, repo *sqliteRepository, videoID string, at time.Time, views, likes, comments int) *VideoStats {
+    t.Helper()
+    stats := &VideoStats{VideoID: videoID, Timestamp: at, Views: views, Likes: likes, Comments: comments}
+    if err := repo.CreateVideoStats(context.Background(), stats); err != nil {
+        t.Fatalf("creating stats: %v", err)
+    }
+    return stats
+}
+
+func TestOpenSQLiteUsesWAL(t *testing.T) {
+    repo := newTestRepository(t)
+    var mode string
+    if err := repo.db.Get(&mode, "PRAGMA journal_mode"); err != nil {
+        t.Fatalf("reading journal mode: %v", err)
+    }
+    var timeout int
+    if err := repo.db.Get(&timeout, "PRAGMA busy_timeout"); err != nil {
+        t.Fatalf("reading busy timeout: %v", err)
+    }
+    if mode != "wal" || timeout != 5000 {
+        t.Errorf("got journal_mode %s and busy_timeout %d, want wal and 5000", mode, timeout)
+    }
+}
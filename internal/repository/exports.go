@@ -0,0 +1,205 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ExportRow is a stats sample joined with its video, its tags and the
+// metadata version current at the sample
+type ExportRow struct {
+    SampleID          int64      `db:"sample_id"`
+    ChangeSeq         int64      `db:"change_seq"`
+    VideoID           string     `db:"video_id"`
+    Platform          string     `db:"platform"`
+    Timestamp         time.Time  `db:"timestamp"`
+    Views             int64      `db:"views"`
+    Likes             int64      `db:"likes"`
+    Comments          int64      `db:"comments"`
+    LastSeenAt        *time.Time `db:"last_seen_at"`
+    Flagged           bool       `db:"flagged"`
+    InstagramUsername string     `db:"instagram_username"`
+    AccountID         string     `db:"account_id"`
+    Tags              TagSet     `db:"tags"`
+    State             string     `db:"state"`
+    PublishedAt       *time.Time `db:"published_at"`
+    RegisteredAt      time.Time  `db:"registered_at"`
+    MetadataVersion   *int64     `db:"metadata_version"`
+    Caption           *string    `db:"caption"`
+    Permalink         *string    `db:"permalink"`
+    MediaType         *string    `db:"media_type"`
+}
+
+// TagSet is a video's tags, scanned from a JSON array
+type TagSet []string
+
+func (t *TagSet) Scan(src interface{}) error {
+    var data []byte
+    switch v := src.(type) {
+    case string:
+        data = []byte(v)
+    case []byte:
+        data = v
+    case nil:
+        *t = TagSet{}
+        return nil
+    default:
+        return fmt.Errorf("unsupported tag set type %T", src)
+    }
+    *t = TagSet{}
+    return json.Unmarshal(data, (*[]string)(t))
+}
+
+// ExportWatermark is the last change shipped by a named incremental export.
+// last_id held sample IDs before changes were numbered; samples from then
+// kept their ID as change_seq, so old watermarks still hold.
+type ExportWatermark struct {
+    Name       string    `db:"name" json:"name"`
+    LastSeq    int64     `db:"last_id" json:"last_change_seq"`
+    ExportedAt time.Time `db:"exported_at" json:"exported_at"`
+}
+
+func createExportWatermarksTable(db *sqlx.DB) error {
+    _, err := db.Exec(`
+    CREATE TABLE IF NOT EXISTS export_watermarks (
+        name VARCHAR(100) PRIMARY KEY,
+        last_id INTEGER NOT NULL,
+        exported_at DATETIME NOT NULL
+    )`)
+    if err != nil {
+        return err
+    }
+
+    // A single row claims the export for one run across processes
+    _, err = db.Exec(`
+    CREATE TABLE IF NOT EXISTS export_runs (
+        id INTEGER PRIMARY KEY CHECK (id = 1),
+        token VARCHAR(100) NOT NULL,
+        started_at DATETIME NOT NULL
+    )`)
+    return err
+}
+
+// trackStatsChanges numbers every insert and update of a sample in
+// change_seq, so incremental exports pick up samples changed after they
+// were shipped, such as last_seen_at bumps or anomaly flags. Samples stored
+// before the column existed are numbered by their ID.
+func trackStatsChanges(db *sqlx.DB) error {
+    statements := []string{
+        `UPDATE video_stats SET change_seq = id WHERE change_seq IS NULL`,
+        `CREATE INDEX IF NOT EXISTS idx_video_stats_change_seq ON video_stats(change_seq)`,
+        `CREATE TRIGGER IF NOT EXISTS video_stats_inserted AFTER INSERT ON video_stats
+        BEGIN
+            UPDATE video_stats SET change_seq = (SELECT COALESCE(MAX(change_seq), 0) + 1 FROM video_stats) WHERE id = NEW.id;
+        END`,
+        `CREATE TRIGGER IF NOT EXISTS video_stats_updated AFTER UPDATE OF views, likes, comments, last_seen_at, flagged ON video_stats
+        BEGIN
+            UPDATE video_stats SET change_seq = (SELECT COALESCE(MAX(change_seq), 0) + 1 FROM video_stats) WHERE id = NEW.id;
+        END`,
+    }
+    for _, statement := range statements {
+        if _, err := db.Exec(statement); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// ClaimExportRun claims the export for one run. It fails while another run
+// holds the claim, unless that claim was taken before staleBefore, as left
+// behind by a run that crashed.
+func (r *sqliteRepository) ClaimExportRun(ctx context.Context, token string, staleBefore time.Time) (bool, error) {
+    result, err := r.db.ExecContext(ctx, `
+    INSERT INTO export_runs (id, token, started_at) VALUES (1, ?, ?)
+    ON CONFLICT (id) DO UPDATE SET token = excluded.token, started_at = excluded.started_at
+    WHERE export_runs.started_at < ?`,
+        token, time.Now().UTC(), staleBefore.UTC())
+    if err != nil {
+        return false, err
+    }
+    claimed, err := result.RowsAffected()
+    return claimed == 1, err
+}
+
+// ReleaseExportRun gives up a claim, if it is still held
+func (r *sqliteRepository) ReleaseExportRun(ctx context.Context, token string) error {
+    _, err := r.db.ExecContext(ctx, `DELETE FROM export_runs WHERE token = ?`, token)
+    return err
+}
+
+func (r *sqliteRepository) GetExportWatermark(ctx context.Context, name string) (*ExportWatermark, error) {
+    var watermark ExportWatermark
+    err := r.db.GetContext(ctx, &watermark, `SELECT * FROM export_watermarks WHERE name = ?`, name)
+    if err == sql.ErrNoRows {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    return &watermark, nil
+}
+
+func (r *sqliteRepository) SetExportWatermark(ctx context.Context, watermark *ExportWatermark) error {
+    _, err := r.db.ExecContext(ctx, `
+    INSERT INTO export_watermarks (name, last_id, exported_at) VALUES (?, ?, ?)
+    ON CONFLICT (name) DO UPDATE SET last_id = excluded.last_id, exported_at = excluded.exported_at`,
+        watermark.Name, watermark.LastSeq, watermark.ExportedAt.UTC())
+    return err
+}
+
+// GetMaxStatsChangeSeq returns the newest sample change number, 0 without
+// samples
+func (r *sqliteRepository) GetMaxStatsChangeSeq(ctx context.Context) (int64, error) {
+    var seq int64
+    err := r.db.GetContext(ctx, &seq, `SELECT COALESCE(MAX(change_seq), 0) FROM video_stats`)
+    return seq, err
+}
+
+// StreamExportRows calls fn for each sample inserted or changed with
+// afterSeq < change_seq <= upToSeq, ordered by day, platform and ID so
+// partitions can be written one after another. The metadata is the latest
+// version recorded at or before the sample, or the first version for
+// samples taken before any.
+func (r *sqliteRepository) StreamExportRows(ctx context.Context, afterSeq, upToSeq int64, fn func(*ExportRow) error) error {
+    query := `
+    WITH tags AS (
+        SELECT video_id, json_group_array(tag) AS tags
+        FROM (SELECT video_id, tag FROM video_tags ORDER BY video_id, tag)
+        GROUP BY video_id
+    )
+    SELECT s.id AS sample_id, s.change_seq, s.video_id, v.platform, s.timestamp, s.views, s.likes, s.comments,
+        s.last_seen_at, s.flagged,
+        COALESCE(v.instagram_username, '') AS instagram_username, v.account_id, COALESCE(t.tags, '[]') AS tags,
+        v.state, v.published_at, v.created_at AS registered_at,
+        m.version AS metadata_version, m.caption, m.permalink, m.media_type
+    FROM video_stats s
+    JOIN videos v ON v.video_id = s.video_id
+    LEFT JOIN tags t ON t.video_id = s.video_id
+    LEFT JOIN video_metadata m ON m.id = COALESCE(
+        (SELECT id FROM video_metadata WHERE video_id = s.video_id AND recorded_at <= s.timestamp ORDER BY version DESC LIMIT 1),
+        (SELECT id FROM video_metadata WHERE video_id = s.video_id ORDER BY version LIMIT 1)
+    )
+    WHERE s.change_seq > ? AND s.change_seq <= ?
+    ORDER BY date(s.timestamp), v.platform, s.id`
+    rows, err := r.db.QueryxContext(ctx, query, afterSeq, upToSeq)
+    if err != nil {
+        return err
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        var row ExportRow
+        if err := rows.StructScan(&row); err != nil {
+            return err
+        }
+        if err := fn(&row); err != nil {
+            return err
+        }
+    }
+    return rows.Err()
+}
@@ -0,0 +1,108 @@
+package repository
+
+import (
+    "context"
+    "strings"
+    "testing"
+    "time"
+)
+
+func streamExport(t *testing.T, repo *sqliteRepository, afterSeq int64) []ExportRow {
+    t.Helper()
+    ctx := context.Background()
+    upTo, err := repo.GetMaxStatsChangeSeq(ctx)
+    if err != nil {
+        t.Fatalf("max change: %v", err)
+    }
+    var rows []ExportRow
+    err = repo.StreamExportRows(ctx, afterSeq, upTo, func(row *ExportRow) error {
+        rows = append(rows, *row)
+        return nil
+    })
+    if err != nil {
+        t.Fatalf("streaming: %v", err)
+    }
+    return rows
+}
+
+func TestStreamExportRowsReshipsChangedSamples(t *testing.T) {
+    repo := newTestRepository(t)
+    ctx := context.Background()
+    at := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+    addVideo(t, repo, Video{VideoID: "a"})
+    first := addStats(t, repo, "a", at, 100, 10, 1)
+    second := addStats(t, repo, "a", at.Add(time.Hour), 200, 20, 2)
+
+    if rows := streamExport(t, repo, 0); len(rows) != 2 {
+        t.Fatalf("got %d rows, want 2", len(rows))
+    }
+    watermark, _ := repo.GetMaxStatsChangeSeq(ctx)
+
+    if err := repo.TouchVideoStats(ctx, second.ID, at.Add(2*time.Hour)); err != nil {
+        t.Fatalf("touching: %v", err)
+    }
+    if err := repo.FlagVideoStats(ctx, []string{first.ID}); err != nil {
+        t.Fatalf("flagging: %v", err)
+    }
+    rows := streamExport(t, repo, watermark)
+    if len(rows) != 2 {
+        t.Fatalf("got %d changed rows, want 2", len(rows))
+    }
+    for _, row := range rows {
+        if row.ChangeSeq <= watermark {
+            t.Errorf("sample %d kept change %d, want above %d", row.SampleID, row.ChangeSeq, watermark)
+        }
+    }
+    // Rows of a day come in sample order
+    if !rows[0].Flagged || rows[1].LastSeenAt == nil {
+        t.Errorf("got flagged %v and last_seen_at %v, want the updated values", rows[0].Flagged, rows[1].LastSeenAt)
+    }
+}
+
+func TestStreamExportRowsCarriesTags(t *testing.T) {
+    repo := newTestRepository(t)
+    ctx := context.Background()
+    at := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+    addVideo(t, repo, Video{VideoID: "a"})
+    addVideo(t, repo, Video{VideoID: "b"})
+    if err := repo.AddVideoTags(ctx, "a", []string{"summer", "launch, EU"}); err != nil {
+        t.Fatalf("tagging: %v", err)
+    }
+    addStats(t, repo, "a", at, 100, 10, 1)
+    addStats(t, repo, "b", at, 100, 10, 1)
+
+    tags := map[string]string{}
+    for _, row := range streamExport(t, repo, 0) {
+        tags[row.VideoID] = strings.Join(row.Tags, "|")
+    }
+    if tags["a"] != "launch, EU|summer" || tags["b"] != "" {
+        t.Errorf("got %q", tags)
+    }
+}
+
+func TestClaimExportRun(t *testing.T) {
+    repo := newTestRepository(t)
+    ctx := context.Background()
+    stale := time.Now().Add(-time.Hour)
+
+    if ok, err := repo.ClaimExportRun(ctx, "first", stale); err != nil || !ok {
+        t.Fatalf("first claim: %v %v", ok, err)
+    }
+    if ok, _ := repo.ClaimExportRun(ctx, "second", stale); ok {
+        t.Error("second run claimed the export while the first held it")
+    }
+    // A claim older than staleBefore is taken over
+    if ok, _ := repo.ClaimExportRun(ctx, "third", time.Now().Add(time.Minute)); !ok {
+        t.Error("a stale claim was not taken over")
+    }
+    if err := repo.ReleaseExportRun(ctx, "first"); err != nil {
+        t.Fatalf("releasing: %v", err)
+    }
+    if ok, _ := repo.ClaimExportRun(ctx, "fourth", stale); ok {
+        t.Error("releasing a lost claim freed the current one")
+    }
+    repo.ReleaseExportRun(ctx, "third")
+    if ok, _ := repo.ClaimExportRun(ctx, "fourth", stale); !ok {
+        t.Error("the export could not be claimed after release")
+    }
+}
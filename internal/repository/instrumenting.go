@@ -0,0 +1,398 @@
+package repository
+
+import (
+    "context"
+    "strconv"
+    "time"
+
+    "github.com/go-kit/kit/metrics"
+)
+
+// instrumentingRepository observes the latency of every repository call
+type instrumentingRepository struct {
+    next     Repository
+    duration metrics.Histogram
+}
+
+// NewInstrumentingRepository wraps next so the duration of each call is
+// observed in duration, labeled by method and success. The streaming calls
+// include the time spent in their callbacks.
+func NewInstrumentingRepository(next Repository, duration metrics.Histogram) Repository {
+    return &instrumentingRepository{next: next, duration: duration}
+}
+
+// observe is deferred with the call's start; err points at the named result
+// so it is read once the call returned
+func (r *instrumentingRepository) observe(method string, begin time.Time, err *error) {
+    r.duration.With("method", method, "success", strconv.FormatBool(*err == nil)).Observe(time.Since(begin).Seconds())
+}
+
+func (r *instrumentingRepository) CreateVideo(ctx context.Context, video *Video) (err error) {
+    defer r.observe("CreateVideo", time.Now(), &err)
+    return r.next.CreateVideo(ctx, video)
+}
+
+func (r *instrumentingRepository) GetVideo(ctx context.Context, platform, videoID string) (result *Video, err error) {
+    defer r.observe("GetVideo", time.Now(), &err)
+    return r.next.GetVideo(ctx, platform, videoID)
+}
+
+func (r *instrumentingRepository) GetVideoWithUsername(ctx context.Context, platform, videoID, username string) (result *Video, err error) {
+    defer r.observe("GetVideoWithUsername", time.Now(), &err)
+    return r.next.GetVideoWithUsername(ctx, platform, videoID, username)
+}
+
+func (r *instrumentingRepository) GetVideoByVideoID(ctx context.Context, videoID string) (result *Video, err error) {
+    defer r.observe("GetVideoByVideoID", time.Now(), &err)
+    return r.next.GetVideoByVideoID(ctx, videoID)
+}
+
+func (r *instrumentingRepository) GetAllVideos(ctx context.Context) (result []Video, err error) {
+    defer r.observe("GetAllVideos", time.Now(), &err)
+    return r.next.GetAllVideos(ctx)
+}
+
+func (r *instrumentingRepository) GetVideos(ctx context.Context, filter VideoFilter) (result []Video, err error) {
+    defer r.observe("GetVideos", time.Now(), &err)
+    return r.next.GetVideos(ctx, filter)
+}
+
+func (r *instrumentingRepository) UpdateVideoState(ctx context.Context, videoID, state string) (err error) {
+    defer r.observe("UpdateVideoState", time.Now(), &err)
+    return r.next.UpdateVideoState(ctx, videoID, state)
+}
+
+func (r *instrumentingRepository) TransitionVideoState(ctx context.Context, videoID, from, to, reason string, at time.Time) (err error) {
+    defer r.observe("TransitionVideoState", time.Now(), &err)
+    return r.next.TransitionVideoState(ctx, videoID, from, to, reason, at)
+}
+
+func (r *instrumentingRepository) GetVideoStateHistory(ctx context.Context, videoID string) (result []StateTransition, err error) {
+    defer r.observe("GetVideoStateHistory", time.Now(), &err)
+    return r.next.GetVideoStateHistory(ctx, videoID)
+}
+
+func (r *instrumentingRepository) CreateTrackedAccount(ctx context.Context, account *TrackedAccount) (err error) {
+    defer r.observe("CreateTrackedAccount", time.Now(), &err)
+    return r.next.CreateTrackedAccount(ctx, account)
+}
+
+func (r *instrumentingRepository) GetTrackedAccount(ctx context.Context, platform, accountID string) (result *TrackedAccount, err error) {
+    defer r.observe("GetTrackedAccount", time.Now(), &err)
+    return r.next.GetTrackedAccount(ctx, platform, accountID)
+}
+
+func (r *instrumentingRepository) GetTrackedAccounts(ctx context.Context) (result []TrackedAccount, err error) {
+    defer r.observe("GetTrackedAccounts", time.Now(), &err)
+    return r.next.GetTrackedAccounts(ctx)
+}
+
+func (r *instrumentingRepository) GetTrackedAccountByID(ctx context.Context, id string) (result *TrackedAccount, err error) {
+    defer r.observe("GetTrackedAccountByID", time.Now(), &err)
+    return r.next.GetTrackedAccountByID(ctx, id)
+}
+
+func (r *instrumentingRepository) UpdateAccountSyncedAt(ctx context.Context, id string, syncedAt time.Time) (err error) {
+    defer r.observe("UpdateAccountSyncedAt", time.Now(), &err)
+    return r.next.UpdateAccountSyncedAt(ctx, id, syncedAt)
+}
+
+func (r *instrumentingRepository) CreateAccountStats(ctx context.Context, stats *AccountStats) (err error) {
+    defer r.observe("CreateAccountStats", time.Now(), &err)
+    return r.next.CreateAccountStats(ctx, stats)
+}
+
+func (r *instrumentingRepository) GetAccountStats(ctx context.Context, accountID string, from, to time.Time) (result []AccountStats, err error) {
+    defer r.observe("GetAccountStats", time.Now(), &err)
+    return r.next.GetAccountStats(ctx, accountID, from, to)
+}
+
+func (r *instrumentingRepository) GetLatestAccountStats(ctx context.Context, accountID string) (result *AccountStats, err error) {
+    defer r.observe("GetLatestAccountStats", time.Now(), &err)
+    return r.next.GetLatestAccountStats(ctx, accountID)
+}
+
+func (r *instrumentingRepository) CreateVideoStats(ctx context.Context, stats *VideoStats) (err error) {
+    defer r.observe("CreateVideoStats", time.Now(), &err)
+    return r.next.CreateVideoStats(ctx, stats)
+}
+
+func (r *instrumentingRepository) GetVideoStats(ctx context.Context, videoID string, from, to time.Time) (result []VideoStats, err error) {
+    defer r.observe("GetVideoStats", time.Now(), &err)
+    return r.next.GetVideoStats(ctx, videoID, from, to)
+}
+
+func (r *instrumentingRepository) StreamVideoStats(ctx context.Context, videoID string, from, to time.Time, excludeFlagged bool, fn func(*VideoStats) error) (err error) {
+    defer r.observe("StreamVideoStats", time.Now(), &err)
+    return r.next.StreamVideoStats(ctx, videoID, from, to, excludeFlagged, fn)
+}
+
+func (r *instrumentingRepository) GetLatestStats(ctx context.Context, videoID string) (result *VideoStats, err error) {
+    defer r.observe("GetLatestStats", time.Now(), &err)
+    return r.next.GetLatestStats(ctx, videoID)
+}
+
+func (r *instrumentingRepository) TouchVideoStats(ctx context.Context, id string, seenAt time.Time) (err error) {
+    defer r.observe("TouchVideoStats", time.Now(), &err)
+    return r.next.TouchVideoStats(ctx, id, seenAt)
+}
+
+func (r *instrumentingRepository) CreateAlertRule(ctx context.Context, rule *AlertRule) (err error) {
+    defer r.observe("CreateAlertRule", time.Now(), &err)
+    return r.next.CreateAlertRule(ctx, rule)
+}
+
+func (r *instrumentingRepository) GetAlertRules(ctx context.Context) (result []AlertRule, err error) {
+    defer r.observe("GetAlertRules", time.Now(), &err)
+    return r.next.GetAlertRules(ctx)
+}
+
+func (r *instrumentingRepository) DeleteAlertRule(ctx context.Context, id string) (result bool, err error) {
+    defer r.observe("DeleteAlertRule", time.Now(), &err)
+    return r.next.DeleteAlertRule(ctx, id)
+}
+
+func (r *instrumentingRepository) GetFiringAlert(ctx context.Context, ruleID, videoID string) (result *Alert, err error) {
+    defer r.observe("GetFiringAlert", time.Now(), &err)
+    return r.next.GetFiringAlert(ctx, ruleID, videoID)
+}
+
+func (r *instrumentingRepository) CreateAlert(ctx context.Context, alert *Alert) (result bool, err error) {
+    defer r.observe("CreateAlert", time.Now(), &err)
+    return r.next.CreateAlert(ctx, alert)
+}
+
+func (r *instrumentingRepository) ResolveAlert(ctx context.Context, id string, value float64, message string, at time.Time) (err error) {
+    defer r.observe("ResolveAlert", time.Now(), &err)
+    return r.next.ResolveAlert(ctx, id, value, message, at)
+}
+
+func (r *instrumentingRepository) GetAlerts(ctx context.Context, state string, limit int) (result []Alert, err error) {
+    defer r.observe("GetAlerts", time.Now(), &err)
+    return r.next.GetAlerts(ctx, state, limit)
+}
+
+func (r *instrumentingRepository) GetStatsAt(ctx context.Context, videoID string, at time.Time) (result *VideoStats, err error) {
+    defer r.observe("GetStatsAt", time.Now(), &err)
+    return r.next.GetStatsAt(ctx, videoID, at)
+}
+
+func (r *instrumentingRepository) CreateWebhook(ctx context.Context, hook *Webhook) (err error) {
+    defer r.observe("CreateWebhook", time.Now(), &err)
+    return r.next.CreateWebhook(ctx, hook)
+}
+
+func (r *instrumentingRepository) GetWebhook(ctx context.Context, id string) (result *Webhook, err error) {
+    defer r.observe("GetWebhook", time.Now(), &err)
+    return r.next.GetWebhook(ctx, id)
+}
+
+func (r *instrumentingRepository) GetWebhooks(ctx context.Context) (result []Webhook, err error) {
+    defer r.observe("GetWebhooks", time.Now(), &err)
+    return r.next.GetWebhooks(ctx)
+}
+
+func (r *instrumentingRepository) DeleteWebhook(ctx context.Context, id string) (result bool, err error) {
+    defer r.observe("DeleteWebhook", time.Now(), &err)
+    return r.next.DeleteWebhook(ctx, id)
+}
+
+func (r *instrumentingRepository) CreateWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) (err error) {
+    defer r.observe("CreateWebhookDelivery", time.Now(), &err)
+    return r.next.CreateWebhookDelivery(ctx, delivery)
+}
+
+func (r *instrumentingRepository) GetDueWebhookDeliveries(ctx context.Context, now time.Time, limit int) (result []WebhookDelivery, err error) {
+    defer r.observe("GetDueWebhookDeliveries", time.Now(), &err)
+    return r.next.GetDueWebhookDeliveries(ctx, now, limit)
+}
+
+func (r *instrumentingRepository) CountDueWebhookDeliveries(ctx context.Context, now time.Time) (result int, err error) {
+    defer r.observe("CountDueWebhookDeliveries", time.Now(), &err)
+    return r.next.CountDueWebhookDeliveries(ctx, now)
+}
+
+func (r *instrumentingRepository) UpdateWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) (err error) {
+    defer r.observe("UpdateWebhookDelivery", time.Now(), &err)
+    return r.next.UpdateWebhookDelivery(ctx, delivery)
+}
+
+func (r *instrumentingRepository) GetWebhookDeliveries(ctx context.Context, webhookID string, limit int) (result []WebhookDelivery, err error) {
+    defer r.observe("GetWebhookDeliveries", time.Now(), &err)
+    return r.next.GetWebhookDeliveries(ctx, webhookID, limit)
+}
+
+func (r *instrumentingRepository) PurgeWebhookDeliveries(ctx context.Context, before time.Time) (result int64, err error) {
+    defer r.observe("PurgeWebhookDeliveries", time.Now(), &err)
+    return r.next.PurgeWebhookDeliveries(ctx, before)
+}
+
+func (r *instrumentingRepository) SaveVideoMetadata(ctx context.Context, meta *VideoMetadata) (result bool, err error) {
+    defer r.observe("SaveVideoMetadata", time.Now(), &err)
+    return r.next.SaveVideoMetadata(ctx, meta)
+}
+
+func (r *instrumentingRepository) GetLatestVideoMetadata(ctx context.Context, videoID string) (result *VideoMetadata, err error) {
+    defer r.observe("GetLatestVideoMetadata", time.Now(), &err)
+    return r.next.GetLatestVideoMetadata(ctx, videoID)
+}
+
+func (r *instrumentingRepository) GetVideoMetadataAt(ctx context.Context, videoID string, at time.Time) (result *VideoMetadata, err error) {
+    defer r.observe("GetVideoMetadataAt", time.Now(), &err)
+    return r.next.GetVideoMetadataAt(ctx, videoID, at)
+}
+
+func (r *instrumentingRepository) GetVideoMetadataHistory(ctx context.Context, videoID string) (result []VideoMetadata, err error) {
+    defer r.observe("GetVideoMetadataHistory", time.Now(), &err)
+    return r.next.GetVideoMetadataHistory(ctx, videoID)
+}
+
+func (r *instrumentingRepository) GetStatsBuckets(ctx context.Context, videoID string, from, to time.Time, interval, agg string, excludeFlagged bool) (result []StatsBucket, err error) {
+    defer r.observe("GetStatsBuckets", time.Now(), &err)
+    return r.next.GetStatsBuckets(ctx, videoID, from, to, interval, agg, excludeFlagged)
+}
+
+func (r *instrumentingRepository) ApplyRetention(ctx context.Context, policy RetentionPolicy, now time.Time, dryRun bool) (result *RetentionReport, err error) {
+    defer r.observe("ApplyRetention", time.Now(), &err)
+    return r.next.ApplyRetention(ctx, policy, now, dryRun)
+}
+
+func (r *instrumentingRepository) FirstStatsSampleReaching(ctx context.Context, videoID, metric string, threshold int) (result *VideoStats, err error) {
+    defer r.observe("FirstStatsSampleReaching", time.Now(), &err)
+    return r.next.FirstStatsSampleReaching(ctx, videoID, metric, threshold)
+}
+
+func (r *instrumentingRepository) CreateMilestone(ctx context.Context, milestone *VideoMilestone) (result bool, err error) {
+    defer r.observe("CreateMilestone", time.Now(), &err)
+    return r.next.CreateMilestone(ctx, milestone)
+}
+
+func (r *instrumentingRepository) GetMilestones(ctx context.Context, videoID string) (result []VideoMilestone, err error) {
+    defer r.observe("GetMilestones", time.Now(), &err)
+    return r.next.GetMilestones(ctx, videoID)
+}
+
+func (r *instrumentingRepository) CreateAnomaly(ctx context.Context, anomaly *Anomaly) (result bool, err error) {
+    defer r.observe("CreateAnomaly", time.Now(), &err)
+    return r.next.CreateAnomaly(ctx, anomaly)
+}
+
+func (r *instrumentingRepository) GetLatestAnomaly(ctx context.Context, videoID, kind string) (result *Anomaly, err error) {
+    defer r.observe("GetLatestAnomaly", time.Now(), &err)
+    return r.next.GetLatestAnomaly(ctx, videoID, kind)
+}
+
+func (r *instrumentingRepository) GetAnomalies(ctx context.Context, videoID string, limit int) (result []Anomaly, err error) {
+    defer r.observe("GetAnomalies", time.Now(), &err)
+    return r.next.GetAnomalies(ctx, videoID, limit)
+}
+
+func (r *instrumentingRepository) FlagVideoStats(ctx context.Context, ids []string) (err error) {
+    defer r.observe("FlagVideoStats", time.Now(), &err)
+    return r.next.FlagVideoStats(ctx, ids)
+}
+
+func (r *instrumentingRepository) GetLikeRatios(ctx context.Context, platform string, minViews int) (result map[string]float64, err error) {
+    defer r.observe("GetLikeRatios", time.Now(), &err)
+    return r.next.GetLikeRatios(ctx, platform, minViews)
+}
+
+func (r *instrumentingRepository) CreateCampaign(ctx context.Context, campaign *Campaign) (err error) {
+    defer r.observe("CreateCampaign", time.Now(), &err)
+    return r.next.CreateCampaign(ctx, campaign)
+}
+
+func (r *instrumentingRepository) GetCampaign(ctx context.Context, id string) (result *Campaign, err error) {
+    defer r.observe("GetCampaign", time.Now(), &err)
+    return r.next.GetCampaign(ctx, id)
+}
+
+func (r *instrumentingRepository) GetCampaigns(ctx context.Context) (result []Campaign, err error) {
+    defer r.observe("GetCampaigns", time.Now(), &err)
+    return r.next.GetCampaigns(ctx)
+}
+
+func (r *instrumentingRepository) DeleteCampaign(ctx context.Context, id string) (result bool, err error) {
+    defer r.observe("DeleteCampaign", time.Now(), &err)
+    return r.next.DeleteCampaign(ctx, id)
+}
+
+func (r *instrumentingRepository) AddCampaignVideos(ctx context.Context, campaignID string, videoIDs []string) (result int, err error) {
+    defer r.observe("AddCampaignVideos", time.Now(), &err)
+    return r.next.AddCampaignVideos(ctx, campaignID, videoIDs)
+}
+
+func (r *instrumentingRepository) RemoveCampaignVideo(ctx context.Context, campaignID, videoID string) (result bool, err error) {
+    defer r.observe("RemoveCampaignVideo", time.Now(), &err)
+    return r.next.RemoveCampaignVideo(ctx, campaignID, videoID)
+}
+
+func (r *instrumentingRepository) GetCampaignVideos(ctx context.Context, campaignID string) (result []Video, err error) {
+    defer r.observe("GetCampaignVideos", time.Now(), &err)
+    return r.next.GetCampaignVideos(ctx, campaignID)
+}
+
+func (r *instrumentingRepository) AddVideoTags(ctx context.Context, videoID string, tags []string) (err error) {
+    defer r.observe("AddVideoTags", time.Now(), &err)
+    return r.next.AddVideoTags(ctx, videoID, tags)
+}
+
+func (r *instrumentingRepository) RemoveVideoTag(ctx context.Context, videoID, tag string) (result bool, err error) {
+    defer r.observe("RemoveVideoTag", time.Now(), &err)
+    return r.next.RemoveVideoTag(ctx, videoID, tag)
+}
+
+func (r *instrumentingRepository) GetVideoTags(ctx context.Context, videoID string) (result []string, err error) {
+    defer r.observe("GetVideoTags", time.Now(), &err)
+    return r.next.GetVideoTags(ctx, videoID)
+}
+
+func (r *instrumentingRepository) GetTags(ctx context.Context) (result []TagSummary, err error) {
+    defer r.observe("GetTags", time.Now(), &err)
+    return r.next.GetTags(ctx)
+}
+
+func (r *instrumentingRepository) GetVideosByTag(ctx context.Context, tag string) (result []Video, err error) {
+    defer r.observe("GetVideosByTag", time.Now(), &err)
+    return r.next.GetVideosByTag(ctx, tag)
+}
+
+func (r *instrumentingRepository) GetTagStatsBuckets(ctx context.Context, tag string, from, to time.Time, interval, agg string, excludeFlagged bool) (result []TagBucket, err error) {
+    defer r.observe("GetTagStatsBuckets", time.Now(), &err)
+    return r.next.GetTagStatsBuckets(ctx, tag, from, to, interval, agg, excludeFlagged)
+}
+
+func (r *instrumentingRepository) GetLeaderboard(ctx context.Context, query LeaderboardQuery) (result []LeaderboardEntry, err error) {
+    defer r.observe("GetLeaderboard", time.Now(), &err)
+    return r.next.GetLeaderboard(ctx, query)
+}
+
+func (r *instrumentingRepository) GetExportWatermark(ctx context.Context, name string) (result *ExportWatermark, err error) {
+    defer r.observe("GetExportWatermark", time.Now(), &err)
+    return r.next.GetExportWatermark(ctx, name)
+}
+
+func (r *instrumentingRepository) SetExportWatermark(ctx context.Context, watermark *ExportWatermark) (err error) {
+    defer r.observe("SetExportWatermark", time.Now(), &err)
+    return r.next.SetExportWatermark(ctx, watermark)
+}
+
+func (r *instrumentingRepository) GetMaxStatsChangeSeq(ctx context.Context) (result int64, err error) {
+    defer r.observe("GetMaxStatsChangeSeq", time.Now(), &err)
+    return r.next.GetMaxStatsChangeSeq(ctx)
+}
+
+func (r *instrumentingRepository) StreamExportRows(ctx context.Context, afterSeq, upToSeq int64, fn func(*ExportRow) error) (err error) {
+    defer r.observe("StreamExportRows", time.Now(), &err)
+    return r.next.StreamExportRows(ctx, afterSeq, upToSeq, fn)
+}
+
+func (r *instrumentingRepository) ClaimExportRun(ctx context.Context, token string, staleBefore time.Time) (result bool, err error) {
+    defer r.observe("ClaimExportRun", time.Now(), &err)
+    return r.next.ClaimExportRun(ctx, token, staleBefore)
+}
+
+func (r *instrumentingRepository) ReleaseExportRun(ctx context.Context, token string) (err error) {
+    defer r.observe("ReleaseExportRun", time.Now(), &err)
+    return r.next.ReleaseExportRun(ctx, token)
+}
@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// LeaderboardQuery selects and orders videos by their growth of one metric
+// between From and To. Relative ranks by percentage growth instead of the
+// absolute increase; videos starting from 0 have no relative growth and are
+// left out.
+type LeaderboardQuery struct {
+    Metric   string
+    Relative bool
+    From     time.Time
+    To       time.Time
+    Platform string
+    Tag      string
+    MinViews int
+    Limit    int
+}
+
+// LeaderboardEntry is one ranked video. Start is the last sample at or
+// before the window start, or the last rolled up bucket that ended by then
+// once retention removed the raw samples, or the first sample inside the
+// window for videos tracked since then.
+type LeaderboardEntry struct {
+    Rank       int       `db:"rank" json:"rank"`
+    VideoID    string    `db:"video_id" json:"video_id"`
+    Platform   string    `db:"platform" json:"platform"`
+    Username   string    `db:"instagram_username" json:"username,omitempty"`
+    StartAt    time.Time `db:"start_at" json:"start_at"`
+    EndAt      time.Time `db:"end_at" json:"end_at"`
+    StartValue int       `db:"start_value" json:"start_value"`
+    EndValue   int       `db:"end_value" json:"end_value"`
+    Delta      int       `db:"delta" json:"delta"`
+    Growth     *float64  `db:"growth" json:"growth_percent,omitempty"`
+    Views      int       `db:"views" json:"views"`
+}
+
+// GetLeaderboard ranks videos in a single query. Each video's boundary
+// samples and buckets are found through the (video_id, timestamp) and
+// (video_id, bucket) indexes, so the cost grows with the number of videos
+// rather than the number of samples. Flagged samples are ignored. The end
+// of the window is always a raw sample.
+func (r *sqliteRepository) GetLeaderboard(ctx context.Context, q LeaderboardQuery) ([]LeaderboardEntry, error) {
+    if !statsMetricColumns[q.Metric] {
+        return nil, fmt.Errorf("unsupported metric: %s", q.Metric)
+    }
+
+    score := "delta"
+    if q.Relative {
+        score = "growth"
+    }
+
+    // Rollups only hold history older than the raw samples, so they are
+    // consulted when no raw sample precedes the window
+    query := fmt.Sprintf(`
+    WITH bounds AS (
+        SELECT v.video_id, v.platform, COALESCE(v.instagram_username, '') AS instagram_username,
+            (SELECT id FROM video_stats WHERE video_id = v.video_id AND flagged = 0 AND timestamp <= ? ORDER BY timestamp DESC LIMIT 1) AS before_id,
+            (SELECT bucket FROM video_stats_hourly WHERE video_id = v.video_id AND bucket <= ? ORDER BY bucket DESC LIMIT 1) AS hourly_bucket,
+            (SELECT bucket FROM video_stats_daily WHERE video_id = v.video_id AND bucket <= ? ORDER BY bucket DESC LIMIT 1) AS daily_bucket,
+            (SELECT id FROM video_stats WHERE video_id = v.video_id AND flagged = 0 AND timestamp <= ? ORDER BY timestamp LIMIT 1) AS first_id,
+            (SELECT id FROM video_stats WHERE video_id = v.video_id AND flagged = 0 AND timestamp <= ? ORDER BY timestamp DESC LIMIT 1) AS end_id
+        FROM videos v
+        WHERE (? = '' OR v.platform = ?)
+            AND (? = '' OR v.video_id IN (SELECT video_id FROM video_tags WHERE tag = ?))
+    ),
+    starts AS (
+        SELECT b.video_id, s.timestamp AS start_at, s.%[1]s AS start_value, 1 AS preference
+        FROM bounds b JOIN video_stats s ON s.id = b.before_id
+        UNION ALL
+        SELECT b.video_id, h.bucket, h.%[1]s, 2
+        FROM bounds b JOIN video_stats_hourly h ON h.video_id = b.video_id AND h.bucket = b.hourly_bucket
+        UNION ALL
+        SELECT b.video_id, d.bucket, d.%[1]s, 3
+        FROM bounds b JOIN video_stats_daily d ON d.video_id = b.video_id AND d.bucket = b.daily_bucket
+        UNION ALL
+        SELECT b.video_id, f.timestamp, f.%[1]s, 4
+        FROM bounds b JOIN video_stats f ON f.id = b.first_id
+    ),
+    ends AS (
+        SELECT b.video_id, b.platform, b.instagram_username, s.start_at, s.start_value,
+            e.timestamp AS end_at, e.%[1]s AS end_value, e.views AS views
+        FROM bounds b
+        JOIN video_stats e ON e.id = b.end_id
+        JOIN (
+            SELECT video_id, start_at, start_value,
+                ROW_NUMBER() OVER (PARTITION BY video_id ORDER BY preference) AS preferred
+            FROM starts
+        ) s ON s.video_id = b.video_id AND s.preferred = 1
+        WHERE e.timestamp >= ? AND e.views >= ?
+    ),
+    growth AS (
+        SELECT video_id, platform, instagram_username, start_at, end_at, start_value, end_value,
+            end_value - start_value AS delta,
+            CASE WHEN start_value > 0 THEN (end_value - start_value) * 100.0 / start_value END AS growth,
+            views
+        FROM ends
+    )
+    SELECT ROW_NUMBER() OVER (ORDER BY %[2]s DESC, video_id) AS rank, *
+    FROM growth
+    WHERE %[2]s IS NOT NULL
+    ORDER BY rank
+    LIMIT ?`, q.Metric, score)
+
+    from, to := q.From.UTC(), q.To.UTC()
+    var entries []LeaderboardEntry
+    err := r.db.SelectContext(ctx, &entries, query,
+        from, from.Add(-time.Hour), from.AddDate(0, 0, -1), to, to,
+        q.Platform, q.Platform, q.Tag, q.Tag,
+        from, q.MinViews, q.Limit)
+    return entries, err
+}
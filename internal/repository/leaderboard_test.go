@@ -0,0 +1,138 @@
+package repository
+
+import (
+    "context"
+    "testing"
+    "time"
+)
+
+func TestGetLeaderboard(t *testing.T) {
+    ctx := context.Background()
+    repo := newTestRepository(t)
+    to := time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC)
+    from := to.Add(-24 * time.Hour)
+
+    addVideo(t, repo, Video{VideoID: "steady"})
+    addStats(t, repo, "steady", from.Add(-time.Hour), 1000, 10, 0)
+    addStats(t, repo, "steady", from.Add(12*time.Hour), 1300, 12, 0)
+    addStats(t, repo, "steady", to.Add(-time.Hour), 1600, 20, 0)
+    addStats(t, repo, "steady", to.Add(time.Hour), 9000, 90, 0) // after the window
+
+    // Tracked since the middle of the window
+    addVideo(t, repo, Video{VideoID: "new", Platform: PlatformInstagram, InstagramUsername: "blue.bottle"})
+    addStats(t, repo, "new", from.Add(6*time.Hour), 200, 1, 0)
+    addStats(t, repo, "new", to.Add(-2*time.Hour), 1000, 5, 0)
+
+    // A flagged spike at the end of the window is ignored
+    addVideo(t, repo, Video{VideoID: "botted"})
+    addStats(t, repo, "botted", from.Add(-time.Hour), 500, 5, 0)
+    addStats(t, repo, "botted", from.Add(10*time.Hour), 550, 5, 0)
+    spike := addStats(t, repo, "botted", to.Add(-time.Minute), 90000, 5, 0)
+    if err := repo.FlagVideoStats(ctx, []string{spike.ID}); err != nil {
+        t.Fatal(err)
+    }
+
+    // No samples in the window
+    addVideo(t, repo, Video{VideoID: "stale"})
+    addStats(t, repo, "stale", from.Add(-48*time.Hour), 100, 1, 0)
+
+    if err := repo.AddVideoTags(ctx, "new", []string{"launch"}); err != nil {
+        t.Fatal(err)
+    }
+
+    tests := []struct {
+        name   string
+        query  LeaderboardQuery
+        videos []string
+        deltas []int
+    }{
+        {"absolute", LeaderboardQuery{Metric: "views"}, []string{"new", "steady", "botted"}, []int{800, 600, 50}},
+        {"relative", LeaderboardQuery{Metric: "views", Relative: true}, []string{"new", "steady", "botted"}, []int{800, 600, 50}},
+        {"likes", LeaderboardQuery{Metric: "likes"}, []string{"steady", "new", "botted"}, []int{10, 4, 0}},
+        {"min views", LeaderboardQuery{Metric: "views", MinViews: 1500}, []string{"steady"}, []int{600}},
+        {"platform", LeaderboardQuery{Metric: "views", Platform: PlatformYouTube}, []string{"steady", "botted"}, []int{600, 50}},
+        {"tag", LeaderboardQuery{Metric: "views", Tag: "launch"}, []string{"new"}, []int{800}},
+        {"limit", LeaderboardQuery{Metric: "views", Limit: 1}, []string{"new"}, []int{800}},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            q := tt.query
+            q.From, q.To = from, to
+            if q.Limit == 0 {
+                q.Limit = 10
+            }
+            entries, err := repo.GetLeaderboard(ctx, q)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if len(entries) != len(tt.videos) {
+                t.Fatalf("got %d entries %+v, want %v", len(entries), entries, tt.videos)
+            }
+            for i, e := range entries {
+                if e.Rank != i+1 || e.VideoID != tt.videos[i] || e.Delta != tt.deltas[i] {
+                    t.Errorf("entry %d = #%d %s delta %d, want #%d %s delta %d", i, e.Rank, e.VideoID, e.Delta, i+1, tt.videos[i], tt.deltas[i])
+                }
+            }
+        })
+    }
+
+    entries, err := repo.GetLeaderboard(ctx, LeaderboardQuery{Metric: "views", Relative: true, From: from, To: to, Limit: 10})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if g := entries[0].Growth; g == nil || *g != 400 {
+        t.Errorf("growth of new = %v, want 400%%", g)
+    }
+    if !entries[1].StartAt.Equal(from.Add(-time.Hour)) || !entries[1].EndAt.Equal(to.Add(-time.Hour)) {
+        t.Errorf("steady measured from %s to %s", entries[1].StartAt, entries[1].EndAt)
+    }
+}
+
+func TestGetLeaderboardStartsFromRollups(t *testing.T) {
+    ctx := context.Background()
+    repo := newTestRepository(t)
+    now := time.Date(2025, 6, 10, 12, 30, 0, 0, time.UTC)
+    to := now
+    from := to.Add(-7 * 24 * time.Hour)
+    hour := from.Add(-5 * time.Hour).Truncate(time.Hour)
+    day := from.Add(-3 * 24 * time.Hour).Truncate(24 * time.Hour)
+
+    addVideo(t, repo, Video{VideoID: "hourly"})
+    addStats(t, repo, "hourly", hour.Add(20*time.Minute), 400, 0, 0)
+    addStats(t, repo, "hourly", to.Add(-time.Hour), 1000, 0, 0)
+
+    addVideo(t, repo, Video{VideoID: "daily"})
+    addStats(t, repo, "daily", day.Add(2*time.Hour), 100, 0, 0)
+    addStats(t, repo, "daily", to.Add(-time.Hour), 1000, 0, 0)
+
+    policy := RetentionPolicy{RawFor: 24 * time.Hour, HourlyFor: 9 * 24 * time.Hour}
+    if _, err := repo.ApplyRetention(ctx, policy, now, false); err != nil {
+        t.Fatal(err)
+    }
+    if countRows(t, repo, "video_stats_hourly") != 1 || countRows(t, repo, "video_stats_daily") != 1 {
+        t.Fatalf("retention left %d hourly and %d daily buckets, want one each",
+            countRows(t, repo, "video_stats_hourly"), countRows(t, repo, "video_stats_daily"))
+    }
+
+    entries, err := repo.GetLeaderboard(ctx, LeaderboardQuery{Metric: "views", From: from, To: to, Limit: 10})
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := map[string]struct {
+        start time.Time
+        delta int
+    }{
+        "daily":  {day, 900},
+        "hourly": {hour, 600},
+    }
+    if len(entries) != len(want) {
+        t.Fatalf("got %d entries %+v, want %d", len(entries), entries, len(want))
+    }
+    for _, e := range entries {
+        w := want[e.VideoID]
+        if e.Delta != w.delta || !e.StartAt.Equal(w.start) {
+            t.Errorf("%s: delta %d from %s, want %d from %s", e.VideoID, e.Delta, e.StartAt, w.delta, w.start)
+        }
+    }
+}
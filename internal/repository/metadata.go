@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func createMetadataTable(db *sqlx.DB) error {
+    _, err := db.Exec(`
+    CREATE TABLE IF NOT EXISTS video_metadata (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        video_id VARCHAR(100) NOT NULL,
+        version INTEGER NOT NULL,
+        caption TEXT NOT NULL DEFAULT '',
+        permalink TEXT NOT NULL DEFAULT '',
+        media_type TEXT NOT NULL DEFAULT '',
+        media_url TEXT NOT NULL DEFAULT '',
+        recorded_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        UNIQUE(video_id, version)
+    )`)
+    return err
+}
+
+// SaveVideoMetadata stores meta as a new version unless it matches the
+// latest one. It reports whether a version was written.
+func (r *sqliteRepository) SaveVideoMetadata(ctx context.Context, meta *VideoMetadata) (bool, error) {
+    latest, err := r.GetLatestVideoMetadata(ctx, meta.VideoID)
+    if err != nil {
+        return false, err
+    }
+    if latest != nil && latest.SameContent(meta) {
+        return false, nil
+    }
+
+    meta.Version = 1
+    if latest != nil {
+        meta.Version = latest.Version + 1
+    }
+
+    query := `
+    INSERT INTO video_metadata (video_id, version, caption, permalink, media_type, media_url, recorded_at)
+    VALUES (?, ?, ?, ?, ?, ?, ?)`
+
+    result, err := r.db.ExecContext(ctx, query, meta.VideoID, meta.Version, meta.Caption,
+        meta.Permalink, meta.MediaType, meta.MediaURL, meta.RecordedAt.UTC())
+    if err != nil {
+        return false, err
+    }
+
+    id, err := result.LastInsertId()
+    if err != nil {
+        return false, err
+    }
+
+    meta.ID = fmt.Sprintf("%d", id)
+    return true, nil
+}
+
+func (r *sqliteRepository) GetLatestVideoMetadata(ctx context.Context, videoID string) (*VideoMetadata, error) {
+    var meta VideoMetadata
+    query := `SELECT * FROM video_metadata WHERE video_id = ? ORDER BY version DESC LIMIT 1`
+    err := r.db.GetContext(ctx, &meta, query, videoID)
+    if err == sql.ErrNoRows {
+        return nil, nil
+    }
+    return &meta, err
+}
+
+// GetVideoMetadataAt returns the version that was current at the given time
+func (r *sqliteRepository) GetVideoMetadataAt(ctx context.Context, videoID string, at time.Time) (*VideoMetadata, error) {
+    var meta VideoMetadata
+    query := `SELECT * FROM video_metadata WHERE video_id = ? AND recorded_at <= ? ORDER BY version DESC LIMIT 1`
+    err := r.db.GetContext(ctx, &meta, query, videoID, at.UTC())
+    if err == sql.ErrNoRows {
+        return nil, nil
+    }
+    return &meta, err
+}
+
+func (r *sqliteRepository) GetVideoMetadataHistory(ctx context.Context, videoID string) ([]VideoMetadata, error) {
+    var history []VideoMetadata
+    query := `SELECT * FROM video_metadata WHERE video_id = ? ORDER BY version`
+    err := r.db.SelectContext(ctx, &history, query, videoID)
+    return history, err
+}
+
+// moveStatsMetadata backfills video_metadata from the caption, permalink,
+// media_type and media_url columns of video_stats, recording a version each
+// time the values changed, and then drops those columns
+func moveStatsMetadata(db *sqlx.DB) error {
+    var columns []struct {
+        Name string `db:"name"`
+    }
+    if err := db.Select(&columns, `SELECT name FROM pragma_table_info('video_stats')`); err != nil {
+        return err
+    }
+    hasMetadata := false
+    for _, c := range columns {
+        if c.Name == "caption" {
+            hasMetadata = true
+        }
+    }
+    if !hasMetadata {
+        return nil
+    }
+
+    tx, err := db.Beginx()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    var rows []struct {
+        VideoID   string         `db:"video_id"`
+        Timestamp time.Time      `db:"timestamp"`
+        Caption   sql.NullString `db:"caption"`
+        Permalink sql.NullString `db:"permalink"`
+        MediaType sql.NullString `db:"media_type"`
+        MediaURL  sql.NullString `db:"media_url"`
+    }
+    err = tx.Select(&rows, `
+    SELECT video_id, timestamp, caption, permalink, media_type, media_url
+    FROM video_stats
+    WHERE caption IS NOT NULL OR permalink IS NOT NULL OR media_type IS NOT NULL OR media_url IS NOT NULL
+    ORDER BY video_id, timestamp`)
+    if err != nil {
+        return err
+    }
+
+    var latest *VideoMetadata
+    for _, row := range rows {
+        meta := &VideoMetadata{
+            VideoID:    row.VideoID,
+            Caption:    row.Caption.String,
+            Permalink:  row.Permalink.String,
+            MediaType:  row.MediaType.String,
+            MediaURL:   row.MediaURL.String,
+            RecordedAt: row.Timestamp,
+        }
+        if latest != nil && latest.VideoID == meta.VideoID && latest.SameContent(meta) {
+            continue
+        }
+
+        meta.Version = 1
+        if latest != nil && latest.VideoID == meta.VideoID {
+            meta.Version = latest.Version + 1
+        }
+        _, err := tx.Exec(`
+        INSERT INTO video_metadata (video_id, version, caption, permalink, media_type, media_url, recorded_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?)`,
+            meta.VideoID, meta.Version, meta.Caption, meta.Permalink, meta.MediaType, meta.MediaURL, meta.RecordedAt.UTC())
+        if err != nil {
+            return err
+        }
+        latest = meta
+    }
+
+    for _, column := range []string{"caption", "permalink", "media_type", "media_url"} {
+        if _, err := tx.Exec(`ALTER TABLE video_stats DROP COLUMN ` + column); err != nil {
+            return err
+        }
+    }
+    return tx.Commit()
+}
@@ -0,0 +1,131 @@
+package repository
+
+import (
+    "context"
+    "testing"
+    "time"
+)
+
+func TestMoveStatsMetadata(t *testing.T) {
+    repo := newTestRepository(t)
+    ctx := context.Background()
+    start := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+
+    // Recreate the columns older databases kept in every stats row
+    for _, column := range []string{"caption", "permalink", "media_type", "media_url"} {
+        if _, err := repo.db.Exec(`ALTER TABLE video_stats ADD COLUMN ` + column + ` TEXT`); err != nil {
+            t.Fatal(err)
+        }
+    }
+    reel := addVideo(t, repo, Video{Platform: PlatformInstagram, VideoID: "1784", InstagramUsername: "bluebottle"})
+    clip := addVideo(t, repo, Video{VideoID: "dQw4w9WgXcQ"})
+    legacy := []struct {
+        video, caption, permalink string
+        at                        time.Time
+    }{
+        {reel.ID, "Morning pour", "https://www.instagram.com/p/Cx1/", start},
+        {reel.ID, "Morning pour", "https://www.instagram.com/p/Cx1/", start.Add(time.Hour)},
+        {reel.ID, "Morning pour over", "https://www.instagram.com/p/Cx1/", start.Add(2 * time.Hour)},
+        {reel.ID, "", "", start.Add(3 * time.Hour)},
+        {clip.ID, "", "", start},
+    }
+    for _, row := range legacy {
+        stats := addStats(t, repo, row.video, row.at, 100, 10, 1)
+        if row.caption == "" {
+            continue
+        }
+        _, err := repo.db.Exec(`UPDATE video_stats SET caption = ?, permalink = ?, media_type = 'VIDEO' WHERE id = ?`,
+            row.caption, row.permalink, stats.ID)
+        if err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    if err := moveStatsMetadata(repo.db); err != nil {
+        t.Fatal(err)
+    }
+
+    // A version is kept for each change, recorded at the sample carrying it
+    history, err := repo.GetVideoMetadataHistory(ctx, reel.ID)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(history) != 2 {
+        t.Fatalf("got %d versions, want 2: %+v", len(history), history)
+    }
+    for i, want := range []struct {
+        caption string
+        at      time.Time
+    }{{"Morning pour", start}, {"Morning pour over", start.Add(2 * time.Hour)}} {
+        meta := history[i]
+        if meta.Version != i+1 || meta.Caption != want.caption || !meta.RecordedAt.Equal(want.at) ||
+            meta.Permalink != "https://www.instagram.com/p/Cx1/" || meta.MediaType != "VIDEO" {
+            t.Errorf("version %d = %+v, want %q at %v", i+1, meta, want.caption, want.at)
+        }
+    }
+    if history, _ := repo.GetVideoMetadataHistory(ctx, clip.ID); len(history) != 0 {
+        t.Errorf("got %+v for a video without metadata", history)
+    }
+
+    if n := countRows(t, repo, "video_stats"); n != len(legacy) {
+        t.Errorf("got %d stats rows, want all %d kept", n, len(legacy))
+    }
+    var columns int
+    if err := repo.db.Get(&columns, `SELECT COUNT(*) FROM pragma_table_info('video_stats') WHERE name = 'caption'`); err != nil {
+        t.Fatal(err)
+    }
+    if columns != 0 {
+        t.Error("caption column not dropped")
+    }
+
+    // Running it again finds nothing to move
+    if err := moveStatsMetadata(repo.db); err != nil {
+        t.Fatal(err)
+    }
+    if history, _ := repo.GetVideoMetadataHistory(ctx, reel.ID); len(history) != 2 {
+        t.Errorf("got %d versions after a second run, want 2", len(history))
+    }
+}
+
+func TestSaveVideoMetadata(t *testing.T) {
+    repo := newTestRepository(t)
+    ctx := context.Background()
+    start := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+    video := addVideo(t, repo, Video{Platform: PlatformInstagram, VideoID: "1784", InstagramUsername: "bluebottle"})
+
+    save := func(caption string, at time.Time) bool {
+        t.Helper()
+        written, err := repo.SaveVideoMetadata(ctx, &VideoMetadata{VideoID: video.ID, Caption: caption, MediaType: "VIDEO", RecordedAt: at})
+        if err != nil {
+            t.Fatal(err)
+        }
+        return written
+    }
+
+    if !save("Morning pour", start) {
+        t.Error("first version not written")
+    }
+    if save("Morning pour", start.Add(time.Hour)) {
+        t.Error("unchanged metadata written as a new version")
+    }
+    if !save("Morning pour over", start.Add(2*time.Hour)) {
+        t.Error("edited caption not written")
+    }
+
+    history, err := repo.GetVideoMetadataHistory(ctx, video.ID)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(history) != 2 || history[0].Version != 1 || history[1].Version != 2 {
+        t.Fatalf("history = %+v, want versions 1 and 2", history)
+    }
+
+    // The unchanged save leaves the first version current until the edit
+    meta, err := repo.GetVideoMetadataAt(ctx, video.ID, start.Add(90*time.Minute))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if meta == nil || meta.Version != 1 || !meta.RecordedAt.Equal(start) {
+        t.Errorf("version at 01:30 = %+v, want version 1 recorded at %v", meta, start)
+    }
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// VideoMilestone records when a video first crossed a threshold. SampleID
+// and SampledAt identify the first poll at or above the threshold;
+// ReachedAt is interpolated between that poll and the one before it.
+type VideoMilestone struct {
+    ID             string    `db:"id" json:"id"`
+    VideoID        string    `db:"video_id" json:"video_id"`
+    Metric         string    `db:"metric" json:"metric"`
+    Threshold      int       `db:"threshold" json:"threshold"`
+    Value          int       `db:"value" json:"value"`
+    SampleID       string    `db:"sample_id" json:"sample_id"`
+    SampledAt      time.Time `db:"sampled_at" json:"sampled_at"`
+    ReachedAt      time.Time `db:"reached_at" json:"reached_at"`
+    Elapsed        string    `db:"-" json:"elapsed,omitempty"`
+    ElapsedSeconds int64     `db:"-" json:"elapsed_seconds,omitempty"`
+}
+
+func createMilestonesTable(db *sqlx.DB) error {
+    _, err := db.Exec(`
+    CREATE TABLE IF NOT EXISTS video_milestones (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        video_id VARCHAR(100) NOT NULL,
+        metric VARCHAR(20) NOT NULL,
+        threshold INTEGER NOT NULL,
+        value INTEGER NOT NULL DEFAULT 0,
+        sample_id VARCHAR(100) NOT NULL DEFAULT '',
+        sampled_at DATETIME NOT NULL,
+        reached_at DATETIME NOT NULL,
+        UNIQUE(video_id, metric, threshold)
+    )`)
+    return err
+}
+
+// CreateMilestone stores a milestone unless it was already recorded, and
+// reports whether it was new
+func (r *sqliteRepository) CreateMilestone(ctx context.Context, milestone *VideoMilestone) (bool, error) {
+    query := `
+    INSERT INTO video_milestones (video_id, metric, threshold, value, sample_id, sampled_at, reached_at)
+    VALUES (?, ?, ?, ?, ?, ?, ?)`
+
+    result, err := r.db.ExecContext(ctx, query, milestone.VideoID, milestone.Metric, milestone.Threshold,
+        milestone.Value, milestone.SampleID, milestone.SampledAt.UTC(), milestone.ReachedAt.UTC())
+    if IsUniqueViolation(err) {
+        return false, nil
+    }
+    if err != nil {
+        return false, err
+    }
+
+    id, err := result.LastInsertId()
+    if err != nil {
+        return false, err
+    }
+
+    milestone.ID = fmt.Sprintf("%d", id)
+    return true, nil
+}
+
+func (r *sqliteRepository) GetMilestones(ctx context.Context, videoID string) ([]VideoMilestone, error) {
+    var milestones []VideoMilestone
+    query := `SELECT * FROM video_milestones WHERE video_id = ? ORDER BY metric DESC, threshold`
+    err := r.db.SelectContext(ctx, &milestones, query, videoID)
+    return milestones, err
+}
+
+// FirstStatsSampleReaching returns the first sample whose metric is at or
+// above threshold, or nil if it was never reached. Rolled up history is
+// searched too; a bucket has no sample ID.
+func (r *sqliteRepository) FirstStatsSampleReaching(ctx context.Context, videoID, metric string, threshold int) (*VideoStats, error) {
+    if !statsMetricColumns[metric] {
+        return nil, fmt.Errorf("unsupported metric: %s", metric)
+    }
+
+    var stats []VideoStats
+    where := fmt.Sprintf(`AND %s >= ?`, metric)
+    query := `SELECT * FROM (` + withRollups(
+        `SELECT `+statsColumns+` FROM video_stats WHERE video_id = ? AND flagged = 0 `+where, where, where,
+    ) + `) ORDER BY timestamp LIMIT 1`
+    if err := r.db.SelectContext(ctx, &stats, query, videoID, threshold, videoID, threshold, videoID, threshold); err != nil || len(stats) == 0 {
+        return nil, err
+    }
+    return &stats[0], nil
+}
@@ -1,7 +1,6 @@
 package repository
 
 import (
-	"database/sql"
 	"time"
 )
 
@@ -13,7 +12,36 @@ type Video struct {
     InstagramUsername string `db:"instagram_username" json:"instagram_username,omitempty"`
     State     string    `db:"state" json:"state"`
     CreatedAt time.Time `db:"created_at" json:"created_at"`
-    Tag       string    `db:"tag" json:"tag,omitempty"`
+    // Tag is the tag given at registration and is not kept in sync with
+    // later changes, so only Tags, the current set, is returned
+    Tag       string    `db:"tag" json:"-"`
+    Tags      []string  `db:"-" json:"tags,omitempty"`
+    AccountID   string     `db:"account_id" json:"account_id,omitempty"`
+    PublishedAt *time.Time `db:"published_at" json:"published_at,omitempty"`
+}
+
+// VideoFilter narrows a video listing; empty fields match everything
+type VideoFilter struct {
+    Platform  string
+    Tag       string
+    AccountID string
+    State     string
+}
+
+// TrackedAccount is a channel or account whose new uploads are registered
+// automatically
+type TrackedAccount struct {
+    ID                string     `db:"id" json:"id"`
+    Platform          string     `db:"platform" json:"platform"`
+    AccountID         string     `db:"account_id" json:"account_id"`
+    Handle            string     `db:"handle" json:"handle,omitempty"`
+    Title             string     `db:"title" json:"title,omitempty"`
+    UploadsPlaylistID string     `db:"uploads_playlist_id" json:"uploads_playlist_id,omitempty"`
+    Tag               string     `db:"tag" json:"tag,omitempty"`
+    MediaType         string     `db:"media_type" json:"media_type,omitempty"`
+    State             string     `db:"state" json:"state"`
+    CreatedAt         time.Time  `db:"created_at" json:"created_at"`
+    LastSyncedAt      *time.Time `db:"last_synced_at" json:"last_synced_at,omitempty"`
 }
 
 // VideoStats represents hourly stats for a video
@@ -24,10 +52,41 @@ type VideoStats struct {
     Views     int       `db:"views" json:"views"`
     Likes     int       `db:"likes" json:"likes"`
     Comments    int       `db:"comments" json:"comments"`
-    Caption     sql.NullString    `db:"caption" json:"caption,omitempty"`
-    Permalink   sql.NullString    `db:"permalink" json:"permalink,omitempty"`
-    MediaType   sql.NullString    `db:"media_type" json:"media_type,omitempty"`
-    MediaURL    sql.NullString    `db:"media_url" json:"media_url,omitempty"`
+    // LastSeenAt is set in change-only storage mode when later polls
+    // returned the same counts
+    LastSeenAt *time.Time `db:"last_seen_at" json:"last_seen_at,omitempty"`
+    // Flagged samples were marked suspicious by the anomaly detector
+    Flagged bool `db:"flagged" json:"flagged,omitempty"`
+}
+
+// VideoMetadata is one version of a video's descriptive fields. A new
+// version is recorded only when one of the fields changes.
+type VideoMetadata struct {
+    ID         string    `db:"id" json:"id"`
+    VideoID    string    `db:"video_id" json:"video_id"`
+    Version    int       `db:"version" json:"version"`
+    Caption    string    `db:"caption" json:"caption,omitempty"`
+    Permalink  string    `db:"permalink" json:"permalink,omitempty"`
+    MediaType  string    `db:"media_type" json:"media_type,omitempty"`
+    MediaURL   string    `db:"media_url" json:"media_url,omitempty"`
+    RecordedAt time.Time `db:"recorded_at" json:"recorded_at"`
+}
+
+// SameContent reports whether two versions carry identical fields
+func (m *VideoMetadata) SameContent(other *VideoMetadata) bool {
+    return m.Caption == other.Caption && m.Permalink == other.Permalink &&
+        m.MediaType == other.MediaType && m.MediaURL == other.MediaURL
+}
+
+// AccountStats is a snapshot of audience metrics for a tracked account.
+// Views is the channel's lifetime views and stays 0 for Instagram.
+type AccountStats struct {
+    ID         string    `db:"id" json:"id"`
+    AccountID  string    `db:"account_id" json:"account_id"`
+    Timestamp  time.Time `db:"timestamp" json:"timestamp"`
+    Followers  int       `db:"followers" json:"followers"`
+    MediaCount int       `db:"media_count" json:"media_count"`
+    Views      int       `db:"views" json:"views"`
 }
 
 // Platform types
@@ -41,4 +100,17 @@ const (
     StateRegistered = "registered"
     StateArchived   = "archived"
     StateError      = "error"
-)
\ No newline at end of file
+    StateDeleted     = "deleted"     // removed from the platform; no longer polled
+    StatePrivate     = "private"     // hidden by its owner; rechecked occasionally
+    StateUnavailable = "unavailable" // transient failure; retried with backoff
+)
+
+// StateTransition is one entry of a video's state history
+type StateTransition struct {
+    ID        string    `db:"id" json:"id"`
+    VideoID   string    `db:"video_id" json:"video_id"`
+    FromState string    `db:"from_state" json:"from"`
+    ToState   string    `db:"to_state" json:"to"`
+    Reason    string    `db:"reason" json:"reason"`
+    ChangedAt time.Time `db:"changed_at" json:"at"`
+}
\ No newline at end of file
@@ -0,0 +1,159 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// RetentionPolicy controls how long stats are kept at each resolution.
+// A zero duration disables that step.
+type RetentionPolicy struct {
+    RawFor    time.Duration `json:"raw_for"`    // raw samples older than this are rolled into hourly buckets
+    HourlyFor time.Duration `json:"hourly_for"` // hourly buckets older than this are rolled into daily buckets
+    Horizon   time.Duration `json:"horizon"`    // daily buckets older than this are purged
+}
+
+// RetentionReport lists the rows a retention run affected, or would affect
+// on a dry run
+type RetentionReport struct {
+    DryRun          bool       `json:"dry_run"`
+    RawCutoff       *time.Time `json:"raw_cutoff,omitempty"`
+    HourlyCutoff    *time.Time `json:"hourly_cutoff,omitempty"`
+    HorizonCutoff   *time.Time `json:"horizon_cutoff,omitempty"`
+    RawRolledUp     int64      `json:"raw_rolled_up"`
+    HourlyWritten   int64      `json:"hourly_written"`
+    HourlyRolledUp  int64      `json:"hourly_rolled_up"`
+    DailyWritten    int64      `json:"daily_written"`
+    DailyPurged     int64      `json:"daily_purged"`
+}
+
+func createRollupTables(db *sqlx.DB) error {
+    for _, table := range []string{"video_stats_hourly", "video_stats_daily"} {
+        _, err := db.Exec(`
+        CREATE TABLE IF NOT EXISTS ` + table + ` (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            video_id VARCHAR(100) NOT NULL,
+            bucket DATETIME NOT NULL,
+            samples INTEGER NOT NULL DEFAULT 0,
+            views INTEGER NOT NULL DEFAULT 0,
+            likes INTEGER NOT NULL DEFAULT 0,
+            comments INTEGER NOT NULL DEFAULT 0,
+            UNIQUE(video_id, bucket)
+        )`)
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// rollupQuery folds the rows of source older than the cutoff and matching
+// filter into target, keeping the last value of each bucket. Buckets are
+// written in the same UTC format the driver uses for times so they compare
+// correctly.
+func rollupQuery(source, timeColumn, samplesExpr, bucketFormat, target, filter string) string {
+    bucket := `strftime('` + bucketFormat + `', ` + timeColumn + `)`
+    return `
+    WITH ranked AS (
+        SELECT video_id, ` + bucket + ` AS bucket, ` + samplesExpr + ` AS samples, views, likes, comments,
+            ROW_NUMBER() OVER (PARTITION BY video_id, ` + bucket + ` ORDER BY ` + timeColumn + ` DESC) AS last_rank
+        FROM ` + source + `
+        WHERE ` + timeColumn + ` < ? ` + filter + `
+    )
+    INSERT INTO ` + target + ` (video_id, bucket, samples, views, likes, comments)
+    SELECT video_id, bucket, SUM(samples),
+        MAX(CASE WHEN last_rank = 1 THEN views END),
+        MAX(CASE WHEN last_rank = 1 THEN likes END),
+        MAX(CASE WHEN last_rank = 1 THEN comments END)
+    FROM ranked
+    WHERE true
+    GROUP BY video_id, bucket
+    ON CONFLICT(video_id, bucket) DO UPDATE SET
+        samples = samples + excluded.samples,
+        views = excluded.views,
+        likes = excluded.likes,
+        comments = excluded.comments`
+}
+
+// withRollups extends a query on a video's raw samples with its hourly and
+// daily buckets, which stand in for the samples retention rolled up. A
+// bucket carries the last counts seen in it and is timestamped with its
+// start; hourlyWhere and dailyWhere filter the bucket tables.
+func withRollups(rawQuery, hourlyWhere, dailyWhere string) string {
+    return rawQuery + `
+    UNION ALL
+    SELECT '' AS id, video_id, bucket AS timestamp, views, likes, comments, NULL AS last_seen_at, 0 AS flagged
+    FROM video_stats_hourly WHERE video_id = ? ` + hourlyWhere + `
+    UNION ALL
+    SELECT '', video_id, bucket, views, likes, comments, NULL, 0
+    FROM video_stats_daily WHERE video_id = ? ` + dailyWhere
+}
+
+// statsColumns are the columns of video_stats in the order withRollups
+// selects them
+const statsColumns = `id, video_id, timestamp, views, likes, comments, last_seen_at, flagged`
+
+// ApplyRetention rolls raw samples into hourly buckets, hourly buckets into
+// daily buckets and purges daily buckets beyond the horizon. Everything runs
+// in one transaction; a dry run rolls it back and only reports the counts.
+func (r *sqliteRepository) ApplyRetention(ctx context.Context, policy RetentionPolicy, now time.Time, dryRun bool) (*RetentionReport, error) {
+    report := &RetentionReport{DryRun: dryRun}
+    now = now.UTC()
+
+    tx, err := r.db.BeginTxx(ctx, nil)
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    exec := func(query string, args ...interface{}) (int64, error) {
+        result, err := tx.ExecContext(ctx, query, args...)
+        if err != nil {
+            return 0, err
+        }
+        return result.RowsAffected()
+    }
+
+    if policy.RawFor > 0 {
+        // Only complete hours are rolled up
+        cutoff := now.Add(-policy.RawFor).Truncate(time.Hour)
+        report.RawCutoff = &cutoff
+
+        if report.HourlyWritten, err = exec(rollupQuery("video_stats", "timestamp", "1", "%Y-%m-%d %H:00:00+00:00", "video_stats_hourly", "AND flagged = 0"), cutoff); err != nil {
+            return nil, err
+        }
+        if report.RawRolledUp, err = exec(`DELETE FROM video_stats WHERE timestamp < ?`, cutoff); err != nil {
+            return nil, err
+        }
+    }
+
+    if policy.HourlyFor > 0 {
+        // Only complete days are rolled up
+        cutoff := now.Add(-policy.HourlyFor)
+        cutoff = time.Date(cutoff.Year(), cutoff.Month(), cutoff.Day(), 0, 0, 0, 0, time.UTC)
+        report.HourlyCutoff = &cutoff
+
+        if report.DailyWritten, err = exec(rollupQuery("video_stats_hourly", "bucket", "samples", "%Y-%m-%d 00:00:00+00:00", "video_stats_daily", ""), cutoff); err != nil {
+            return nil, err
+        }
+        if report.HourlyRolledUp, err = exec(`DELETE FROM video_stats_hourly WHERE bucket < ?`, cutoff); err != nil {
+            return nil, err
+        }
+    }
+
+    if policy.Horizon > 0 {
+        cutoff := now.Add(-policy.Horizon)
+        report.HorizonCutoff = &cutoff
+
+        if report.DailyPurged, err = exec(`DELETE FROM video_stats_daily WHERE bucket < ?`, cutoff); err != nil {
+            return nil, err
+        }
+    }
+
+    if dryRun {
+        return report, nil
+    }
+    return report, tx.Commit()
+}
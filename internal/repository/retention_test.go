@@ -0,0 +1,184 @@
+package repository
+
+import (
+    "context"
+    "testing"
+    "time"
+)
+
+func countRows(t *testing.T, repo *sqliteRepository, table string) int {
+    t.Helper()
+    var n int
+    if err := repo.db.Get(&n, `SELECT COUNT(*) FROM `+table); err != nil {
+        t.Fatal(err)
+    }
+    return n
+}
+
+func TestApplyRetention(t *testing.T) {
+    ctx := context.Background()
+    now := time.Date(2025, 6, 1, 12, 30, 0, 0, time.UTC)
+    policy := RetentionPolicy{RawFor: 24 * time.Hour, HourlyFor: 7 * 24 * time.Hour, Horizon: 30 * 24 * time.Hour}
+
+    tests := []struct {
+        name   string
+        dryRun bool
+        raw    int
+        hourly int
+        daily  int
+    }{
+        {"dry run keeps everything", true, 6, 0, 0},
+        {"rolls up and purges", false, 1, 1, 1},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            repo := newTestRepository(t)
+            addVideo(t, repo, Video{VideoID: "v1"})
+            // Two samples in one hour three days ago end up in one hourly bucket
+            addStats(t, repo, "v1", now.Add(-72*time.Hour+5*time.Minute), 100, 1, 0)
+            addStats(t, repo, "v1", now.Add(-72*time.Hour+20*time.Minute), 150, 2, 0)
+            // Two samples ten days ago are rolled all the way to one daily bucket
+            addStats(t, repo, "v1", now.Add(-240*time.Hour), 10, 0, 0)
+            addStats(t, repo, "v1", now.Add(-239*time.Hour), 20, 0, 0)
+            // Beyond the horizon
+            addStats(t, repo, "v1", now.Add(-60*24*time.Hour), 1, 0, 0)
+            // Within the raw window
+            addStats(t, repo, "v1", now.Add(-time.Hour), 500, 5, 0)
+
+            // The first run only rolls raw samples into hours; the second,
+            // as the worker would, moves old hours into days
+            report, err := repo.ApplyRetention(ctx, policy, now, tt.dryRun)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if report.RawRolledUp != 5 {
+                t.Errorf("raw rolled up = %d, want 5", report.RawRolledUp)
+            }
+            if _, err := repo.ApplyRetention(ctx, policy, now, tt.dryRun); err != nil {
+                t.Fatal(err)
+            }
+
+            if got := countRows(t, repo, "video_stats"); got != tt.raw {
+                t.Errorf("raw samples = %d, want %d", got, tt.raw)
+            }
+            if got := countRows(t, repo, "video_stats_hourly"); got != tt.hourly {
+                t.Errorf("hourly buckets = %d, want %d", got, tt.hourly)
+            }
+            if got := countRows(t, repo, "video_stats_daily"); got != tt.daily {
+                t.Errorf("daily buckets = %d, want %d", got, tt.daily)
+            }
+        })
+    }
+}
+
+func TestRollupKeepsLastCountsAndSampleCount(t *testing.T) {
+    ctx := context.Background()
+    repo := newTestRepository(t)
+    now := time.Date(2025, 6, 1, 12, 30, 0, 0, time.UTC)
+    hour := now.Add(-48 * time.Hour).Truncate(time.Hour)
+
+    addVideo(t, repo, Video{VideoID: "v1"})
+    addStats(t, repo, "v1", hour.Add(10*time.Minute), 100, 1, 0)
+    addStats(t, repo, "v1", hour.Add(50*time.Minute), 180, 3, 1)
+    if _, err := repo.ApplyRetention(ctx, RetentionPolicy{RawFor: 24 * time.Hour}, now, false); err != nil {
+        t.Fatal(err)
+    }
+
+    buckets, err := repo.GetStatsBuckets(ctx, "v1", hour.Add(-time.Hour), now, IntervalHour, AggLast, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(buckets) != 1 || buckets[0].Samples != 2 || buckets[0].Views != 180 || !buckets[0].Bucket.Equal(hour) {
+        t.Errorf("buckets = %+v, want one bucket at %s with 2 samples and 180 views", buckets, hour)
+    }
+}
+
+func TestRollupDropsFlaggedSamples(t *testing.T) {
+    ctx := context.Background()
+    repo := newTestRepository(t)
+    now := time.Date(2025, 6, 1, 12, 30, 0, 0, time.UTC)
+    hour := now.Add(-48 * time.Hour).Truncate(time.Hour)
+
+    addVideo(t, repo, Video{VideoID: "v1"})
+    addStats(t, repo, "v1", hour.Add(10*time.Minute), 100, 1, 0)
+    addStats(t, repo, "v1", hour.Add(30*time.Minute), 180, 3, 1)
+    spike := addStats(t, repo, "v1", hour.Add(50*time.Minute), 90000, 3, 1)
+    if err := repo.FlagVideoStats(ctx, []string{spike.ID}); err != nil {
+        t.Fatal(err)
+    }
+
+    reached, err := repo.FirstStatsSampleReaching(ctx, "v1", "views", 1000)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if reached != nil {
+        t.Errorf("flagged sample %+v counted as reaching 1000 views", reached)
+    }
+
+    report, err := repo.ApplyRetention(ctx, RetentionPolicy{RawFor: 24 * time.Hour}, now, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if report.RawRolledUp != 3 {
+        t.Errorf("raw rolled up = %d, want all 3 samples removed", report.RawRolledUp)
+    }
+    buckets, err := repo.GetStatsBuckets(ctx, "v1", hour.Add(-time.Hour), now, IntervalHour, AggLast, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(buckets) != 1 || buckets[0].Samples != 2 || buckets[0].Views != 180 {
+        t.Errorf("buckets = %+v, want one bucket with 2 samples and 180 views", buckets)
+    }
+}
+
+func TestPointLookupsReadRollups(t *testing.T) {
+    ctx := context.Background()
+    repo := newTestRepository(t)
+    now := time.Date(2025, 6, 1, 12, 30, 0, 0, time.UTC)
+    hour := now.Add(-48 * time.Hour).Truncate(time.Hour)
+
+    addVideo(t, repo, Video{VideoID: "v1"})
+    addStats(t, repo, "v1", hour.Add(10*time.Minute), 100, 1, 0)
+    addStats(t, repo, "v1", hour.Add(50*time.Minute), 1200, 3, 0)
+    addStats(t, repo, "v1", now.Add(-time.Hour), 5000, 9, 0)
+    if _, err := repo.ApplyRetention(ctx, RetentionPolicy{RawFor: 24 * time.Hour}, now, false); err != nil {
+        t.Fatal(err)
+    }
+
+    tests := []struct {
+        name  string
+        at    time.Time
+        views int // 0 for no sample
+    }{
+        {"before any history", hour.Add(-time.Minute), 0},
+        {"inside the bucket", hour.Add(30 * time.Minute), 0},
+        {"after the bucket ended", hour.Add(time.Hour), 1200},
+        {"raw sample", now, 5000},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            stats, err := repo.GetStatsAt(ctx, "v1", tt.at)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if tt.views == 0 {
+                if stats != nil {
+                    t.Errorf("GetStatsAt = %+v, want none", stats)
+                }
+                return
+            }
+            if stats == nil || stats.Views != tt.views {
+                t.Errorf("GetStatsAt = %+v, want %d views", stats, tt.views)
+            }
+        })
+    }
+
+    first, err := repo.FirstStatsSampleReaching(ctx, "v1", "views", 1000)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if first == nil || first.Views != 1200 || !first.Timestamp.Equal(hour) || first.ID != "" {
+        t.Errorf("FirstStatsSampleReaching = %+v, want the rolled up bucket at %s", first, hour)
+    }
+}
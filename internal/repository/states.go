@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func createStateHistoryTable(db *sqlx.DB) error {
+    _, err := db.Exec(`
+    CREATE TABLE IF NOT EXISTS video_state_history (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        video_id VARCHAR(100) NOT NULL,
+        from_state VARCHAR(20) NOT NULL DEFAULT '',
+        to_state VARCHAR(20) NOT NULL,
+        reason TEXT NOT NULL DEFAULT '',
+        changed_at DATETIME DEFAULT CURRENT_TIMESTAMP
+    )`)
+    if err != nil {
+        return err
+    }
+    _, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_video_state_history_video ON video_state_history(video_id, changed_at)`)
+    return err
+}
+
+// TransitionVideoState moves a video from one state to another and records
+// the change. Nothing is written when the video is no longer in from, so
+// concurrent pollers cannot record the same transition twice.
+func (r *sqliteRepository) TransitionVideoState(ctx context.Context, videoID, from, to, reason string, at time.Time) error {
+    tx, err := r.db.BeginTxx(ctx, nil)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    result, err := tx.ExecContext(ctx, `UPDATE videos SET state = ? WHERE video_id = ? AND state = ?`, to, videoID, from)
+    if err != nil {
+        return err
+    }
+    changed, err := result.RowsAffected()
+    if err != nil || changed == 0 {
+        return err
+    }
+
+    _, err = tx.ExecContext(ctx, `
+    INSERT INTO video_state_history (video_id, from_state, to_state, reason, changed_at)
+    VALUES (?, ?, ?, ?, ?)`, videoID, from, to, reason, at.UTC())
+    if err != nil {
+        return err
+    }
+    return tx.Commit()
+}
+
+func (r *sqliteRepository) GetVideoStateHistory(ctx context.Context, videoID string) ([]StateTransition, error) {
+    var history []StateTransition
+    query := `SELECT * FROM video_state_history WHERE video_id = ? ORDER BY changed_at, id`
+    err := r.db.SelectContext(ctx, &history, query, videoID)
+    return history, err
+}
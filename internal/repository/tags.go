@@ -0,0 +1,208 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// TagSummary is a tag with the number of videos carrying it
+type TagSummary struct {
+    Tag    string `db:"tag" json:"tag"`
+    Videos int    `db:"videos" json:"videos"`
+}
+
+// HasTag reports whether the video carries tag
+func (v *Video) HasTag(tag string) bool {
+    for _, t := range v.Tags {
+        if t == tag {
+            return true
+        }
+    }
+    return false
+}
+
+// createTagsTable creates video_tags and, the first time, seeds it with the
+// single tag videos used to be registered with
+func createTagsTable(db *sqlx.DB) error {
+    var exists int
+    if err := db.Get(&exists, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'video_tags'`); err != nil {
+        return err
+    }
+
+    _, err := db.Exec(`
+    CREATE TABLE IF NOT EXISTS video_tags (
+        video_id VARCHAR(100) NOT NULL,
+        tag VARCHAR(100) NOT NULL,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (video_id, tag)
+    )`)
+    if err != nil {
+        return err
+    }
+    if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_video_tags_tag ON video_tags(tag)`); err != nil {
+        return err
+    }
+    if exists > 0 {
+        return nil
+    }
+
+    _, err = db.Exec(`
+    INSERT INTO video_tags (video_id, tag, created_at)
+    SELECT video_id, tag, created_at FROM videos WHERE tag IS NOT NULL AND tag <> ''
+    ON CONFLICT (video_id, tag) DO NOTHING`)
+    return err
+}
+
+// AddVideoTags attaches tags to a video, ignoring ones it already has
+func (r *sqliteRepository) AddVideoTags(ctx context.Context, videoID string, tags []string) error {
+    tx, err := r.db.BeginTxx(ctx, nil)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    now := time.Now().UTC()
+    for _, tag := range tags {
+        _, err := tx.ExecContext(ctx, `
+        INSERT INTO video_tags (video_id, tag, created_at) VALUES (?, ?, ?)
+        ON CONFLICT (video_id, tag) DO NOTHING`, videoID, tag, now)
+        if err != nil {
+            return err
+        }
+    }
+    return tx.Commit()
+}
+
+func (r *sqliteRepository) RemoveVideoTag(ctx context.Context, videoID, tag string) (bool, error) {
+    result, err := r.db.ExecContext(ctx, `DELETE FROM video_tags WHERE video_id = ? AND tag = ?`, videoID, tag)
+    if err != nil {
+        return false, err
+    }
+    removed, err := result.RowsAffected()
+    return removed > 0, err
+}
+
+func (r *sqliteRepository) GetVideoTags(ctx context.Context, videoID string) ([]string, error) {
+    var tags []string
+    err := r.db.SelectContext(ctx, &tags, `SELECT tag FROM video_tags WHERE video_id = ? ORDER BY tag`, videoID)
+    return tags, err
+}
+
+func (r *sqliteRepository) GetTags(ctx context.Context) ([]TagSummary, error) {
+    var tags []TagSummary
+    query := `SELECT tag, COUNT(*) AS videos FROM video_tags GROUP BY tag ORDER BY tag`
+    err := r.db.SelectContext(ctx, &tags, query)
+    return tags, err
+}
+
+// GetVideosByTag returns the videos carrying a tag, in any state
+func (r *sqliteRepository) GetVideosByTag(ctx context.Context, tag string) ([]Video, error) {
+    var videos []Video
+    query := `
+    SELECT * FROM videos
+    WHERE video_id IN (SELECT video_id FROM video_tags WHERE tag = ?)
+    ORDER BY platform, video_id`
+    if err := r.db.SelectContext(ctx, &videos, query, tag); err != nil {
+        return nil, err
+    }
+    return videos, r.attachTags(ctx, videos)
+}
+
+// TagBucket is one bucket of a tagged video. A carry row holds the video's
+// last unflagged counts at or before the start of the range and has no
+// bucket.
+type TagBucket struct {
+    VideoID string
+    Carry   bool
+    StatsBucket
+}
+
+// GetTagStatsBuckets buckets the samples of every video carrying a tag in
+// one query, like GetStatsBuckets, followed by one carry row per video that
+// has counts from before the range. Rows are ordered by video, carry first.
+func (r *sqliteRepository) GetTagStatsBuckets(ctx context.Context, tag string, from, to time.Time, interval, agg string, excludeFlagged bool) ([]TagBucket, error) {
+    tagged := `video_id IN (SELECT video_id FROM video_tags WHERE tag = ?)`
+    query, err := bucketQuery(r.db.DriverName(), tagged, interval, agg, excludeFlagged)
+    if err != nil {
+        return nil, err
+    }
+    // Only rollup buckets that ended by from are known to hold earlier counts
+    query += `
+    UNION ALL
+    SELECT video_id, '' AS bucket, 0, views, likes, comments FROM (
+        SELECT video_id, views, likes, comments,
+            ROW_NUMBER() OVER (PARTITION BY video_id ORDER BY timestamp DESC) AS last_rank
+        FROM (
+            SELECT video_id, timestamp, views, likes, comments
+            FROM video_stats WHERE ` + tagged + ` AND timestamp <= ? AND flagged = 0
+            UNION ALL
+            SELECT video_id, bucket, views, likes, comments
+            FROM video_stats_hourly WHERE ` + tagged + ` AND bucket <= ?
+            UNION ALL
+            SELECT video_id, bucket, views, likes, comments
+            FROM video_stats_daily WHERE ` + tagged + ` AND bucket <= ?
+        ) before
+    ) latest
+    WHERE last_rank = 1
+    ORDER BY video_id, bucket`
+
+    from, to = from.UTC(), to.UTC()
+    rows, err := r.db.QueryContext(ctx, r.db.Rebind(query),
+        from, to, tag, tag, tag,
+        tag, from, tag, from.Add(-time.Hour), tag, from.AddDate(0, 0, -1))
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var buckets []TagBucket
+    for rows.Next() {
+        var b TagBucket
+        var start string
+        if err := rows.Scan(&b.VideoID, &start, &b.Samples, &b.Views, &b.Likes, &b.Comments); err != nil {
+            return nil, err
+        }
+        if start == "" {
+            b.Carry = true
+        } else if b.Bucket, err = parseBucket(start); err != nil {
+            return nil, err
+        }
+        buckets = append(buckets, b)
+    }
+    return buckets, rows.Err()
+}
+
+// attachTags loads the tags of the given videos in one query
+func (r *sqliteRepository) attachTags(ctx context.Context, videos []Video) error {
+    if len(videos) == 0 {
+        return nil
+    }
+
+    ids := make([]string, len(videos))
+    for i, video := range videos {
+        ids[i] = video.VideoID
+    }
+    query, args, err := sqlx.In(`SELECT video_id, tag FROM video_tags WHERE video_id IN (?) ORDER BY tag`, ids)
+    if err != nil {
+        return err
+    }
+
+    var rows []struct {
+        VideoID string `db:"video_id"`
+        Tag     string `db:"tag"`
+    }
+    if err := r.db.SelectContext(ctx, &rows, r.db.Rebind(query), args...); err != nil {
+        return err
+    }
+
+    tags := make(map[string][]string)
+    for _, row := range rows {
+        tags[row.VideoID] = append(tags[row.VideoID], row.Tag)
+    }
+    for i := range videos {
+        videos[i].Tags = tags[videos[i].VideoID]
+    }
+    return nil
+}
@@ -0,0 +1,73 @@
+package repository
+
+import (
+    "context"
+    "testing"
+    "time"
+)
+
+func TestGetTagStatsBuckets(t *testing.T) {
+    ctx := context.Background()
+    repo := newTestRepository(t)
+    base := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+
+    addVideo(t, repo, Video{VideoID: "v1"})
+    addVideo(t, repo, Video{VideoID: "v2"})
+    addVideo(t, repo, Video{VideoID: "other"})
+    for _, id := range []string{"v1", "v2"} {
+        if err := repo.AddVideoTags(ctx, id, []string{"launch"}); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    addStats(t, repo, "v1", base.Add(-2*time.Hour), 50, 5, 0) // before the range
+    addStats(t, repo, "v1", base.Add(10*time.Minute), 100, 10, 1)
+    addStats(t, repo, "v1", base.Add(50*time.Minute), 160, 12, 1)
+    addStats(t, repo, "v1", base.Add(2*time.Hour), 300, 20, 2)
+    addStats(t, repo, "v2", base.Add(time.Hour+5*time.Minute), 1000, 80, 4)
+    addStats(t, repo, "other", base.Add(10*time.Minute), 99999, 1, 1)
+
+    type row struct {
+        video string
+        carry bool
+        start time.Time
+        views int
+    }
+    tests := []struct {
+        name string
+        agg  string
+        want []row
+    }{
+        {"last", AggLast, []row{
+            {"v1", true, time.Time{}, 50},
+            {"v1", false, base, 160},
+            {"v1", false, base.Add(2 * time.Hour), 300},
+            {"v2", false, base.Add(time.Hour), 1000},
+        }},
+        {"delta restarts for each video", AggDelta, []row{
+            {"v1", true, time.Time{}, 50},
+            {"v1", false, base, 60},
+            {"v1", false, base.Add(2 * time.Hour), 140},
+            {"v2", false, base.Add(time.Hour), 0},
+        }},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, err := repo.GetTagStatsBuckets(ctx, "launch", base, base.Add(3*time.Hour), IntervalHour, tt.agg, false)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if len(got) != len(tt.want) {
+                t.Fatalf("got %d rows %+v, want %d", len(got), got, len(tt.want))
+            }
+            for i, want := range tt.want {
+                g := got[i]
+                if g.VideoID != want.video || g.Carry != want.carry || !g.Bucket.Equal(want.start) || g.Views != want.views {
+                    t.Errorf("row %d = %s carry=%v %s views=%d, want %s carry=%v %s views=%d",
+                        i, g.VideoID, g.Carry, g.Bucket, g.Views, want.video, want.carry, want.start, want.views)
+                }
+            }
+        })
+    }
+}
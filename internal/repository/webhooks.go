@@ -0,0 +1,240 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Webhook delivery states
+const (
+    DeliveryPending   = "pending"
+    DeliveryDelivered = "delivered"
+    DeliveryFailed    = "failed"
+)
+
+// Webhook is a registered receiver. An empty event list subscribes to every
+// event.
+type Webhook struct {
+    ID        string    `db:"id" json:"id"`
+    URL       string    `db:"url" json:"url"`
+    Secret    string    `db:"secret" json:"secret,omitempty"`
+    Events    StringList `db:"events" json:"events"`
+    CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+// Wants reports whether the webhook subscribes to event
+func (w *Webhook) Wants(event string) bool {
+    if len(w.Events) == 0 {
+        return true
+    }
+    for _, e := range w.Events {
+        if e == event {
+            return true
+        }
+    }
+    return false
+}
+
+// StringList is stored as a comma-separated column
+type StringList []string
+
+func (l StringList) Value() (driver.Value, error) {
+    return strings.Join(l, ","), nil
+}
+
+func (l *StringList) Scan(src interface{}) error {
+    var s string
+    switch v := src.(type) {
+    case string:
+        s = v
+    case []byte:
+        s = string(v)
+    case nil:
+    default:
+        return fmt.Errorf("unsupported string list type %T", src)
+    }
+
+    *l = StringList{}
+    for _, event := range strings.Split(s, ",") {
+        if event != "" {
+            *l = append(*l, event)
+        }
+    }
+    return nil
+}
+
+// WebhookDelivery is one queued event for one webhook, and its delivery log
+type WebhookDelivery struct {
+    ID             string     `db:"id" json:"id"`
+    WebhookID      string     `db:"webhook_id" json:"webhook_id"`
+    Event          string     `db:"event" json:"event"`
+    Payload        string     `db:"payload" json:"payload"`
+    Status         string     `db:"status" json:"status"`
+    Attempts       int        `db:"attempts" json:"attempts"`
+    NextAttemptAt  time.Time  `db:"next_attempt_at" json:"next_attempt_at"`
+    LastStatusCode int        `db:"last_status_code" json:"last_status_code,omitempty"`
+    LastError      string     `db:"last_error" json:"last_error,omitempty"`
+    CreatedAt      time.Time  `db:"created_at" json:"created_at"`
+    DeliveredAt    *time.Time `db:"delivered_at" json:"delivered_at,omitempty"`
+}
+
+func createWebhookTables(db *sqlx.DB) error {
+    _, err := db.Exec(`
+    CREATE TABLE IF NOT EXISTS webhooks (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        url TEXT NOT NULL,
+        secret TEXT NOT NULL DEFAULT '',
+        events TEXT NOT NULL DEFAULT '',
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+    )`)
+    if err != nil {
+        return err
+    }
+
+    _, err = db.Exec(`
+    CREATE TABLE IF NOT EXISTS webhook_deliveries (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        webhook_id VARCHAR(100) NOT NULL,
+        event VARCHAR(50) NOT NULL,
+        payload TEXT NOT NULL,
+        status VARCHAR(20) NOT NULL DEFAULT 'pending',
+        attempts INTEGER NOT NULL DEFAULT 0,
+        next_attempt_at DATETIME NOT NULL,
+        last_status_code INTEGER NOT NULL DEFAULT 0,
+        last_error TEXT NOT NULL DEFAULT '',
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        delivered_at DATETIME
+    )`)
+    if err != nil {
+        return err
+    }
+
+    _, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at)`)
+    return err
+}
+
+func (r *sqliteRepository) CreateWebhook(ctx context.Context, hook *Webhook) error {
+    hook.CreatedAt = time.Now()
+    query := `INSERT INTO webhooks (url, secret, events, created_at) VALUES (?, ?, ?, ?)`
+
+    result, err := r.db.ExecContext(ctx, query, hook.URL, hook.Secret, hook.Events, hook.CreatedAt.UTC())
+    if err != nil {
+        return err
+    }
+
+    id, err := result.LastInsertId()
+    if err != nil {
+        return err
+    }
+
+    hook.ID = fmt.Sprintf("%d", id)
+    return nil
+}
+
+func (r *sqliteRepository) GetWebhook(ctx context.Context, id string) (*Webhook, error) {
+    var hook Webhook
+    err := r.db.GetContext(ctx, &hook, `SELECT * FROM webhooks WHERE id = ?`, id)
+    if err == sql.ErrNoRows {
+        return nil, nil
+    }
+    return &hook, err
+}
+
+func (r *sqliteRepository) GetWebhooks(ctx context.Context) ([]Webhook, error) {
+    var hooks []Webhook
+    err := r.db.SelectContext(ctx, &hooks, `SELECT * FROM webhooks ORDER BY id`)
+    return hooks, err
+}
+
+// DeleteWebhook removes a webhook and drops its undelivered events
+func (r *sqliteRepository) DeleteWebhook(ctx context.Context, id string) (bool, error) {
+    result, err := r.db.ExecContext(ctx, `DELETE FROM webhooks WHERE id = ?`, id)
+    if err != nil {
+        return false, err
+    }
+    deleted, err := result.RowsAffected()
+    if err != nil || deleted == 0 {
+        return false, err
+    }
+
+    _, err = r.db.ExecContext(ctx, `DELETE FROM webhook_deliveries WHERE webhook_id = ? AND status = ?`, id, DeliveryPending)
+    return true, err
+}
+
+func (r *sqliteRepository) CreateWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) error {
+    delivery.CreatedAt = time.Now()
+    query := `
+    INSERT INTO webhook_deliveries (webhook_id, event, payload, status, next_attempt_at, created_at)
+    VALUES (?, ?, ?, ?, ?, ?)`
+
+    result, err := r.db.ExecContext(ctx, query, delivery.WebhookID, delivery.Event, delivery.Payload,
+        delivery.Status, delivery.NextAttemptAt.UTC(), delivery.CreatedAt.UTC())
+    if err != nil {
+        return err
+    }
+
+    id, err := result.LastInsertId()
+    if err != nil {
+        return err
+    }
+
+    delivery.ID = fmt.Sprintf("%d", id)
+    return nil
+}
+
+// GetDueWebhookDeliveries returns pending deliveries whose next attempt is
+// at or before now, oldest first
+func (r *sqliteRepository) GetDueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]WebhookDelivery, error) {
+    var deliveries []WebhookDelivery
+    query := `
+    SELECT * FROM webhook_deliveries
+    WHERE status = ? AND next_attempt_at <= ?
+    ORDER BY next_attempt_at, id
+    LIMIT ?`
+    err := r.db.SelectContext(ctx, &deliveries, query, DeliveryPending, now.UTC(), limit)
+    return deliveries, err
+}
+
+// CountDueWebhookDeliveries returns how many pending deliveries are due
+func (r *sqliteRepository) CountDueWebhookDeliveries(ctx context.Context, now time.Time) (int, error) {
+    var count int
+    err := r.db.GetContext(ctx, &count, `SELECT COUNT(*) FROM webhook_deliveries WHERE status = ? AND next_attempt_at <= ?`,
+        DeliveryPending, now.UTC())
+    return count, err
+}
+
+// UpdateWebhookDelivery stores the outcome of a delivery attempt
+func (r *sqliteRepository) UpdateWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) error {
+    query := `
+    UPDATE webhook_deliveries
+    SET status = ?, attempts = ?, next_attempt_at = ?, last_status_code = ?, last_error = ?, delivered_at = ?
+    WHERE id = ?`
+    _, err := r.db.ExecContext(ctx, query, delivery.Status, delivery.Attempts, delivery.NextAttemptAt.UTC(),
+        delivery.LastStatusCode, delivery.LastError, utcPtr(delivery.DeliveredAt), delivery.ID)
+    return err
+}
+
+// PurgeWebhookDeliveries deletes the delivered and failed deliveries created
+// before the cutoff; pending ones are kept whatever their age
+func (r *sqliteRepository) PurgeWebhookDeliveries(ctx context.Context, before time.Time) (int64, error) {
+    result, err := r.db.ExecContext(ctx, `DELETE FROM webhook_deliveries WHERE status != ? AND created_at < ?`,
+        DeliveryPending, before.UTC())
+    if err != nil {
+        return 0, err
+    }
+    return result.RowsAffected()
+}
+
+// GetWebhookDeliveries returns the most recent deliveries of a webhook
+func (r *sqliteRepository) GetWebhookDeliveries(ctx context.Context, webhookID string, limit int) ([]WebhookDelivery, error) {
+    var deliveries []WebhookDelivery
+    query := `SELECT * FROM webhook_deliveries WHERE webhook_id = ? ORDER BY id DESC LIMIT ?`
+    err := r.db.SelectContext(ctx, &deliveries, query, webhookID, limit)
+    return deliveries, err
+}
@@ -0,0 +1,55 @@
+package repository
+
+import (
+    "context"
+    "testing"
+    "time"
+)
+
+func TestPurgeWebhookDeliveries(t *testing.T) {
+    ctx := context.Background()
+    repo := newTestRepository(t)
+    hook := &Webhook{URL: "http://example.com/hook", Secret: "s"}
+    if err := repo.CreateWebhook(ctx, hook); err != nil {
+        t.Fatal(err)
+    }
+
+    now := time.Now()
+    old := now.Add(-40 * 24 * time.Hour)
+    deliveries := []struct {
+        status  string
+        created time.Time
+        kept    bool
+    }{
+        {DeliveryDelivered, old, false},
+        {DeliveryFailed, old, false},
+        {DeliveryPending, old, true},
+        {DeliveryDelivered, now, true},
+        {DeliveryFailed, now, true},
+    }
+    for _, d := range deliveries {
+        delivery := &WebhookDelivery{WebhookID: hook.ID, Event: "video.errored", Payload: "{}", Status: d.status, NextAttemptAt: now}
+        if err := repo.CreateWebhookDelivery(ctx, delivery); err != nil {
+            t.Fatal(err)
+        }
+        if _, err := repo.db.Exec(`UPDATE webhook_deliveries SET created_at = ? WHERE id = ?`, d.created.UTC(), delivery.ID); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    purged, err := repo.PurgeWebhookDeliveries(ctx, now.Add(-30*24*time.Hour))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if purged != 2 {
+        t.Errorf("purged %d deliveries, want 2", purged)
+    }
+    if n := countRows(t, repo, "webhook_deliveries"); n != 3 {
+        t.Errorf("%d deliveries left, want 3", n)
+    }
+    var pending int
+    repo.db.Get(&pending, `SELECT COUNT(*) FROM webhook_deliveries WHERE status = ?`, DeliveryPending)
+    if pending != 1 {
+        t.Errorf("%d pending deliveries left, want 1", pending)
+    }
+}
@@ -0,0 +1,361 @@
+package service
+
+import (
+    "context"
+    "errors"
+    "log"
+    "strings"
+    "time"
+    "video-stats-tracker/internal/platform"
+    "video-stats-tracker/internal/repository"
+)
+
+// accountSyncOverlap re-reads a little history on every sync so uploads that
+// appear late in the playlist are not missed; duplicates are skipped
+const accountSyncOverlap = 24 * time.Hour
+
+// TrackChannel starts following a YouTube channel (channel ID or @handle).
+// Existing uploads published within lookback are registered right away, or
+// all recent uploads when lookback is zero; new uploads are picked up by
+// SyncTrackedAccounts.
+func (s *videoService) TrackChannel(ctx context.Context, channel, tag string, lookback time.Duration) (*repository.TrackedAccount, int, error) {
+    channel = strings.TrimSpace(channel)
+    if channel == "" {
+        return nil, 0, Errorf(CodeValidation, "channel is required")
+    }
+    if lookback < 0 {
+        return nil, 0, Errorf(CodeValidation, "lookback must not be negative")
+    }
+
+    info, err := s.youtubeClient.GetChannel(ctx, channel)
+    if errors.Is(err, platform.ErrChannelNotFound) {
+        return nil, 0, Errorf(CodeNotFound, "youtube channel not found: %s", channel)
+    }
+    if err != nil {
+        return nil, 0, Errorf(CodeUpstream, "youtube channel lookup failed: %w", err)
+    }
+
+    existing, err := s.repo.GetTrackedAccount(ctx, repository.PlatformYouTube, info.ID)
+    if err != nil {
+        return nil, 0, err
+    }
+    if existing != nil {
+        return nil, 0, Errorf(CodeDuplicate, "channel already being tracked")
+    }
+
+    account := &repository.TrackedAccount{
+        Platform:          repository.PlatformYouTube,
+        AccountID:         info.ID,
+        Handle:            info.Handle,
+        Title:             info.Title,
+        UploadsPlaylistID: info.UploadsPlaylistID,
+        Tag:               tag,
+        State:             repository.AccountActive,
+    }
+    if err := s.repo.CreateTrackedAccount(ctx, account); err != nil {
+        if repository.IsUniqueViolation(err) {
+            return nil, 0, Errorf(CodeDuplicate, "channel already being tracked")
+        }
+        return nil, 0, err
+    }
+
+    var since time.Time
+    if lookback > 0 {
+        since = time.Now().Add(-lookback)
+    }
+    registered, err := s.syncYouTubeChannel(ctx, account, since)
+    if err != nil {
+        return account, registered, Errorf(CodeUpstream, "channel tracked but initial sync failed: %w", err)
+    }
+    return account, registered, nil
+}
+
+// instagramMediaTypes are the filters accepted for tracked Instagram
+// accounts, matching media_type or media_product_type
+var instagramMediaTypes = map[string]bool{
+    "IMAGE": true, "VIDEO": true, "CAROUSEL_ALBUM": true, "FEED": true, "REELS": true,
+}
+
+// TrackInstagramAccount starts following an Instagram account. Posts are
+// optionally filtered by a comma-separated list of media types (e.g. REELS);
+// matching posts published within lookback, paging back as far as needed,
+// or the first page of posts when lookback is zero, are registered right
+// away with the account's tag.
+func (s *videoService) TrackInstagramAccount(ctx context.Context, username, tag, mediaType string, lookback time.Duration) (*repository.TrackedAccount, int, error) {
+    username = strings.TrimPrefix(strings.TrimSpace(username), "@")
+    if username == "" {
+        return nil, 0, Errorf(CodeValidation, "username is required")
+    }
+    if lookback < 0 {
+        return nil, 0, Errorf(CodeValidation, "lookback must not be negative")
+    }
+
+    var types []string
+    for _, t := range strings.Split(mediaType, ",") {
+        t = strings.ToUpper(strings.TrimSpace(t))
+        if t == "" {
+            continue
+        }
+        if !instagramMediaTypes[t] {
+            return nil, 0, Errorf(CodeValidation, "unsupported media_type: %s", t)
+        }
+        types = append(types, t)
+    }
+
+    existing, err := s.repo.GetTrackedAccount(ctx, repository.PlatformInstagram, username)
+    if err != nil {
+        return nil, 0, err
+    }
+    if existing != nil {
+        return nil, 0, Errorf(CodeDuplicate, "account already being tracked")
+    }
+
+    var since time.Time
+    if lookback > 0 {
+        since = time.Now().Add(-lookback)
+    }
+
+    // Make sure the account is reachable before storing it
+    media, err := s.instagramClient.RecentMedia(ctx, username, since)
+    if err != nil {
+        return nil, 0, Errorf(CodeUpstream, "instagram account lookup failed for %s: %w", username, err)
+    }
+
+    account := &repository.TrackedAccount{
+        Platform:  repository.PlatformInstagram,
+        AccountID: username,
+        Handle:    "@" + username,
+        Tag:       tag,
+        MediaType: strings.Join(types, ","),
+        State:     repository.AccountActive,
+    }
+    if err := s.repo.CreateTrackedAccount(ctx, account); err != nil {
+        if repository.IsUniqueViolation(err) {
+            return nil, 0, Errorf(CodeDuplicate, "account already being tracked")
+        }
+        return nil, 0, err
+    }
+
+    registered, err := s.registerInstagramMedia(ctx, account, media, since)
+    if err != nil {
+        return account, registered, Errorf(CodeUpstream, "account tracked but initial sync failed: %w", err)
+    }
+    return account, registered, s.repo.UpdateAccountSyncedAt(ctx, account.ID, time.Now())
+}
+
+func (s *videoService) GetTrackedAccounts(ctx context.Context) ([]repository.TrackedAccount, error) {
+    return s.repo.GetTrackedAccounts(ctx)
+}
+
+// SyncTrackedAccounts discovers new uploads of every active tracked account
+// and registers them with the account's tag
+func (s *videoService) SyncTrackedAccounts(ctx context.Context) error {
+    accounts, err := s.repo.GetTrackedAccounts(ctx)
+    if err != nil {
+        return err
+    }
+
+    for i := range accounts {
+        account := &accounts[i]
+        if account.State != repository.AccountActive {
+            continue
+        }
+
+        since := account.CreatedAt
+        if account.LastSyncedAt != nil {
+            since = *account.LastSyncedAt
+        }
+        since = since.Add(-accountSyncOverlap)
+
+        var registered int
+        switch account.Platform {
+        case repository.PlatformYouTube:
+            registered, err = s.syncYouTubeChannel(ctx, account, since)
+        case repository.PlatformInstagram:
+            registered, err = s.syncInstagramAccount(ctx, account, since)
+        default:
+            continue
+        }
+
+        if err != nil {
+            log.Printf("Error syncing %s account %s: %v", account.Platform, account.AccountID, err)
+            continue
+        }
+        if registered > 0 {
+            log.Printf("Registered %d new uploads from %s account %s", registered, account.Platform, account.AccountID)
+        }
+    }
+    return nil
+}
+
+// syncYouTubeChannel registers uploads published after since and records
+// the sync time
+func (s *videoService) syncYouTubeChannel(ctx context.Context, account *repository.TrackedAccount, since time.Time) (int, error) {
+    syncedAt := time.Now()
+    uploads, err := s.youtubeClient.GetUploads(ctx, account.UploadsPlaylistID, since)
+    if err != nil {
+        return 0, err
+    }
+
+    registered := 0
+    for _, upload := range uploads {
+        var publishedAt *time.Time
+        if !upload.PublishedAt.IsZero() {
+            publishedAt = &upload.PublishedAt
+        }
+        created, err := s.registerDiscovered(ctx, account, upload.VideoID, "", publishedAt)
+        if err != nil {
+            return registered, err
+        }
+        if created {
+            registered++
+        }
+    }
+
+    return registered, s.repo.UpdateAccountSyncedAt(ctx, account.ID, syncedAt)
+}
+
+// syncInstagramAccount registers the account's posts published after since,
+// paging back until it reaches them, and records the sync time
+func (s *videoService) syncInstagramAccount(ctx context.Context, account *repository.TrackedAccount, since time.Time) (int, error) {
+    syncedAt := time.Now()
+    media, err := s.instagramClient.RecentMedia(ctx, account.AccountID, since)
+    if err != nil {
+        return 0, err
+    }
+
+    registered, err := s.registerInstagramMedia(ctx, account, media, since)
+    if err != nil {
+        return registered, err
+    }
+    return registered, s.repo.UpdateAccountSyncedAt(ctx, account.ID, syncedAt)
+}
+
+// registerInstagramMedia registers posts matching the account's media type
+// filter that were published after since
+func (s *videoService) registerInstagramMedia(ctx context.Context, account *repository.TrackedAccount, media []platform.InstagramMedia, since time.Time) (int, error) {
+    registered := 0
+    for _, m := range media {
+        if !matchesMediaFilter(m, account.MediaType) {
+            continue
+        }
+
+        publishedAt := m.PublishedAt()
+        if !since.IsZero() && publishedAt != nil && publishedAt.Before(since) {
+            continue
+        }
+
+        created, err := s.registerDiscovered(ctx, account, m.ID, account.AccountID, publishedAt)
+        if err != nil {
+            return registered, err
+        }
+        if created {
+            registered++
+        }
+    }
+    return registered, nil
+}
+
+func matchesMediaFilter(m platform.InstagramMedia, filter string) bool {
+    if filter == "" {
+        return true
+    }
+    for _, t := range strings.Split(filter, ",") {
+        if m.MatchesType(t) {
+            return true
+        }
+    }
+    return false
+}
+
+// registerDiscovered registers a video found on a tracked account unless it
+// is already tracked
+func (s *videoService) registerDiscovered(ctx context.Context, account *repository.TrackedAccount, videoID, username string, publishedAt *time.Time) (bool, error) {
+    existing, err := s.findExisting(ctx, account.Platform, videoID, username)
+    if err != nil || existing != nil {
+        return false, err
+    }
+
+    video := &repository.Video{
+        Platform:          account.Platform,
+        VideoID:           videoID,
+        InstagramUsername: username,
+        State:             repository.StateRegistered,
+        Tag:               account.Tag,
+        AccountID:         account.ID,
+        PublishedAt:       publishedAt,
+    }
+    if err := s.repo.CreateVideo(ctx, video); err != nil {
+        if repository.IsUniqueViolation(err) {
+            return false, nil
+        }
+        return false, err
+    }
+    s.publish(ctx, EventVideoDiscovered, video)
+    return true, nil
+}
+
+// UpdateAccountStats records a snapshot of followers, media count and
+// channel views for every active tracked account
+func (s *videoService) UpdateAccountStats(ctx context.Context) error {
+    accounts, err := s.repo.GetTrackedAccounts(ctx)
+    if err != nil {
+        return err
+    }
+
+    for _, account := range accounts {
+        if account.State != repository.AccountActive {
+            continue
+        }
+
+        stats := &repository.AccountStats{AccountID: account.ID}
+        switch account.Platform {
+        case repository.PlatformYouTube:
+            channelStats, err := s.youtubeClient.GetChannelStats(ctx, account.AccountID)
+            if err != nil {
+                log.Printf("Error fetching channel stats for %s: %v", account.AccountID, err)
+                continue
+            }
+            stats.Followers = channelStats.Subscribers
+            stats.MediaCount = channelStats.Videos
+            stats.Views = channelStats.Views
+        case repository.PlatformInstagram:
+            igStats, err := s.instagramClient.GetAccountStats(ctx, account.AccountID)
+            if err != nil {
+                log.Printf("Error fetching account stats for %s: %v", account.AccountID, err)
+                continue
+            }
+            stats.Followers = igStats.FollowersCount
+            stats.MediaCount = igStats.MediaCount
+        default:
+            continue
+        }
+
+        stats.Timestamp = time.Now()
+        if err := s.repo.CreateAccountStats(ctx, stats); err != nil {
+            log.Printf("Error saving account stats for %s: %v", account.AccountID, err)
+        }
+    }
+    return nil
+}
+
+// GetAccountStats returns the audience history of a tracked account
+func (s *videoService) GetAccountStats(ctx context.Context, id string, from, to time.Time) (*repository.TrackedAccount, []repository.AccountStats, error) {
+    if to.Before(from) {
+        return nil, nil, Errorf(CodeValidation, "from must be before to")
+    }
+
+    account, err := s.repo.GetTrackedAccountByID(ctx, id)
+    if err != nil {
+        return nil, nil, err
+    }
+    if account == nil {
+        return nil, nil, Errorf(CodeNotFound, "account not tracked: %s", id)
+    }
+
+    stats, err := s.repo.GetAccountStats(ctx, id, from, to)
+    if err != nil {
+        return nil, nil, err
+    }
+    return account, stats, nil
+}
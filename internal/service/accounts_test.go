@@ -0,0 +1,280 @@
+package service
+
+import (
+    "context"
+    "errors"
+    "testing"
+    "time"
+    "video-stats-tracker/internal/platform"
+    "video-stats-tracker/internal/repository"
+)
+
+// accountRepository keeps tracked accounts in memory on top of the videos
+// of registrationRepository; created videos count as tracked afterwards
+type accountRepository struct {
+    *registrationRepository
+    accounts []repository.TrackedAccount
+    stats    []repository.AccountStats
+}
+
+func newAccountRepository() *accountRepository {
+    return &accountRepository{registrationRepository: &registrationRepository{existing: make(map[string]*repository.Video)}}
+}
+
+func (r *accountRepository) CreateVideo(ctx context.Context, video *repository.Video) error {
+    if err := r.registrationRepository.CreateVideo(ctx, video); err != nil {
+        return err
+    }
+    key := video.Platform + "/" + video.VideoID
+    if video.Platform == repository.PlatformInstagram {
+        key = video.Platform + "/" + video.InstagramUsername + "/" + video.VideoID
+    }
+    r.existing[key] = video
+    return nil
+}
+
+func (r *accountRepository) GetWebhooks(ctx context.Context) ([]repository.Webhook, error) {
+    return nil, nil
+}
+
+func (r *accountRepository) CreateTrackedAccount(ctx context.Context, account *repository.TrackedAccount) error {
+    account.ID = account.AccountID + "-account"
+    account.CreatedAt = time.Now()
+    r.accounts = append(r.accounts, *account)
+    return nil
+}
+
+func (r *accountRepository) GetTrackedAccount(ctx context.Context, platform, accountID string) (*repository.TrackedAccount, error) {
+    for i := range r.accounts {
+        if r.accounts[i].Platform == platform && r.accounts[i].AccountID == accountID {
+            return &r.accounts[i], nil
+        }
+    }
+    return nil, nil
+}
+
+func (r *accountRepository) GetTrackedAccounts(ctx context.Context) ([]repository.TrackedAccount, error) {
+    return append([]repository.TrackedAccount(nil), r.accounts...), nil
+}
+
+func (r *accountRepository) UpdateAccountSyncedAt(ctx context.Context, id string, syncedAt time.Time) error {
+    for i := range r.accounts {
+        if r.accounts[i].ID == id {
+            r.accounts[i].LastSyncedAt = &syncedAt
+        }
+    }
+    return nil
+}
+
+func (r *accountRepository) CreateAccountStats(ctx context.Context, stats *repository.AccountStats) error {
+    r.stats = append(r.stats, *stats)
+    return nil
+}
+
+// createdIDs lists the video IDs registered since the last call
+func (r *accountRepository) createdIDs() []string {
+    var ids []string
+    for _, video := range r.created {
+        ids = append(ids, video.VideoID)
+    }
+    r.created = nil
+    return ids
+}
+
+func sameIDs(got, want []string) bool {
+    if len(got) != len(want) {
+        return false
+    }
+    for i := range got {
+        if got[i] != want[i] {
+            return false
+        }
+    }
+    return true
+}
+
+func reel(id string, published time.Time) platform.InstagramMedia {
+    m := post(id, published)
+    m.MediaType = "VIDEO"
+    m.MediaProductType = "REELS"
+    return m
+}
+
+func TestTrackInstagramAccount(t *testing.T) {
+    now := time.Now()
+    instagram := &stubInstagram{
+        media: map[string][]platform.InstagramMedia{
+            "bluebottle": {
+                reel("hour", now.Add(-time.Hour)),
+                post("photo", now.AddDate(0, 0, -2)),
+                reel("days", now.AddDate(0, 0, -3)),
+                reel("old", now.AddDate(0, 0, -10)),
+            },
+        },
+        failing: map[string]bool{"ratelimited": true},
+    }
+    repo := newAccountRepository()
+    svc := &videoService{repo: repo, instagramClient: instagram}
+    ctx := context.Background()
+
+    account, registered, err := svc.TrackInstagramAccount(ctx, "bluebottle", "coffee", "reels", 5*24*time.Hour)
+    if err != nil {
+        t.Fatal(err)
+    }
+    // Only reels inside the lookback are registered
+    if ids := repo.createdIDs(); registered != 2 || !sameIDs(ids, []string{"hour", "days"}) {
+        t.Fatalf("registered %d: %v, want hour and days", registered, ids)
+    }
+    for _, video := range repo.existing {
+        if video.Tag != "coffee" || video.AccountID != account.ID || video.InstagramUsername != "bluebottle" {
+            t.Errorf("video %+v not linked to the account", video)
+        }
+    }
+    if repo.accounts[0].LastSyncedAt == nil {
+        t.Error("initial sync time not recorded")
+    }
+
+    if _, _, err := svc.TrackInstagramAccount(ctx, "bluebottle", "", "", 0); ErrorCode(err) != CodeDuplicate {
+        t.Errorf("tracking again: err = %v, want duplicate", err)
+    }
+    if _, _, err := svc.TrackInstagramAccount(ctx, "ratelimited", "", "", 0); ErrorCode(err) != CodeUpstream || !errors.Is(err, errStubUpstream) {
+        t.Errorf("unreachable account: err = %v, want upstream", err)
+    }
+    if len(repo.accounts) != 1 {
+        t.Errorf("stored %d accounts, want the unreachable one skipped", len(repo.accounts))
+    }
+
+    // A re-sync reads back past the last sync and skips what it already has
+    instagram.media["bluebottle"] = append([]platform.InstagramMedia{reel("new", now)}, instagram.media["bluebottle"]...)
+    if err := svc.SyncTrackedAccounts(ctx); err != nil {
+        t.Fatal(err)
+    }
+    if ids := repo.createdIDs(); !sameIDs(ids, []string{"new"}) {
+        t.Errorf("re-sync registered %v, want only new", ids)
+    }
+}
+
+func TestTrackChannel(t *testing.T) {
+    now := time.Now()
+    channel := &platform.YouTubeChannel{ID: "UCroast", Title: "Roastery", Handle: "@roastery", UploadsPlaylistID: "UUroast"}
+    youtube := &stubYouTube{
+        channels: map[string]*platform.YouTubeChannel{"@roastery": channel, "UCroast": channel},
+        uploads: map[string][]platform.YouTubeUpload{
+            "UUroast": {
+                {VideoID: "today", PublishedAt: now.Add(-time.Hour)},
+                {VideoID: "lastweek", PublishedAt: now.AddDate(0, 0, -6)},
+                {VideoID: "lastmonth", PublishedAt: now.AddDate(0, -1, 0)},
+            },
+        },
+    }
+    repo := newAccountRepository()
+    svc := &videoService{repo: repo, youtubeClient: youtube}
+    ctx := context.Background()
+
+    account, registered, err := svc.TrackChannel(ctx, " @roastery ", "beans", 7*24*time.Hour)
+    if err != nil {
+        t.Fatal(err)
+    }
+    // Uploads older than the lookback are left alone
+    if ids := repo.createdIDs(); registered != 2 || !sameIDs(ids, []string{"today", "lastweek"}) {
+        t.Fatalf("registered %d: %v, want today and lastweek", registered, ids)
+    }
+    if account.AccountID != "UCroast" || account.UploadsPlaylistID != "UUroast" {
+        t.Errorf("account = %+v", account)
+    }
+    for _, video := range repo.existing {
+        if video.Tag != "beans" || video.AccountID != account.ID || video.PublishedAt == nil {
+            t.Errorf("video %+v not linked to the channel", video)
+        }
+    }
+
+    if _, _, err := svc.TrackChannel(ctx, "UCroast", "", 0); ErrorCode(err) != CodeDuplicate {
+        t.Errorf("tracking by ID again: err = %v, want duplicate", err)
+    }
+    if _, _, err := svc.TrackChannel(ctx, "@nobody", "", 0); ErrorCode(err) != CodeNotFound {
+        t.Errorf("unknown channel: err = %v, want not found", err)
+    }
+    if _, _, err := svc.TrackChannel(ctx, "@roastery", "", -time.Hour); ErrorCode(err) != CodeValidation {
+        t.Errorf("negative lookback: err = %v, want validation", err)
+    }
+
+    // The overlap re-reads today's upload, which is not registered twice
+    youtube.uploads["UUroast"] = append([]platform.YouTubeUpload{{VideoID: "new", PublishedAt: now}}, youtube.uploads["UUroast"]...)
+    if err := svc.SyncTrackedAccounts(ctx); err != nil {
+        t.Fatal(err)
+    }
+    if ids := repo.createdIDs(); !sameIDs(ids, []string{"new"}) {
+        t.Errorf("re-sync registered %v, want only new", ids)
+    }
+
+    youtube.err = errStubUpstream
+    if _, _, err := svc.TrackChannel(ctx, "@other", "", 0); ErrorCode(err) != CodeUpstream {
+        t.Errorf("outage: err = %v, want upstream", err)
+    }
+}
+
+func TestSyncTrackedAccountsSkipsInactive(t *testing.T) {
+    repo := newAccountRepository()
+    repo.accounts = []repository.TrackedAccount{
+        {ID: "1", Platform: repository.PlatformYouTube, AccountID: "UCpaused", UploadsPlaylistID: "UUpaused", State: repository.AccountPaused, CreatedAt: time.Now().AddDate(0, 0, -1)},
+    }
+    youtube := &stubYouTube{uploads: map[string][]platform.YouTubeUpload{
+        "UUpaused": {{VideoID: "fresh", PublishedAt: time.Now()}},
+    }}
+    svc := &videoService{repo: repo, youtubeClient: youtube}
+
+    if err := svc.SyncTrackedAccounts(context.Background()); err != nil {
+        t.Fatal(err)
+    }
+    if ids := repo.createdIDs(); len(ids) != 0 {
+        t.Errorf("registered %v from an inactive account", ids)
+    }
+}
+
+func TestUpdateAccountStats(t *testing.T) {
+    repo := newAccountRepository()
+    repo.accounts = []repository.TrackedAccount{
+        {ID: "1", Platform: repository.PlatformYouTube, AccountID: "UCroast", State: repository.AccountActive},
+        {ID: "2", Platform: repository.PlatformInstagram, AccountID: "ratelimited", State: repository.AccountActive},
+        {ID: "3", Platform: repository.PlatformInstagram, AccountID: "bluebottle", State: repository.AccountActive},
+        {ID: "4", Platform: repository.PlatformInstagram, AccountID: "dormant", State: repository.AccountPaused},
+        {ID: "5", Platform: repository.PlatformYouTube, AccountID: "UCgone", State: repository.AccountActive},
+    }
+    svc := &videoService{
+        repo: repo,
+        youtubeClient: &stubYouTube{stats: map[string]*platform.YouTubeChannelStats{
+            "UCroast": {Subscribers: 1200, Views: 90000, Videos: 45},
+        }},
+        instagramClient: &stubInstagram{
+            stats: map[string]*platform.InstagramAccountStats{
+                "bluebottle": {FollowersCount: 5300, MediaCount: 310},
+                "dormant":    {FollowersCount: 10, MediaCount: 1},
+            },
+            failing: map[string]bool{"ratelimited": true},
+        },
+    }
+
+    before := time.Now()
+    if err := svc.UpdateAccountStats(context.Background()); err != nil {
+        t.Fatal(err)
+    }
+
+    // Failing lookups are skipped without stopping the other accounts, and
+    // paused accounts are not polled
+    want := []repository.AccountStats{
+        {AccountID: "1", Followers: 1200, MediaCount: 45, Views: 90000},
+        {AccountID: "3", Followers: 5300, MediaCount: 310},
+    }
+    if len(repo.stats) != len(want) {
+        t.Fatalf("stored %+v, want %d snapshots", repo.stats, len(want))
+    }
+    for i, stats := range repo.stats {
+        if stats.Timestamp.Before(before) {
+            t.Errorf("snapshot %d at %v, want the poll time", i, stats.Timestamp)
+        }
+        stats.Timestamp = time.Time{}
+        if stats != want[i] {
+            t.Errorf("snapshot %d = %+v, want %+v", i, stats, want[i])
+        }
+    }
+}
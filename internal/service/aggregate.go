@@ -0,0 +1,156 @@
+package service
+
+import (
+    "context"
+    "time"
+    "video-stats-tracker/internal/repository"
+)
+
+// GetStatsBuckets returns a video's stats aggregated into hourly, daily or
+// weekly buckets. With fill set, buckets without samples between the first
+// bucket with data and the end of the range are filled in: cumulative
+// aggregations carry the previous value forward and deltas are zero. With
+// excludeFlagged, samples marked by the anomaly detector are left out.
+func (s *videoService) GetStatsBuckets(ctx context.Context, videoID string, from, to time.Time, interval, agg string, fill, excludeFlagged bool) ([]repository.StatsBucket, error) {
+    agg, err := checkBucketQuery(interval, agg)
+    if err != nil {
+        return nil, err
+    }
+
+    if _, err := s.checkStatsQuery(ctx, videoID, from, to); err != nil {
+        return nil, err
+    }
+
+    buckets, err := s.repo.GetStatsBuckets(ctx, videoID, from, to, interval, agg, excludeFlagged)
+    if err != nil {
+        return nil, err
+    }
+    if !fill || len(buckets) == 0 {
+        return buckets, nil
+    }
+    return fillBuckets(buckets, to, interval, agg), nil
+}
+
+// checkBucketQuery validates a bucket interval and aggregation, returning
+// the aggregation with its default applied
+func checkBucketQuery(interval, agg string) (string, error) {
+    if interval != repository.IntervalHour && interval != repository.IntervalDay && interval != repository.IntervalWeek {
+        return "", Errorf(CodeValidation, "unsupported interval: %s (use 1h, 1d or 1w)", interval)
+    }
+    if agg == "" {
+        agg = repository.AggLast
+    }
+    if agg != repository.AggLast && agg != repository.AggMax && agg != repository.AggDelta {
+        return "", Errorf(CodeValidation, "unsupported agg: %s (use last, max or delta)", agg)
+    }
+    return agg, nil
+}
+
+// fillBuckets inserts the missing buckets of a sorted series up to the bucket
+// containing end
+func fillBuckets(buckets []repository.StatsBucket, end time.Time, interval, agg string) []repository.StatsBucket {
+    last := truncateBucket(end, interval)
+    filled := make([]repository.StatsBucket, 0, len(buckets))
+
+    i := 0
+    prev := buckets[0]
+    for start := buckets[0].Bucket; !start.After(last); start = nextBucket(start, interval) {
+        if i < len(buckets) && buckets[i].Bucket.Equal(start) {
+            prev = buckets[i]
+            filled = append(filled, prev)
+            i++
+            continue
+        }
+
+        gap := repository.StatsBucket{Bucket: start, Filled: true}
+        if agg != repository.AggDelta {
+            gap.Views, gap.Likes, gap.Comments = prev.Views, prev.Likes, prev.Comments
+        }
+        filled = append(filled, gap)
+    }
+    return filled
+}
+
+// truncateBucket returns the start of the UTC bucket containing t, matching
+// the SQL bucketing (weeks start on Monday)
+func truncateBucket(t time.Time, interval string) time.Time {
+    t = t.UTC()
+    switch interval {
+    case repository.IntervalHour:
+        return t.Truncate(time.Hour)
+    case repository.IntervalWeek:
+        day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+        return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+    default:
+        return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+    }
+}
+
+func nextBucket(t time.Time, interval string) time.Time {
+    switch interval {
+    case repository.IntervalHour:
+        return t.Add(time.Hour)
+    case repository.IntervalWeek:
+        return t.AddDate(0, 0, 7)
+    default:
+        return t.AddDate(0, 0, 1)
+    }
+}
+
+// Limits of expanded series, which are built in memory: the step must be at
+// least MinExpandStep and the range may span at most MaxExpandPoints steps
+const (
+    MinExpandStep   = time.Minute
+    MaxExpandPoints = 50000
+)
+
+// CheckExpand validates an expand step for the range [from, to]
+func CheckExpand(step time.Duration, from, to time.Time) error {
+    if step < MinExpandStep {
+        return Errorf(CodeValidation, "expand must be at least %s", MinExpandStep)
+    }
+    if points := to.Sub(from) / step; points > MaxExpandPoints {
+        return Errorf(CodeValidation, "expand=%s yields %d points over this range, more than %d: use a larger step or a shorter range",
+            step, points, MaxExpandPoints)
+    }
+    return nil
+}
+
+// ExpandStats turns collapsed samples back into a regular series: each
+// sample that was seen again later is repeated every step until its
+// last_seen_at. Only points within [from, to] are returned, so the result
+// holds at most one point per step of the range and sample; see CheckExpand.
+func ExpandStats(stats []repository.VideoStats, step time.Duration, from, to time.Time) []repository.VideoStats {
+    if step <= 0 {
+        return stats
+    }
+
+    expanded := make([]repository.VideoStats, 0, len(stats))
+    for _, stat := range stats {
+        end := stat.Timestamp
+        if stat.LastSeenAt != nil {
+            end = *stat.LastSeenAt
+        }
+
+        // Samples collapsed long before the range start at its first step
+        start := stat.Timestamp
+        if start.Before(from) {
+            start = start.Add(from.Sub(start) / step * step)
+        }
+        for t := start; ; t = t.Add(step) {
+            if t.After(end) {
+                t = end
+            }
+            if !t.Before(from) && !t.After(to) {
+                point := stat
+                point.Timestamp = t
+                point.LastSeenAt = nil
+                expanded = append(expanded, point)
+            }
+            if !t.Before(end) {
+                break
+            }
+        }
+    }
+    return expanded
+}
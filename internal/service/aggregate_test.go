@@ -0,0 +1,135 @@
+package service
+
+import (
+    "testing"
+    "time"
+    "video-stats-tracker/internal/repository"
+)
+
+func TestFillBuckets(t *testing.T) {
+    base := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+    buckets := []repository.StatsBucket{
+        {Bucket: base, Samples: 2, Views: 100, Likes: 10},
+        {Bucket: base.Add(3 * time.Hour), Samples: 1, Views: 400, Likes: 40},
+    }
+
+    tests := []struct {
+        name   string
+        agg    string
+        end    time.Time
+        views  []int
+        filled []bool
+    }{
+        {"cumulative values carry forward", repository.AggLast, base.Add(4*time.Hour + 30*time.Minute),
+            []int{100, 100, 100, 400, 400}, []bool{false, true, true, false, true}},
+        {"deltas are zero in gaps", repository.AggDelta, base.Add(3 * time.Hour),
+            []int{100, 0, 0, 400}, []bool{false, true, true, false}},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got := fillBuckets(buckets, tt.end, repository.IntervalHour, tt.agg)
+            if len(got) != len(tt.views) {
+                t.Fatalf("got %d buckets %+v, want %d", len(got), got, len(tt.views))
+            }
+            for i := range got {
+                if got[i].Views != tt.views[i] || got[i].Filled != tt.filled[i] {
+                    t.Errorf("bucket %d = views %d filled %v, want %d %v", i, got[i].Views, got[i].Filled, tt.views[i], tt.filled[i])
+                }
+                if i > 0 && !got[i].Bucket.After(got[i-1].Bucket) {
+                    t.Errorf("bucket %d at %s does not follow %s", i, got[i].Bucket, got[i-1].Bucket)
+                }
+            }
+        })
+    }
+}
+
+func TestTruncateBucket(t *testing.T) {
+    at := time.Date(2025, 3, 16, 23, 45, 0, 0, time.FixedZone("CET", 3600)) // Sunday 22:45 UTC
+    tests := []struct {
+        interval string
+        want     time.Time
+    }{
+        {repository.IntervalHour, time.Date(2025, 3, 16, 22, 0, 0, 0, time.UTC)},
+        {repository.IntervalDay, time.Date(2025, 3, 16, 0, 0, 0, 0, time.UTC)},
+        {repository.IntervalWeek, time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)},
+    }
+    for _, tt := range tests {
+        if got := truncateBucket(at, tt.interval); !got.Equal(tt.want) {
+            t.Errorf("truncateBucket(%s, %s) = %s, want %s", at, tt.interval, got, tt.want)
+        }
+        if next := nextBucket(tt.want, tt.interval); !next.After(tt.want) {
+            t.Errorf("nextBucket(%s, %s) = %s", tt.want, tt.interval, next)
+        }
+    }
+}
+
+func TestCheckBucketQuery(t *testing.T) {
+    if agg, err := checkBucketQuery(repository.IntervalDay, ""); err != nil || agg != repository.AggLast {
+        t.Errorf("default aggregation = %q, %v", agg, err)
+    }
+    if _, err := checkBucketQuery("2h", repository.AggLast); ErrorCode(err) != CodeValidation {
+        t.Errorf("unsupported interval: %v", err)
+    }
+    if _, err := checkBucketQuery(repository.IntervalHour, "sum"); ErrorCode(err) != CodeValidation {
+        t.Errorf("unsupported aggregation: %v", err)
+    }
+}
+
+func TestExpandStats(t *testing.T) {
+    base := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+    seen := base.Add(10 * time.Minute)
+    stats := []repository.VideoStats{
+        {ID: "1", Timestamp: base, Views: 100, LastSeenAt: &seen},
+        {ID: "2", Timestamp: base.Add(12 * time.Minute), Views: 150},
+    }
+
+    tests := []struct {
+        name  string
+        step  time.Duration
+        from  time.Time
+        to    time.Time
+        times []time.Duration // offsets from base
+    }{
+        {"repeats up to last_seen_at", 4 * time.Minute, base, base.Add(time.Hour), []time.Duration{0, 4, 8, 10, 12}},
+        {"clips to the range", 4 * time.Minute, base.Add(5 * time.Minute), base.Add(11 * time.Minute), []time.Duration{8, 10}},
+        {"zero step keeps the rows", 0, base, base.Add(time.Hour), []time.Duration{0, 12}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got := ExpandStats(stats, tt.step, tt.from, tt.to)
+            if len(got) != len(tt.times) {
+                t.Fatalf("got %d points %+v, want %d", len(got), got, len(tt.times))
+            }
+            for i, offset := range tt.times {
+                if want := base.Add(offset * time.Minute); tt.step > 0 && !got[i].Timestamp.Equal(want) {
+                    t.Errorf("point %d at %s, want %s", i, got[i].Timestamp, want)
+                }
+                if tt.step > 0 && got[i].LastSeenAt != nil {
+                    t.Errorf("point %d keeps last_seen_at", i)
+                }
+            }
+        })
+    }
+}
+
+func TestCheckExpand(t *testing.T) {
+    from := time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)
+    tests := []struct {
+        step time.Duration
+        to   time.Time
+        ok   bool
+    }{
+        {time.Minute, from.AddDate(0, 0, 7), true},
+        {time.Nanosecond, from.Add(time.Hour), false},
+        {59 * time.Second, from.Add(time.Hour), false},
+        {time.Minute, from.AddDate(0, 0, 60), false},
+        {time.Hour, from.AddDate(1, 0, 0), true},
+    }
+    for _, tt := range tests {
+        err := CheckExpand(tt.step, from, tt.to)
+        if (err == nil) != tt.ok || (err != nil && ErrorCode(err) != CodeValidation) {
+            t.Errorf("CheckExpand(%s, %s) = %v, want ok=%v", tt.step, tt.to.Sub(from), err, tt.ok)
+        }
+    }
+}
@@ -0,0 +1,334 @@
+package service
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "strings"
+    "time"
+    "video-stats-tracker/internal/repository"
+)
+
+// Webhook events sent by the webhook notifier
+const (
+    EventAlertFiring   = "alert.firing"
+    EventAlertResolved = "alert.resolved"
+)
+
+// Notifier delivers alert state changes. Rules pick notifiers by name; a
+// rule without notifiers uses all of them.
+type Notifier interface {
+    Name() string
+    Notify(ctx context.Context, notification AlertNotification) error
+}
+
+// AlertNotification describes an alert that started firing or resolved
+type AlertNotification struct {
+    Rule  repository.AlertRule `json:"rule"`
+    Alert repository.Alert     `json:"alert"`
+    Video repository.Video     `json:"video"`
+}
+
+// LogNotifier writes alerts to the process log
+type LogNotifier struct{}
+
+func (LogNotifier) Name() string { return "log" }
+
+func (LogNotifier) Notify(_ context.Context, n AlertNotification) error {
+    log.Printf("Alert %s: rule %q on video %s: %s", n.Alert.State, n.Rule.Name, n.Video.VideoID, n.Alert.Message)
+    return nil
+}
+
+// WebhookNotifier queues alert.firing and alert.resolved webhook events
+type WebhookNotifier struct {
+    service Service
+}
+
+func NewWebhookNotifier(s Service) *WebhookNotifier {
+    return &WebhookNotifier{service: s}
+}
+
+func (n *WebhookNotifier) Name() string { return "webhook" }
+
+func (n *WebhookNotifier) Notify(ctx context.Context, notification AlertNotification) error {
+    event := EventAlertFiring
+    if notification.Alert.State == repository.AlertResolved {
+        event = EventAlertResolved
+    }
+    return n.service.Publish(ctx, event, notification)
+}
+
+// WithNotifiers replaces the default log and webhook notifiers
+func WithNotifiers(notifiers ...Notifier) Option {
+    return func(s *videoService) {
+        s.notifiers = notifiers
+    }
+}
+
+var alertOperators = map[string]func(a, b float64) bool{
+    "<":  func(a, b float64) bool { return a < b },
+    "<=": func(a, b float64) bool { return a <= b },
+    ">":  func(a, b float64) bool { return a > b },
+    ">=": func(a, b float64) bool { return a >= b },
+}
+
+// CreateAlertRule validates and stores a rule
+func (s *videoService) CreateAlertRule(ctx context.Context, rule *repository.AlertRule) error {
+    if rule.ScopeType == "" {
+        rule.ScopeType = repository.ScopeAll
+    }
+    switch rule.ScopeType {
+    case repository.ScopeAll:
+        rule.ScopeValue = ""
+    case repository.ScopeVideo, repository.ScopeTag:
+        if rule.ScopeValue == "" {
+            return Errorf(CodeValidation, "scope_value is required for %s scope", rule.ScopeType)
+        }
+    case repository.ScopePlatform:
+        if rule.ScopeValue != repository.PlatformYouTube && rule.ScopeValue != repository.PlatformInstagram {
+            return Errorf(CodeValidation, "scope_value must be youtube or instagram for platform scope")
+        }
+    default:
+        return Errorf(CodeValidation, "unsupported scope_type: %s (use all, video, tag or platform)", rule.ScopeType)
+    }
+
+    if rule.Metric != "views" && rule.Metric != "likes" && rule.Metric != "comments" {
+        return Errorf(CodeValidation, "unsupported metric: %s (use views, likes or comments)", rule.Metric)
+    }
+
+    switch rule.Kind {
+    case repository.RuleThreshold:
+        if _, ok := alertOperators[rule.Operator]; !ok {
+            return Errorf(CodeValidation, "unsupported operator: %q (use <, <=, > or >=)", rule.Operator)
+        }
+        rule.Window = ""
+    case repository.RuleGrowth:
+        if _, ok := alertOperators[rule.Operator]; !ok {
+            return Errorf(CodeValidation, "unsupported operator: %q (use <, <=, > or >=)", rule.Operator)
+        }
+        if err := requirePositiveDuration("window", rule.Window); err != nil {
+            return err
+        }
+    case repository.RuleStalled:
+        if err := requirePositiveDuration("window", rule.Window); err != nil {
+            return err
+        }
+        rule.Operator, rule.Value = "", 0
+    default:
+        return Errorf(CodeValidation, "unsupported kind: %s (use threshold, growth or stalled)", rule.Kind)
+    }
+
+    if rule.MinAge != "" {
+        if err := requirePositiveDuration("min_age", rule.MinAge); err != nil {
+            return err
+        }
+    }
+
+    for _, name := range rule.Notifiers {
+        if s.notifier(name) == nil {
+            return Errorf(CodeValidation, "unknown notifier: %s", name)
+        }
+    }
+    if rule.Notifiers == nil {
+        rule.Notifiers = repository.StringList{}
+    }
+    if rule.Name == "" {
+        rule.Name = describeRule(rule)
+    }
+
+    return s.repo.CreateAlertRule(ctx, rule)
+}
+
+func requirePositiveDuration(field, value string) error {
+    d, err := time.ParseDuration(value)
+    if err != nil || d <= 0 {
+        return Errorf(CodeValidation, "%s must be a positive duration such as 1h or 24h", field)
+    }
+    return nil
+}
+
+// describeRule names a rule after its condition, e.g. "views < 1000 after 24h"
+func describeRule(rule *repository.AlertRule) string {
+    var desc string
+    switch rule.Kind {
+    case repository.RuleThreshold:
+        desc = fmt.Sprintf("%s %s %g", rule.Metric, rule.Operator, rule.Value)
+    case repository.RuleGrowth:
+        desc = fmt.Sprintf("%s grew %s %g%% in %s", rule.Metric, rule.Operator, rule.Value, rule.Window)
+    case repository.RuleStalled:
+        desc = fmt.Sprintf("%s stalled for %s", rule.Metric, rule.Window)
+    }
+    if rule.MinAge != "" {
+        desc += " after " + rule.MinAge
+    }
+    return desc
+}
+
+func (s *videoService) GetAlertRules(ctx context.Context) ([]repository.AlertRule, error) {
+    return s.repo.GetAlertRules(ctx)
+}
+
+func (s *videoService) DeleteAlertRule(ctx context.Context, id string) error {
+    deleted, err := s.repo.DeleteAlertRule(ctx, id)
+    if err != nil {
+        return err
+    }
+    if !deleted {
+        return Errorf(CodeNotFound, "alert rule not found: %s", id)
+    }
+    return nil
+}
+
+// GetAlerts lists alerts, optionally only firing or resolved ones
+func (s *videoService) GetAlerts(ctx context.Context, state string, limit int) ([]repository.Alert, error) {
+    if state != "" && state != repository.AlertFiring && state != repository.AlertResolved {
+        return nil, Errorf(CodeValidation, "unsupported state: %s (use firing or resolved)", state)
+    }
+    if limit <= 0 || limit > 500 {
+        limit = 100
+    }
+    return s.repo.GetAlerts(ctx, state, limit)
+}
+
+// EvaluateAlerts checks every rule matching the video against its latest
+// stats. A rule whose condition holds opens a firing alert unless one is
+// already open; an open alert whose condition no longer holds is resolved.
+// Rules that cannot be evaluated yet (too little history, video younger
+// than min_age) leave the alert state unchanged. The poller loads rules once
+// per run and passes them to every video.
+func (s *videoService) EvaluateAlerts(ctx context.Context, video *repository.Video, rules []repository.AlertRule) error {
+    now := time.Now()
+    for i := range rules {
+        rule := &rules[i]
+        if !rule.Matches(video) {
+            continue
+        }
+
+        firing, value, message, ok, err := s.checkRule(ctx, rule, video, now)
+        if err != nil {
+            return err
+        }
+        if !ok {
+            continue
+        }
+
+        open, err := s.repo.GetFiringAlert(ctx, rule.ID, video.VideoID)
+        if err != nil {
+            return err
+        }
+
+        switch {
+        case firing && open == nil:
+            alert := &repository.Alert{
+                RuleID:  rule.ID,
+                VideoID: video.VideoID,
+                State:   repository.AlertFiring,
+                Value:   value,
+                Message: message,
+                FiredAt: now,
+            }
+            created, err := s.repo.CreateAlert(ctx, alert)
+            if err != nil {
+                return err
+            }
+            if created {
+                s.notify(ctx, rule, alert, video)
+            }
+        case !firing && open != nil:
+            if err := s.repo.ResolveAlert(ctx, open.ID, value, message, now); err != nil {
+                return err
+            }
+            open.State, open.Value, open.Message, open.ResolvedAt = repository.AlertResolved, value, message, &now
+            s.notify(ctx, rule, open, video)
+        }
+    }
+    return nil
+}
+
+// checkRule evaluates one rule. ok is false when the rule cannot be decided
+// yet.
+func (s *videoService) checkRule(ctx context.Context, rule *repository.AlertRule, video *repository.Video, now time.Time) (firing bool, value float64, message string, ok bool, err error) {
+    if rule.MinAge != "" {
+        minAge, _ := time.ParseDuration(rule.MinAge)
+        start := video.CreatedAt
+        if video.PublishedAt != nil {
+            start = *video.PublishedAt
+        }
+        if now.Sub(start) < minAge {
+            return false, 0, "", false, nil
+        }
+    }
+
+    // Samples flagged by the anomaly detector never trigger alerts
+    latest, err := s.repo.GetStatsAt(ctx, video.VideoID, now)
+    if err != nil || latest == nil {
+        return false, 0, "", false, err
+    }
+    current := float64(metricValue(latest, rule.Metric))
+
+    if rule.Kind == repository.RuleThreshold {
+        firing = alertOperators[rule.Operator](current, rule.Value)
+        return firing, current, fmt.Sprintf("%s is %g (%s %g)", rule.Metric, current, rule.Operator, rule.Value), true, nil
+    }
+
+    window, _ := time.ParseDuration(rule.Window)
+    base, err := s.repo.GetStatsAt(ctx, video.VideoID, now.Add(-window))
+    if err != nil || base == nil {
+        return false, 0, "", false, err
+    }
+    previous := float64(metricValue(base, rule.Metric))
+
+    if rule.Kind == repository.RuleStalled {
+        firing = current == previous
+        return firing, current, fmt.Sprintf("%s unchanged at %g for %s", rule.Metric, current, rule.Window), true, nil
+    }
+
+    if previous <= 0 {
+        return false, 0, "", false, nil
+    }
+    growth := (current - previous) / previous * 100
+    firing = alertOperators[rule.Operator](growth, rule.Value)
+    return firing, growth, fmt.Sprintf("%s grew %.1f%% in %s (%s %g%%)", rule.Metric, growth, rule.Window, rule.Operator, rule.Value), true, nil
+}
+
+func metricValue(stats *repository.VideoStats, metric string) int {
+    switch metric {
+    case "likes":
+        return stats.Likes
+    case "comments":
+        return stats.Comments
+    }
+    return stats.Views
+}
+
+func (s *videoService) notifier(name string) Notifier {
+    for _, n := range s.notifiers {
+        if strings.EqualFold(n.Name(), name) {
+            return n
+        }
+    }
+    return nil
+}
+
+// notify sends an alert through the rule's notifiers; failures are logged
+// so one broken notifier does not hold up the others
+func (s *videoService) notify(ctx context.Context, rule *repository.AlertRule, alert *repository.Alert, video *repository.Video) {
+    notification := AlertNotification{Rule: *rule, Alert: *alert, Video: *video}
+    for _, n := range s.notifiers {
+        if len(rule.Notifiers) > 0 && !containsFold(rule.Notifiers, n.Name()) {
+            continue
+        }
+        if err := n.Notify(ctx, notification); err != nil {
+            log.Printf("Error sending alert %s via %s: %v", alert.ID, n.Name(), err)
+        }
+    }
+}
+
+func containsFold(values []string, value string) bool {
+    for _, v := range values {
+        if strings.EqualFold(v, value) {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,238 @@
+package service
+
+import (
+    "context"
+    "testing"
+    "time"
+    "video-stats-tracker/internal/repository"
+)
+
+// alertRepository serves samples oldest first and keeps rules and alerts in
+// memory. Like the database it never returns flagged samples.
+type alertRepository struct {
+    repository.Repository
+    samples []repository.VideoStats
+    rules   []repository.AlertRule
+    alerts  []repository.Alert
+    raced   bool
+}
+
+func (r *alertRepository) GetStatsAt(ctx context.Context, videoID string, at time.Time) (*repository.VideoStats, error) {
+    var latest *repository.VideoStats
+    for i := range r.samples {
+        sample := &r.samples[i]
+        if sample.VideoID == videoID && !sample.Flagged && !sample.Timestamp.After(at) {
+            latest = sample
+        }
+    }
+    return latest, nil
+}
+
+func (r *alertRepository) CreateAlertRule(ctx context.Context, rule *repository.AlertRule) error {
+    r.rules = append(r.rules, *rule)
+    return nil
+}
+
+func (r *alertRepository) GetFiringAlert(ctx context.Context, ruleID, videoID string) (*repository.Alert, error) {
+    for i := range r.alerts {
+        if a := r.alerts[i]; a.RuleID == ruleID && a.VideoID == videoID && a.State == repository.AlertFiring {
+            return &a, nil
+        }
+    }
+    return nil, nil
+}
+
+// CreateAlert reports false when raced, as if another evaluation had opened
+// the alert first
+func (r *alertRepository) CreateAlert(ctx context.Context, alert *repository.Alert) (bool, error) {
+    if r.raced {
+        return false, nil
+    }
+    alert.ID = alert.RuleID + "/" + alert.VideoID + "/" + time.Duration(len(r.alerts)).String()
+    r.alerts = append(r.alerts, *alert)
+    return true, nil
+}
+
+func (r *alertRepository) ResolveAlert(ctx context.Context, id string, value float64, message string, at time.Time) error {
+    for i := range r.alerts {
+        if r.alerts[i].ID == id {
+            r.alerts[i].State, r.alerts[i].Value, r.alerts[i].Message, r.alerts[i].ResolvedAt = repository.AlertResolved, value, message, &at
+        }
+    }
+    return nil
+}
+
+// recordingNotifier collects the notifications sent through it
+type recordingNotifier struct {
+    name string
+    sent []AlertNotification
+}
+
+func (n *recordingNotifier) Name() string { return n.name }
+
+func (n *recordingNotifier) Notify(ctx context.Context, notification AlertNotification) error {
+    n.sent = append(n.sent, notification)
+    return nil
+}
+
+// sentStates lists the rule and state of each notification since the last
+// call
+func (n *recordingNotifier) sentStates() []string {
+    var states []string
+    for _, notification := range n.sent {
+        states = append(states, notification.Rule.ID+" "+notification.Alert.State)
+    }
+    n.sent = nil
+    return states
+}
+
+func TestCreateAlertRule(t *testing.T) {
+    tests := []struct {
+        name string
+        rule repository.AlertRule
+        code string
+        want string
+    }{
+        {"threshold after min age", repository.AlertRule{Kind: repository.RuleThreshold, Metric: "views", Operator: "<", Value: 1000, Window: "1h", MinAge: "24h"}, "", "views < 1000 after 24h"},
+        {"growth", repository.AlertRule{Kind: repository.RuleGrowth, Metric: "likes", Operator: ">", Value: 20, Window: "1h", ScopeType: repository.ScopeTag, ScopeValue: "launch"}, "", "likes grew > 20% in 1h"},
+        {"stalled", repository.AlertRule{Kind: repository.RuleStalled, Metric: "comments", Operator: ">", Value: 3, Window: "6h", Notifiers: repository.StringList{"pager"}}, "", "comments stalled for 6h"},
+        {"named", repository.AlertRule{Name: "slow start", Kind: repository.RuleThreshold, Metric: "views", Operator: "<", Value: 10}, "", "slow start"},
+        {"unknown scope", repository.AlertRule{ScopeType: "channel", Kind: repository.RuleThreshold, Metric: "views", Operator: "<"}, CodeValidation, ""},
+        {"scope without value", repository.AlertRule{ScopeType: repository.ScopeVideo, Kind: repository.RuleThreshold, Metric: "views", Operator: "<"}, CodeValidation, ""},
+        {"unknown platform", repository.AlertRule{ScopeType: repository.ScopePlatform, ScopeValue: "vimeo", Kind: repository.RuleThreshold, Metric: "views", Operator: "<"}, CodeValidation, ""},
+        {"unknown metric", repository.AlertRule{Kind: repository.RuleThreshold, Metric: "shares", Operator: "<"}, CodeValidation, ""},
+        {"unknown operator", repository.AlertRule{Kind: repository.RuleGrowth, Metric: "views", Operator: "=", Window: "1h"}, CodeValidation, ""},
+        {"growth without window", repository.AlertRule{Kind: repository.RuleGrowth, Metric: "views", Operator: ">"}, CodeValidation, ""},
+        {"negative window", repository.AlertRule{Kind: repository.RuleStalled, Metric: "views", Window: "-1h"}, CodeValidation, ""},
+        {"bad min age", repository.AlertRule{Kind: repository.RuleThreshold, Metric: "views", Operator: "<", MinAge: "a day"}, CodeValidation, ""},
+        {"unknown kind", repository.AlertRule{Kind: "spike", Metric: "views"}, CodeValidation, ""},
+        {"unknown notifier", repository.AlertRule{Kind: repository.RuleThreshold, Metric: "views", Operator: "<", Notifiers: repository.StringList{"email"}}, CodeValidation, ""},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            repo := &alertRepository{}
+            svc := &videoService{repo: repo, notifiers: []Notifier{&recordingNotifier{name: "log"}, &recordingNotifier{name: "pager"}}}
+
+            err := svc.CreateAlertRule(context.Background(), &tt.rule)
+            if tt.code != "" {
+                if ErrorCode(err) != tt.code || len(repo.rules) != 0 {
+                    t.Fatalf("err = %v, want %s and nothing stored", err, tt.code)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            rule := repo.rules[0]
+            if rule.Name != tt.want || rule.Notifiers == nil || rule.ScopeType == "" {
+                t.Errorf("stored %+v, want it named %q with defaults filled in", rule, tt.want)
+            }
+            // Fields the kind does not use are cleared
+            if (rule.Kind == repository.RuleThreshold && rule.Window != "") || (rule.Kind == repository.RuleStalled && (rule.Operator != "" || rule.Value != 0)) {
+                t.Errorf("stored %+v with unused fields", rule)
+            }
+        })
+    }
+}
+
+func TestEvaluateAlerts(t *testing.T) {
+    now := time.Now()
+    sample := func(ago time.Duration, views, likes, comments int) repository.VideoStats {
+        return repository.VideoStats{VideoID: "v1", Timestamp: now.Add(-ago), Views: views, Likes: likes, Comments: comments}
+    }
+    repo := &alertRepository{samples: []repository.VideoStats{
+        sample(7*time.Hour, 500, 100, 5),
+        sample(time.Hour, 800, 110, 5),
+        sample(10*time.Minute, 900, 150, 5),
+    }}
+    slack, pager := &recordingNotifier{name: "slack"}, &recordingNotifier{name: "pager"}
+    svc := &videoService{repo: repo, notifiers: []Notifier{slack, pager}}
+    ctx := context.Background()
+
+    video := &repository.Video{VideoID: "v1", Platform: repository.PlatformYouTube, Tags: []string{"launch"}, CreatedAt: now.AddDate(0, 0, -2)}
+    rules := []repository.AlertRule{
+        {ID: "slow", ScopeType: repository.ScopeAll, Kind: repository.RuleThreshold, Metric: "views", Operator: "<", Value: 1000, MinAge: "24h"},
+        {ID: "growing", ScopeType: repository.ScopeTag, ScopeValue: "launch", Kind: repository.RuleGrowth, Metric: "likes", Operator: ">", Value: 20, Window: "1h", Notifiers: repository.StringList{"pager"}},
+        {ID: "quiet", ScopeType: repository.ScopePlatform, ScopeValue: repository.PlatformYouTube, Kind: repository.RuleStalled, Metric: "comments", Window: "6h"},
+        {ID: "other", ScopeType: repository.ScopeVideo, ScopeValue: "v2", Kind: repository.RuleThreshold, Metric: "views", Operator: ">", Value: 0},
+        {ID: "young", ScopeType: repository.ScopeAll, Kind: repository.RuleThreshold, Metric: "views", Operator: ">", Value: 0, MinAge: "72h"},
+        {ID: "longer", ScopeType: repository.ScopeAll, Kind: repository.RuleGrowth, Metric: "views", Operator: ">", Value: 0, Window: "48h"},
+    }
+
+    if err := svc.EvaluateAlerts(ctx, video, rules); err != nil {
+        t.Fatal(err)
+    }
+    // Rules for other videos, younger videos or longer history stay quiet
+    if len(repo.alerts) != 3 {
+        t.Fatalf("opened %+v, want slow, growing and quiet", repo.alerts)
+    }
+    if got := slack.sentStates(); !sameIDs(got, []string{"slow firing", "quiet firing"}) {
+        t.Errorf("slack got %v", got)
+    }
+    if got := pager.sentStates(); !sameIDs(got, []string{"slow firing", "growing firing", "quiet firing"}) {
+        t.Errorf("pager got %v", got)
+    }
+    if growth := repo.alerts[1].Value; growth < 36 || growth > 37 {
+        t.Errorf("growth = %g, want 150 likes over 110 an hour ago", growth)
+    }
+
+    // Open alerts are not opened or sent again while the condition holds
+    if err := svc.EvaluateAlerts(ctx, video, rules); err != nil {
+        t.Fatal(err)
+    }
+    if len(repo.alerts) != 3 || len(slack.sent)+len(pager.sent) != 0 {
+        t.Errorf("re-evaluation opened %d alerts and sent %d notifications", len(repo.alerts)-3, len(slack.sent)+len(pager.sent))
+    }
+
+    // New counts resolve the alerts whose condition cleared
+    repo.samples = append(repo.samples, sample(0, 1200, 150, 6))
+    if err := svc.EvaluateAlerts(ctx, video, rules); err != nil {
+        t.Fatal(err)
+    }
+    if got := slack.sentStates(); !sameIDs(got, []string{"slow resolved", "quiet resolved"}) {
+        t.Errorf("slack got %v", got)
+    }
+    pager.sent = nil
+    for _, alert := range repo.alerts {
+        want := repository.AlertResolved
+        if alert.RuleID == "growing" {
+            want = repository.AlertFiring
+        }
+        if alert.State != want || (want == repository.AlertResolved && alert.ResolvedAt == nil) {
+            t.Errorf("alert %s is %s, want %s", alert.RuleID, alert.State, want)
+        }
+    }
+
+    // An alert opened by a concurrent evaluation is not sent twice
+    repo.samples = append(repo.samples, sample(-time.Second, 900, 150, 6))
+    repo.raced = true
+    if err := svc.EvaluateAlerts(ctx, video, rules); err != nil {
+        t.Fatal(err)
+    }
+    if len(slack.sent)+len(pager.sent) != 0 {
+        t.Errorf("sent %v and %v for an alert opened elsewhere", slack.sentStates(), pager.sentStates())
+    }
+}
+
+func TestEvaluateAlertsIgnoresFlaggedSamples(t *testing.T) {
+    now := time.Now()
+    repo := &alertRepository{samples: []repository.VideoStats{
+        {VideoID: "v1", Timestamp: now.Add(-2 * time.Hour), Views: 400},
+        {VideoID: "v1", Timestamp: now.Add(-time.Minute), Views: 90000, Flagged: true},
+    }}
+    notifier := &recordingNotifier{name: "log"}
+    svc := &videoService{repo: repo, notifiers: []Notifier{notifier}}
+    video := &repository.Video{VideoID: "v1", CreatedAt: now.AddDate(0, 0, -1)}
+    rules := []repository.AlertRule{
+        {ID: "spike", Kind: repository.RuleThreshold, Metric: "views", Operator: ">", Value: 10000},
+        {ID: "jump", Kind: repository.RuleGrowth, Metric: "views", Operator: ">", Value: 100, Window: "1h"},
+    }
+
+    if err := svc.EvaluateAlerts(context.Background(), video, rules); err != nil {
+        t.Fatal(err)
+    }
+    if len(repo.alerts) != 0 || len(notifier.sent) != 0 {
+        t.Errorf("flagged spike opened %+v", repo.alerts)
+    }
+}
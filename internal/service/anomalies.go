@@ -0,0 +1,319 @@
+package service
+
+import (
+    "context"
+    "fmt"
+    "sort"
+    "sync"
+    "time"
+    "video-stats-tracker/internal/repository"
+)
+
+// EventAnomalyDetected is published for every new anomaly
+const EventAnomalyDetected = "anomaly.detected"
+
+// Detector tuning. A spike is an increase of at least SpikeMinIncrease that
+// is also SpikeFactor times what the video's median hourly growth over the
+// last anomalyWindow predicts. A drop is a decrease of at least
+// DropMinDecrease and DropTolerance of the previous count, which leaves room
+// for the small corrections platforms make to their counters. A ratio
+// anomaly is a like/view ratio more than RatioFactor away from the median of
+// at least RatioMinCohort other videos on the same platform.
+const (
+    SpikeMinIncrease = 500
+    SpikeFactor      = 10.0
+    DropMinDecrease  = 10
+    DropTolerance    = 0.01
+    RatioFactor      = 5.0
+    RatioMinViews    = 1000
+    RatioMinCohort   = 5
+    RatioCooldown    = 24 * time.Hour
+    anomalyWindow    = 24 * time.Hour
+    spikeMinRates    = 3
+    // likeCohortTTL is one regular poll run, so each run loads a
+    // platform's ratios once
+    likeCohortTTL = 2 * time.Minute
+)
+
+var anomalyMetrics = []string{"views", "likes", "comments"}
+
+// detectAnomalies checks the latest sample of a video against its recent
+// unflagged history and its cohort, and returns the new anomalies and the IDs
+// of the samples it flagged. Spikes flag the sample that jumped; drops flag
+// the earlier samples that were inflated, or the latest sample when it is
+// below all of the recent history. Ratio anomalies are recorded for review
+// but leave the counts unflagged.
+func (s *videoService) detectAnomalies(ctx context.Context, video *repository.Video) ([]repository.Anomaly, []string, error) {
+    now := time.Now()
+    stats, err := s.repo.GetVideoStats(ctx, video.VideoID, now.Add(-anomalyWindow), now)
+    if err != nil || len(stats) == 0 {
+        return nil, nil, err
+    }
+
+    cur := stats[len(stats)-1]
+    if cur.Flagged {
+        return nil, nil, nil
+    }
+    var history []repository.VideoStats
+    for _, sample := range stats[:len(stats)-1] {
+        if !sample.Flagged {
+            history = append(history, sample)
+        }
+    }
+
+    var found []repository.Anomaly
+    var flagged []string
+    for _, metric := range anomalyMetrics {
+        anomaly, ids := checkCounter(history, &cur, metric)
+        if anomaly != nil {
+            found = append(found, *anomaly)
+            flagged = append(flagged, ids...)
+        }
+    }
+
+    ratio, err := s.checkLikeRatio(ctx, video, &cur, now)
+    if err != nil {
+        return nil, nil, err
+    }
+    if ratio != nil {
+        found = append(found, *ratio)
+    }
+
+    if err := s.repo.FlagVideoStats(ctx, flagged); err != nil {
+        return nil, nil, err
+    }
+
+    var created []repository.Anomaly
+    for _, anomaly := range found {
+        anomaly.DetectedAt = now
+        isNew, err := s.repo.CreateAnomaly(ctx, &anomaly)
+        if err != nil {
+            return nil, flagged, err
+        }
+        if isNew {
+            s.publish(ctx, EventAnomalyDetected, anomaly)
+            created = append(created, anomaly)
+        }
+    }
+    return created, flagged, nil
+}
+
+// checkCounter looks for a drop or a spike of one counter and returns the
+// anomaly with the samples to flag
+func checkCounter(history []repository.VideoStats, cur *repository.VideoStats, metric string) (*repository.Anomaly, []string) {
+    if len(history) == 0 {
+        return nil, nil
+    }
+    prev := history[len(history)-1]
+    value, before := metricValue(cur, metric), metricValue(&prev, metric)
+
+    anomaly := &repository.Anomaly{VideoID: cur.VideoID, SampleID: cur.ID, Metric: metric}
+
+    if decrease := before - value; decrease >= DropMinDecrease && float64(decrease) >= DropTolerance*float64(before) {
+        anomaly.Kind = repository.AnomalyDrop
+        anomaly.Value, anomaly.Expected = float64(value), float64(before)
+
+        // When older samples agree with the new count, the samples above it
+        // were inflated; otherwise the new count is the odd one out
+        var inflated []string
+        for _, sample := range history {
+            if metricValue(&sample, metric) > value {
+                inflated = append(inflated, sample.ID)
+            }
+        }
+        if len(inflated) == len(history) {
+            inflated = []string{cur.ID}
+        }
+        anomaly.Flagged = len(inflated)
+        anomaly.Message = fmt.Sprintf("%s dropped from %d to %d", metric, before, value)
+        return anomaly, inflated
+    }
+
+    hours := cur.Timestamp.Sub(seenAt(&prev)).Hours()
+    rate, ok := medianRate(history, metric)
+    if !ok || hours <= 0 {
+        return nil, nil
+    }
+    increase := float64(value - before)
+    expected := rate * hours
+    if increase < SpikeMinIncrease || increase < SpikeFactor*expected {
+        return nil, nil
+    }
+
+    anomaly.Kind = repository.AnomalySpike
+    anomaly.Value, anomaly.Expected = increase, expected
+    anomaly.Flagged = 1
+    anomaly.Message = fmt.Sprintf("%s rose by %.0f in %s, expected about %.0f", metric, increase, cur.Timestamp.Sub(seenAt(&prev)).Round(time.Minute), expected)
+    return anomaly, []string{cur.ID}
+}
+
+// checkLikeRatio compares the like/view ratio of the latest sample with the
+// other videos on the platform. A video is reported at most once per
+// RatioCooldown.
+func (s *videoService) checkLikeRatio(ctx context.Context, video *repository.Video, cur *repository.VideoStats, now time.Time) (*repository.Anomaly, error) {
+    if cur.Views < RatioMinViews {
+        return nil, nil
+    }
+
+    last, err := s.repo.GetLatestAnomaly(ctx, video.VideoID, repository.AnomalyRatio)
+    if err != nil {
+        return nil, err
+    }
+    if last != nil && now.Sub(last.DetectedAt) < RatioCooldown {
+        return nil, nil
+    }
+
+    cohort, peers, err := s.cohorts.median(ctx, s.repo, video.Platform, video.VideoID, now)
+    if err != nil || peers < RatioMinCohort {
+        return nil, err
+    }
+    ratio := float64(cur.Likes) / float64(cur.Views)
+    if cohort <= 0 || (ratio <= cohort*RatioFactor && ratio >= cohort/RatioFactor) {
+        return nil, nil
+    }
+
+    return &repository.Anomaly{
+        VideoID:  video.VideoID,
+        SampleID: cur.ID,
+        Kind:     repository.AnomalyRatio,
+        Metric:   "likes",
+        Value:    ratio,
+        Expected: cohort,
+        Message:  fmt.Sprintf("like/view ratio %.4f against a %s median of %.4f over %d videos", ratio, video.Platform, cohort, peers),
+    }, nil
+}
+
+// likeCohorts caches the like/view ratios of each platform's videos, so a
+// poll run scans video_stats once per platform instead of once per video
+type likeCohorts struct {
+    mu        sync.Mutex
+    platforms map[string]*likeCohort
+}
+
+type likeCohort struct {
+    loadedAt time.Time
+    sorted   []float64
+    byVideo  map[string]float64
+}
+
+func newLikeCohorts() *likeCohorts {
+    return &likeCohorts{platforms: make(map[string]*likeCohort)}
+}
+
+// median returns the median ratio of the other videos on a platform and how
+// many there are, loading the ratios when the cached ones are stale
+func (c *likeCohorts) median(ctx context.Context, repo repository.Repository, platform, videoID string, now time.Time) (float64, int, error) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    cohort := c.platforms[platform]
+    if cohort == nil || now.Sub(cohort.loadedAt) >= likeCohortTTL {
+        ratios, err := repo.GetLikeRatios(ctx, platform, RatioMinViews)
+        if err != nil {
+            return 0, 0, err
+        }
+        cohort = &likeCohort{loadedAt: now, byVideo: ratios}
+        for _, ratio := range ratios {
+            cohort.sorted = append(cohort.sorted, ratio)
+        }
+        sort.Float64s(cohort.sorted)
+        c.platforms[platform] = cohort
+    }
+
+    skip := -1
+    if own, ok := cohort.byVideo[videoID]; ok {
+        skip = sort.SearchFloat64s(cohort.sorted, own)
+    }
+    peers := len(cohort.sorted)
+    if skip >= 0 {
+        peers--
+    }
+    if peers == 0 {
+        return 0, 0, nil
+    }
+    return medianSkipping(cohort.sorted, skip), peers, nil
+}
+
+// medianSkipping is the median of sorted without the value at index skip,
+// or of all of it when skip is negative
+func medianSkipping(sorted []float64, skip int) float64 {
+    n := len(sorted)
+    if skip >= 0 {
+        n--
+    }
+    at := func(i int) float64 {
+        if skip >= 0 && i >= skip {
+            return sorted[i+1]
+        }
+        return sorted[i]
+    }
+    mid := n / 2
+    if n%2 == 0 {
+        return (at(mid-1) + at(mid)) / 2
+    }
+    return at(mid)
+}
+
+// GetAnomalies returns the latest anomalies, optionally for one video
+func (s *videoService) GetAnomalies(ctx context.Context, videoID string, limit int) ([]repository.Anomaly, error) {
+    if limit <= 0 || limit > 500 {
+        limit = 100
+    }
+    return s.repo.GetAnomalies(ctx, videoID, limit)
+}
+
+// isFlagged reports whether the sample with id is among the flagged IDs
+func isFlagged(flagged []string, id string) bool {
+    for _, f := range flagged {
+        if f == id {
+            return true
+        }
+    }
+    return false
+}
+
+// WithoutFlagged drops the samples marked by the anomaly detector
+func WithoutFlagged(stats []repository.VideoStats) []repository.VideoStats {
+    clean := make([]repository.VideoStats, 0, len(stats))
+    for _, sample := range stats {
+        if !sample.Flagged {
+            clean = append(clean, sample)
+        }
+    }
+    return clean
+}
+
+// medianRate returns the median hourly growth of a metric between
+// consecutive samples, if there are enough of them to be meaningful
+func medianRate(history []repository.VideoStats, metric string) (float64, bool) {
+    var rates []float64
+    for i := 1; i < len(history); i++ {
+        hours := history[i].Timestamp.Sub(seenAt(&history[i-1])).Hours()
+        if hours <= 0 {
+            continue
+        }
+        rates = append(rates, float64(metricValue(&history[i], metric)-metricValue(&history[i-1], metric))/hours)
+    }
+    if len(rates) < spikeMinRates {
+        return 0, false
+    }
+    return median(rates), true
+}
+
+// seenAt is the last time a sample's counts were observed
+func seenAt(stats *repository.VideoStats) time.Time {
+    if stats.LastSeenAt != nil {
+        return *stats.LastSeenAt
+    }
+    return stats.Timestamp
+}
+
+func median(values []float64) float64 {
+    sorted := append([]float64(nil), values...)
+    sort.Float64s(sorted)
+    mid := len(sorted) / 2
+    if len(sorted)%2 == 0 {
+        return (sorted[mid-1] + sorted[mid]) / 2
+    }
+    return sorted[mid]
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+    "context"
+    "testing"
+    "time"
+    "video-stats-tracker/internal/repository"
+)
+
+// hourly builds samples one hour apart with the given view counts
+func hourly(base time.Time, views ...int) []repository.VideoStats {
+    var stats []repository.VideoStats
+    for i, v := range views {
+        stats = append(stats, repository.VideoStats{
+            ID:        string(rune('a' + i)),
+            VideoID:   "v1",
+            Timestamp: base.Add(time.Duration(i) * time.Hour),
+            Views:     v,
+        })
+    }
+    return stats
+}
+
+func TestCheckCounter(t *testing.T) {
+    base := time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC)
+
+    tests := []struct {
+        name    string
+        views   []int // history followed by the new sample
+        kind    string
+        flagged []string
+    }{
+        {"steady growth", []int{100, 200, 300, 400, 500}, "", nil},
+        {"spike", []int{100, 200, 300, 400, 5000}, repository.AnomalySpike, []string{"e"}},
+        {"large but proportional growth", []int{1000, 11000, 21000, 31000, 41000}, "", nil},
+        {"too little history for a rate", []int{100, 200, 5000}, "", nil},
+        {"small counter correction", []int{10000, 10100, 10200, 10150}, "", nil},
+        {"drop below inflated samples", []int{100, 200, 900, 950, 210}, repository.AnomalyDrop, []string{"c", "d"}},
+        {"drop below all history", []int{500, 600, 700, 100}, repository.AnomalyDrop, []string{"d"}},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            stats := hourly(base, tt.views...)
+            history, cur := stats[:len(stats)-1], &stats[len(stats)-1]
+
+            anomaly, flagged := checkCounter(history, cur, "views")
+            if tt.kind == "" {
+                if anomaly != nil {
+                    t.Errorf("got %s anomaly: %s", anomaly.Kind, anomaly.Message)
+                }
+                return
+            }
+            if anomaly == nil || anomaly.Kind != tt.kind {
+                t.Fatalf("anomaly = %+v, want %s", anomaly, tt.kind)
+            }
+            if anomaly.Flagged != len(tt.flagged) || len(flagged) != len(tt.flagged) {
+                t.Fatalf("flagged %v, want %v", flagged, tt.flagged)
+            }
+            for i := range flagged {
+                if flagged[i] != tt.flagged[i] {
+                    t.Errorf("flagged %v, want %v", flagged, tt.flagged)
+                }
+            }
+        })
+    }
+}
+
+func TestMedianRateUsesLastSeen(t *testing.T) {
+    base := time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC)
+    stats := hourly(base, 0, 100, 200, 300)
+    // The second sample's counts were still seen 30 minutes later, so the
+    // next 100 views took half an hour
+    seen := stats[1].Timestamp.Add(30 * time.Minute)
+    stats[1].LastSeenAt = &seen
+
+    rate, ok := medianRate(stats, "views")
+    if !ok || rate != 100 {
+        t.Errorf("medianRate = %v, %v; want 100, true", rate, ok)
+    }
+    if _, ok := medianRate(stats[:3], "views"); ok {
+        t.Errorf("two rates were enough for a median")
+    }
+}
+
+func TestMedianSkipping(t *testing.T) {
+    sorted := []float64{1, 2, 3, 4, 10}
+    tests := []struct {
+        skip int
+        want float64
+    }{
+        {-1, 3},
+        {4, 2.5},
+        {0, 3.5},
+        {2, 3},
+    }
+    for _, tt := range tests {
+        if got := medianSkipping(sorted, tt.skip); got != tt.want {
+            t.Errorf("medianSkipping(skip %d) = %v, want %v", tt.skip, got, tt.want)
+        }
+    }
+}
+
+// ratioRepository serves fixed like ratios and counts the loads
+type ratioRepository struct {
+    repository.Repository
+    ratios map[string]float64
+    loads  int
+}
+
+func (r *ratioRepository) GetLikeRatios(ctx context.Context, platform string, minViews int) (map[string]float64, error) {
+    r.loads++
+    return r.ratios, nil
+}
+
+func TestLikeCohortsCachePerRun(t *testing.T) {
+    repo := &ratioRepository{ratios: map[string]float64{"a": 0.01, "b": 0.02, "c": 0.03, "d": 0.04, "e": 0.05, "v1": 0.5}}
+    cohorts := newLikeCohorts()
+    now := time.Now()
+
+    for i, videoID := range []string{"v1", "a", "z"} {
+        cohort, peers, err := cohorts.median(context.Background(), repo, repository.PlatformYouTube, videoID, now.Add(time.Duration(i)*time.Second))
+        if err != nil {
+            t.Fatal(err)
+        }
+        wantPeers := 5
+        if videoID == "z" {
+            wantPeers = 6
+        }
+        if peers != wantPeers {
+            t.Errorf("%s: %d peers, want %d", videoID, peers, wantPeers)
+        }
+        if videoID == "v1" && cohort != 0.03 {
+            t.Errorf("v1: cohort median %v, want 0.03 without its own ratio", cohort)
+        }
+    }
+    if repo.loads != 1 {
+        t.Errorf("loaded ratios %d times in one run, want 1", repo.loads)
+    }
+
+    if _, _, err := cohorts.median(context.Background(), repo, repository.PlatformYouTube, "v1", now.Add(likeCohortTTL)); err != nil {
+        t.Fatal(err)
+    }
+    if repo.loads != 2 {
+        t.Errorf("stale ratios were not reloaded")
+    }
+}
@@ -0,0 +1,349 @@
+package service
+
+import (
+    "context"
+    "sort"
+    "time"
+    "video-stats-tracker/internal/repository"
+)
+
+// Cohorts a video can be benchmarked against
+const (
+    CohortPlatform = "platform"
+    CohortTag      = "tag"
+    CohortAccount  = "account"
+)
+
+// Benchmark tuning. A video needs BenchmarkMinPeers other videos of its
+// cohort at its age to get a percentile; from BenchmarkAbove it performs
+// above usual, up to BenchmarkBelow below.
+const (
+    BenchmarkMinPeers = 3
+    BenchmarkAbove    = 75.0
+    BenchmarkBelow    = 25.0
+
+    defaultBenchmarkStep   = 6 * time.Hour
+    defaultBenchmarkMaxAge = 7 * 24 * time.Hour
+)
+
+// Benchmark is the typical curve of a cohort, aligned by time since
+// publication
+type Benchmark struct {
+    Platform  string           `json:"platform,omitempty"`
+    Tag       string           `json:"tag,omitempty"`
+    AccountID string           `json:"account_id,omitempty"`
+    Metric    string           `json:"metric"`
+    Step      string           `json:"step"`
+    Videos    int              `json:"videos"`
+    Curve     []BenchmarkPoint `json:"curve"`
+}
+
+// BenchmarkPoint holds the percentiles of the cohort's counts at an age,
+// over the Videos that had reached it
+type BenchmarkPoint struct {
+    AgeHours float64 `json:"age_hours"`
+    Videos   int     `json:"videos"`
+    P10      float64 `json:"p10"`
+    P25      float64 `json:"p25"`
+    Median   float64 `json:"median"`
+    P75      float64 `json:"p75"`
+    P90      float64 `json:"p90"`
+}
+
+// VideoBenchmark places a video's latest count among its cohort's counts at
+// the same age. Percentile is the share of peers below it.
+type VideoBenchmark struct {
+    Cohort      string  `json:"cohort"`
+    CohortValue string  `json:"cohort_value"`
+    Metric      string  `json:"metric"`
+    AgeHours    float64 `json:"age_hours"`
+    Value       float64 `json:"value"`
+    Median      float64 `json:"median"`
+    Percentile  float64 `json:"percentile"`
+    Peers       int     `json:"peers"`
+    // Performance is above, typical or below
+    Performance string `json:"performance"`
+}
+
+// VideoListing is a video with its latest sample and, when requested, its
+// standing in a cohort
+type VideoListing struct {
+    repository.Video
+    Latest    *repository.VideoStats `json:"latest,omitempty"`
+    Benchmark *VideoBenchmark        `json:"benchmark,omitempty"`
+}
+
+// GetBenchmark computes the percentile curves of the videos matching the
+// cohort filter every step up to maxAge after publication
+func (s *videoService) GetBenchmark(ctx context.Context, cohort repository.VideoFilter, metric string, step, maxAge time.Duration) (*Benchmark, error) {
+    if cohort.Platform == "" && cohort.Tag == "" && cohort.AccountID == "" {
+        return nil, Errorf(CodeValidation, "platform, tag or account_id is required")
+    }
+    cohort.State = ""
+    if metric == "" {
+        metric = "views"
+    }
+    if !benchmarkMetric(metric) {
+        return nil, Errorf(CodeValidation, "unsupported metric: %s (use views, likes or comments)", metric)
+    }
+    if step == 0 {
+        step = defaultBenchmarkStep
+    }
+    if maxAge == 0 {
+        maxAge = defaultBenchmarkMaxAge
+    }
+    if step < time.Hour {
+        return nil, Errorf(CodeValidation, "step must be at least 1h")
+    }
+    if maxAge > maxCompareAge {
+        return nil, Errorf(CodeValidation, "max_age must be at most %s", maxCompareAge)
+    }
+    if int(maxAge/step) > maxComparePoints {
+        return nil, Errorf(CodeValidation, "too many points: use a larger step or a smaller max_age")
+    }
+
+    videos, err := s.repo.GetVideos(ctx, cohort)
+    if err != nil {
+        return nil, err
+    }
+    histories, err := s.cohortHistories(ctx, videos, nil)
+    if err != nil {
+        return nil, err
+    }
+
+    benchmark := &Benchmark{
+        Platform:  cohort.Platform,
+        Tag:       cohort.Tag,
+        AccountID: cohort.AccountID,
+        Metric:    metric,
+        Step:      step.String(),
+        Videos:    len(videos),
+        Curve:     []BenchmarkPoint{},
+    }
+    for age := time.Duration(0); age <= maxAge; age += step {
+        values := cohortValues(histories, "", age.Hours(), step.Hours(), metric)
+        if len(values) == 0 {
+            continue
+        }
+        benchmark.Curve = append(benchmark.Curve, BenchmarkPoint{
+            AgeHours: age.Hours(),
+            Videos:   len(values),
+            P10:      percentile(values, 10),
+            P25:      percentile(values, 25),
+            Median:   percentile(values, 50),
+            P75:      percentile(values, 75),
+            P90:      percentile(values, 90),
+        })
+    }
+    return benchmark, nil
+}
+
+// ListVideos returns the videos matching the filter. With a cohort, each
+// video is benchmarked against the videos sharing its platform, tag or
+// account: the tag filter when given, otherwise the video's registration
+// tag or its first tag.
+func (s *videoService) ListVideos(ctx context.Context, filter repository.VideoFilter, cohort, metric string) ([]VideoListing, error) {
+    if cohort != "" && cohort != CohortPlatform && cohort != CohortTag && cohort != CohortAccount {
+        return nil, Errorf(CodeValidation, "unsupported benchmark: %s (use platform, tag or account)", cohort)
+    }
+    if metric == "" {
+        metric = "views"
+    }
+    if !benchmarkMetric(metric) {
+        return nil, Errorf(CodeValidation, "unsupported metric: %s (use views, likes or comments)", metric)
+    }
+
+    videos, err := s.repo.GetVideos(ctx, filter)
+    if err != nil {
+        return nil, err
+    }
+
+    // Histories are shared between cohorts; each cohort is loaded once
+    histories := make(map[string]*ageSeries)
+    cohorts := make(map[string]map[string]*ageSeries)
+
+    listings := make([]VideoListing, len(videos))
+    for i, video := range videos {
+        listings[i].Video = video
+        latest, err := s.repo.GetLatestStats(ctx, video.VideoID)
+        if err != nil {
+            return nil, err
+        }
+        listings[i].Latest = latest
+
+        value := cohortValue(&video, cohort, filter.Tag)
+        if value == "" {
+            continue
+        }
+        key := cohort + ":" + value
+        members, ok := cohorts[key]
+        if !ok {
+            peers, err := s.repo.GetVideos(ctx, cohortFilter(cohort, value))
+            if err != nil {
+                return nil, err
+            }
+            if members, err = s.cohortHistories(ctx, peers, histories); err != nil {
+                return nil, err
+            }
+            cohorts[key] = members
+        }
+        listings[i].Benchmark = videoBenchmark(video.VideoID, members, cohort, value, metric)
+    }
+    return listings, nil
+}
+
+// cohortHistories loads the hourly history since publication of each
+// video, reusing the ones already in cache
+func (s *videoService) cohortHistories(ctx context.Context, videos []repository.Video, cache map[string]*ageSeries) (map[string]*ageSeries, error) {
+    now := time.Now()
+    histories := make(map[string]*ageSeries, len(videos))
+    for i := range videos {
+        video := &videos[i]
+        if history, ok := cache[video.VideoID]; ok {
+            histories[video.VideoID] = history
+            continue
+        }
+
+        start := milestoneStart(video)
+        maxAge := now.Sub(start)
+        if maxAge > maxCompareAge {
+            maxAge = maxCompareAge
+        }
+        history, err := s.ageHistory(ctx, video, start, maxAge, now)
+        if err != nil {
+            return nil, err
+        }
+        histories[video.VideoID] = history
+        if cache != nil {
+            cache[video.VideoID] = history
+        }
+    }
+    return histories, nil
+}
+
+// videoBenchmark ranks a video's latest count among the counts its peers
+// had at the same age
+func videoBenchmark(videoID string, histories map[string]*ageSeries, cohort, value, metric string) *VideoBenchmark {
+    history := histories[videoID]
+    if history == nil || len(history.hours) == 0 {
+        return nil
+    }
+    last := len(history.hours) - 1
+    point := AgePoint{
+        AgeHours: history.hours[last],
+        Views:    history.views[last],
+        Likes:    history.likes[last],
+        Comments: history.comments[last],
+    }
+
+    peers := cohortValues(histories, videoID, point.AgeHours, defaultBenchmarkStep.Hours(), metric)
+    if len(peers) < BenchmarkMinPeers {
+        return nil
+    }
+
+    current := point.value(metric)
+    var below float64
+    for _, peer := range peers {
+        switch {
+        case peer < current:
+            below++
+        case peer == current:
+            below += 0.5
+        }
+    }
+
+    benchmark := &VideoBenchmark{
+        Cohort:      cohort,
+        CohortValue: value,
+        Metric:      metric,
+        AgeHours:    point.AgeHours,
+        Value:       current,
+        Median:      median(peers),
+        Percentile:  below / float64(len(peers)) * 100,
+        Peers:       len(peers),
+        Performance: "typical",
+    }
+    switch {
+    case benchmark.Percentile >= BenchmarkAbove:
+        benchmark.Performance = "above"
+    case benchmark.Percentile <= BenchmarkBelow:
+        benchmark.Performance = "below"
+    }
+    return benchmark
+}
+
+// cohortValues returns the counts at an age of every video sampled within
+// the given hours of it, leaving out exclude. Peers without a real sample
+// around that age would only contribute interpolated guesses.
+func cohortValues(histories map[string]*ageSeries, exclude string, age, within float64, metric string) []float64 {
+    var values []float64
+    for videoID, history := range histories {
+        if videoID == exclude {
+            continue
+        }
+        if !history.sampledNear(age, within) {
+            continue
+        }
+        if point, ok := history.at(age, within); ok {
+            values = append(values, point.value(metric))
+        }
+    }
+    return values
+}
+
+// cohortValue is the platform, tag or account a video is benchmarked in
+func cohortValue(video *repository.Video, cohort, tag string) string {
+    switch cohort {
+    case CohortPlatform:
+        return video.Platform
+    case CohortAccount:
+        return video.AccountID
+    case CohortTag:
+        if tag != "" {
+            return tag
+        }
+        if video.Tag != "" && video.HasTag(video.Tag) {
+            return video.Tag
+        }
+        if len(video.Tags) > 0 {
+            return video.Tags[0]
+        }
+    }
+    return ""
+}
+
+func cohortFilter(cohort, value string) repository.VideoFilter {
+    switch cohort {
+    case CohortTag:
+        return repository.VideoFilter{Tag: value}
+    case CohortAccount:
+        return repository.VideoFilter{AccountID: value}
+    }
+    return repository.VideoFilter{Platform: value}
+}
+
+func benchmarkMetric(metric string) bool {
+    return metric == "views" || metric == "likes" || metric == "comments"
+}
+
+func (p AgePoint) value(metric string) float64 {
+    switch metric {
+    case "likes":
+        return p.Likes
+    case "comments":
+        return p.Comments
+    }
+    return p.Views
+}
+
+// percentile interpolates linearly between the closest ranks
+func percentile(values []float64, p float64) float64 {
+    sorted := append([]float64(nil), values...)
+    sort.Float64s(sorted)
+    rank := p / 100 * float64(len(sorted)-1)
+    lower := int(rank)
+    if lower+1 >= len(sorted) {
+        return sorted[len(sorted)-1]
+    }
+    return sorted[lower] + (rank-float64(lower))*(sorted[lower+1]-sorted[lower])
+}
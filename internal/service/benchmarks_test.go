@@ -0,0 +1,16 @@
+package service
+
+import "testing"
+
+func TestCohortValuesDropsUnsampledPeers(t *testing.T) {
+    histories := map[string]*ageSeries{
+        "near":  {hours: []float64{20, 26}, views: []float64{200, 260}, likes: []float64{0, 0}, comments: []float64{0, 0}},
+        "gap":   {hours: []float64{1, 100}, views: []float64{10, 1000}, likes: []float64{0, 0}, comments: []float64{0, 0}},
+        "self":  {hours: []float64{24}, views: []float64{240}, likes: []float64{0}, comments: []float64{0}},
+        "young": {hours: []float64{10}, views: []float64{100}, likes: []float64{0}, comments: []float64{0}},
+    }
+    values := cohortValues(histories, "self", 24, 6, "views")
+    if len(values) != 1 || values[0] != 240 {
+        t.Errorf("got %v, want only the peer sampled near 24h at 240", values)
+    }
+}
@@ -0,0 +1,213 @@
+package service
+
+import (
+    "context"
+    "fmt"
+    "strings"
+    "video-stats-tracker/internal/platform"
+    "video-stats-tracker/internal/repository"
+)
+
+// VideoRegistration is a single row of a bulk registration request
+type VideoRegistration struct {
+    Platform string `json:"platform"`
+    VideoID  string `json:"video_id"`
+    URL      string `json:"url,omitempty"`
+    Username string `json:"username,omitempty"`
+    Tag      string `json:"tag,omitempty"`
+}
+
+// RegistrationResult reports what happened to one row of a bulk registration
+type RegistrationResult struct {
+    Row      int    `json:"row"`
+    Platform string `json:"platform"`
+    VideoID  string `json:"video_id"`
+    Username string `json:"username,omitempty"`
+    Status   string `json:"status"`
+    ID       string `json:"id,omitempty"`
+    Error    string `json:"error,omitempty"`
+}
+
+// Bulk registration statuses
+const (
+    RegistrationCreated   = "created"
+    RegistrationDuplicate = "duplicate"
+    RegistrationNotFound  = "not_found"
+    RegistrationInvalid   = "invalid"
+    RegistrationFailed    = "failed"
+)
+
+// RegisterVideos registers many videos at once. Rows are validated up front,
+// Instagram posts are looked up in their account's media, whose pages are
+// read once per request, YouTube videos are checked with batched lookups,
+// and every row gets its own result.
+func (s *videoService) RegisterVideos(ctx context.Context, videos []VideoRegistration) ([]RegistrationResult, error) {
+    results := make([]RegistrationResult, len(videos))
+    seen := make(map[string]bool)
+    ctx = platform.WithMediaCache(ctx)
+    var youtubeIDs []string
+    instagramRows := make(map[string][]int)
+
+    for i, v := range videos {
+        v.Platform = strings.ToLower(strings.TrimSpace(v.Platform))
+        v.VideoID = strings.TrimSpace(v.VideoID)
+        v.URL = strings.TrimSpace(v.URL)
+        v.Username = strings.TrimSpace(v.Username)
+
+        results[i] = RegistrationResult{Row: i + 1}
+
+        // Links are resolved to platform IDs first, sharing media fetches
+        if v.VideoID == "" && v.URL != "" {
+            if resolved, err := s.resolveVideoURL(ctx, v.URL, v.Username); err != nil {
+                results[i].Status = registrationStatus(err)
+                results[i].Error = err.Error()
+            } else {
+                v.Platform, v.VideoID, v.Username = resolved.Platform, resolved.VideoID, resolved.Username
+            }
+        }
+
+        videos[i] = v
+        results[i].Platform = v.Platform
+        results[i].VideoID = v.VideoID
+        results[i].Username = v.Username
+        if results[i].Status != "" {
+            continue
+        }
+
+        if err := validateRegistration(v); err != nil {
+            results[i].Status = RegistrationInvalid
+            results[i].Error = err.Error()
+            continue
+        }
+
+        key := registrationKey(v)
+        if seen[key] {
+            results[i].Status = RegistrationDuplicate
+            results[i].Error = "video appears more than once in the request"
+            continue
+        }
+        seen[key] = true
+
+        if v.Platform == repository.PlatformInstagram {
+            instagramRows[v.Username] = append(instagramRows[v.Username], i)
+        } else {
+            youtubeIDs = append(youtubeIDs, v.VideoID)
+        }
+    }
+
+    // Validate YouTube videos in batches
+    if len(youtubeIDs) > 0 {
+        found, err := s.youtubeClient.FindVideos(ctx, youtubeIDs)
+        for i, v := range videos {
+            if results[i].Status != "" || v.Platform != repository.PlatformYouTube {
+                continue
+            }
+            if err != nil {
+                results[i].Status = RegistrationFailed
+                results[i].Error = fmt.Sprintf("youtube lookup failed: %v", err)
+            } else if !found[v.VideoID] {
+                results[i].Status = RegistrationNotFound
+                results[i].Error = fmt.Sprintf("youtube video not found: %s", v.VideoID)
+            }
+        }
+    }
+
+    // Validate Instagram posts; an account's pages are shared by its rows
+    for username, rows := range instagramRows {
+        for _, i := range rows {
+            found, err := s.findInstagramPost(ctx, username, videos[i].VideoID)
+            if err != nil {
+                results[i].Status = RegistrationFailed
+                results[i].Error = fmt.Sprintf("instagram account lookup failed for %s: %v", username, err)
+            } else if !found {
+                results[i].Status = RegistrationNotFound
+                results[i].Error = fmt.Sprintf("instagram post not found: %s for user %s", videos[i].VideoID, username)
+            }
+        }
+    }
+
+    for i, v := range videos {
+        if results[i].Status != "" {
+            continue
+        }
+
+        existing, err := s.findExisting(ctx, v.Platform, v.VideoID, v.Username)
+        if err != nil {
+            results[i].Status = RegistrationFailed
+            results[i].Error = err.Error()
+            continue
+        }
+        if existing != nil {
+            results[i].Status = RegistrationDuplicate
+            results[i].ID = existing.ID
+            results[i].Error = "video already being tracked"
+            continue
+        }
+
+        video := &repository.Video{
+            Platform:          v.Platform,
+            VideoID:           v.VideoID,
+            InstagramUsername: v.Username,
+            State:             repository.StateRegistered,
+            Tag:               v.Tag,
+        }
+        if err := s.repo.CreateVideo(ctx, video); err != nil {
+            results[i].Status = RegistrationFailed
+            if repository.IsUniqueViolation(err) {
+                results[i].Status = RegistrationDuplicate
+            }
+            results[i].Error = err.Error()
+            continue
+        }
+
+        results[i].Status = RegistrationCreated
+        results[i].ID = video.ID
+    }
+
+    return results, nil
+}
+
+// validateRegistration checks the fields of a registration without calling
+// any platform API
+func validateRegistration(v VideoRegistration) error {
+    if v.Platform != repository.PlatformYouTube && v.Platform != repository.PlatformInstagram {
+        return Errorf(CodeValidation, "unsupported platform: %s", v.Platform)
+    }
+    if v.VideoID == "" {
+        return Errorf(CodeValidation, "video_id is required")
+    }
+    if v.Platform == repository.PlatformInstagram && v.Username == "" {
+        return Errorf(CodeValidation, "instagram_username is required for Instagram posts")
+    }
+    return nil
+}
+
+// registrationStatus maps a service error onto a bulk row status
+func registrationStatus(err error) string {
+    switch ErrorCode(err) {
+    case CodeValidation:
+        return RegistrationInvalid
+    case CodeNotFound:
+        return RegistrationNotFound
+    case CodeDuplicate:
+        return RegistrationDuplicate
+    default:
+        return RegistrationFailed
+    }
+}
+
+func registrationKey(v VideoRegistration) string {
+    if v.Platform == repository.PlatformInstagram {
+        return v.Platform + "/" + v.Username + "/" + v.VideoID
+    }
+    return v.Platform + "/" + v.VideoID
+}
+
+// findInstagramPost reports whether a post is among the media of username,
+// paging back as far as polling does
+func (s *videoService) findInstagramPost(ctx context.Context, username, videoID string) (bool, error) {
+    media, err := s.instagramClient.FindMedia(ctx, username, func(m platform.InstagramMedia) bool {
+        return m.ID == videoID
+    })
+    return media != nil, err
+}
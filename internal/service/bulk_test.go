@@ -0,0 +1,127 @@
+package service
+
+import (
+    "context"
+    "errors"
+    "testing"
+    "time"
+    "video-stats-tracker/internal/platform"
+    "video-stats-tracker/internal/repository"
+)
+
+// registrationRepository holds already tracked videos and collects created
+// ones
+type registrationRepository struct {
+    repository.Repository
+    existing map[string]*repository.Video
+    created  []repository.Video
+    failOn   string
+}
+
+func (r *registrationRepository) GetVideo(ctx context.Context, platform, videoID string) (*repository.Video, error) {
+    return r.existing[platform+"/"+videoID], nil
+}
+
+func (r *registrationRepository) GetVideoWithUsername(ctx context.Context, platform, videoID, username string) (*repository.Video, error) {
+    return r.existing[platform+"/"+username+"/"+videoID], nil
+}
+
+func (r *registrationRepository) CreateVideo(ctx context.Context, video *repository.Video) error {
+    if video.VideoID == r.failOn {
+        return errors.New("disk full")
+    }
+    video.ID = video.VideoID + "-id"
+    r.created = append(r.created, *video)
+    return nil
+}
+
+func TestRegisterVideos(t *testing.T) {
+    now := time.Now()
+    repo := &registrationRepository{
+        existing: map[string]*repository.Video{"youtube/tracked": {ID: "7"}},
+        failOn:   "broken",
+    }
+    instagram := &stubInstagram{
+        media: map[string][]platform.InstagramMedia{
+            "bluebottle": {post("1784", now), post("Cx1abc", now)},
+        },
+        failing: map[string]bool{"ratelimited": true},
+    }
+    svc := &videoService{
+        repo:            repo,
+        youtubeClient:   &stubYouTube{videos: map[string]bool{"dQw4w9WgXcQ": true, "tracked": true, "broken": true}},
+        instagramClient: instagram,
+    }
+
+    rows := []VideoRegistration{
+        {Platform: " YouTube ", VideoID: "dQw4w9WgXcQ", Tag: "launch"},
+        {Platform: "youtube", VideoID: "dQw4w9WgXcQ"},
+        {Platform: "youtube", VideoID: "missing"},
+        {Platform: "youtube", VideoID: "tracked"},
+        {Platform: "vimeo", VideoID: "123"},
+        {Platform: "instagram", VideoID: "1784"},
+        {Platform: "instagram", VideoID: "1784", Username: "bluebottle"},
+        {Platform: "instagram", VideoID: "gone", Username: "bluebottle"},
+        {Platform: "instagram", VideoID: "1785", Username: "ratelimited"},
+        {URL: "https://www.instagram.com/p/Cx1abc/", Username: "bluebottle"},
+        {URL: "https://www.instagram.com/p/Cx1abc/"},
+        {Platform: "youtube", VideoID: "broken"},
+    }
+    want := []struct {
+        status string
+        id     string
+    }{
+        {RegistrationCreated, "dQw4w9WgXcQ-id"},
+        {RegistrationDuplicate, ""},
+        {RegistrationNotFound, ""},
+        {RegistrationDuplicate, "7"},
+        {RegistrationInvalid, ""},
+        {RegistrationInvalid, ""},
+        {RegistrationCreated, "1784-id"},
+        {RegistrationNotFound, ""},
+        {RegistrationFailed, ""},
+        {RegistrationCreated, "Cx1abc-id"},
+        {RegistrationInvalid, ""},
+        {RegistrationFailed, ""},
+    }
+
+    results, err := svc.RegisterVideos(context.Background(), rows)
+    if err != nil {
+        t.Fatal(err)
+    }
+    for i, w := range want {
+        got := results[i]
+        if got.Row != i+1 || got.Status != w.status || got.ID != w.id {
+            t.Errorf("row %d = %+v, want %s %s", i+1, got, w.status, w.id)
+        }
+        if w.status != RegistrationCreated && got.Error == "" {
+            t.Errorf("row %d has no error message", i+1)
+        }
+    }
+    if results[0].Platform != "youtube" {
+        t.Errorf("platform = %q, want it normalized", results[0].Platform)
+    }
+    if len(repo.created) != 3 || repo.created[0].Tag != "launch" {
+        t.Errorf("created %+v, want the 3 valid new videos", repo.created)
+    }
+}
+
+func TestRegisterVideosYouTubeOutage(t *testing.T) {
+    repo := &registrationRepository{}
+    svc := &videoService{
+        repo:            repo,
+        youtubeClient:   &stubYouTube{err: errors.New("quota exceeded")},
+        instagramClient: &stubInstagram{media: map[string][]platform.InstagramMedia{"bluebottle": {post("1784", time.Now())}}},
+    }
+
+    results, err := svc.RegisterVideos(context.Background(), []VideoRegistration{
+        {Platform: "youtube", VideoID: "dQw4w9WgXcQ"},
+        {Platform: "instagram", VideoID: "1784", Username: "bluebottle"},
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    if results[0].Status != RegistrationFailed || results[1].Status != RegistrationCreated {
+        t.Errorf("got %+v, want the YouTube row failed and the Instagram row created", results)
+    }
+}
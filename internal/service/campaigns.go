@@ -0,0 +1,338 @@
+package service
+
+import (
+    "context"
+    "strings"
+    "time"
+    "video-stats-tracker/internal/repository"
+)
+
+// CampaignReport is a campaign with its progress. All counts are growth
+// within the campaign window: each video's counts at the end of the window
+// (or now) minus its counts when the campaign started, so videos published
+// earlier only contribute what they gained during the campaign.
+type CampaignReport struct {
+    repository.Campaign
+    Interval       string                 `json:"interval"`
+    ElapsedPercent float64                `json:"elapsed_percent"`
+    Totals         CampaignTotals         `json:"totals"`
+    Goals          []CampaignGoal         `json:"goals"`
+    Videos         []CampaignContribution `json:"videos"`
+    Series         []CampaignPoint        `json:"series"`
+}
+
+type CampaignTotals struct {
+    Views      int `json:"views"`
+    Likes      int `json:"likes"`
+    Comments   int `json:"comments"`
+    Engagement int `json:"engagement"`
+}
+
+// CampaignGoal is the progress toward one target. A goal is on track when
+// its share of the target is at least the share of the window that passed.
+type CampaignGoal struct {
+    Metric  string  `json:"metric"`
+    Target  int     `json:"target"`
+    Current int     `json:"current"`
+    Percent float64 `json:"percent"`
+    OnTrack bool    `json:"on_track"`
+}
+
+// CampaignContribution is what one video added to the campaign totals, with
+// its share of the campaign's views and engagement in percent. Baseline
+// tells what its growth is measured from, taken at BaselineAt.
+type CampaignContribution struct {
+    VideoID         string `json:"video_id"`
+    Platform        string `json:"platform"`
+    CampaignTotals
+    ViewsShare      float64    `json:"views_share"`
+    EngagementShare float64    `json:"engagement_share"`
+    Baseline        string     `json:"baseline"`
+    BaselineAt      *time.Time `json:"baseline_at,omitempty"`
+}
+
+// Campaign baselines. Without counts from before the campaign started, a
+// video published during the campaign grew from zero; for any other video
+// the growth before its first sample in the window is unknown and left out.
+const (
+    BaselineCampaignStart = "campaign_start"
+    BaselinePublished     = "published"
+    BaselineFirstSample   = "first_sample"
+    BaselineNone          = "none"
+)
+
+// CampaignPoint is the campaign's cumulative growth at the end of a bucket
+type CampaignPoint struct {
+    Bucket time.Time `json:"bucket"`
+    CampaignTotals
+}
+
+// CreateCampaign validates and stores a campaign with its initial videos,
+// returning the video IDs without duplicates
+func (s *videoService) CreateCampaign(ctx context.Context, campaign *repository.Campaign, videoIDs []string) ([]string, error) {
+    campaign.Name = strings.TrimSpace(campaign.Name)
+    if campaign.Name == "" {
+        return nil, Errorf(CodeValidation, "name is required")
+    }
+    if campaign.StartsAt.IsZero() || campaign.EndsAt.IsZero() {
+        return nil, Errorf(CodeValidation, "starts_at and ends_at are required")
+    }
+    if !campaign.EndsAt.After(campaign.StartsAt) {
+        return nil, Errorf(CodeValidation, "ends_at must be after starts_at")
+    }
+    if campaign.TargetViews < 0 || campaign.TargetEngagement < 0 {
+        return nil, Errorf(CodeValidation, "targets must not be negative")
+    }
+
+    videoIDs, err := s.checkCampaignVideos(ctx, videoIDs)
+    if err != nil {
+        return nil, err
+    }
+
+    if err := s.repo.CreateCampaign(ctx, campaign); err != nil {
+        return nil, err
+    }
+    if _, err := s.repo.AddCampaignVideos(ctx, campaign.ID, videoIDs); err != nil {
+        return nil, err
+    }
+    return videoIDs, nil
+}
+
+func (s *videoService) GetCampaigns(ctx context.Context) ([]repository.Campaign, error) {
+    return s.repo.GetCampaigns(ctx)
+}
+
+func (s *videoService) DeleteCampaign(ctx context.Context, id string) error {
+    deleted, err := s.repo.DeleteCampaign(ctx, id)
+    if err != nil {
+        return err
+    }
+    if !deleted {
+        return Errorf(CodeNotFound, "campaign not found: %s", id)
+    }
+    return nil
+}
+
+// AddCampaignVideos adds tracked videos to a campaign and returns how many
+// were not already members
+func (s *videoService) AddCampaignVideos(ctx context.Context, id string, videoIDs []string) (int, error) {
+    if _, err := s.getCampaign(ctx, id); err != nil {
+        return 0, err
+    }
+    videoIDs, err := s.checkCampaignVideos(ctx, videoIDs)
+    if err != nil {
+        return 0, err
+    }
+    if len(videoIDs) == 0 {
+        return 0, Errorf(CodeValidation, "videos is required")
+    }
+    return s.repo.AddCampaignVideos(ctx, id, videoIDs)
+}
+
+func (s *videoService) RemoveCampaignVideo(ctx context.Context, id, videoID string) error {
+    if _, err := s.getCampaign(ctx, id); err != nil {
+        return err
+    }
+    removed, err := s.repo.RemoveCampaignVideo(ctx, id, videoID)
+    if err != nil {
+        return err
+    }
+    if !removed {
+        return Errorf(CodeNotFound, "video %s is not part of campaign %s", videoID, id)
+    }
+    return nil
+}
+
+// GetCampaignReport aggregates the campaign's videos over its window in
+// hourly or daily buckets. Flagged samples are left out.
+func (s *videoService) GetCampaignReport(ctx context.Context, id, interval string) (*CampaignReport, error) {
+    if interval == "" {
+        interval = repository.IntervalDay
+    }
+    if interval != repository.IntervalHour && interval != repository.IntervalDay {
+        return nil, Errorf(CodeValidation, "unsupported interval: %s (use 1h or 1d)", interval)
+    }
+
+    campaign, err := s.getCampaign(ctx, id)
+    if err != nil {
+        return nil, err
+    }
+    videos, err := s.repo.GetCampaignVideos(ctx, id)
+    if err != nil {
+        return nil, err
+    }
+
+    now := time.Now()
+    end := campaign.EndsAt
+    if now.Before(end) {
+        end = now
+    }
+    report := &CampaignReport{
+        Campaign:       *campaign,
+        Interval:       interval,
+        ElapsedPercent: elapsedPercent(campaign, now),
+        Videos:         []CampaignContribution{},
+        Series:         []CampaignPoint{},
+    }
+
+    // Bucket starts covering the window; empty before the campaign starts
+    var starts []time.Time
+    if end.After(campaign.StartsAt) {
+        for t := truncateBucket(campaign.StartsAt, interval); !t.After(end); t = nextBucket(t, interval) {
+            starts = append(starts, t)
+            report.Series = append(report.Series, CampaignPoint{Bucket: t})
+        }
+    }
+
+    for _, video := range videos {
+        contribution := CampaignContribution{VideoID: video.VideoID, Platform: video.Platform, Baseline: BaselineNone}
+        if len(starts) > 0 {
+            gains, err := s.campaignGains(ctx, &video, campaign.StartsAt, end, interval, starts, &contribution)
+            if err != nil {
+                return nil, err
+            }
+            for i, gain := range gains {
+                report.Series[i].add(gain)
+            }
+            contribution.CampaignTotals = gains[len(gains)-1]
+        }
+        report.Totals.add(contribution.CampaignTotals)
+        report.Videos = append(report.Videos, contribution)
+    }
+
+    for i := range report.Videos {
+        contribution := &report.Videos[i]
+        contribution.ViewsShare = percentOf(contribution.Views, report.Totals.Views)
+        contribution.EngagementShare = percentOf(contribution.Engagement, report.Totals.Engagement)
+    }
+
+    if campaign.TargetViews > 0 {
+        report.Goals = append(report.Goals, newCampaignGoal("views", campaign.TargetViews, report.Totals.Views, report.ElapsedPercent))
+    }
+    if campaign.TargetEngagement > 0 {
+        report.Goals = append(report.Goals, newCampaignGoal("engagement", campaign.TargetEngagement, report.Totals.Engagement, report.ElapsedPercent))
+    }
+    if report.Goals == nil {
+        report.Goals = []CampaignGoal{}
+    }
+    return report, nil
+}
+
+// campaignGains returns a video's growth since the campaign started at the
+// end of each bucket, carrying the last known value over buckets without
+// samples. The baseline it used is recorded in contribution.
+func (s *videoService) campaignGains(ctx context.Context, video *repository.Video, start, end time.Time, interval string, starts []time.Time, contribution *CampaignContribution) ([]CampaignTotals, error) {
+    var baseline CampaignTotals
+    before, err := s.repo.GetStatsAt(ctx, video.VideoID, start)
+    if err != nil {
+        return nil, err
+    }
+    if before == nil && (video.PublishedAt == nil || video.PublishedAt.Before(start)) {
+        // Registered after the campaign started, or its history was purged:
+        // measure from the first sample there is, rolled up or raw
+        before, err = s.repo.FirstStatsSampleReaching(ctx, video.VideoID, "views", 0)
+        if err != nil {
+            return nil, err
+        }
+        contribution.Baseline = BaselineFirstSample
+        if before == nil {
+            contribution.Baseline = BaselineNone
+        }
+    } else if before == nil {
+        contribution.Baseline, contribution.BaselineAt = BaselinePublished, video.PublishedAt
+    } else {
+        contribution.Baseline = BaselineCampaignStart
+    }
+    if before != nil {
+        baseline = totalsOf(before.Views, before.Likes, before.Comments)
+        at := before.Timestamp
+        contribution.BaselineAt = &at
+    }
+
+    buckets, err := s.repo.GetStatsBuckets(ctx, video.VideoID, start, end, interval, repository.AggLast, true)
+    if err != nil {
+        return nil, err
+    }
+
+    gains := make([]CampaignTotals, len(starts))
+    var current CampaignTotals
+    j := 0
+    for i, bucket := range starts {
+        for j < len(buckets) && !buckets[j].Bucket.After(bucket) {
+            b := buckets[j]
+            current = totalsOf(b.Views-baseline.Views, b.Likes-baseline.Likes, b.Comments-baseline.Comments)
+            j++
+        }
+        gains[i] = current
+    }
+    return gains, nil
+}
+
+// checkCampaignVideos removes duplicates and rejects videos that are not
+// tracked
+func (s *videoService) checkCampaignVideos(ctx context.Context, videoIDs []string) ([]string, error) {
+    seen := make(map[string]bool)
+    var unique []string
+    for _, videoID := range videoIDs {
+        videoID = strings.TrimSpace(videoID)
+        if videoID == "" || seen[videoID] {
+            continue
+        }
+        seen[videoID] = true
+
+        video, err := s.repo.GetVideoByVideoID(ctx, videoID)
+        if err != nil {
+            return nil, err
+        }
+        if video == nil {
+            return nil, Errorf(CodeNotFound, "video not tracked: %s", videoID)
+        }
+        unique = append(unique, videoID)
+    }
+    return unique, nil
+}
+
+func (s *videoService) getCampaign(ctx context.Context, id string) (*repository.Campaign, error) {
+    campaign, err := s.repo.GetCampaign(ctx, id)
+    if err != nil {
+        return nil, err
+    }
+    if campaign == nil {
+        return nil, Errorf(CodeNotFound, "campaign not found: %s", id)
+    }
+    return campaign, nil
+}
+
+func newCampaignGoal(metric string, target, current int, elapsed float64) CampaignGoal {
+    percent := percentOf(current, target)
+    return CampaignGoal{Metric: metric, Target: target, Current: current, Percent: percent, OnTrack: percent >= elapsed}
+}
+
+// elapsedPercent is the share of the campaign window that has passed
+func elapsedPercent(campaign *repository.Campaign, now time.Time) float64 {
+    switch {
+    case now.Before(campaign.StartsAt):
+        return 0
+    case now.After(campaign.EndsAt):
+        return 100
+    }
+    return now.Sub(campaign.StartsAt).Seconds() / campaign.EndsAt.Sub(campaign.StartsAt).Seconds() * 100
+}
+
+func totalsOf(views, likes, comments int) CampaignTotals {
+    return CampaignTotals{Views: views, Likes: likes, Comments: comments, Engagement: likes + comments}
+}
+
+func (t *CampaignTotals) add(other CampaignTotals) {
+    t.Views += other.Views
+    t.Likes += other.Likes
+    t.Comments += other.Comments
+    t.Engagement += other.Engagement
+}
+
+func percentOf(part, whole int) float64 {
+    if whole == 0 {
+        return 0
+    }
+    return float64(part) / float64(whole) * 100
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+    "context"
+    "testing"
+    "time"
+    "video-stats-tracker/internal/repository"
+)
+
+// campaignRepository serves a fixed history: before is the sample at the
+// campaign start, first the earliest sample, buckets the in-window values
+type campaignRepository struct {
+    repository.Repository
+    before, first *repository.VideoStats
+    buckets       []repository.StatsBucket
+}
+
+func (r *campaignRepository) GetStatsAt(ctx context.Context, videoID string, at time.Time) (*repository.VideoStats, error) {
+    return r.before, nil
+}
+
+func (r *campaignRepository) FirstStatsSampleReaching(ctx context.Context, videoID, metric string, threshold int) (*repository.VideoStats, error) {
+    return r.first, nil
+}
+
+func (r *campaignRepository) GetStatsBuckets(ctx context.Context, videoID string, from, to time.Time, interval, agg string, excludeFlagged bool) ([]repository.StatsBucket, error) {
+    return r.buckets, nil
+}
+
+func TestCampaignGainsBaseline(t *testing.T) {
+    start := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+    published := start.Add(-30 * 24 * time.Hour)
+    lateRelease := start.Add(36 * time.Hour)
+    starts := []time.Time{start, start.Add(24 * time.Hour), start.Add(48 * time.Hour)}
+    buckets := []repository.StatsBucket{
+        {Bucket: start.Add(24 * time.Hour), Views: 5000},
+        {Bucket: start.Add(48 * time.Hour), Views: 8000},
+    }
+
+    tests := []struct {
+        name        string
+        publishedAt *time.Time
+        before      *repository.VideoStats
+        first       *repository.VideoStats
+        baseline    string
+        views       []int
+    }{
+        {"counts before the campaign", &published, &repository.VideoStats{Timestamp: start.Add(-time.Hour), Views: 3000},
+            nil, BaselineCampaignStart, []int{0, 2000, 5000}},
+        {"registered during the campaign", &published, nil,
+            &repository.VideoStats{Timestamp: start.Add(20 * time.Hour), Views: 4000}, BaselineFirstSample, []int{0, 1000, 4000}},
+        {"unknown publish time", nil, nil,
+            &repository.VideoStats{Timestamp: start.Add(20 * time.Hour), Views: 4000}, BaselineFirstSample, []int{0, 1000, 4000}},
+        {"published during the campaign", &lateRelease, nil, nil, BaselinePublished, []int{0, 5000, 8000}},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            svc := &videoService{repo: &campaignRepository{before: tt.before, first: tt.first, buckets: buckets}}
+            video := &repository.Video{VideoID: "v1", PublishedAt: tt.publishedAt}
+            var contribution CampaignContribution
+
+            gains, err := svc.campaignGains(context.Background(), video, start, start.Add(72*time.Hour), repository.IntervalDay, starts, &contribution)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if contribution.Baseline != tt.baseline || contribution.BaselineAt == nil {
+                t.Errorf("baseline = %s at %v, want %s", contribution.Baseline, contribution.BaselineAt, tt.baseline)
+            }
+            for i, want := range tt.views {
+                if gains[i].Views != want {
+                    t.Errorf("gain %d = %d views, want %d", i, gains[i].Views, want)
+                }
+            }
+        })
+    }
+}
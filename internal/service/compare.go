@@ -0,0 +1,318 @@
+package service
+
+import (
+    "context"
+    "math"
+    "time"
+    "video-stats-tracker/internal/repository"
+)
+
+// Comparison alignments and normalizations
+const (
+    AlignPublish      = "publish"
+    AlignRegistration = "registration"
+
+    NormalizeNone      = "none"
+    NormalizeReference = "reference"
+    NormalizeFinal     = "final"
+)
+
+// Comparison limits
+const (
+    maxCompareVideos = 10
+    maxComparePoints = 2000
+    maxCompareAge    = 90 * 24 * time.Hour
+)
+
+// CompareOptions controls how series are aligned. Step and MaxAge default to
+// one hour and the age of the oldest video.
+type CompareOptions struct {
+    Align     string
+    Step      time.Duration
+    MaxAge    time.Duration
+    Normalize string
+}
+
+// Comparison holds the series of several videos on a common age axis
+type Comparison struct {
+    Align     string          `json:"align"`
+    Normalize string          `json:"normalize"`
+    Step      string          `json:"step"`
+    Reference string          `json:"reference"`
+    // CommonAgeHours is the largest age all videos have reached
+    CommonAgeHours float64         `json:"common_age_hours"`
+    Videos         []ComparedVideo `json:"videos"`
+}
+
+// ComparedVideo is one video's aligned series. VsReference is how far ahead
+// (positive) or behind (negative) of the reference video its views were at
+// the common age, in percent.
+type ComparedVideo struct {
+    VideoID     string     `json:"video_id"`
+    Platform    string     `json:"platform"`
+    Start       time.Time  `json:"start"`
+    AgeHours    float64    `json:"age_hours"`
+    AtCommonAge *AgePoint  `json:"at_common_age,omitempty"`
+    VsReference *float64   `json:"vs_reference_percent,omitempty"`
+    Points      []AgePoint `json:"points"`
+}
+
+// AgePoint is a video's counts at an age, interpolated between samples
+type AgePoint struct {
+    AgeHours float64 `json:"age_hours"`
+    Views    float64 `json:"views"`
+    Likes    float64 `json:"likes"`
+    Comments float64 `json:"comments"`
+}
+
+// ageSeries is a video's hourly history as ages and counts
+type ageSeries struct {
+    hours                  []float64
+    views, likes, comments []float64
+}
+
+// CompareVideos aligns the hourly history of the videos by time since
+// publication (or registration) and samples it every step. The first video
+// is the reference the others are compared against.
+func (s *videoService) CompareVideos(ctx context.Context, videoIDs []string, opts CompareOptions) (*Comparison, error) {
+    if len(videoIDs) < 2 || len(videoIDs) > maxCompareVideos {
+        return nil, Errorf(CodeValidation, "compare between 2 and %d videos", maxCompareVideos)
+    }
+    if opts.Align == "" {
+        opts.Align = AlignPublish
+    }
+    if opts.Align != AlignPublish && opts.Align != AlignRegistration {
+        return nil, Errorf(CodeValidation, "unsupported align: %s (use publish or registration)", opts.Align)
+    }
+    if opts.Normalize == "" {
+        opts.Normalize = NormalizeNone
+    }
+    if opts.Normalize != NormalizeNone && opts.Normalize != NormalizeReference && opts.Normalize != NormalizeFinal {
+        return nil, Errorf(CodeValidation, "unsupported normalize: %s (use none, reference or final)", opts.Normalize)
+    }
+    if opts.Step == 0 {
+        opts.Step = time.Hour
+    }
+    if opts.Step < time.Hour {
+        return nil, Errorf(CodeValidation, "step must be at least 1h")
+    }
+
+    now := time.Now()
+    videos := make([]*repository.Video, len(videoIDs))
+    starts := make([]time.Time, len(videoIDs))
+    var oldest time.Duration
+    for i, videoID := range videoIDs {
+        video, err := s.trackedVideo(ctx, videoID)
+        if err != nil {
+            return nil, err
+        }
+        videos[i] = video
+        starts[i] = video.CreatedAt
+        if opts.Align == AlignPublish {
+            starts[i] = milestoneStart(video)
+        }
+        if age := now.Sub(starts[i]); age > oldest {
+            oldest = age
+        }
+    }
+    if opts.MaxAge <= 0 {
+        opts.MaxAge = oldest
+    }
+    if opts.MaxAge > maxCompareAge {
+        opts.MaxAge = maxCompareAge
+    }
+    if int(opts.MaxAge/opts.Step) > maxComparePoints {
+        return nil, Errorf(CodeValidation, "too many points: use a larger step or a smaller max_age")
+    }
+
+    comparison := &Comparison{
+        Align:     opts.Align,
+        Normalize: opts.Normalize,
+        Step:      opts.Step.String(),
+        Reference: videoIDs[0],
+    }
+
+    // Counts start from zero at publication when a video was sampled within
+    // a step of it
+    zeroWithin := 0.0
+    if opts.Align == AlignPublish {
+        zeroWithin = opts.Step.Hours()
+    }
+
+    series := make([]*ageSeries, len(videos))
+    commonAge := opts.MaxAge.Hours()
+    for i, video := range videos {
+        history, err := s.ageHistory(ctx, video, starts[i], opts.MaxAge, now)
+        if err != nil {
+            return nil, err
+        }
+        series[i] = history
+
+        covered := 0.0
+        if n := len(history.hours); n > 0 {
+            covered = history.hours[n-1]
+        }
+        if covered < commonAge {
+            commonAge = covered
+        }
+
+        compared := ComparedVideo{
+            VideoID:  video.VideoID,
+            Platform: video.Platform,
+            Start:    starts[i],
+            AgeHours: now.Sub(starts[i]).Hours(),
+            Points:   []AgePoint{},
+        }
+        for age := time.Duration(0); age <= opts.MaxAge; age += opts.Step {
+            if point, ok := history.at(age.Hours(), zeroWithin); ok {
+                compared.Points = append(compared.Points, point)
+            }
+        }
+        comparison.Videos = append(comparison.Videos, compared)
+    }
+    comparison.CommonAgeHours = commonAge
+
+    var reference *AgePoint
+    for i := range comparison.Videos {
+        compared := &comparison.Videos[i]
+        point, ok := series[i].at(commonAge, zeroWithin)
+        if !ok {
+            continue
+        }
+        compared.AtCommonAge = &point
+        if i == 0 {
+            reference = &point
+        } else if reference != nil && reference.Views > 0 {
+            diff := (point.Views - reference.Views) / reference.Views * 100
+            compared.VsReference = &diff
+        }
+    }
+
+    normalizeComparison(comparison, opts.Normalize)
+    return comparison, nil
+}
+
+// ageHistory loads the hourly buckets of a video up to maxAge after start.
+// Each bucket holds the last sample of its hour, stood in for by the middle
+// of the hour as in forecasts.
+func (s *videoService) ageHistory(ctx context.Context, video *repository.Video, start time.Time, maxAge time.Duration, now time.Time) (*ageSeries, error) {
+    end := start.Add(maxAge)
+    if end.After(now) {
+        end = now
+    }
+    buckets, err := s.repo.GetStatsBuckets(ctx, video.VideoID, start.Add(-time.Hour), end, repository.IntervalHour, repository.AggLast, true)
+    if err != nil {
+        return nil, err
+    }
+
+    history := &ageSeries{}
+    for _, b := range buckets {
+        at := b.Bucket.Add(30 * time.Minute)
+        if at.After(now) {
+            at = now
+        }
+        age := at.Sub(start).Hours()
+        if age < 0 || age > maxAge.Hours() {
+            continue
+        }
+        history.hours = append(history.hours, age)
+        history.views = append(history.views, float64(b.Views))
+        history.likes = append(history.likes, float64(b.Likes))
+        history.comments = append(history.comments, float64(b.Comments))
+    }
+    return history, nil
+}
+
+// at interpolates the counts at an age. Ages after the last sample are not
+// known. Before the first sample, counts grow from zero at publication only
+// when that sample came within zeroWithin hours of it; for a video first
+// sampled later, or with zeroWithin 0, those ages are unknown.
+func (h *ageSeries) at(age, zeroWithin float64) (AgePoint, bool) {
+    point := AgePoint{AgeHours: age}
+    n := len(h.hours)
+    if n == 0 || age > h.hours[n-1] {
+        return point, false
+    }
+
+    i := 0
+    for i < n && h.hours[i] < age {
+        i++
+    }
+    if h.hours[i] == age {
+        point.Views, point.Likes, point.Comments = h.views[i], h.likes[i], h.comments[i]
+        return point, true
+    }
+
+    // Interpolate between the previous sample (or zero at age 0) and i
+    var t0, v0, l0, c0 float64
+    if i > 0 {
+        t0, v0, l0, c0 = h.hours[i-1], h.views[i-1], h.likes[i-1], h.comments[i-1]
+    } else if h.hours[0] > zeroWithin {
+        return point, false
+    }
+    frac := (age - t0) / (h.hours[i] - t0)
+    point.Views = v0 + frac*(h.views[i]-v0)
+    point.Likes = l0 + frac*(h.likes[i]-l0)
+    point.Comments = c0 + frac*(h.comments[i]-c0)
+    return point, true
+}
+
+// sampledNear reports whether a sample was taken within the given hours of
+// an age
+func (h *ageSeries) sampledNear(age, within float64) bool {
+    for _, hours := range h.hours {
+        if math.Abs(hours-age) <= within {
+            return true
+        }
+    }
+    return false
+}
+
+// normalizeComparison rescales the points in percent: of the reference
+// video's counts at the same age, or of each video's own counts at the
+// common age
+func normalizeComparison(comparison *Comparison, normalize string) {
+    if normalize == NormalizeNone {
+        return
+    }
+
+    reference := make(map[float64]AgePoint)
+    for _, point := range comparison.Videos[0].Points {
+        reference[point.AgeHours] = point
+    }
+
+    for i := range comparison.Videos {
+        compared := &comparison.Videos[i]
+        if normalize == NormalizeFinal && compared.AtCommonAge == nil {
+            compared.Points = []AgePoint{}
+            continue
+        }
+
+        var kept []AgePoint
+        for _, point := range compared.Points {
+            base := reference[point.AgeHours]
+            if normalize == NormalizeFinal {
+                base = *compared.AtCommonAge
+            } else if _, ok := reference[point.AgeHours]; !ok {
+                continue
+            }
+            kept = append(kept, AgePoint{
+                AgeHours: point.AgeHours,
+                Views:    ratioPercent(point.Views, base.Views),
+                Likes:    ratioPercent(point.Likes, base.Likes),
+                Comments: ratioPercent(point.Comments, base.Comments),
+            })
+        }
+        if kept == nil {
+            kept = []AgePoint{}
+        }
+        compared.Points = kept
+    }
+}
+
+func ratioPercent(value, base float64) float64 {
+    if base == 0 {
+        return 0
+    }
+    return value / base * 100
+}
@@ -0,0 +1,34 @@
+package service
+
+import "testing"
+
+func TestAgeSeriesAt(t *testing.T) {
+    early := &ageSeries{
+        hours:    []float64{2, 4},
+        views:    []float64{100, 300},
+        likes:    []float64{10, 30},
+        comments: []float64{1, 3},
+    }
+    late := &ageSeries{
+        hours:    []float64{48, 50},
+        views:    []float64{5000, 5200},
+        likes:    []float64{500, 520},
+        comments: []float64{50, 52},
+    }
+
+    if point, ok := early.at(3, 6); !ok || point.Views != 200 {
+        t.Errorf("between samples: got %v %v, want 200", point.Views, ok)
+    }
+    if point, ok := early.at(1, 6); !ok || point.Views != 50 {
+        t.Errorf("sampled within a step: got %v %v, want 50 from zero", point.Views, ok)
+    }
+    if _, ok := early.at(1, 0); ok {
+        t.Error("without zeroWithin, ages before the first sample should be unknown")
+    }
+    if _, ok := late.at(24, 6); ok {
+        t.Error("first sampled two days in, ages before it should be unknown")
+    }
+    if _, ok := early.at(5, 6); ok {
+        t.Error("ages after the last sample should be unknown")
+    }
+}
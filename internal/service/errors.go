@@ -0,0 +1,47 @@
+package service
+
+import (
+    "errors"
+    "fmt"
+)
+
+// Error codes returned to API clients; the transport maps each code to an
+// HTTP status
+const (
+    CodeValidation = "validation_error"
+    CodeDuplicate  = "duplicate"
+    CodeNotFound   = "not_found"
+    CodeUpstream   = "upstream_error"
+    CodeInternal   = "internal_error"
+)
+
+// Error is a service error with a machine-readable code
+type Error struct {
+    Code    string
+    Message string
+    Err     error
+}
+
+func (e *Error) Error() string {
+    return e.Message
+}
+
+func (e *Error) Unwrap() error {
+    return e.Err
+}
+
+// Errorf builds a service error with the given code
+func Errorf(code, format string, args ...interface{}) *Error {
+    err := fmt.Errorf(format, args...)
+    return &Error{Code: code, Message: err.Error(), Err: errors.Unwrap(err)}
+}
+
+// ErrorCode returns the code of a service error, or CodeInternal for any
+// other error
+func ErrorCode(err error) string {
+    var svcErr *Error
+    if errors.As(err, &svcErr) {
+        return svcErr.Code
+    }
+    return CodeInternal
+}
@@ -0,0 +1,344 @@
+package service
+
+import (
+    "context"
+    "math"
+    "time"
+    "video-stats-tracker/internal/repository"
+)
+
+// Forecast horizons, measured from publication
+var ForecastHorizons = []struct {
+    Label string
+    Age   time.Duration
+}{
+    {"24h", 24 * time.Hour},
+    {"7d", 7 * 24 * time.Hour},
+    {"30d", 30 * 24 * time.Hour},
+}
+
+// Curve models fitted on cumulative counts against hours since publication
+const (
+    ModelLog      = "log"   // y = a + b*ln(t)
+    ModelPowerLaw = "power" // y = a * t^b
+)
+
+// forecastZ is the two-sided 95% normal quantile used for the bands
+const forecastZ = 1.96
+
+// minForecastSamples is the number of hourly buckets a fit needs
+const minForecastSamples = 3
+
+// Forecast projects a video's views and likes
+type Forecast struct {
+    VideoID     string                `json:"video_id"`
+    Start       time.Time             `json:"start"`
+    AgeHours    float64               `json:"age_hours"`
+    Samples     int                   `json:"samples"`
+    Models      map[string]CurveFit   `json:"models"`
+    Projections []ForecastPoint       `json:"projections"`
+    Target      *TargetForecast       `json:"target,omitempty"`
+}
+
+// CurveFit summarizes the model chosen for a metric. RMSE is measured on
+// the observed counts.
+type CurveFit struct {
+    Model string  `json:"model"`
+    A     float64 `json:"a"`
+    B     float64 `json:"b"`
+    RMSE  float64 `json:"rmse"`
+
+    n, xMean, sxx, sigma float64
+}
+
+// Projection is a projected count with its 95% prediction interval.
+// Horizons the video has already passed report the observed count, or no
+// projection when no sample was taken by then.
+type Projection struct {
+    Value    float64 `json:"value"`
+    Lower    float64 `json:"lower"`
+    Upper    float64 `json:"upper"`
+    Observed bool    `json:"observed,omitempty"`
+}
+
+// ForecastPoint holds the projections at one horizon
+type ForecastPoint struct {
+    Horizon string      `json:"horizon"`
+    At      time.Time   `json:"at"`
+    Views   *Projection `json:"views"`
+    Likes   *Projection `json:"likes"`
+}
+
+// TargetForecast tells whether a metric is on track to reach a target by a
+// deadline. Probability comes from the prediction interval of the fit.
+type TargetForecast struct {
+    Metric      string     `json:"metric"`
+    Target      int        `json:"target"`
+    Deadline    time.Time  `json:"deadline"`
+    Projected   *Projection `json:"projected"`
+    Probability float64    `json:"probability"`
+    OnTrack     bool       `json:"on_track"`
+}
+
+// ForecastTarget is an optional contracted number to check
+type ForecastTarget struct {
+    Metric   string
+    Target   int
+    Deadline time.Time
+}
+
+// GetForecast fits decay curves to a video's hourly history and projects
+// views and likes at 24h, 7d and 30d after publication. The log and
+// power-law fits are both tried and the one closer to the observed counts
+// is used per metric.
+func (s *videoService) GetForecast(ctx context.Context, videoID string, target *ForecastTarget) (*Forecast, error) {
+    video, err := s.repo.GetVideoByVideoID(ctx, videoID)
+    if err != nil {
+        return nil, err
+    }
+    if video == nil {
+        return nil, Errorf(CodeNotFound, "video not tracked: %s", videoID)
+    }
+    if target != nil {
+        if target.Metric != "views" && target.Metric != "likes" {
+            return nil, Errorf(CodeValidation, "unsupported target metric: %s (use views or likes)", target.Metric)
+        }
+        if target.Target <= 0 {
+            return nil, Errorf(CodeValidation, "target must be positive")
+        }
+    }
+
+    now := time.Now()
+    start := milestoneStart(video)
+    buckets, err := s.repo.GetStatsBuckets(ctx, videoID, start.Add(-time.Hour), now, repository.IntervalHour, repository.AggLast, true)
+    if err != nil {
+        return nil, err
+    }
+
+    // Each bucket holds the last sample of its hour; the exact time is not
+    // kept, so the middle of the hour stands in for it
+    var hours, views, likes []float64
+    for _, b := range buckets {
+        at := b.Bucket.Add(30 * time.Minute)
+        if at.After(now) {
+            at = now
+        }
+        t := at.Sub(start).Hours()
+        if t <= 0 {
+            continue
+        }
+        hours = append(hours, t)
+        views = append(views, float64(b.Views))
+        likes = append(likes, float64(b.Likes))
+    }
+    if len(hours) < minForecastSamples {
+        return nil, Errorf(CodeValidation, "not enough history to forecast: need at least %d hourly samples", minForecastSamples)
+    }
+
+    fits := map[string]*CurveFit{"views": bestFit(hours, views), "likes": bestFit(hours, likes)}
+    latest := map[string]float64{"views": views[len(views)-1], "likes": likes[len(likes)-1]}
+
+    forecast := &Forecast{
+        VideoID:  videoID,
+        Start:    start,
+        AgeHours: now.Sub(start).Hours(),
+        Samples:  len(hours),
+        Models:   make(map[string]CurveFit),
+    }
+    for metric, fit := range fits {
+        if fit == nil {
+            return nil, Errorf(CodeValidation, "not enough variation in %s history to forecast", metric)
+        }
+        forecast.Models[metric] = *fit
+    }
+
+    // A time already passed is answered from the history only: the curve
+    // would invent a count that was never observed
+    project := func(metric string, at time.Time) *Projection {
+        if !at.After(now) {
+            observed, ok := observedAt(hours, map[string][]float64{"views": views, "likes": likes}[metric], at.Sub(start).Hours())
+            if !ok {
+                return nil
+            }
+            return &Projection{Value: observed, Lower: observed, Upper: observed, Observed: true}
+        }
+        p := fits[metric].project(at.Sub(start).Hours(), latest[metric])
+        return &p
+    }
+
+    for _, horizon := range ForecastHorizons {
+        at := start.Add(horizon.Age)
+        forecast.Projections = append(forecast.Projections, ForecastPoint{
+            Horizon: horizon.Label,
+            At:      at,
+            Views:   project("views", at),
+            Likes:   project("likes", at),
+        })
+    }
+
+    if target != nil {
+        fit := fits[target.Metric]
+        if !target.Deadline.After(start) {
+            return nil, Errorf(CodeValidation, "deadline must be after the video was published")
+        }
+        projected := project(target.Metric, target.Deadline)
+
+        var probability float64
+        switch {
+        case latest[target.Metric] >= float64(target.Target):
+            probability = 1
+        case !target.Deadline.After(now):
+            // The deadline passed without the target being reached
+        default:
+            probability = fit.probabilityAtLeast(target.Deadline.Sub(start).Hours(), float64(target.Target))
+        }
+        forecast.Target = &TargetForecast{
+            Metric:      target.Metric,
+            Target:      target.Target,
+            Deadline:    target.Deadline,
+            Projected:   projected,
+            Probability: math.Round(probability*1000) / 1000,
+            OnTrack:     probability >= 0.5,
+        }
+    }
+    return forecast, nil
+}
+
+// observedAt returns the last observed count at or before t
+func observedAt(hours, values []float64, t float64) (float64, bool) {
+    found := false
+    var value float64
+    for i, h := range hours {
+        if h > t {
+            break
+        }
+        value, found = values[i], true
+    }
+    return value, found
+}
+
+// bestFit fits both models and keeps the one with the lower RMSE on the
+// observed counts, or nil when neither can be fitted
+func bestFit(hours, values []float64) *CurveFit {
+    var best *CurveFit
+    for _, model := range []string{ModelLog, ModelPowerLaw} {
+        fit := fitCurve(model, hours, values)
+        if fit != nil && (best == nil || fit.RMSE < best.RMSE) {
+            best = fit
+        }
+    }
+    return best
+}
+
+// fitCurve runs a least squares regression of the transformed counts on
+// ln(t). The power law is fitted in log space, so it needs positive counts.
+func fitCurve(model string, hours, values []float64) *CurveFit {
+    var xs, ys []float64
+    for i, t := range hours {
+        y := values[i]
+        if model == ModelPowerLaw {
+            if y <= 0 {
+                continue
+            }
+            y = math.Log(y)
+        }
+        xs = append(xs, math.Log(t))
+        ys = append(ys, y)
+    }
+
+    n := float64(len(xs))
+    if n < minForecastSamples {
+        return nil
+    }
+
+    var xMean, yMean float64
+    for i := range xs {
+        xMean += xs[i]
+        yMean += ys[i]
+    }
+    xMean /= n
+    yMean /= n
+
+    var sxx, sxy float64
+    for i := range xs {
+        sxx += (xs[i] - xMean) * (xs[i] - xMean)
+        sxy += (xs[i] - xMean) * (ys[i] - yMean)
+    }
+    if sxx == 0 {
+        return nil
+    }
+
+    fit := &CurveFit{Model: model, B: sxy / sxx, n: n, xMean: xMean, sxx: sxx}
+    intercept := yMean - fit.B*xMean
+
+    var residuals, squaredErr float64
+    for i := range xs {
+        r := ys[i] - (intercept + fit.B*xs[i])
+        residuals += r * r
+    }
+    fit.sigma = math.Sqrt(residuals / math.Max(n-2, 1))
+
+    fit.A = intercept
+    if model == ModelPowerLaw {
+        fit.A = math.Exp(intercept)
+    }
+    for i, t := range hours {
+        if model == ModelPowerLaw && values[i] <= 0 {
+            continue
+        }
+        d := values[i] - fit.value(t)
+        squaredErr += d * d
+    }
+    fit.RMSE = math.Sqrt(squaredErr / n)
+    return fit
+}
+
+// value evaluates the fitted curve at t hours
+func (f *CurveFit) value(t float64) float64 {
+    if f.Model == ModelPowerLaw {
+        return f.A * math.Pow(t, f.B)
+    }
+    return f.A + f.B*math.Log(t)
+}
+
+// transformedSE is the standard error of a new observation at t in the
+// space the regression was fitted in
+func (f *CurveFit) transformedSE(t float64) float64 {
+    x := math.Log(t)
+    return f.sigma * math.Sqrt(1+1/f.n+(x-f.xMean)*(x-f.xMean)/f.sxx)
+}
+
+// project returns the projection at t with its 95% band. Counts are
+// cumulative, so nothing is projected below the latest observed value.
+func (f *CurveFit) project(t, floor float64) Projection {
+    se := f.transformedSE(t)
+    var p Projection
+    if f.Model == ModelPowerLaw {
+        center := math.Log(f.value(t))
+        p = Projection{Value: math.Exp(center), Lower: math.Exp(center - forecastZ*se), Upper: math.Exp(center + forecastZ*se)}
+    } else {
+        center := f.value(t)
+        p = Projection{Value: center, Lower: center - forecastZ*se, Upper: center + forecastZ*se}
+    }
+
+    p.Value, p.Lower, p.Upper = math.Max(p.Value, floor), math.Max(p.Lower, floor), math.Max(p.Upper, floor)
+    p.Value, p.Lower, p.Upper = math.Round(p.Value), math.Round(p.Lower), math.Round(p.Upper)
+    return p
+}
+
+// probabilityAtLeast is the probability that the count at t reaches target
+// under the fit's normal prediction error
+func (f *CurveFit) probabilityAtLeast(t, target float64) float64 {
+    se := f.transformedSE(t)
+    center, goal := f.value(t), target
+    if f.Model == ModelPowerLaw {
+        center, goal = math.Log(center), math.Log(target)
+    }
+    if se == 0 {
+        if center >= goal {
+            return 1
+        }
+        return 0
+    }
+    return 0.5 * (1 + math.Erf((center-goal)/(se*math.Sqrt2)))
+}
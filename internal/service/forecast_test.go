@@ -0,0 +1,111 @@
+package service
+
+import (
+    "math"
+    "testing"
+)
+
+// curve samples y at t = 1..n hours with a small alternating wobble, so the
+// fits have a nonzero prediction error
+func curve(n int, y func(t float64) float64) (hours, values []float64) {
+    for i := 1; i <= n; i++ {
+        t := float64(i)
+        wobble := 1.0 + 0.01*float64(i%2*2-1)
+        hours = append(hours, t)
+        values = append(values, y(t)*wobble)
+    }
+    return hours, values
+}
+
+func TestBestFitPicksTheModel(t *testing.T) {
+    tests := []struct {
+        name  string
+        model string
+        y     func(t float64) float64
+        a, b  float64
+    }{
+        {"log", ModelLog, func(t float64) float64 { return 1000 + 500*math.Log(t) }, 1000, 500},
+        {"power law", ModelPowerLaw, func(t float64) float64 { return 200 * math.Pow(t, 1.5) }, 200, 1.5},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            hours, values := curve(48, tt.y)
+            fit := bestFit(hours, values)
+            if fit == nil {
+                t.Fatal("no fit")
+            }
+            if fit.Model != tt.model {
+                t.Errorf("model = %s, want %s", fit.Model, tt.model)
+            }
+            if math.Abs(fit.A-tt.a)/tt.a > 0.05 || math.Abs(fit.B-tt.b)/tt.b > 0.05 {
+                t.Errorf("fit a=%.3f b=%.3f, want about a=%.3f b=%.3f", fit.A, fit.B, tt.a, tt.b)
+            }
+        })
+    }
+}
+
+func TestFitCurveNeedsVariation(t *testing.T) {
+    if fit := fitCurve(ModelLog, []float64{1, 2}, []float64{10, 20}); fit != nil {
+        t.Errorf("fitted %d samples, want nil", 2)
+    }
+    if fit := fitCurve(ModelLog, []float64{5, 5, 5}, []float64{10, 20, 30}); fit != nil {
+        t.Errorf("fitted samples at one age, want nil")
+    }
+    // Zero counts cannot be fitted in log space
+    if fit := fitCurve(ModelPowerLaw, []float64{1, 2, 3, 4}, []float64{0, 0, 5, 9}); fit != nil {
+        t.Errorf("power law fitted two positive counts, want nil")
+    }
+}
+
+func TestProjectBand(t *testing.T) {
+    hours, values := curve(48, func(t float64) float64 { return 1000 + 500*math.Log(t) })
+    fit := fitCurve(ModelLog, hours, values)
+
+    p := fit.project(24*7, 0)
+    want := 1000 + 500*math.Log(24*7)
+    if math.Abs(p.Value-want)/want > 0.02 {
+        t.Errorf("projected %v at 7d, want about %v", p.Value, want)
+    }
+    if !(p.Lower < p.Value && p.Value < p.Upper) {
+        t.Errorf("band %v..%v does not surround %v", p.Lower, p.Upper, p.Value)
+    }
+    if near, far := fit.project(49, 0), fit.project(24*30, 0); far.Upper-far.Lower <= near.Upper-near.Lower {
+        t.Errorf("band at 30d (%v) is not wider than at 49h (%v)", far.Upper-far.Lower, near.Upper-near.Lower)
+    }
+
+    // Counts are cumulative: nothing below the latest observed value
+    floored := fit.project(24*7, 1e6)
+    if floored.Value != 1e6 || floored.Lower != 1e6 {
+        t.Errorf("projection %+v fell below the floor", floored)
+    }
+}
+
+func TestProbabilityAtLeast(t *testing.T) {
+    hours, values := curve(48, func(t float64) float64 { return 200 * math.Pow(t, 1.5) })
+    fit := fitCurve(ModelPowerLaw, hours, values)
+    at := 24.0 * 7
+    center := fit.value(at)
+
+    if p := fit.probabilityAtLeast(at, center); math.Abs(p-0.5) > 0.01 {
+        t.Errorf("probability of reaching the projection = %v, want 0.5", p)
+    }
+    if p := fit.probabilityAtLeast(at, center/2); p < 0.99 {
+        t.Errorf("probability of reaching half the projection = %v, want about 1", p)
+    }
+    if p := fit.probabilityAtLeast(at, center*2); p > 0.01 {
+        t.Errorf("probability of reaching twice the projection = %v, want about 0", p)
+    }
+}
+
+func TestObservedAt(t *testing.T) {
+    hours := []float64{2.5, 3.5, 30.5}
+    values := []float64{10, 20, 300}
+
+    if _, ok := observedAt(hours, values, 1); ok {
+        t.Errorf("observed a count before the first sample")
+    }
+    if v, ok := observedAt(hours, values, 24); !ok || v != 20 {
+        t.Errorf("observedAt(24h) = %v, %v; want 20, true", v, ok)
+    }
+}
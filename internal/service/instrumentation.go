@@ -0,0 +1,77 @@
+package service
+
+import (
+    "context"
+    "log"
+    "time"
+    "video-stats-tracker/internal/platform"
+    "video-stats-tracker/internal/repository"
+
+    "github.com/go-kit/kit/metrics"
+)
+
+// Queues reported in Instrumentation.QueueDepth
+const (
+    QueueRetry    = "retry"
+    QueueWebhooks = "webhooks"
+)
+
+// Instrumentation holds the operational metrics recorded by the service
+// and its platform clients. Nil metrics are not recorded.
+type Instrumentation struct {
+    Platform platform.Metrics
+    // QueueDepth is labeled by queue: the videos waiting out a retry
+    // backoff and the webhook deliveries due
+    QueueDepth metrics.Gauge
+    // Videos exports the latest counts of every polled video
+    Videos *VideoGauges
+}
+
+// VideoGauges are set to a video's counts each time it is polled, labeled
+// by video_id and platform. Tags are left out so that retagging a video
+// does not start new series; the server exports them separately. Series of
+// videos that are no longer polled keep their last value until the process
+// restarts.
+type VideoGauges struct {
+    Views    metrics.Gauge
+    Likes    metrics.Gauge
+    Comments metrics.Gauge
+}
+
+// WithInstrumentation records the service's operational metrics
+func WithInstrumentation(m Instrumentation) Option {
+    return func(s *videoService) {
+        s.youtubeClient.Instrument(m.Platform)
+        s.instagramClient.Instrument(m.Platform)
+        if m.QueueDepth != nil {
+            s.queueDepth = m.QueueDepth
+            s.retries.depth = m.QueueDepth.With("queue", QueueRetry)
+        }
+        s.videoGauges = m.Videos
+    }
+}
+
+// observeVideo sets the per-video gauges, when enabled
+func (s *videoService) observeVideo(video *repository.Video, stats *repository.VideoStats) {
+    if s.videoGauges == nil {
+        return
+    }
+    labels := []string{"video_id", video.VideoID, "platform", video.Platform}
+    s.videoGauges.Views.With(labels...).Set(float64(stats.Views))
+    s.videoGauges.Likes.With(labels...).Set(float64(stats.Likes))
+    s.videoGauges.Comments.With(labels...).Set(float64(stats.Comments))
+}
+
+// observeWebhookQueue reports how many deliveries are due, before a batch
+// takes its share
+func (s *videoService) observeWebhookQueue(ctx context.Context, now time.Time) {
+    if s.queueDepth == nil {
+        return
+    }
+    due, err := s.repo.CountDueWebhookDeliveries(ctx, now)
+    if err != nil {
+        log.Printf("Error counting due webhook deliveries: %v", err)
+        return
+    }
+    s.queueDepth.With("queue", QueueWebhooks).Set(float64(due))
+}
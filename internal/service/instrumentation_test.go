@@ -0,0 +1,35 @@
+package service
+
+import (
+    "strings"
+    "testing"
+    "video-stats-tracker/internal/repository"
+
+    "github.com/go-kit/kit/metrics"
+)
+
+// labelGauge records the labels and value of the last Set
+type labelGauge struct {
+    labels []string
+    value  float64
+}
+
+func (g *labelGauge) With(labelValues ...string) metrics.Gauge {
+    g.labels = labelValues
+    return g
+}
+
+func (g *labelGauge) Set(value float64) { g.value = value }
+func (g *labelGauge) Add(delta float64) { g.value += delta }
+
+func TestObserveVideoLeavesOutTags(t *testing.T) {
+    views := &labelGauge{}
+    svc := &videoService{videoGauges: &VideoGauges{Views: views, Likes: &labelGauge{}, Comments: &labelGauge{}}}
+    video := &repository.Video{VideoID: "a", Platform: repository.PlatformYouTube, Tag: "legacy", Tags: []string{"launch", "summer"}}
+    svc.observeVideo(video, &repository.VideoStats{Views: 1200})
+
+    want := "video_id|a|platform|youtube"
+    if got := strings.Join(views.labels, "|"); got != want || views.value != 1200 {
+        t.Errorf("got %s = %v, want %s = 1200", got, views.value, want)
+    }
+}
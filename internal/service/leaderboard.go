@@ -0,0 +1,84 @@
+package service
+
+import (
+    "context"
+    "strings"
+    "time"
+    "video-stats-tracker/internal/repository"
+)
+
+// Leaderboard defaults and limits
+const (
+    DefaultLeaderboardWindow = 24 * time.Hour
+    DefaultLeaderboardLimit  = 10
+    maxLeaderboardLimit      = 100
+)
+
+// Leaderboard is a ranking of videos by growth over a window
+type Leaderboard struct {
+    Metric   string                        `json:"metric"`
+    Window   string                        `json:"window"`
+    From     time.Time                     `json:"from"`
+    To       time.Time                     `json:"to"`
+    Platform string                        `json:"platform,omitempty"`
+    Tag      string                        `json:"tag,omitempty"`
+    Entries  []repository.LeaderboardEntry `json:"entries"`
+}
+
+// GetLeaderboard ranks videos by <counter>_delta (absolute increase) or
+// <counter>_growth (percentage increase) over the window ending at to
+func (s *videoService) GetLeaderboard(ctx context.Context, metric string, window time.Duration, to time.Time, platform, tag string, minViews, limit int) (*Leaderboard, error) {
+    if metric == "" {
+        metric = "views_delta"
+    }
+    counter, kind, _ := strings.Cut(metric, "_")
+    if kind != "delta" && kind != "growth" {
+        return nil, Errorf(CodeValidation, "unsupported metric: %s (use views, likes or comments with _delta or _growth)", metric)
+    }
+    if counter != "views" && counter != "likes" && counter != "comments" {
+        return nil, Errorf(CodeValidation, "unsupported metric: %s (use views, likes or comments with _delta or _growth)", metric)
+    }
+    if platform != "" && platform != repository.PlatformYouTube && platform != repository.PlatformInstagram {
+        return nil, Errorf(CodeValidation, "unsupported platform: %s", platform)
+    }
+    if window <= 0 {
+        window = DefaultLeaderboardWindow
+    }
+    if to.IsZero() {
+        to = time.Now()
+    }
+    if limit <= 0 {
+        limit = DefaultLeaderboardLimit
+    }
+    if limit > maxLeaderboardLimit {
+        limit = maxLeaderboardLimit
+    }
+
+    from := to.Add(-window)
+    entries, err := s.repo.GetLeaderboard(ctx, repository.LeaderboardQuery{
+        Metric:   counter,
+        Relative: kind == "growth",
+        From:     from,
+        To:       to,
+        Platform: platform,
+        Tag:      tag,
+        MinViews: minViews,
+        Limit:    limit,
+    })
+    if err != nil {
+        return nil, err
+    }
+    if entries == nil {
+        entries = []repository.LeaderboardEntry{}
+    }
+
+    return &Leaderboard{
+        Metric:   metric,
+        Window:   window.String(),
+        From:     from,
+        To:       to,
+        Platform: platform,
+        Tag:      tag,
+        Entries:  entries,
+    }, nil
+}
@@ -0,0 +1,229 @@
+package service
+
+import (
+    "context"
+    "strings"
+    "time"
+    "video-stats-tracker/internal/repository"
+)
+
+// Metric kinds accepted by the metrics= query parameter
+const (
+    MetricRaw        = "raw"
+    MetricDeltas     = "deltas"
+    MetricVelocity   = "velocity"
+    MetricEngagement = "engagement"
+    MetricMilestones = "milestones"
+)
+
+var metricKinds = map[string]bool{
+    MetricRaw: true, MetricDeltas: true, MetricVelocity: true, MetricEngagement: true, MetricMilestones: true,
+}
+
+// Default milestone thresholds, see WithMilestones
+var (
+    ViewMilestones = []int{1000, 10000, 100000, 1000000}
+    LikeMilestones = []int{100, 1000, 10000, 100000}
+)
+
+// DerivedMetrics holds the metrics computed from a video's stats history
+type DerivedMetrics struct {
+    Deltas     []StatsDelta      `json:"deltas,omitempty"`
+    Velocity   []StatsVelocity   `json:"velocity,omitempty"`
+    Engagement []EngagementPoint `json:"engagement,omitempty"`
+    Milestones []MilestoneTime   `json:"milestones,omitempty"`
+}
+
+// StatsDelta is the growth between two consecutive samples
+type StatsDelta struct {
+    From     time.Time `json:"from"`
+    To       time.Time `json:"to"`
+    Views    int       `json:"views"`
+    Likes    int       `json:"likes"`
+    Comments int       `json:"comments"`
+}
+
+// StatsVelocity is the hourly growth rate between two consecutive samples
+type StatsVelocity struct {
+    From            time.Time `json:"from"`
+    To              time.Time `json:"to"`
+    ViewsPerHour    float64   `json:"views_per_hour"`
+    LikesPerHour    float64   `json:"likes_per_hour"`
+    CommentsPerHour float64   `json:"comments_per_hour"`
+}
+
+// EngagementPoint is (likes + comments) divided by views, or by followers
+// for Instagram where views are not available
+type EngagementPoint struct {
+    Timestamp time.Time `json:"timestamp"`
+    Rate      float64   `json:"rate"`
+    Basis     string    `json:"basis"`
+}
+
+// MilestoneTime reports when a video first reached a threshold, measured
+// from publication (or registration when the publish time is unknown)
+type MilestoneTime struct {
+    Metric         string    `json:"metric"`
+    Threshold      int       `json:"threshold"`
+    ReachedAt      time.Time `json:"reached_at"`
+    Elapsed        string    `json:"elapsed"`
+    ElapsedSeconds int64     `json:"elapsed_seconds"`
+}
+
+// ParseMetricKinds splits and validates a comma-separated metrics list
+func ParseMetricKinds(value string) ([]string, error) {
+    var kinds []string
+    for _, kind := range strings.Split(value, ",") {
+        kind = strings.ToLower(strings.TrimSpace(kind))
+        if kind == "" {
+            continue
+        }
+        if !metricKinds[kind] {
+            return nil, Errorf(CodeValidation, "unsupported metric: %s", kind)
+        }
+        kinds = append(kinds, kind)
+    }
+    return kinds, nil
+}
+
+// GetStatsWithMetrics returns the raw stats of a video together with the
+// requested derived metrics, optionally without flagged samples
+func (s *videoService) GetStatsWithMetrics(ctx context.Context, videoID string, from, to time.Time, kinds []string, excludeFlagged bool) ([]repository.VideoStats, *DerivedMetrics, error) {
+    stats, err := s.GetVideoStats(ctx, videoID, from, to)
+    if err != nil {
+        return nil, nil, err
+    }
+    if excludeFlagged {
+        stats = WithoutFlagged(stats)
+    }
+
+    metrics := &DerivedMetrics{}
+    for _, kind := range kinds {
+        switch kind {
+        case MetricDeltas:
+            metrics.Deltas = computeDeltas(stats)
+        case MetricVelocity:
+            metrics.Velocity = computeVelocity(stats)
+        case MetricEngagement:
+            video, err := s.repo.GetVideoByVideoID(ctx, videoID)
+            if err != nil {
+                return nil, nil, err
+            }
+            followers, err := s.followersFor(ctx, video)
+            if err != nil {
+                return nil, nil, err
+            }
+            metrics.Engagement = computeEngagement(video, stats, followers)
+        case MetricMilestones:
+            milestones, err := s.milestoneTimes(ctx, videoID)
+            if err != nil {
+                return nil, nil, err
+            }
+            metrics.Milestones = milestones
+        }
+    }
+
+    return stats, metrics, nil
+}
+
+func computeDeltas(stats []repository.VideoStats) []StatsDelta {
+    var deltas []StatsDelta
+    for i := 1; i < len(stats); i++ {
+        prev, cur := stats[i-1], stats[i]
+        deltas = append(deltas, StatsDelta{
+            From:     prev.Timestamp,
+            To:       cur.Timestamp,
+            Views:    cur.Views - prev.Views,
+            Likes:    cur.Likes - prev.Likes,
+            Comments: cur.Comments - prev.Comments,
+        })
+    }
+    return deltas
+}
+
+func computeVelocity(stats []repository.VideoStats) []StatsVelocity {
+    var velocity []StatsVelocity
+    for i := 1; i < len(stats); i++ {
+        prev, cur := stats[i-1], stats[i]
+        hours := cur.Timestamp.Sub(prev.Timestamp).Hours()
+        if hours <= 0 {
+            continue
+        }
+        velocity = append(velocity, StatsVelocity{
+            From:            prev.Timestamp,
+            To:              cur.Timestamp,
+            ViewsPerHour:    float64(cur.Views-prev.Views) / hours,
+            LikesPerHour:    float64(cur.Likes-prev.Likes) / hours,
+            CommentsPerHour: float64(cur.Comments-prev.Comments) / hours,
+        })
+    }
+    return velocity
+}
+
+// computeEngagement uses views for YouTube and followers for Instagram,
+// whose stored views are only an engagement proxy. Instagram posts without
+// a tracked account (and so without a follower count) get no engagement.
+func computeEngagement(video *repository.Video, stats []repository.VideoStats, followers int) []EngagementPoint {
+    var points []EngagementPoint
+    for _, stat := range stats {
+        base, basis := stat.Views, "views"
+        if video != nil && video.Platform == repository.PlatformInstagram {
+            base, basis = followers, "followers"
+        }
+        if base <= 0 {
+            continue
+        }
+        points = append(points, EngagementPoint{
+            Timestamp: stat.Timestamp,
+            Rate:      float64(stat.Likes+stat.Comments) / float64(base),
+            Basis:     basis,
+        })
+    }
+    return points
+}
+
+// followersFor returns the latest follower count of the account a video
+// belongs to, or 0 when the account is not tracked
+func (s *videoService) followersFor(ctx context.Context, video *repository.Video) (int, error) {
+    if video == nil {
+        return 0, nil
+    }
+
+    accountID := video.AccountID
+    if accountID == "" && video.Platform == repository.PlatformInstagram {
+        account, err := s.repo.GetTrackedAccount(ctx, repository.PlatformInstagram, video.InstagramUsername)
+        if err != nil || account == nil {
+            return 0, err
+        }
+        accountID = account.ID
+    }
+    if accountID == "" {
+        return 0, nil
+    }
+
+    latest, err := s.repo.GetLatestAccountStats(ctx, accountID)
+    if err != nil || latest == nil {
+        return 0, err
+    }
+    return latest.Followers, nil
+}
+
+// milestoneTimes reports the recorded milestones of the video
+func (s *videoService) milestoneTimes(ctx context.Context, videoID string) ([]MilestoneTime, error) {
+    recorded, err := s.GetMilestones(ctx, videoID)
+    if err != nil {
+        return nil, err
+    }
+
+    var milestones []MilestoneTime
+    for _, m := range recorded {
+        milestones = append(milestones, MilestoneTime{
+            Metric:         m.Metric,
+            Threshold:      m.Threshold,
+            ReachedAt:      m.ReachedAt,
+            Elapsed:        m.Elapsed,
+            ElapsedSeconds: m.ElapsedSeconds,
+        })
+    }
+    return milestones, nil
+}
@@ -0,0 +1,185 @@
+package service
+
+import (
+    "context"
+    "log"
+    "time"
+    "video-stats-tracker/internal/repository"
+)
+
+// WithMilestones replaces the default view and like thresholds that are
+// recorded as milestones
+func WithMilestones(views, likes []int) Option {
+    return func(s *videoService) {
+        s.viewMilestones, s.likeMilestones = views, likes
+    }
+}
+
+func (s *videoService) milestoneThresholds() map[string][]int {
+    return map[string][]int{"views": s.viewMilestones, "likes": s.likeMilestones}
+}
+
+// recordMilestones stores every threshold crossed between the latest
+// unflagged sample before cur and cur, and publishes a milestone.reached
+// event for each. The first sample has no baseline, so thresholds a video
+// had already passed when it was registered are not reported. The sample is
+// already stored, so a failure is only logged; the startup backfill records
+// the milestone later.
+func (s *videoService) recordMilestones(ctx context.Context, video *repository.Video, cur *repository.VideoStats) {
+    prev, err := s.repo.GetStatsAt(ctx, video.VideoID, cur.Timestamp.Add(-time.Nanosecond))
+    if err != nil {
+        log.Printf("Error loading the milestone baseline of video %s: %v", video.VideoID, err)
+        return
+    }
+    if prev == nil {
+        return
+    }
+
+    for metric, thresholds := range s.milestoneThresholds() {
+        before, after := metricValue(prev, metric), metricValue(cur, metric)
+        for _, threshold := range thresholds {
+            if before >= threshold || after < threshold {
+                continue
+            }
+
+            milestone := newMilestone(video.VideoID, metric, threshold, prev, cur)
+            created, err := s.repo.CreateMilestone(ctx, milestone)
+            if err != nil {
+                log.Printf("Error recording %s milestone %d for video %s: %v", metric, threshold, video.VideoID, err)
+                continue
+            }
+            if created {
+                setElapsed(milestone, milestoneStart(video))
+                s.publish(ctx, EventMilestoneReached, MilestoneEvent{
+                    VideoMilestone: *milestone,
+                    Platform:       video.Platform,
+                })
+            }
+        }
+    }
+}
+
+// GetMilestones returns the recorded milestones of a video with the time
+// each took from publication
+func (s *videoService) GetMilestones(ctx context.Context, videoID string) ([]repository.VideoMilestone, error) {
+    video, err := s.repo.GetVideoByVideoID(ctx, videoID)
+    if err != nil {
+        return nil, err
+    }
+    if video == nil {
+        return nil, Errorf(CodeNotFound, "video not tracked: %s", videoID)
+    }
+
+    milestones, err := s.repo.GetMilestones(ctx, videoID)
+    if err != nil {
+        return nil, err
+    }
+    start := milestoneStart(video)
+    for i := range milestones {
+        setElapsed(&milestones[i], start)
+    }
+    return milestones, nil
+}
+
+// BackfillMilestones records the thresholds every video crossed before
+// milestones were recorded or configured. The poller runs it once at
+// startup; a video that fails is logged and skipped.
+func (s *videoService) BackfillMilestones(ctx context.Context) error {
+    videos, err := s.repo.GetVideos(ctx, repository.VideoFilter{})
+    if err != nil {
+        return err
+    }
+    for _, video := range videos {
+        if err := s.backfillMilestones(ctx, video.VideoID); err != nil {
+            log.Printf("Error backfilling milestones for video %s: %v", video.VideoID, err)
+        }
+    }
+    return nil
+}
+
+// backfillMilestones records missing milestones from the first sample at or
+// above each threshold and the sample before it. Thresholds already passed
+// by the very first sample are skipped: the crossing time is unknown.
+func (s *videoService) backfillMilestones(ctx context.Context, videoID string) error {
+    existing, err := s.repo.GetMilestones(ctx, videoID)
+    if err != nil {
+        return err
+    }
+    recorded := make(map[string]map[int]bool)
+    for _, m := range existing {
+        if recorded[m.Metric] == nil {
+            recorded[m.Metric] = make(map[int]bool)
+        }
+        recorded[m.Metric][m.Threshold] = true
+    }
+
+    for metric, thresholds := range s.milestoneThresholds() {
+        for _, threshold := range thresholds {
+            if recorded[metric][threshold] {
+                continue
+            }
+
+            cur, err := s.repo.FirstStatsSampleReaching(ctx, videoID, metric, threshold)
+            if err != nil {
+                return err
+            }
+            if cur == nil {
+                break
+            }
+            prev, err := s.repo.GetStatsAt(ctx, videoID, cur.Timestamp.Add(-time.Nanosecond))
+            if err != nil {
+                return err
+            }
+            if prev == nil {
+                continue
+            }
+
+            if _, err := s.repo.CreateMilestone(ctx, newMilestone(videoID, metric, threshold, prev, cur)); err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
+
+// newMilestone builds the milestone for a threshold crossed between two
+// samples. The crossing time is interpolated linearly from the last time the
+// previous counts were seen to the new sample.
+func newMilestone(videoID, metric string, threshold int, prev, cur *repository.VideoStats) *repository.VideoMilestone {
+    from := prev.Timestamp
+    if prev.LastSeenAt != nil {
+        from = *prev.LastSeenAt
+    }
+    before, after := metricValue(prev, metric), metricValue(cur, metric)
+
+    reachedAt := cur.Timestamp
+    if after > before && cur.Timestamp.After(from) {
+        fraction := float64(threshold-before) / float64(after-before)
+        reachedAt = from.Add(time.Duration(fraction * float64(cur.Timestamp.Sub(from))))
+    }
+
+    return &repository.VideoMilestone{
+        VideoID:   videoID,
+        Metric:    metric,
+        Threshold: threshold,
+        Value:     after,
+        SampleID:  cur.ID,
+        SampledAt: cur.Timestamp,
+        ReachedAt: reachedAt,
+    }
+}
+
+// milestoneStart is the publication time of a video, or its registration
+// time when the publish time is unknown
+func milestoneStart(video *repository.Video) time.Time {
+    if video.PublishedAt != nil {
+        return *video.PublishedAt
+    }
+    return video.CreatedAt
+}
+
+func setElapsed(milestone *repository.VideoMilestone, start time.Time) {
+    elapsed := milestone.ReachedAt.Sub(start)
+    milestone.Elapsed = elapsed.Round(time.Minute).String()
+    milestone.ElapsedSeconds = int64(elapsed.Seconds())
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+    "context"
+    "errors"
+    "testing"
+    "time"
+    "video-stats-tracker/internal/repository"
+)
+
+func TestNewMilestoneInterpolates(t *testing.T) {
+    base := time.Date(2025, 4, 1, 12, 0, 0, 0, time.UTC)
+    seen := base.Add(30 * time.Minute)
+
+    tests := []struct {
+        name      string
+        prev      repository.VideoStats
+        cur       repository.VideoStats
+        threshold int
+        want      time.Time
+    }{
+        {"halfway", repository.VideoStats{Timestamp: base, Views: 900},
+            repository.VideoStats{ID: "2", Timestamp: base.Add(time.Hour), Views: 1100}, 1000, base.Add(30 * time.Minute)},
+        {"at the new sample", repository.VideoStats{Timestamp: base, Views: 900},
+            repository.VideoStats{ID: "2", Timestamp: base.Add(time.Hour), Views: 1000}, 1000, base.Add(time.Hour)},
+        {"from when the previous counts were last seen", repository.VideoStats{Timestamp: base, LastSeenAt: &seen, Views: 0},
+            repository.VideoStats{ID: "2", Timestamp: base.Add(time.Hour), Views: 2000}, 1000, base.Add(45 * time.Minute)},
+        {"same timestamp", repository.VideoStats{Timestamp: base, Views: 900},
+            repository.VideoStats{ID: "2", Timestamp: base, Views: 1100}, 1000, base},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            m := newMilestone("v1", "views", tt.threshold, &tt.prev, &tt.cur)
+            if !m.ReachedAt.Equal(tt.want) {
+                t.Errorf("reached_at = %v, want %v", m.ReachedAt, tt.want)
+            }
+            if m.SampleID != tt.cur.ID || !m.SampledAt.Equal(tt.cur.Timestamp) || m.Value != tt.cur.Views {
+                t.Errorf("milestone = %+v, want it to keep the new sample", m)
+            }
+        })
+    }
+}
+
+func TestSetElapsed(t *testing.T) {
+    start := time.Date(2025, 4, 1, 12, 0, 0, 0, time.UTC)
+    m := &repository.VideoMilestone{ReachedAt: start.Add(9*time.Hour + 20*time.Minute + 10*time.Second)}
+    setElapsed(m, start)
+    if m.Elapsed != "9h20m0s" || m.ElapsedSeconds != 33610 {
+        t.Errorf("elapsed = %s (%ds), want 9h20m0s (33610s)", m.Elapsed, m.ElapsedSeconds)
+    }
+}
+
+// milestoneRepository serves one baseline sample and collects created
+// milestones
+type milestoneRepository struct {
+    repository.Repository
+    baseline *repository.VideoStats
+    created  []repository.VideoMilestone
+    fail     bool
+}
+
+func (r *milestoneRepository) GetStatsAt(ctx context.Context, videoID string, at time.Time) (*repository.VideoStats, error) {
+    return r.baseline, nil
+}
+
+func (r *milestoneRepository) CreateMilestone(ctx context.Context, m *repository.VideoMilestone) (bool, error) {
+    if r.fail {
+        return false, errors.New("database is locked")
+    }
+    r.created = append(r.created, *m)
+    return true, nil
+}
+
+func (r *milestoneRepository) GetWebhooks(ctx context.Context) ([]repository.Webhook, error) {
+    return nil, nil
+}
+
+func TestRecordMilestones(t *testing.T) {
+    base := time.Date(2025, 4, 1, 12, 0, 0, 0, time.UTC)
+    video := &repository.Video{VideoID: "v1", CreatedAt: base}
+    prev := &repository.VideoStats{Timestamp: base, Views: 500, Likes: 90}
+    cur := &repository.VideoStats{ID: "2", Timestamp: base.Add(time.Hour), Views: 20000, Likes: 95}
+
+    repo := &milestoneRepository{baseline: prev}
+    svc := &videoService{repo: repo, viewMilestones: []int{1000, 10000, 100000}, likeMilestones: []int{100}}
+    svc.recordMilestones(context.Background(), video, cur)
+
+    if len(repo.created) != 2 {
+        t.Fatalf("recorded %d milestones, want the 1000 and 10000 view thresholds", len(repo.created))
+    }
+    for i, threshold := range []int{1000, 10000} {
+        if m := repo.created[i]; m.Metric != "views" || m.Threshold != threshold {
+            t.Errorf("milestone %d = %s %d, want views %d", i, m.Metric, m.Threshold, threshold)
+        }
+    }
+
+    repo.created, repo.baseline = nil, nil
+    svc.recordMilestones(context.Background(), video, cur)
+    if len(repo.created) != 0 {
+        t.Errorf("first sample recorded %d milestones, want none", len(repo.created))
+    }
+
+    // A failing insert is logged rather than failing the poll
+    repo.fail, repo.baseline = true, prev
+    svc.recordMilestones(context.Background(), video, cur)
+}
@@ -0,0 +1,269 @@
+package service
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "os"
+    "path/filepath"
+    "time"
+    "video-stats-tracker/internal/repository"
+
+    "github.com/parquet-go/parquet-go"
+)
+
+// DefaultExportName is the watermark used when an export is not named
+const DefaultExportName = "warehouse"
+
+// parquetBatchSize is how many rows are handed to the writer at once
+const parquetBatchSize = 1024
+
+// exportClaimTimeout is how long a run holds the export claim before
+// another may assume it crashed and take over
+const exportClaimTimeout = 6 * time.Hour
+
+// ParquetExport reports one run of the warehouse export. Samples inserted
+// or changed with FromSeq < change_seq <= ToSeq were written.
+type ParquetExport struct {
+    Name    string        `json:"name"`
+    Dir     string        `json:"dir"`
+    Full    bool          `json:"full"`
+    FromSeq int64         `json:"from_change_seq"`
+    ToSeq   int64         `json:"to_change_seq"`
+    Rows    int           `json:"rows"`
+    Files   []ParquetFile `json:"files"`
+}
+
+// ParquetFile is one partition file written by an export
+type ParquetFile struct {
+    Path     string `json:"path"`
+    Platform string `json:"platform"`
+    Date     string `json:"date"`
+    Rows     int    `json:"rows"`
+}
+
+// warehouseRow is the Parquet schema of an exported sample. Optional
+// columns are null when the value is unknown; the optional timestamps are
+// held as Unix milliseconds because zero time.Time values are not written
+// as null. A sample changed after it was shipped is shipped again with a
+// higher change_seq, which supersedes the earlier row.
+type warehouseRow struct {
+    SampleID          int64     `parquet:"sample_id"`
+    ChangeSeq         int64     `parquet:"change_seq"`
+    VideoID           string    `parquet:"video_id,dict"`
+    Platform          string    `parquet:"platform,dict"`
+    Timestamp         time.Time `parquet:"timestamp,timestamp(millisecond)"`
+    Views             int64     `parquet:"views"`
+    Likes             int64     `parquet:"likes"`
+    Comments          int64     `parquet:"comments"`
+    LastSeenAt        int64     `parquet:"last_seen_at,optional,timestamp(millisecond)"`
+    Flagged           bool      `parquet:"flagged"`
+    InstagramUsername string    `parquet:"instagram_username,dict"`
+    AccountID         string    `parquet:"account_id,dict"`
+    Tags              []string  `parquet:"tags,list"`
+    State             string    `parquet:"state,dict"`
+    PublishedAt       int64     `parquet:"published_at,optional,timestamp(millisecond)"`
+    RegisteredAt      time.Time `parquet:"registered_at,timestamp(millisecond)"`
+    MetadataVersion   int64     `parquet:"metadata_version,optional"`
+    Caption           string    `parquet:"caption,optional"`
+    Permalink         string    `parquet:"permalink,optional"`
+    MediaType         string    `parquet:"media_type,optional,dict"`
+}
+
+func newWarehouseRow(row *repository.ExportRow) warehouseRow {
+    w := warehouseRow{
+        SampleID:          row.SampleID,
+        ChangeSeq:         row.ChangeSeq,
+        VideoID:           row.VideoID,
+        Platform:          row.Platform,
+        Timestamp:         row.Timestamp.UTC(),
+        Views:             row.Views,
+        Likes:             row.Likes,
+        Comments:          row.Comments,
+        Flagged:           row.Flagged,
+        InstagramUsername: row.InstagramUsername,
+        AccountID:         row.AccountID,
+        Tags:              row.Tags,
+        State:             row.State,
+        RegisteredAt:      row.RegisteredAt.UTC(),
+    }
+    if row.LastSeenAt != nil {
+        w.LastSeenAt = row.LastSeenAt.UnixMilli()
+    }
+    if row.PublishedAt != nil {
+        w.PublishedAt = row.PublishedAt.UnixMilli()
+    }
+    if row.MetadataVersion != nil {
+        w.MetadataVersion = *row.MetadataVersion
+        w.Caption, w.Permalink, w.MediaType = *row.Caption, *row.Permalink, *row.MediaType
+    }
+    return w
+}
+
+// WithExportDir sets the directory Parquet exports are written to
+func WithExportDir(dir string) Option {
+    return func(s *videoService) {
+        s.exportDir = dir
+    }
+}
+
+// ExportParquet writes the samples inserted or changed since the named
+// export's watermark to Parquet files partitioned as
+// platform=<platform>/date=<YYYY-MM-DD>. Files are named after the change
+// range and only appear, and the watermark only moves, once every file is
+// complete, so a failed run can simply be repeated. full ignores the
+// watermark and exports everything into its own full/<name>-<seq>
+// directory, apart from the incremental files.
+func (s *videoService) ExportParquet(ctx context.Context, name string, full bool) (*ParquetExport, error) {
+    if name == "" {
+        name = DefaultExportName
+    }
+    if len(name) > 100 {
+        return nil, Errorf(CodeValidation, "name longer than 100 characters")
+    }
+    // The claim is held in the database so runs of the server and of the
+    // export command exclude each other
+    token := fmt.Sprintf("%s-%d", name, time.Now().UnixNano())
+    claimed, err := s.repo.ClaimExportRun(ctx, token, time.Now().Add(-exportClaimTimeout))
+    if err != nil {
+        return nil, err
+    }
+    if !claimed {
+        return nil, Errorf(CodeDuplicate, "an export is already running")
+    }
+    defer func() {
+        if err := s.repo.ReleaseExportRun(context.Background(), token); err != nil {
+            log.Printf("Failed to release export claim: %v", err)
+        }
+    }()
+
+    export := &ParquetExport{Name: name, Dir: s.exportDir, Full: full, Files: []ParquetFile{}}
+    if !full {
+        watermark, err := s.repo.GetExportWatermark(ctx, name)
+        if err != nil {
+            return nil, err
+        }
+        if watermark != nil {
+            export.FromSeq = watermark.LastSeq
+        }
+    }
+
+    // Samples stored or changed during the run are left for the next one
+    maxSeq, err := s.repo.GetMaxStatsChangeSeq(ctx)
+    if err != nil {
+        return nil, err
+    }
+    export.ToSeq = maxSeq
+    if export.ToSeq <= export.FromSeq {
+        export.ToSeq = export.FromSeq
+        return export, nil
+    }
+    if full {
+        export.Dir = filepath.Join(s.exportDir, "full", fmt.Sprintf("%s-%d", name, export.ToSeq))
+    }
+
+    partitions := &parquetPartitions{export: export}
+    err = s.repo.StreamExportRows(ctx, export.FromSeq, export.ToSeq, partitions.write)
+    if err == nil {
+        err = partitions.close()
+    }
+    if err != nil {
+        partitions.discard()
+        return nil, err
+    }
+
+    for _, file := range export.Files {
+        if err := os.Rename(file.Path+".tmp", file.Path); err != nil {
+            return nil, err
+        }
+    }
+    err = s.repo.SetExportWatermark(ctx, &repository.ExportWatermark{Name: name, LastSeq: export.ToSeq, ExportedAt: time.Now()})
+    if err != nil {
+        return nil, err
+    }
+    return export, nil
+}
+
+// parquetPartitions writes rows to one file per platform and day. Rows
+// arrive grouped by partition, so only one file is open at a time.
+type parquetPartitions struct {
+    export *ParquetExport
+    file   *os.File
+    writer *parquet.GenericWriter[warehouseRow]
+    batch  []warehouseRow
+}
+
+func (p *parquetPartitions) write(row *repository.ExportRow) error {
+    platform, date := row.Platform, row.Timestamp.UTC().Format("2006-01-02")
+    current := len(p.export.Files) - 1
+    if p.writer == nil || p.export.Files[current].Platform != platform || p.export.Files[current].Date != date {
+        if err := p.close(); err != nil {
+            return err
+        }
+        if err := p.open(platform, date); err != nil {
+            return err
+        }
+        current = len(p.export.Files) - 1
+    }
+
+    p.batch = append(p.batch, newWarehouseRow(row))
+    p.export.Files[current].Rows++
+    p.export.Rows++
+    if len(p.batch) == parquetBatchSize {
+        return p.flush()
+    }
+    return nil
+}
+
+// open starts the temporary file of a partition
+func (p *parquetPartitions) open(platform, date string) error {
+    dir := filepath.Join(p.export.Dir, "platform="+platform, "date="+date)
+    if err := os.MkdirAll(dir, 0o755); err != nil {
+        return err
+    }
+    path := filepath.Join(dir, fmt.Sprintf("part-%d-%d.parquet", p.export.FromSeq+1, p.export.ToSeq))
+    file, err := os.Create(path + ".tmp")
+    if err != nil {
+        return err
+    }
+
+    p.file = file
+    p.writer = parquet.NewGenericWriter[warehouseRow](file, parquet.Compression(&parquet.Snappy))
+    p.export.Files = append(p.export.Files, ParquetFile{Path: path, Platform: platform, Date: date})
+    return nil
+}
+
+func (p *parquetPartitions) flush() error {
+    if len(p.batch) == 0 {
+        return nil
+    }
+    _, err := p.writer.Write(p.batch)
+    p.batch = p.batch[:0]
+    return err
+}
+
+// close completes the open partition file, if any
+func (p *parquetPartitions) close() error {
+    if p.writer == nil {
+        return nil
+    }
+    err := p.flush()
+    if err == nil {
+        err = p.writer.Close()
+    }
+    if closeErr := p.file.Close(); err == nil {
+        err = closeErr
+    }
+    p.writer, p.file = nil, nil
+    return err
+}
+
+// discard removes the temporary files of a failed run
+func (p *parquetPartitions) discard() {
+    if p.file != nil {
+        p.file.Close()
+    }
+    for _, file := range p.export.Files {
+        os.Remove(file.Path + ".tmp")
+    }
+}
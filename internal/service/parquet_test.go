@@ -0,0 +1,142 @@
+package service
+
+import (
+    "context"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+    "video-stats-tracker/internal/repository"
+
+    "github.com/parquet-go/parquet-go"
+)
+
+// exportRepository serves export rows by change number and records the
+// claim and watermark
+type exportRepository struct {
+    repository.Repository
+    rows      []repository.ExportRow
+    watermark *repository.ExportWatermark
+    claimed   string
+}
+
+func (r *exportRepository) ClaimExportRun(ctx context.Context, token string, staleBefore time.Time) (bool, error) {
+    if r.claimed != "" {
+        return false, nil
+    }
+    r.claimed = token
+    return true, nil
+}
+
+func (r *exportRepository) ReleaseExportRun(ctx context.Context, token string) error {
+    if r.claimed == token {
+        r.claimed = ""
+    }
+    return nil
+}
+
+func (r *exportRepository) GetExportWatermark(ctx context.Context, name string) (*repository.ExportWatermark, error) {
+    return r.watermark, nil
+}
+
+func (r *exportRepository) SetExportWatermark(ctx context.Context, watermark *repository.ExportWatermark) error {
+    r.watermark = watermark
+    return nil
+}
+
+func (r *exportRepository) GetMaxStatsChangeSeq(ctx context.Context) (int64, error) {
+    var seq int64
+    for _, row := range r.rows {
+        if row.ChangeSeq > seq {
+            seq = row.ChangeSeq
+        }
+    }
+    return seq, nil
+}
+
+func (r *exportRepository) StreamExportRows(ctx context.Context, afterSeq, upToSeq int64, fn func(*repository.ExportRow) error) error {
+    for i := range r.rows {
+        if r.rows[i].ChangeSeq > afterSeq && r.rows[i].ChangeSeq <= upToSeq {
+            if err := fn(&r.rows[i]); err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
+
+func readWarehouseRows(t *testing.T, path string) []warehouseRow {
+    t.Helper()
+    rows, err := parquet.ReadFile[warehouseRow](path)
+    if err != nil {
+        t.Fatalf("reading %s: %v", path, err)
+    }
+    return rows
+}
+
+func TestExportParquet(t *testing.T) {
+    at := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+    repo := &exportRepository{rows: []repository.ExportRow{
+        {SampleID: 1, ChangeSeq: 1, VideoID: "a", Platform: "youtube", Timestamp: at, Views: 100, Tags: repository.TagSet{"launch, EU", "summer"}},
+        {SampleID: 2, ChangeSeq: 2, VideoID: "a", Platform: "youtube", Timestamp: at.Add(time.Hour), Views: 200, Tags: repository.TagSet{}},
+    }}
+    dir := t.TempDir()
+    svc := &videoService{repo: repo, exportDir: dir}
+    ctx := context.Background()
+
+    export, err := svc.ExportParquet(ctx, "", false)
+    if err != nil {
+        t.Fatalf("exporting: %v", err)
+    }
+    if export.FromSeq != 0 || export.ToSeq != 2 || export.Rows != 2 || len(export.Files) != 1 {
+        t.Fatalf("got %+v", export)
+    }
+    want := filepath.Join(dir, "platform=youtube", "date=2025-06-01", "part-1-2.parquet")
+    if export.Files[0].Path != want {
+        t.Errorf("path = %s, want %s", export.Files[0].Path, want)
+    }
+    rows := readWarehouseRows(t, want)
+    if strings.Join(rows[0].Tags, "|") != "launch, EU|summer" || len(rows[1].Tags) != 0 {
+        t.Errorf("tags = %q and %q", rows[0].Tags, rows[1].Tags)
+    }
+    if repo.claimed != "" {
+        t.Error("the claim was not released")
+    }
+
+    // A sample flagged after it was shipped goes out again with its change
+    repo.rows[0].ChangeSeq, repo.rows[0].Flagged = 3, true
+    export, err = svc.ExportParquet(ctx, "", false)
+    if err != nil {
+        t.Fatalf("exporting the change: %v", err)
+    }
+    if export.FromSeq != 2 || export.ToSeq != 3 || export.Rows != 1 {
+        t.Fatalf("got %+v", export)
+    }
+    if rows := readWarehouseRows(t, export.Files[0].Path); rows[0].SampleID != 1 || rows[0].ChangeSeq != 3 || !rows[0].Flagged {
+        t.Errorf("got %+v", rows[0])
+    }
+
+    // Full exports go to their own snapshot directory
+    export, err = svc.ExportParquet(ctx, "", true)
+    if err != nil {
+        t.Fatalf("full export: %v", err)
+    }
+    if export.Dir != filepath.Join(dir, "full", "warehouse-3") || export.Rows != 2 {
+        t.Errorf("got %+v", export)
+    }
+    if _, err := os.Stat(filepath.Join(export.Dir, "platform=youtube", "date=2025-06-01", "part-1-3.parquet")); err != nil {
+        t.Errorf("full export file: %v", err)
+    }
+}
+
+func TestExportParquetClaimed(t *testing.T) {
+    repo := &exportRepository{claimed: "other"}
+    svc := &videoService{repo: repo, exportDir: t.TempDir()}
+    if _, err := svc.ExportParquet(context.Background(), "", false); ErrorCode(err) != CodeDuplicate {
+        t.Errorf("got %v, want a duplicate error", err)
+    }
+    if repo.claimed != "other" {
+        t.Error("the other run's claim was released")
+    }
+}
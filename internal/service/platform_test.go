@@ -0,0 +1,111 @@
+package service
+
+import (
+    "context"
+    "errors"
+    "time"
+    "video-stats-tracker/internal/platform"
+)
+
+// stubYouTube answers lookups from a fixed set of video IDs, channels and
+// their uploads, newest first
+type stubYouTube struct {
+    youtubeAPI
+    videos   map[string]bool
+    channels map[string]*platform.YouTubeChannel
+    uploads  map[string][]platform.YouTubeUpload
+    stats    map[string]*platform.YouTubeChannelStats
+    err      error
+}
+
+func (y *stubYouTube) FindVideos(ctx context.Context, videoIDs []string) (map[string]bool, error) {
+    if y.err != nil {
+        return nil, y.err
+    }
+    found := make(map[string]bool)
+    for _, id := range videoIDs {
+        found[id] = y.videos[id]
+    }
+    return found, nil
+}
+
+func (y *stubYouTube) GetChannel(ctx context.Context, channel string) (*platform.YouTubeChannel, error) {
+    if y.err != nil {
+        return nil, y.err
+    }
+    if info := y.channels[channel]; info != nil {
+        return info, nil
+    }
+    return nil, platform.ErrChannelNotFound
+}
+
+// GetUploads returns the uploads of a playlist published after since
+func (y *stubYouTube) GetUploads(ctx context.Context, playlistID string, since time.Time) ([]platform.YouTubeUpload, error) {
+    if y.err != nil {
+        return nil, y.err
+    }
+    var uploads []platform.YouTubeUpload
+    for _, upload := range y.uploads[playlistID] {
+        if since.IsZero() || !upload.PublishedAt.Before(since) {
+            uploads = append(uploads, upload)
+        }
+    }
+    return uploads, nil
+}
+
+func (y *stubYouTube) GetChannelStats(ctx context.Context, channelID string) (*platform.YouTubeChannelStats, error) {
+    if stats := y.stats[channelID]; stats != nil {
+        return stats, nil
+    }
+    return nil, platform.ErrChannelNotFound
+}
+
+// stubInstagram serves the media of each username, newest first; accounts
+// in failing answer with an error
+type stubInstagram struct {
+    instagramAPI
+    media   map[string][]platform.InstagramMedia
+    stats   map[string]*platform.InstagramAccountStats
+    failing map[string]bool
+}
+
+var errStubUpstream = errors.New("graph API unavailable")
+
+func (i *stubInstagram) FindMedia(ctx context.Context, username string, match func(platform.InstagramMedia) bool) (*platform.InstagramMedia, error) {
+    if i.failing[username] {
+        return nil, errStubUpstream
+    }
+    for _, m := range i.media[username] {
+        if match(m) {
+            return &m, nil
+        }
+    }
+    return nil, nil
+}
+
+// RecentMedia returns the media published after since, like the client does
+// once it has paged back far enough
+func (i *stubInstagram) RecentMedia(ctx context.Context, username string, since time.Time) ([]platform.InstagramMedia, error) {
+    if i.failing[username] {
+        return nil, errStubUpstream
+    }
+    var recent []platform.InstagramMedia
+    for _, m := range i.media[username] {
+        if published := m.PublishedAt(); since.IsZero() || published == nil || !published.Before(since) {
+            recent = append(recent, m)
+        }
+    }
+    return recent, nil
+}
+
+func (i *stubInstagram) GetAccountStats(ctx context.Context, username string) (*platform.InstagramAccountStats, error) {
+    if i.failing[username] {
+        return nil, errStubUpstream
+    }
+    return i.stats[username], nil
+}
+
+// post is Instagram media published at the given time
+func post(id string, published time.Time) platform.InstagramMedia {
+    return platform.InstagramMedia{ID: id, Permalink: "https://www.instagram.com/p/" + id + "/", Timestamp: published.Format("2006-01-02T15:04:05-0700")}
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+    "context"
+    "video-stats-tracker/internal/platform"
+)
+
+// ResolveVideoURL turns a YouTube or Instagram link into a registration.
+// Instagram shortcodes are resolved to media IDs by paging through the
+// account's media, so the username must come from the link or be given.
+func (s *videoService) ResolveVideoURL(ctx context.Context, rawURL, username string) (*VideoRegistration, error) {
+    return s.resolveVideoURL(ctx, rawURL, username)
+}
+
+// resolveVideoURL resolves a link; media pages are shared through the
+// context's media cache, so links of one account in a bulk request read its
+// listing once
+func (s *videoService) resolveVideoURL(ctx context.Context, rawURL, username string) (*VideoRegistration, error) {
+    parsed, err := platform.ParseVideoURL(rawURL)
+    if err != nil {
+        return nil, Errorf(CodeValidation, "%v", err)
+    }
+
+    if parsed.Shortcode == "" {
+        return &VideoRegistration{Platform: parsed.Platform, VideoID: parsed.VideoID, Username: username}, nil
+    }
+
+    if parsed.Username != "" {
+        username = parsed.Username
+    }
+    if username == "" {
+        return nil, Errorf(CodeValidation, "username is required to resolve Instagram link %s", rawURL)
+    }
+
+    media, err := s.instagramClient.FindMedia(ctx, username, func(m platform.InstagramMedia) bool {
+        return platform.PermalinkShortcode(m.Permalink) == parsed.Shortcode
+    })
+    if err != nil {
+        return nil, Errorf(CodeUpstream, "instagram account lookup failed for %s: %w", username, err)
+    }
+    if media == nil {
+        return nil, Errorf(CodeNotFound, "instagram post %s not found in the media of %s", parsed.Shortcode, username)
+    }
+    return &VideoRegistration{Platform: parsed.Platform, VideoID: media.ID, Username: username}, nil
+}
@@ -3,67 +3,202 @@ package service
 import (
     "context"
     "fmt"
+    "log"
+    "net/http"
     "time"
     "video-stats-tracker/internal/platform"
     "video-stats-tracker/internal/repository"
+
+    "github.com/go-kit/kit/metrics"
 )
 
 type Service interface {
     // Core APIs
-    RegisterVideo(ctx context.Context, platform, videoID, username, tag string) error
+    RegisterVideo(ctx context.Context, platform, videoID, username, tag string) (*repository.Video, error)
+    RegisterVideos(ctx context.Context, videos []VideoRegistration) ([]RegistrationResult, error)
+    ResolveVideoURL(ctx context.Context, rawURL, username string) (*VideoRegistration, error)
     GetVideoStats(ctx context.Context, videoID string, from, to time.Time) ([]repository.VideoStats, error)
+    StreamVideoStats(ctx context.Context, videoID string, from, to time.Time, excludeFlagged bool, fn func(*repository.VideoStats) error) error
+    GetStatsBuckets(ctx context.Context, videoID string, from, to time.Time, interval, agg string, fill, excludeFlagged bool) ([]repository.StatsBucket, error)
+    GetStatsWithMetrics(ctx context.Context, videoID string, from, to time.Time, kinds []string, excludeFlagged bool) ([]repository.VideoStats, *DerivedMetrics, error)
+    GetMilestones(ctx context.Context, videoID string) ([]repository.VideoMilestone, error)
+    GetForecast(ctx context.Context, videoID string, target *ForecastTarget) (*Forecast, error)
+    GetVideoMetadata(ctx context.Context, videoID string, at *time.Time) ([]repository.VideoMetadata, error)
+    GetVideoStateHistory(ctx context.Context, videoID string) (*repository.Video, []repository.StateTransition, error)
+    ListVideos(ctx context.Context, filter repository.VideoFilter, cohort, metric string) ([]VideoListing, error)
+    GetBenchmark(ctx context.Context, cohort repository.VideoFilter, metric string, step, maxAge time.Duration) (*Benchmark, error)
+    ExportParquet(ctx context.Context, name string, full bool) (*ParquetExport, error)
+    CompareVideos(ctx context.Context, videoIDs []string, opts CompareOptions) (*Comparison, error)
+    GetLeaderboard(ctx context.Context, metric string, window time.Duration, to time.Time, platform, tag string, minViews, limit int) (*Leaderboard, error)
+
+    // Tracked accounts
+    TrackChannel(ctx context.Context, channel, tag string, lookback time.Duration) (*repository.TrackedAccount, int, error)
+    TrackInstagramAccount(ctx context.Context, username, tag, mediaType string, lookback time.Duration) (*repository.TrackedAccount, int, error)
+    GetTrackedAccounts(ctx context.Context) ([]repository.TrackedAccount, error)
+    GetAccountStats(ctx context.Context, id string, from, to time.Time) (*repository.TrackedAccount, []repository.AccountStats, error)
     
     // Internal methods for polling
     GetAllVideos(ctx context.Context) ([]repository.Video, error)
     UpdateVideoStats(ctx context.Context, video *repository.Video) error
+    SyncTrackedAccounts(ctx context.Context) error
+    UpdateAccountStats(ctx context.Context) error
+    ApplyRetention(ctx context.Context, dryRun bool) (*repository.RetentionReport, error)
+    DetectViral(ctx context.Context, video *repository.Video) (bool, error)
+    DeliverWebhooks(ctx context.Context) error
+    BackfillMilestones(ctx context.Context) error
+    PurgeWebhookDeliveries(ctx context.Context) (int64, error)
+
+    // Alerts
+    CreateAlertRule(ctx context.Context, rule *repository.AlertRule) error
+    GetAlertRules(ctx context.Context) ([]repository.AlertRule, error)
+    DeleteAlertRule(ctx context.Context, id string) error
+    GetAlerts(ctx context.Context, state string, limit int) ([]repository.Alert, error)
+    EvaluateAlerts(ctx context.Context, video *repository.Video, rules []repository.AlertRule) error
+
+    // Anomalies
+    GetAnomalies(ctx context.Context, videoID string, limit int) ([]repository.Anomaly, error)
+
+    // Campaigns
+    CreateCampaign(ctx context.Context, campaign *repository.Campaign, videoIDs []string) ([]string, error)
+    GetCampaigns(ctx context.Context) ([]repository.Campaign, error)
+    GetCampaignReport(ctx context.Context, id, interval string) (*CampaignReport, error)
+    DeleteCampaign(ctx context.Context, id string) error
+    AddCampaignVideos(ctx context.Context, id string, videoIDs []string) (int, error)
+    RemoveCampaignVideo(ctx context.Context, id, videoID string) error
+
+    // Tags
+    AddVideoTags(ctx context.Context, videoID string, tags []string) ([]string, error)
+    RemoveVideoTag(ctx context.Context, videoID, tag string) ([]string, error)
+    GetTags(ctx context.Context) ([]repository.TagSummary, error)
+    GetTagStats(ctx context.Context, tag string, from, to time.Time, interval, agg string, excludeFlagged bool) (*TagStats, error)
+
+    // Webhooks
+    CreateWebhook(ctx context.Context, url, secret string, events []string) (*repository.Webhook, error)
+    GetWebhooks(ctx context.Context) ([]repository.Webhook, error)
+    DeleteWebhook(ctx context.Context, id string) error
+    GetWebhookDeliveries(ctx context.Context, id string, limit int) ([]repository.WebhookDelivery, error)
+    Publish(ctx context.Context, event string, data interface{}) error
+}
+
+// youtubeAPI is the part of the YouTube client the service calls
+type youtubeAPI interface {
+    Instrument(m platform.Metrics)
+    GetVideoStats(ctx context.Context, videoID string) (*repository.VideoStats, error)
+    FindVideos(ctx context.Context, videoIDs []string) (map[string]bool, error)
+    GetChannel(ctx context.Context, channel string) (*platform.YouTubeChannel, error)
+    GetUploads(ctx context.Context, playlistID string, since time.Time) ([]platform.YouTubeUpload, error)
+    GetChannelStats(ctx context.Context, channelID string) (*platform.YouTubeChannelStats, error)
+}
+
+// instagramAPI is the part of the Instagram client the service calls
+type instagramAPI interface {
+    Instrument(m platform.Metrics)
+    GetVideoStats(ctx context.Context, username, videoID string, publishedAt *time.Time) (*repository.VideoStats, *repository.VideoMetadata, error)
+    FindMedia(ctx context.Context, username string, match func(platform.InstagramMedia) bool) (*platform.InstagramMedia, error)
+    RecentMedia(ctx context.Context, username string, since time.Time) ([]platform.InstagramMedia, error)
+    GetAccountStats(ctx context.Context, username string) (*platform.InstagramAccountStats, error)
 }
 
 type videoService struct {
     repo            repository.Repository
-    youtubeClient   *platform.YouTubeClient
-    instagramClient *platform.InstagramClient
+    youtubeClient   youtubeAPI
+    instagramClient instagramAPI
+    retention       repository.RetentionPolicy
+    storageMode     string
+    retries         *retrySchedule
+    webhookClient   *http.Client
+    webhookKeep     time.Duration
+    viral           *viralTracker
+    cohorts         *likeCohorts
+    notifiers       []Notifier
+    viewMilestones  []int
+    likeMilestones  []int
+    exportDir       string
+    queueDepth      metrics.Gauge
+    videoGauges     *VideoGauges
+}
+
+// Option configures optional service behavior
+type Option func(*videoService)
+
+// WithRetention sets the policy applied by ApplyRetention
+func WithRetention(policy repository.RetentionPolicy) Option {
+    return func(s *videoService) {
+        s.retention = policy
+    }
+}
+
+// Stats storage modes. In change-only mode a poll returning the same counts
+// as the previous sample only bumps that sample's last_seen_at.
+const (
+    StorageAll     = "all"
+    StorageChanges = "changes"
+)
+
+// ValidStorageMode reports whether mode is StorageAll or StorageChanges
+func ValidStorageMode(mode string) bool {
+    return mode == StorageAll || mode == StorageChanges
+}
+
+// WithStorageMode selects how repeated identical samples are stored
+func WithStorageMode(mode string) Option {
+    return func(s *videoService) {
+        s.storageMode = mode
+    }
 }
 
-func NewService(repo repository.Repository, youtubeAPIKey, instagramToken, instagramID string) Service {
-    return &videoService{
+func NewService(repo repository.Repository, youtubeAPIKey, instagramToken, instagramID string, opts ...Option) Service {
+    s := &videoService{
         repo:            repo,
         youtubeClient:   platform.NewYouTubeClient(youtubeAPIKey),
         instagramClient: platform.NewInstagramClient(instagramToken, instagramID),
+        retries:         newRetrySchedule(),
+        webhookClient:   &http.Client{Timeout: 10 * time.Second},
+        webhookKeep:     DefaultWebhookRetention,
+        viral:           newViralTracker(),
+        cohorts:         newLikeCohorts(),
+        viewMilestones:  ViewMilestones,
+        likeMilestones:  LikeMilestones,
+        exportDir:       "exports",
+    }
+    s.notifiers = []Notifier{LogNotifier{}, NewWebhookNotifier(s)}
+    for _, opt := range opts {
+        opt(s)
     }
+    return s
 }
 
-func (s *videoService) RegisterVideo(ctx context.Context, platform, videoID, username, tag string) error {
-var existing *repository.Video
-    var err error
-    
-    if platform == repository.PlatformInstagram {
-        // For Instagram, check with username
-        existing, err = s.repo.GetVideoWithUsername(ctx, platform, videoID, username)
-    } else {
-        // For YouTube, check normally
-        existing, err = s.repo.GetVideo(ctx, platform, videoID)
+func (s *videoService) RegisterVideo(ctx context.Context, platform, videoID, username, tag string) (*repository.Video, error) {
+    registration := VideoRegistration{Platform: platform, VideoID: videoID, Username: username, Tag: tag}
+    if err := validateRegistration(registration); err != nil {
+        return nil, err
     }
-    
+
+    existing, err := s.findExisting(ctx, platform, videoID, username)
     if err != nil {
-        return err
+        return nil, err
     }
     if existing != nil {
-        return fmt.Errorf("video already being tracked")
+        return nil, Errorf(CodeDuplicate, "video already being tracked")
     }
 
-    // Validate platform
-    if platform != repository.PlatformYouTube && platform != repository.PlatformInstagram {
-        return fmt.Errorf("unsupported platform: %s", platform)
-    }
-
-    // For Instagram, validate that the post exists and get username
-    if platform == repository.PlatformInstagram {
-        if username == "" {
-            return fmt.Errorf("instagram_username is required for Instagram posts")
+    // Validate that the video or post exists on the platform
+    switch platform {
+    case repository.PlatformYouTube:
+        found, err := s.youtubeClient.FindVideos(ctx, []string{videoID})
+        if err != nil {
+            return nil, Errorf(CodeUpstream, "youtube lookup failed: %w", err)
+        }
+        if !found[videoID] {
+            return nil, Errorf(CodeNotFound, "youtube video not found: %s", videoID)
         }
-        _, err := s.instagramClient.GetMediaDetails(ctx, username, videoID)
+    case repository.PlatformInstagram:
+        found, err := s.findInstagramPost(ctx, username, videoID)
         if err != nil {
-            return fmt.Errorf("instagram post not found: %s for user %s", videoID, username)
+            return nil, Errorf(CodeUpstream, "instagram account lookup failed for %s: %w", username, err)
+        }
+        if !found {
+            return nil, Errorf(CodeNotFound, "instagram post not found: %s for user %s", videoID, username)
         }
     }
 
@@ -76,19 +211,81 @@ var existing *repository.Video
         Tag:      tag,
     }
 
-    return s.repo.CreateVideo(ctx, video)
+    if err := s.repo.CreateVideo(ctx, video); err != nil {
+        if repository.IsUniqueViolation(err) {
+            return nil, Errorf(CodeDuplicate, "video already being tracked")
+        }
+        return nil, err
+    }
+    return video, nil
+}
+
+// findExisting looks up an already registered video; Instagram posts are
+// unique per username
+func (s *videoService) findExisting(ctx context.Context, platform, videoID, username string) (*repository.Video, error) {
+    if platform == repository.PlatformInstagram {
+        // For Instagram, check with username
+        return s.repo.GetVideoWithUsername(ctx, platform, videoID, username)
+    }
+    // For YouTube, check normally
+    return s.repo.GetVideo(ctx, platform, videoID)
 }
 
 func (s *videoService) GetVideoStats(ctx context.Context, videoID string, from, to time.Time) ([]repository.VideoStats, error) {
+    if _, err := s.checkStatsQuery(ctx, videoID, from, to); err != nil {
+        return nil, err
+    }
     return s.repo.GetVideoStats(ctx, videoID, from, to)
 }
 
+// StreamVideoStats passes the raw samples in the range to fn as they are
+// read. Unlike GetVideoStats the video is optional: without one every
+// video's samples are streamed, for bulk exports.
+func (s *videoService) StreamVideoStats(ctx context.Context, videoID string, from, to time.Time, excludeFlagged bool, fn func(*repository.VideoStats) error) error {
+    if videoID != "" {
+        if _, err := s.checkStatsQuery(ctx, videoID, from, to); err != nil {
+            return err
+        }
+    } else if to.Before(from) {
+        return Errorf(CodeValidation, "from must be before to")
+    }
+    return s.repo.StreamVideoStats(ctx, videoID, from, to, excludeFlagged, fn)
+}
+
+// checkStatsQuery validates a stats query and returns the tracked video
+func (s *videoService) checkStatsQuery(ctx context.Context, videoID string, from, to time.Time) (*repository.Video, error) {
+    if videoID == "" {
+        return nil, Errorf(CodeValidation, "video_id is required")
+    }
+    if to.Before(from) {
+        return nil, Errorf(CodeValidation, "from must be before to")
+    }
+
+    video, err := s.repo.GetVideoByVideoID(ctx, videoID)
+    if err != nil {
+        return nil, err
+    }
+    if video == nil {
+        return nil, Errorf(CodeNotFound, "video not tracked: %s", videoID)
+    }
+    return video, nil
+}
+
 func (s *videoService) GetAllVideos(ctx context.Context) ([]repository.Video, error) {
     return s.repo.GetAllVideos(ctx)
 }
 
+// UpdateVideoStats polls a video and stores a sample. Deleted, private and
+// unavailable content changes the video's state; private and unavailable
+// videos are retried on a schedule and return to registered once a poll
+// succeeds again.
 func (s *videoService) UpdateVideoStats(ctx context.Context, video *repository.Video) error {
+    if !s.retries.due(video.VideoID, time.Now()) {
+        return nil
+    }
+
     var stats *repository.VideoStats
+    var meta *repository.VideoMetadata
     var err error
 
     // Fetch stats from appropriate platform
@@ -96,20 +293,89 @@ func (s *videoService) UpdateVideoStats(ctx context.Context, video *repository.V
     case repository.PlatformYouTube:
         stats, err = s.youtubeClient.GetVideoStats(ctx, video.VideoID)
     case repository.PlatformInstagram:
-        stats, err = s.instagramClient.GetVideoStats(ctx, video.InstagramUsername, video.VideoID)
+        stats, meta, err = s.instagramClient.GetVideoStats(ctx, video.InstagramUsername, video.VideoID, video.PublishedAt)
     default:
         return fmt.Errorf("unsupported platform: %s", video.Platform)
     }
 
     if err != nil {
-        // Mark video as error if it's not found/accessible
-        if err.Error() == "video not found" || err.Error() == "instagram post not found or inaccessible" {
-            s.repo.UpdateVideoState(ctx, video.VideoID, repository.StateError)
-        }
+        return s.handleFetchError(ctx, video, err)
+    }
+    if err := s.markRecovered(ctx, video); err != nil {
+        return err
+    }
+
+    previous, err := s.repo.GetLatestStats(ctx, video.VideoID)
+    if err != nil {
         return err
     }
 
     // Add timestamp and save
     stats.Timestamp = time.Now()
+    if err := s.saveStats(ctx, previous, stats); err != nil {
+        return err
+    }
+    s.observeVideo(video, stats)
+
+    // Flag bot spikes and counter drops before they can become milestones,
+    // or trigger viral detection and alerts in the poller
+    _, flagged, err := s.detectAnomalies(ctx, video)
+    if err != nil {
+        log.Printf("Error detecting anomalies for video %s: %v", video.VideoID, err)
+    }
+    if !isFlagged(flagged, stats.ID) {
+        s.recordMilestones(ctx, video, stats)
+    }
+
+    // Metadata only gets a new version when it changed
+    if meta != nil {
+        meta.RecordedAt = stats.Timestamp
+        if _, err := s.repo.SaveVideoMetadata(ctx, meta); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// saveStats inserts a sample, or in change-only mode extends the previous
+// sample when the counts are unchanged
+func (s *videoService) saveStats(ctx context.Context, latest, stats *repository.VideoStats) error {
+    if s.storageMode != StorageChanges {
+        return s.repo.CreateVideoStats(ctx, stats)
+    }
+
+    if latest != nil && latest.Views == stats.Views && latest.Likes == stats.Likes && latest.Comments == stats.Comments {
+        return s.repo.TouchVideoStats(ctx, latest.ID, stats.Timestamp)
+    }
     return s.repo.CreateVideoStats(ctx, stats)
-}
\ No newline at end of file
+}
+
+// GetVideoMetadata returns the metadata versions of a video. With at set,
+// only the version that was current at that time is returned.
+func (s *videoService) GetVideoMetadata(ctx context.Context, videoID string, at *time.Time) ([]repository.VideoMetadata, error) {
+    video, err := s.repo.GetVideoByVideoID(ctx, videoID)
+    if err != nil {
+        return nil, err
+    }
+    if video == nil {
+        return nil, Errorf(CodeNotFound, "video not tracked: %s", videoID)
+    }
+
+    if at == nil {
+        return s.repo.GetVideoMetadataHistory(ctx, videoID)
+    }
+    meta, err := s.repo.GetVideoMetadataAt(ctx, videoID, *at)
+    if err != nil {
+        return nil, err
+    }
+    if meta == nil {
+        return nil, Errorf(CodeNotFound, "no metadata recorded for %s at %s", videoID, at.Format(time.RFC3339))
+    }
+    return []repository.VideoMetadata{*meta}, nil
+}
+
+// ApplyRetention downsamples and purges old stats according to the
+// configured policy; a dry run only reports the rows that would change
+func (s *videoService) ApplyRetention(ctx context.Context, dryRun bool) (*repository.RetentionReport, error) {
+    return s.repo.ApplyRetention(ctx, s.retention, time.Now(), dryRun)
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+    "context"
+    "errors"
+    "sync"
+    "time"
+    "video-stats-tracker/internal/platform"
+    "video-stats-tracker/internal/repository"
+
+    "github.com/go-kit/kit/metrics"
+)
+
+// Retry schedule for videos that could not be polled. Unavailable videos
+// back off exponentially; private videos are rechecked once a day in case
+// they are made public again.
+const (
+    UnavailableRetryBase   = 5 * time.Minute
+    UnavailableRetryMax    = 6 * time.Hour
+    PrivateRecheckInterval = 24 * time.Hour
+)
+
+// retrySchedule remembers when a failing video may be polled again. It is
+// kept in memory: after a restart every video is retried once.
+type retrySchedule struct {
+    mu      sync.Mutex
+    entries map[string]retryEntry
+    // depth, when set, follows the number of videos waiting
+    depth metrics.Gauge
+}
+
+type retryEntry struct {
+    attempts int
+    next     time.Time
+}
+
+func newRetrySchedule() *retrySchedule {
+    return &retrySchedule{entries: make(map[string]retryEntry)}
+}
+
+func (r *retrySchedule) due(videoID string, now time.Time) bool {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    entry, ok := r.entries[videoID]
+    return !ok || !now.Before(entry.next)
+}
+
+// backoff schedules the next attempt, doubling the wait on every failure
+func (r *retrySchedule) backoff(videoID string, now time.Time) time.Time {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    entry := r.entries[videoID]
+    wait := UnavailableRetryBase << entry.attempts
+    if wait <= 0 || wait > UnavailableRetryMax {
+        wait = UnavailableRetryMax
+    }
+    entry.attempts++
+    entry.next = now.Add(wait)
+    r.entries[videoID] = entry
+    r.report()
+    return entry.next
+}
+
+func (r *retrySchedule) delay(videoID string, next time.Time) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    r.entries[videoID] = retryEntry{next: next}
+    r.report()
+}
+
+func (r *retrySchedule) clear(videoID string) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    delete(r.entries, videoID)
+    r.report()
+}
+
+// report updates the depth gauge; the lock must be held
+func (r *retrySchedule) report() {
+    if r.depth != nil {
+        r.depth.Set(float64(len(r.entries)))
+    }
+}
+
+// StateChange is the payload of video.errored events
+type StateChange struct {
+    VideoID  string    `json:"video_id"`
+    Platform string    `json:"platform"`
+    From     string    `json:"from"`
+    To       string    `json:"to"`
+    Reason   string    `json:"reason"`
+    At       time.Time `json:"at"`
+}
+
+// handleFetchError moves a video into the state matching a platform error
+// and schedules its next attempt. Errors that say nothing about the
+// content are returned without a state change.
+func (s *videoService) handleFetchError(ctx context.Context, video *repository.Video, fetchErr error) error {
+    now := time.Now()
+
+    var state string
+    switch {
+    case errors.Is(fetchErr, platform.ErrContentDeleted):
+        state = repository.StateDeleted
+        s.retries.clear(video.VideoID)
+    case errors.Is(fetchErr, platform.ErrContentPrivate):
+        state = repository.StatePrivate
+        s.retries.delay(video.VideoID, now.Add(PrivateRecheckInterval))
+    case errors.Is(fetchErr, platform.ErrContentUnavailable):
+        state = repository.StateUnavailable
+        s.retries.backoff(video.VideoID, now)
+    default:
+        return fetchErr
+    }
+
+    if video.State != state {
+        if err := s.repo.TransitionVideoState(ctx, video.VideoID, video.State, state, fetchErr.Error(), now); err != nil {
+            return err
+        }
+        s.publish(ctx, EventVideoErrored, StateChange{
+            VideoID:  video.VideoID,
+            Platform: video.Platform,
+            From:     video.State,
+            To:       state,
+            Reason:   fetchErr.Error(),
+            At:       now,
+        })
+        video.State = state
+    }
+    return fetchErr
+}
+
+// markRecovered returns a private or unavailable video to registered after
+// a successful fetch
+func (s *videoService) markRecovered(ctx context.Context, video *repository.Video) error {
+    s.retries.clear(video.VideoID)
+    if video.State == repository.StateRegistered {
+        return nil
+    }
+
+    reason := "recovered from " + video.State
+    if err := s.repo.TransitionVideoState(ctx, video.VideoID, video.State, repository.StateRegistered, reason, time.Now()); err != nil {
+        return err
+    }
+    video.State = repository.StateRegistered
+    return nil
+}
+
+// GetVideoStateHistory returns a video with its recorded state transitions
+func (s *videoService) GetVideoStateHistory(ctx context.Context, videoID string) (*repository.Video, []repository.StateTransition, error) {
+    video, err := s.repo.GetVideoByVideoID(ctx, videoID)
+    if err != nil {
+        return nil, nil, err
+    }
+    if video == nil {
+        return nil, nil, Errorf(CodeNotFound, "video not tracked: %s", videoID)
+    }
+
+    history, err := s.repo.GetVideoStateHistory(ctx, videoID)
+    if err != nil {
+        return nil, nil, err
+    }
+    return video, history, nil
+}
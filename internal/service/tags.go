@@ -0,0 +1,157 @@
+package service
+
+import (
+    "context"
+    "strings"
+    "time"
+    "video-stats-tracker/internal/repository"
+)
+
+const maxTagLength = 100
+
+// TagStats is the summed series of every video carrying a tag
+type TagStats struct {
+    Tag      string                   `json:"tag"`
+    Interval string                   `json:"interval"`
+    Agg      string                   `json:"agg"`
+    Videos   []string                 `json:"videos"`
+    Series   []repository.StatsBucket `json:"series"`
+}
+
+// AddVideoTags attaches tags to a tracked video and returns its tags
+func (s *videoService) AddVideoTags(ctx context.Context, videoID string, tags []string) ([]string, error) {
+    if _, err := s.trackedVideo(ctx, videoID); err != nil {
+        return nil, err
+    }
+
+    var clean []string
+    for _, tag := range tags {
+        tag = strings.TrimSpace(tag)
+        if tag == "" {
+            continue
+        }
+        if len(tag) > maxTagLength {
+            return nil, Errorf(CodeValidation, "tag longer than %d characters: %s", maxTagLength, tag)
+        }
+        clean = append(clean, tag)
+    }
+    if len(clean) == 0 {
+        return nil, Errorf(CodeValidation, "tags is required")
+    }
+
+    if err := s.repo.AddVideoTags(ctx, videoID, clean); err != nil {
+        return nil, err
+    }
+    return s.repo.GetVideoTags(ctx, videoID)
+}
+
+// RemoveVideoTag detaches a tag from a video and returns its remaining tags
+func (s *videoService) RemoveVideoTag(ctx context.Context, videoID, tag string) ([]string, error) {
+    if _, err := s.trackedVideo(ctx, videoID); err != nil {
+        return nil, err
+    }
+    removed, err := s.repo.RemoveVideoTag(ctx, videoID, tag)
+    if err != nil {
+        return nil, err
+    }
+    if !removed {
+        return nil, Errorf(CodeNotFound, "video %s has no tag %q", videoID, tag)
+    }
+    return s.repo.GetVideoTags(ctx, videoID)
+}
+
+func (s *videoService) GetTags(ctx context.Context) ([]repository.TagSummary, error) {
+    return s.repo.GetTags(ctx)
+}
+
+// GetTagStats sums the bucketed series of all videos carrying a tag. Every
+// bucket from the start of the range is returned; a video without samples
+// in a bucket contributes its last known counts (nothing for deltas), and
+// buckets where no video had samples are marked filled.
+func (s *videoService) GetTagStats(ctx context.Context, tag string, from, to time.Time, interval, agg string, excludeFlagged bool) (*TagStats, error) {
+    if interval == "" {
+        interval = repository.IntervalDay
+    }
+    agg, err := checkBucketQuery(interval, agg)
+    if err != nil {
+        return nil, err
+    }
+    if to.Before(from) {
+        return nil, Errorf(CodeValidation, "from must be before to")
+    }
+
+    videos, err := s.repo.GetVideosByTag(ctx, tag)
+    if err != nil {
+        return nil, err
+    }
+    if len(videos) == 0 {
+        return nil, Errorf(CodeNotFound, "no videos tagged %q", tag)
+    }
+
+    result := &TagStats{Tag: tag, Interval: interval, Agg: agg, Videos: []string{}}
+    for t := truncateBucket(from, interval); !t.After(to); t = nextBucket(t, interval) {
+        result.Series = append(result.Series, repository.StatsBucket{Bucket: t, Filled: true})
+    }
+
+    for _, video := range videos {
+        result.Videos = append(result.Videos, video.VideoID)
+    }
+
+    rows, err := s.repo.GetTagStatsBuckets(ctx, tag, from, to, interval, agg, excludeFlagged)
+    if err != nil {
+        return nil, err
+    }
+    for start := 0; start < len(rows); {
+        end := start
+        for end < len(rows) && rows[end].VideoID == rows[start].VideoID {
+            end++
+        }
+        addTagSeries(result.Series, rows[start:end], agg)
+        start = end
+    }
+    return result, nil
+}
+
+// addTagSeries adds one video's buckets to the tag's series. Cumulative
+// series start from the video's counts before the range and carry them over
+// buckets without samples.
+func addTagSeries(series []repository.StatsBucket, rows []repository.TagBucket, agg string) {
+    var carry repository.StatsBucket
+    if len(rows) > 0 && rows[0].Carry {
+        if agg != repository.AggDelta {
+            carry = rows[0].StatsBucket
+        }
+        rows = rows[1:]
+    }
+
+    j := 0
+    for i := range series {
+        total := &series[i]
+        value := carry
+        value.Samples = 0
+        if j < len(rows) && rows[j].Bucket.Equal(total.Bucket) {
+            value = rows[j].StatsBucket
+            total.Filled = false
+            j++
+            if agg != repository.AggDelta {
+                carry = value
+            }
+        }
+        total.Samples += value.Samples
+        total.Views += value.Views
+        total.Likes += value.Likes
+        total.Comments += value.Comments
+    }
+}
+
+// trackedVideo returns a video or a not found error
+func (s *videoService) trackedVideo(ctx context.Context, videoID string) (*repository.Video, error) {
+    video, err := s.repo.GetVideoByVideoID(ctx, videoID)
+    if err != nil {
+        return nil, err
+    }
+    if video == nil {
+        return nil, Errorf(CodeNotFound, "video not tracked: %s", videoID)
+    }
+    return video, nil
+}
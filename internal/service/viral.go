@@ -0,0 +1,90 @@
+package service
+
+import (
+    "context"
+    "sync"
+    "time"
+    "video-stats-tracker/internal/repository"
+)
+
+// A video is considered viral when its views grow by at least
+// ViralViewsPerHour between its two latest unflagged samples. Each video is reported
+// at most once per ViralCooldown.
+const (
+    ViralViewsPerHour = 1000
+    ViralCooldown     = 24 * time.Hour
+    viralWindow       = 6 * time.Hour
+)
+
+// ViralEvent is the payload of viral.detected events
+type ViralEvent struct {
+    VideoID      string    `json:"video_id"`
+    Platform     string    `json:"platform"`
+    Views        int       `json:"views"`
+    ViewsPerHour float64   `json:"views_per_hour"`
+    DetectedAt   time.Time `json:"detected_at"`
+}
+
+// MilestoneEvent is the payload of milestone.reached events
+type MilestoneEvent struct {
+    repository.VideoMilestone
+    Platform string `json:"platform"`
+}
+
+// viralTracker remembers when each video was last reported viral
+type viralTracker struct {
+    mu       sync.Mutex
+    reported map[string]time.Time
+}
+
+func newViralTracker() *viralTracker {
+    return &viralTracker{reported: make(map[string]time.Time)}
+}
+
+// mark records a detection and reports whether it is new
+func (t *viralTracker) mark(videoID string, now time.Time) bool {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    if last, ok := t.reported[videoID]; ok && now.Sub(last) < ViralCooldown {
+        return false
+    }
+    t.reported[videoID] = now
+    return true
+}
+
+// DetectViral compares the two latest samples of a video and publishes a
+// viral.detected event the first time the view velocity crosses the
+// threshold within the cooldown
+func (s *videoService) DetectViral(ctx context.Context, video *repository.Video) (bool, error) {
+    now := time.Now()
+    stats, err := s.repo.GetVideoStats(ctx, video.VideoID, now.Add(-viralWindow), now)
+    if err != nil {
+        return false, err
+    }
+    // Flagged samples are suspected bot activity, not real growth
+    stats = WithoutFlagged(stats)
+    if len(stats) < 2 {
+        return false, nil
+    }
+
+    prev, cur := stats[len(stats)-2], stats[len(stats)-1]
+    hours := cur.Timestamp.Sub(prev.Timestamp).Hours()
+    if hours <= 0 {
+        return false, nil
+    }
+    velocity := float64(cur.Views-prev.Views) / hours
+    if velocity < ViralViewsPerHour {
+        return false, nil
+    }
+
+    if s.viral.mark(video.VideoID, now) {
+        s.publish(ctx, EventViralDetected, ViralEvent{
+            VideoID:      video.VideoID,
+            Platform:     video.Platform,
+            Views:        cur.Views,
+            ViewsPerHour: velocity,
+            DetectedAt:   now,
+        })
+    }
+    return true, nil
+}
@@ -0,0 +1,269 @@
+package service
+
+import (
+    "bytes"
+    "context"
+    "crypto/hmac"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "io"
+    "log"
+    "net/http"
+    "net/url"
+    "time"
+    "video-stats-tracker/internal/repository"
+)
+
+// Webhook events
+const (
+    EventViralDetected    = "viral.detected"
+    EventMilestoneReached = "milestone.reached"
+    EventVideoErrored     = "video.errored"
+    EventVideoDiscovered  = "video.discovered"
+)
+
+var webhookEvents = map[string]bool{
+    EventViralDetected: true, EventMilestoneReached: true, EventVideoErrored: true, EventVideoDiscovered: true,
+    EventAlertFiring: true, EventAlertResolved: true, EventAnomalyDetected: true,
+}
+
+// Delivery tuning. Failed attempts are retried with exponential backoff
+// starting at WebhookRetryBase until WebhookMaxAttempts is reached.
+const (
+    WebhookMaxAttempts = 6
+    WebhookRetryBase   = 30 * time.Second
+    webhookBatchSize   = 50
+)
+
+// DefaultWebhookRetention is how long delivered and failed deliveries stay
+// in the log
+const DefaultWebhookRetention = 30 * 24 * time.Hour
+
+// WithWebhookRetention sets how long delivered and failed deliveries are
+// kept; zero keeps them forever
+func WithWebhookRetention(keep time.Duration) Option {
+    return func(s *videoService) {
+        s.webhookKeep = keep
+    }
+}
+
+// WebhookSignatureHeader carries "sha256=" followed by the hex HMAC-SHA256
+// of the request body, keyed with the webhook secret
+const WebhookSignatureHeader = "X-Webhook-Signature"
+
+// WebhookPayload is the JSON body posted to receivers
+type WebhookPayload struct {
+    Event     string      `json:"event"`
+    CreatedAt time.Time   `json:"created_at"`
+    Data      interface{} `json:"data"`
+}
+
+// CreateWebhook registers a receiver. A secret is generated when none is
+// given; it is only returned here.
+func (s *videoService) CreateWebhook(ctx context.Context, rawURL, secret string, events []string) (*repository.Webhook, error) {
+    parsed, err := url.Parse(rawURL)
+    if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+        return nil, Errorf(CodeValidation, "url must be an absolute http or https URL")
+    }
+    for _, event := range events {
+        if !webhookEvents[event] {
+            return nil, Errorf(CodeValidation, "unsupported event: %s", event)
+        }
+    }
+
+    if secret == "" {
+        buf := make([]byte, 32)
+        if _, err := rand.Read(buf); err != nil {
+            return nil, err
+        }
+        secret = hex.EncodeToString(buf)
+    }
+
+    hook := &repository.Webhook{URL: rawURL, Secret: secret, Events: events}
+    if err := s.repo.CreateWebhook(ctx, hook); err != nil {
+        return nil, err
+    }
+    return hook, nil
+}
+
+// GetWebhooks lists the registered receivers without their secrets
+func (s *videoService) GetWebhooks(ctx context.Context) ([]repository.Webhook, error) {
+    hooks, err := s.repo.GetWebhooks(ctx)
+    if err != nil {
+        return nil, err
+    }
+    for i := range hooks {
+        hooks[i].Secret = ""
+    }
+    return hooks, nil
+}
+
+func (s *videoService) DeleteWebhook(ctx context.Context, id string) error {
+    deleted, err := s.repo.DeleteWebhook(ctx, id)
+    if err != nil {
+        return err
+    }
+    if !deleted {
+        return Errorf(CodeNotFound, "webhook not found: %s", id)
+    }
+    return nil
+}
+
+// GetWebhookDeliveries returns the delivery log of a webhook, newest first
+func (s *videoService) GetWebhookDeliveries(ctx context.Context, id string, limit int) ([]repository.WebhookDelivery, error) {
+    hook, err := s.repo.GetWebhook(ctx, id)
+    if err != nil {
+        return nil, err
+    }
+    if hook == nil {
+        return nil, Errorf(CodeNotFound, "webhook not found: %s", id)
+    }
+    if limit <= 0 || limit > 500 {
+        limit = 100
+    }
+    return s.repo.GetWebhookDeliveries(ctx, id, limit)
+}
+
+// Publish queues an event for every webhook subscribed to it. Delivery
+// happens asynchronously in DeliverWebhooks.
+func (s *videoService) Publish(ctx context.Context, event string, data interface{}) error {
+    hooks, err := s.repo.GetWebhooks(ctx)
+    if err != nil {
+        return err
+    }
+
+    now := time.Now()
+    var payload []byte
+    for _, hook := range hooks {
+        if !hook.Wants(event) {
+            continue
+        }
+        if payload == nil {
+            payload, err = json.Marshal(WebhookPayload{Event: event, CreatedAt: now.UTC(), Data: data})
+            if err != nil {
+                return err
+            }
+        }
+
+        delivery := &repository.WebhookDelivery{
+            WebhookID:     hook.ID,
+            Event:         event,
+            Payload:       string(payload),
+            Status:        repository.DeliveryPending,
+            NextAttemptAt: now,
+        }
+        if err := s.repo.CreateWebhookDelivery(ctx, delivery); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// publish queues an event on behalf of the poller; a failure to queue only
+// gets logged so it never fails the poll itself
+func (s *videoService) publish(ctx context.Context, event string, data interface{}) {
+    if err := s.Publish(ctx, event, data); err != nil {
+        log.Printf("Error queueing %s webhook: %v", event, err)
+    }
+}
+
+// DeliverWebhooks posts the due deliveries and records each attempt
+func (s *videoService) DeliverWebhooks(ctx context.Context) error {
+    now := time.Now()
+    s.observeWebhookQueue(ctx, now)
+
+    deliveries, err := s.repo.GetDueWebhookDeliveries(ctx, now, webhookBatchSize)
+    if err != nil {
+        return err
+    }
+
+    hooks := make(map[string]*repository.Webhook)
+    for i := range deliveries {
+        delivery := &deliveries[i]
+
+        hook, ok := hooks[delivery.WebhookID]
+        if !ok {
+            if hook, err = s.repo.GetWebhook(ctx, delivery.WebhookID); err != nil {
+                return err
+            }
+            hooks[delivery.WebhookID] = hook
+        }
+
+        if hook == nil {
+            delivery.Status = repository.DeliveryFailed
+            delivery.LastError = "webhook deleted"
+        } else {
+            s.attemptDelivery(ctx, hook, delivery)
+        }
+        if err := s.repo.UpdateWebhookDelivery(ctx, delivery); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// PurgeWebhookDeliveries trims the delivery log to the retention period
+func (s *videoService) PurgeWebhookDeliveries(ctx context.Context) (int64, error) {
+    if s.webhookKeep <= 0 {
+        return 0, nil
+    }
+    return s.repo.PurgeWebhookDeliveries(ctx, time.Now().Add(-s.webhookKeep))
+}
+
+func (s *videoService) attemptDelivery(ctx context.Context, hook *repository.Webhook, delivery *repository.WebhookDelivery) {
+    now := time.Now()
+    delivery.Attempts++
+    delivery.LastStatusCode = 0
+    delivery.LastError = ""
+
+    err := s.postWebhook(ctx, hook, delivery)
+    if err == nil {
+        delivery.Status = repository.DeliveryDelivered
+        delivery.DeliveredAt = &now
+        return
+    }
+
+    delivery.LastError = err.Error()
+    if delivery.Attempts >= WebhookMaxAttempts {
+        delivery.Status = repository.DeliveryFailed
+        return
+    }
+    delivery.NextAttemptAt = now.Add(WebhookRetryBase << (delivery.Attempts - 1))
+}
+
+func (s *videoService) postWebhook(ctx context.Context, hook *repository.Webhook, delivery *repository.WebhookDelivery) error {
+    body := []byte(delivery.Payload)
+
+    req, err := http.NewRequestWithContext(ctx, "POST", hook.URL, bytes.NewReader(body))
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Content-Type", "application/json")
+    req.Header.Set("X-Webhook-Event", delivery.Event)
+    req.Header.Set("X-Webhook-Delivery", delivery.ID)
+    req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(hook.Secret, body))
+
+    resp, err := s.webhookClient.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+    delivery.LastStatusCode = resp.StatusCode
+    if resp.StatusCode < 200 || resp.StatusCode > 299 {
+        return fmt.Errorf("receiver responded %s", resp.Status)
+    }
+    return nil
+}
+
+// SignWebhookPayload returns the signature header value for body, so
+// receivers written in Go can verify deliveries with hmac.Equal
+func SignWebhookPayload(secret string, body []byte) string {
+    mac := hmac.New(sha256.New, []byte(secret))
+    mac.Write(body)
+    return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
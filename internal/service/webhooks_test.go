@@ -0,0 +1,183 @@
+package service
+
+import (
+    "context"
+    "crypto/hmac"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "sync"
+    "testing"
+    "time"
+    "video-stats-tracker/internal/repository"
+)
+
+// deliveryRepository keeps one webhook and its deliveries in memory. Every
+// pending delivery counts as due, so retries can be driven without waiting
+// out the backoff.
+type deliveryRepository struct {
+    repository.Repository
+    hook       *repository.Webhook
+    deliveries []repository.WebhookDelivery
+}
+
+func (r *deliveryRepository) GetWebhook(ctx context.Context, id string) (*repository.Webhook, error) {
+    if r.hook == nil || r.hook.ID != id {
+        return nil, nil
+    }
+    return r.hook, nil
+}
+
+func (r *deliveryRepository) GetDueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]repository.WebhookDelivery, error) {
+    var due []repository.WebhookDelivery
+    for _, d := range r.deliveries {
+        if d.Status == repository.DeliveryPending {
+            due = append(due, d)
+        }
+    }
+    return due, nil
+}
+
+func (r *deliveryRepository) UpdateWebhookDelivery(ctx context.Context, delivery *repository.WebhookDelivery) error {
+    for i := range r.deliveries {
+        if r.deliveries[i].ID == delivery.ID {
+            r.deliveries[i] = *delivery
+        }
+    }
+    return nil
+}
+
+// receiver is an httptest server that checks each request's signature and
+// answers with the next status in line, 200 once they run out
+type receiver struct {
+    *httptest.Server
+    mu       sync.Mutex
+    statuses []int
+    requests int
+    badSigs  int
+}
+
+func newReceiver(t *testing.T, secret string, statuses ...int) *receiver {
+    r := &receiver{statuses: statuses}
+    r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+        body, _ := io.ReadAll(req.Body)
+        r.mu.Lock()
+        defer r.mu.Unlock()
+        r.requests++
+        if !hmac.Equal([]byte(req.Header.Get(WebhookSignatureHeader)), []byte(SignWebhookPayload(secret, body))) {
+            r.badSigs++
+        }
+        status := http.StatusOK
+        if len(r.statuses) > 0 {
+            status, r.statuses = r.statuses[0], r.statuses[1:]
+        }
+        w.WriteHeader(status)
+    }))
+    t.Cleanup(r.Close)
+    return r
+}
+
+func newDeliveryService(t *testing.T, secret string, recv *receiver) (*videoService, *deliveryRepository) {
+    repo := &deliveryRepository{
+        hook: &repository.Webhook{ID: "1", URL: recv.URL, Secret: secret},
+        deliveries: []repository.WebhookDelivery{{
+            ID: "10", WebhookID: "1", Event: EventVideoErrored, Payload: `{"event":"video.errored"}`,
+            Status: repository.DeliveryPending, NextAttemptAt: time.Now(),
+        }},
+    }
+    return &videoService{repo: repo, webhookClient: recv.Client()}, repo
+}
+
+func TestDeliverWebhooksSignsPayload(t *testing.T) {
+    recv := newReceiver(t, "s3cret")
+    svc, repo := newDeliveryService(t, "s3cret", recv)
+
+    if err := svc.DeliverWebhooks(context.Background()); err != nil {
+        t.Fatal(err)
+    }
+    if recv.requests != 1 || recv.badSigs != 0 {
+        t.Fatalf("receiver got %d requests, %d with a bad signature", recv.requests, recv.badSigs)
+    }
+    d := repo.deliveries[0]
+    if d.Status != repository.DeliveryDelivered || d.Attempts != 1 || d.LastStatusCode != http.StatusOK || d.DeliveredAt == nil {
+        t.Errorf("delivery = %+v, want delivered on the first attempt", d)
+    }
+}
+
+func TestDeliverWebhooksSignatureMismatch(t *testing.T) {
+    recv := newReceiver(t, "receiver-secret")
+    svc, _ := newDeliveryService(t, "other-secret", recv)
+
+    if err := svc.DeliverWebhooks(context.Background()); err != nil {
+        t.Fatal(err)
+    }
+    if recv.badSigs != 1 {
+        t.Errorf("signature with the wrong secret was accepted")
+    }
+}
+
+func TestDeliverWebhooksBackoff(t *testing.T) {
+    recv := newReceiver(t, "s3cret", 500, 500, 500, 500, 500, 500)
+    svc, repo := newDeliveryService(t, "s3cret", recv)
+
+    for attempt := 1; attempt <= WebhookMaxAttempts; attempt++ {
+        before := time.Now()
+        if err := svc.DeliverWebhooks(context.Background()); err != nil {
+            t.Fatal(err)
+        }
+        d := repo.deliveries[0]
+        if d.Attempts != attempt || d.LastStatusCode != http.StatusInternalServerError {
+            t.Fatalf("attempt %d: delivery = %+v", attempt, d)
+        }
+        if attempt == WebhookMaxAttempts {
+            if d.Status != repository.DeliveryFailed {
+                t.Errorf("status after %d attempts = %s, want failed", attempt, d.Status)
+            }
+            break
+        }
+
+        if d.Status != repository.DeliveryPending {
+            t.Fatalf("attempt %d: status = %s, want pending", attempt, d.Status)
+        }
+        // 30s, 1m, 2m, 4m, 8m
+        wait := WebhookRetryBase << (attempt - 1)
+        if delay := d.NextAttemptAt.Sub(before); delay < wait || delay > wait+time.Second {
+            t.Errorf("attempt %d: retried after %v, want %v", attempt, delay, wait)
+        }
+    }
+
+    if err := svc.DeliverWebhooks(context.Background()); err != nil {
+        t.Fatal(err)
+    }
+    if recv.requests != WebhookMaxAttempts || recv.badSigs != 0 {
+        t.Errorf("receiver got %d requests, %d with a bad signature; want %d signed", recv.requests, recv.badSigs, WebhookMaxAttempts)
+    }
+}
+
+func TestDeliverWebhooksRecovers(t *testing.T) {
+    recv := newReceiver(t, "s3cret", 503)
+    svc, repo := newDeliveryService(t, "s3cret", recv)
+
+    for i := 0; i < 2; i++ {
+        if err := svc.DeliverWebhooks(context.Background()); err != nil {
+            t.Fatal(err)
+        }
+    }
+    d := repo.deliveries[0]
+    if d.Status != repository.DeliveryDelivered || d.Attempts != 2 || d.LastError != "" {
+        t.Errorf("delivery = %+v, want delivered on the second attempt", d)
+    }
+}
+
+func TestDeliverWebhooksDeletedHook(t *testing.T) {
+    recv := newReceiver(t, "s3cret")
+    svc, repo := newDeliveryService(t, "s3cret", recv)
+    repo.hook = nil
+
+    if err := svc.DeliverWebhooks(context.Background()); err != nil {
+        t.Fatal(err)
+    }
+    if d := repo.deliveries[0]; d.Status != repository.DeliveryFailed || recv.requests != 0 {
+        t.Errorf("delivery = %+v after %d requests, want failed without posting", d, recv.requests)
+    }
+}
@@ -0,0 +1,433 @@
+package http
+
+import (
+    "archive/zip"
+    "bufio"
+    "context"
+    "encoding/csv"
+    "encoding/json"
+    "encoding/xml"
+    "fmt"
+    "io"
+    "mime"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "video-stats-tracker/internal/endpoint"
+)
+
+// Export formats besides the default JSON
+const (
+    formatCSV    = "csv"
+    formatNDJSON = "ndjson"
+    formatXLSX   = "xlsx"
+)
+
+var exportContentTypes = map[string]string{
+    formatCSV:    "text/csv; charset=utf-8",
+    formatNDJSON: "application/x-ndjson",
+    formatXLSX:   "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// exportWriteWindow is how long a streamed export may take to send the rows
+// since it last made progress. The deadline moves forward as rows are
+// written, so a large export outlasts the server's write timeout while a
+// stalled client still times out.
+const exportWriteWindow = 10 * time.Second
+
+// export is the format a request asked for. Explicit formats come from
+// ?format= and are an error on endpoints without a table; formats taken
+// from the Accept header fall back to JSON there.
+type export struct {
+    format   string
+    explicit bool
+    name     string
+}
+
+type exportKey struct{}
+
+// exportBefore records the requested export format in the context
+func exportBefore(ctx context.Context, r *http.Request) context.Context {
+    name := strings.NewReplacer("/", "-", " ", "_").Replace(strings.Trim(r.URL.Path, "/"))
+    if name == "" {
+        name = "export"
+    }
+
+    if format := strings.ToLower(r.URL.Query().Get("format")); format != "" {
+        return context.WithValue(ctx, exportKey{}, export{format: format, explicit: true, name: name})
+    }
+    for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+        mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+        if err != nil {
+            continue
+        }
+        switch mediaType {
+        case "application/json":
+            return ctx
+        case "text/csv":
+            return context.WithValue(ctx, exportKey{}, export{format: formatCSV, name: name})
+        case "application/x-ndjson", "application/ndjson":
+            return context.WithValue(ctx, exportKey{}, export{format: formatNDJSON, name: name})
+        case exportContentTypes[formatXLSX]:
+            return context.WithValue(ctx, exportKey{}, export{format: formatXLSX, name: name})
+        }
+    }
+    return ctx
+}
+
+// exportFormat returns the requested non-JSON format, if any
+func exportFormat(ctx context.Context) string {
+    exp, _ := ctx.Value(exportKey{}).(export)
+    if exp.format == "json" {
+        return ""
+    }
+    return exp.format
+}
+
+// encodeExport writes a table response in the requested format. It reports
+// false when the response should be encoded as JSON instead.
+func encodeExport(ctx context.Context, w http.ResponseWriter, response interface{}) (bool, error) {
+    exp, _ := ctx.Value(exportKey{}).(export)
+    if exp.format == "" || exp.format == "json" {
+        return false, nil
+    }
+    if _, ok := exportContentTypes[exp.format]; !ok {
+        encodeError(ctx, badRequest(fmt.Errorf("unsupported format: %s (use json, csv, ndjson or xlsx)", exp.format)), w)
+        return true, nil
+    }
+    table, ok := response.(endpoint.Table)
+    if !ok {
+        if exp.explicit {
+            encodeError(ctx, badRequest(fmt.Errorf("format %s is not available for this endpoint", exp.format)), w)
+            return true, nil
+        }
+        return false, nil
+    }
+
+    // Headers are sent with the first row, so errors raised before it (such
+    // as validation of a streamed query) still get a proper error response
+    columns := table.Columns()
+    var out rowWriter
+    controller := http.NewResponseController(w)
+    var extended time.Time
+    extend := func() {
+        if now := time.Now(); now.Sub(extended) >= time.Second {
+            controller.SetWriteDeadline(now.Add(exportWriteWindow))
+            extended = now
+        }
+    }
+    start := func() error {
+        extend()
+        w.Header().Set("Content-Type", exportContentTypes[exp.format])
+        w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, exp.name, exp.format))
+        switch exp.format {
+        case formatCSV:
+            out = newCSVWriter(w, columns)
+        case formatNDJSON:
+            out = newNDJSONWriter(w, columns)
+        default:
+            out = newXLSXWriter(w, columns)
+        }
+        return out.Begin()
+    }
+
+    err := table.Rows(ctx, func(row []interface{}) error {
+        if out == nil {
+            if err := start(); err != nil {
+                return err
+            }
+        }
+        extend()
+        return out.Write(row)
+    })
+    if err != nil {
+        if out == nil {
+            encodeError(ctx, err, w)
+            return true, nil
+        }
+        // Part of the body is already sent; the client sees a truncated file
+        return true, err
+    }
+    if out == nil {
+        if err := start(); err != nil {
+            return true, err
+        }
+    }
+    extend()
+    return true, out.Close()
+}
+
+// rowWriter encodes rows of cells in one export format
+type rowWriter interface {
+    Begin() error
+    Write(row []interface{}) error
+    Close() error
+}
+
+// cellValue dereferences optional cells; nil pointers become nil
+func cellValue(v interface{}) interface{} {
+    switch v := v.(type) {
+    case *time.Time:
+        if v == nil {
+            return nil
+        }
+        return *v
+    case *float64:
+        if v == nil {
+            return nil
+        }
+        return *v
+    case *int:
+        if v == nil {
+            return nil
+        }
+        return *v
+    case *string:
+        if v == nil {
+            return nil
+        }
+        return *v
+    }
+    return v
+}
+
+// cellText is the text form of a cell for CSV
+func cellText(v interface{}) string {
+    switch v := cellValue(v).(type) {
+    case nil:
+        return ""
+    case string:
+        return v
+    case int:
+        return strconv.Itoa(v)
+    case float64:
+        return strconv.FormatFloat(v, 'f', -1, 64)
+    case bool:
+        return strconv.FormatBool(v)
+    case time.Time:
+        return v.UTC().Format(time.RFC3339)
+    default:
+        return fmt.Sprint(v)
+    }
+}
+
+type csvWriter struct {
+    w       *csv.Writer
+    columns []string
+    record  []string
+}
+
+func newCSVWriter(w io.Writer, columns []string) *csvWriter {
+    return &csvWriter{w: csv.NewWriter(w), columns: columns, record: make([]string, len(columns))}
+}
+
+func (c *csvWriter) Begin() error { return c.w.Write(c.columns) }
+
+func (c *csvWriter) Write(row []interface{}) error {
+    for i, v := range row {
+        c.record[i] = cellText(v)
+    }
+    return c.w.Write(c.record)
+}
+
+func (c *csvWriter) Close() error {
+    c.w.Flush()
+    return c.w.Error()
+}
+
+// ndjsonWriter writes one JSON object per row with the columns as keys, in
+// column order
+type ndjsonWriter struct {
+    w       *bufio.Writer
+    columns []string
+}
+
+func newNDJSONWriter(w io.Writer, columns []string) *ndjsonWriter {
+    return &ndjsonWriter{w: bufio.NewWriter(w), columns: columns}
+}
+
+func (n *ndjsonWriter) Begin() error { return nil }
+
+func (n *ndjsonWriter) Write(row []interface{}) error {
+    n.w.WriteByte('{')
+    for i, v := range row {
+        if i > 0 {
+            n.w.WriteByte(',')
+        }
+        key, _ := json.Marshal(n.columns[i])
+        value, err := json.Marshal(cellValue(v))
+        if err != nil {
+            return err
+        }
+        n.w.Write(key)
+        n.w.WriteByte(':')
+        n.w.Write(value)
+    }
+    _, err := n.w.WriteString("}\n")
+    return err
+}
+
+func (n *ndjsonWriter) Close() error { return n.w.Flush() }
+
+// maxSheetRows is the most data rows Excel shows on one sheet, under the
+// header row. Longer exports continue on further sheets.
+const maxSheetRows = 1<<20 - 1
+
+const xlsxHeader = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n"
+
+// excelEpoch is day 0 of Excel's 1900 date system, as used for serial
+// date-times
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// xlsxWriter streams a minimal Office Open XML workbook. Strings are
+// written inline and times as date-time serials, so nothing has to be kept
+// in memory but the current row.
+type xlsxWriter struct {
+    zip     *zip.Writer
+    sheet   *bufio.Writer
+    columns []string
+    sheets  int
+    rows    int
+}
+
+func newXLSXWriter(w io.Writer, columns []string) *xlsxWriter {
+    return &xlsxWriter{zip: zip.NewWriter(w), columns: columns}
+}
+
+func (x *xlsxWriter) Begin() error {
+    parts := []struct{ name, body string }{
+        {"[Content_Types].xml", `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+            `<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+            `<Default Extension="xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+            `<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+            `<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+            `</Types>`},
+        {"_rels/.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+            `<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+            `</Relationships>`},
+        // Style 1 formats date-time serials
+        {"xl/styles.xml", `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+            `<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts>` +
+            `<fonts count="1"><font><sz val="11"/><name val="Calibri"/></font></fonts>` +
+            `<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+            `<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+            `<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+            `<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+            `<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/></cellXfs>` +
+            `</styleSheet>`},
+    }
+    for _, part := range parts {
+        if err := x.writePart(part.name, part.body); err != nil {
+            return err
+        }
+    }
+    return x.nextSheet()
+}
+
+func (x *xlsxWriter) writePart(name, body string) error {
+    f, err := x.zip.Create(name)
+    if err != nil {
+        return err
+    }
+    _, err = io.WriteString(f, xlsxHeader+body)
+    return err
+}
+
+// nextSheet ends the current sheet and starts another with the header row
+func (x *xlsxWriter) nextSheet() error {
+    if err := x.endSheet(); err != nil {
+        return err
+    }
+    x.sheets++
+    x.rows = 0
+    f, err := x.zip.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", x.sheets))
+    if err != nil {
+        return err
+    }
+    x.sheet = bufio.NewWriter(f)
+    x.sheet.WriteString(xlsxHeader + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+
+    header := make([]interface{}, len(x.columns))
+    for i, column := range x.columns {
+        header[i] = column
+    }
+    return x.writeRow(header)
+}
+
+func (x *xlsxWriter) endSheet() error {
+    if x.sheet == nil {
+        return nil
+    }
+    x.sheet.WriteString(`</sheetData></worksheet>`)
+    return x.sheet.Flush()
+}
+
+func (x *xlsxWriter) Write(row []interface{}) error {
+    if x.rows == maxSheetRows {
+        if err := x.nextSheet(); err != nil {
+            return err
+        }
+    }
+    x.rows++
+    return x.writeRow(row)
+}
+
+func (x *xlsxWriter) writeRow(row []interface{}) error {
+    w := x.sheet
+    w.WriteString("<row>")
+    for _, v := range row {
+        switch v := cellValue(v).(type) {
+        case nil:
+            w.WriteString("<c/>")
+        case int:
+            fmt.Fprintf(w, "<c><v>%d</v></c>", v)
+        case float64:
+            fmt.Fprintf(w, "<c><v>%s</v></c>", strconv.FormatFloat(v, 'f', -1, 64))
+        case bool:
+            if v {
+                w.WriteString(`<c t="b"><v>1</v></c>`)
+            } else {
+                w.WriteString(`<c t="b"><v>0</v></c>`)
+            }
+        case time.Time:
+            serial := float64(v.Sub(excelEpoch)) / float64(24*time.Hour)
+            fmt.Fprintf(w, `<c s="1"><v>%s</v></c>`, strconv.FormatFloat(serial, 'f', -1, 64))
+        default:
+            w.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`)
+            if err := xml.EscapeText(w, []byte(cellText(v))); err != nil {
+                return err
+            }
+            w.WriteString("</t></is></c>")
+        }
+    }
+    _, err := w.WriteString("</row>")
+    return err
+}
+
+// Close ends the last sheet and writes the workbook listing every sheet
+func (x *xlsxWriter) Close() error {
+    if err := x.endSheet(); err != nil {
+        return err
+    }
+
+    var sheets, rels strings.Builder
+    for i := 1; i <= x.sheets; i++ {
+        fmt.Fprintf(&sheets, `<sheet name="Sheet%d" sheetId="%d" r:id="rId%d"/>`, i, i, i)
+        fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i, i)
+    }
+    fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, x.sheets+1)
+
+    err := x.writePart("xl/workbook.xml", `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" `+
+        `xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`+sheets.String()+`</sheets></workbook>`)
+    if err != nil {
+        return err
+    }
+    err = x.writePart("xl/_rels/workbook.xml.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`+
+        rels.String()+`</Relationships>`)
+    if err != nil {
+        return err
+    }
+    return x.zip.Close()
+}
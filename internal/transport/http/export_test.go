@@ -0,0 +1,127 @@
+package http
+
+import (
+    "archive/zip"
+    "bytes"
+    "encoding/csv"
+    "encoding/json"
+    "io"
+    "strings"
+    "testing"
+    "time"
+)
+
+var exportColumns = []string{"video_id", "views", "ratio", "timestamp", "note"}
+
+func exportRows() [][]interface{} {
+    at := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+    var missing *float64
+    return [][]interface{}{
+        {"abc", 10, 0.5, &at, "a, \"quoted\" <note>"},
+        {"def", 20, missing, at, nil},
+    }
+}
+
+func writeExport(t *testing.T, out rowWriter) {
+    t.Helper()
+    if err := out.Begin(); err != nil {
+        t.Fatalf("begin: %v", err)
+    }
+    for _, row := range exportRows() {
+        if err := out.Write(row); err != nil {
+            t.Fatalf("write: %v", err)
+        }
+    }
+    if err := out.Close(); err != nil {
+        t.Fatalf("close: %v", err)
+    }
+}
+
+func TestCSVWriter(t *testing.T) {
+    var buf bytes.Buffer
+    writeExport(t, newCSVWriter(&buf, exportColumns))
+
+    records, err := csv.NewReader(&buf).ReadAll()
+    if err != nil {
+        t.Fatalf("reading csv: %v", err)
+    }
+    want := [][]string{
+        exportColumns,
+        {"abc", "10", "0.5", "2025-06-01T12:00:00Z", "a, \"quoted\" <note>"},
+        {"def", "20", "", "2025-06-01T12:00:00Z", ""},
+    }
+    if len(records) != len(want) {
+        t.Fatalf("got %d records, want %d", len(records), len(want))
+    }
+    for i := range want {
+        if strings.Join(records[i], "|") != strings.Join(want[i], "|") {
+            t.Errorf("record %d: got %q, want %q", i, records[i], want[i])
+        }
+    }
+}
+
+func TestNDJSONWriter(t *testing.T) {
+    var buf bytes.Buffer
+    writeExport(t, newNDJSONWriter(&buf, exportColumns))
+
+    lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+    if len(lines) != 2 {
+        t.Fatalf("got %d lines, want 2", len(lines))
+    }
+    if !strings.HasPrefix(lines[0], `{"video_id":"abc","views":10,`) {
+        t.Errorf("columns out of order: %s", lines[0])
+    }
+    var second map[string]interface{}
+    if err := json.Unmarshal([]byte(lines[1]), &second); err != nil {
+        t.Fatalf("decoding line: %v", err)
+    }
+    if second["ratio"] != nil || second["timestamp"] != "2025-06-01T12:00:00Z" {
+        t.Errorf("got %v", second)
+    }
+}
+
+func TestXLSXWriter(t *testing.T) {
+    var buf bytes.Buffer
+    writeExport(t, newXLSXWriter(&buf, exportColumns))
+
+    archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+    if err != nil {
+        t.Fatalf("reading workbook: %v", err)
+    }
+    parts := map[string]string{}
+    for _, f := range archive.File {
+        r, err := f.Open()
+        if err != nil {
+            t.Fatalf("opening %s: %v", f.Name, err)
+        }
+        body, _ := io.ReadAll(r)
+        r.Close()
+        parts[f.Name] = string(body)
+    }
+    for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml"} {
+        if _, ok := parts[name]; !ok {
+            t.Errorf("missing part %s", name)
+        }
+    }
+    if !strings.Contains(parts["xl/workbook.xml"], `<sheet name="Sheet1"`) {
+        t.Errorf("workbook lists no sheet: %s", parts["xl/workbook.xml"])
+    }
+
+    sheet := parts["xl/worksheets/sheet1.xml"]
+    if got := strings.Count(sheet, "<row>"); got != 3 {
+        t.Errorf("got %d rows, want header and 2", got)
+    }
+    // 2025-06-01 12:00 is day 45809.5 of Excel's 1900 date system
+    for _, cell := range []string{
+        `<c t="inlineStr"><is><t xml:space="preserve">video_id</t></is></c>`,
+        `<c><v>10</v></c>`,
+        `<c><v>0.5</v></c>`,
+        `<c s="1"><v>45809.5</v></c>`,
+        `a, &#34;quoted&#34; &lt;note&gt;`,
+        `<c/>`,
+    } {
+        if !strings.Contains(sheet, cell) {
+            t.Errorf("sheet is missing %s", cell)
+        }
+    }
+}
@@ -2,25 +2,39 @@ package http
 
 import (
     "context"
+    "encoding/csv"
     "encoding/json"
+    "fmt"
+    "io"
+    "mime"
     "net/http"
 	"os"
+    "strconv"
+    "strings"
     "time"
 
 	"github.com/go-kit/log"
     "github.com/gorilla/mux"
+    kitEndpoint "github.com/go-kit/kit/endpoint"
     "github.com/go-kit/kit/transport"
     kitHttp "github.com/go-kit/kit/transport/http"
+    "github.com/prometheus/client_golang/prometheus/promhttp"
 
     "video-stats-tracker/internal/endpoint"
+    "video-stats-tracker/internal/repository"
+    "video-stats-tracker/internal/service"
 )
 
+// maxBulkUploadBytes caps the size of a bulk registration body or CSV upload
+const maxBulkUploadBytes = 10 << 20
+
 func NewHTTPHandler(endpoints endpoint.Endpoints) http.Handler {
     r := mux.NewRouter()
     logger := log.NewLogfmtLogger(os.Stderr)
     options := []kitHttp.ServerOption{
         kitHttp.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
         kitHttp.ServerErrorEncoder(encodeError),
+        kitHttp.ServerBefore(exportBefore),
     }
 
     // Register video endpoint
@@ -31,6 +45,14 @@ func NewHTTPHandler(endpoints endpoint.Endpoints) http.Handler {
         options...,
     ))
 
+    // Bulk register endpoint (JSON array or CSV upload)
+    r.Methods("POST").Path("/track-videos").Handler(kitHttp.NewServer(
+        endpoints.RegisterVideos,
+        decodeRegisterVideosRequest,
+        encodeResponse,
+        options...,
+    ))
+
     // Get stats endpoint
     r.Methods("GET").Path("/stats").Handler(kitHttp.NewServer(
         endpoints.GetStats,
@@ -39,57 +61,816 @@ func NewHTTPHandler(endpoints endpoint.Endpoints) http.Handler {
         options...,
     ))
 
+    // Tracked channel and account endpoints
+    r.Methods("POST").Path("/track-channel").Handler(kitHttp.NewServer(
+        endpoints.TrackChannel,
+        decodeTrackChannelRequest,
+        encodeResponse,
+        options...,
+    ))
+
+    r.Methods("POST").Path("/track-account").Handler(kitHttp.NewServer(
+        endpoints.TrackAccount,
+        decodeTrackAccountRequest,
+        encodeResponse,
+        options...,
+    ))
+
+    r.Methods("GET").Path("/accounts").Handler(kitHttp.NewServer(
+        endpoints.GetAccounts,
+        decodeEmptyRequest,
+        encodeResponse,
+        options...,
+    ))
+
+    r.Methods("GET").Path("/accounts/{id}/stats").Handler(kitHttp.NewServer(
+        endpoints.GetAccountStats,
+        decodeGetAccountStatsRequest,
+        encodeResponse,
+        options...,
+    ))
+
+    r.Methods("GET").Path("/videos").Handler(kitHttp.NewServer(
+        endpoints.ListVideos,
+        decodeListVideosRequest,
+        encodeResponse,
+        options...,
+    ))
+
+    r.Methods("GET").Path("/videos/{id}/metadata").Handler(kitHttp.NewServer(
+        endpoints.GetMetadata,
+        decodeGetMetadataRequest,
+        encodeResponse,
+        options...,
+    ))
+
+    r.Methods("GET").Path("/videos/{id}/milestones").Handler(kitHttp.NewServer(
+        endpoints.GetMilestones,
+        decodeGetMilestonesRequest,
+        encodeResponse,
+        options...,
+    ))
+
+    r.Methods("GET").Path("/videos/{id}/forecast").Handler(kitHttp.NewServer(
+        endpoints.GetForecast,
+        decodeGetForecastRequest,
+        encodeResponse,
+        options...,
+    ))
+
+    r.Methods("POST").Path("/videos/{id}/tags").Handler(kitHttp.NewServer(
+        endpoints.AddVideoTags,
+        decodeVideoTagsRequest,
+        encodeResponse,
+        options...,
+    ))
+
+    r.Methods("DELETE").Path("/videos/{id}/tags/{tag}").Handler(kitHttp.NewServer(
+        endpoints.RemoveVideoTag,
+        decodeVideoTagsRequest,
+        encodeResponse,
+        options...,
+    ))
+
+    r.Methods("GET").Path("/compare").Handler(kitHttp.NewServer(
+        endpoints.CompareVideos,
+        decodeCompareVideosRequest,
+        encodeResponse,
+        options...,
+    ))
+
+    r.Methods("GET").Path("/benchmarks").Handler(kitHttp.NewServer(
+        endpoints.GetBenchmark,
+        decodeGetBenchmarkRequest,
+        encodeResponse,
+        options...,
+    ))
+
+    r.Methods("GET").Path("/leaderboard").Handler(kitHttp.NewServer(
+        endpoints.GetLeaderboard,
+        decodeGetLeaderboardRequest,
+        encodeResponse,
+        options...,
+    ))
+
+    r.Methods("GET").Path("/tags").Handler(kitHttp.NewServer(
+        endpoints.GetTags,
+        decodeEmptyRequest,
+        encodeResponse,
+        options...,
+    ))
+
+    r.Methods("GET").Path("/tags/{tag}/stats").Handler(kitHttp.NewServer(
+        endpoints.GetTagStats,
+        decodeGetTagStatsRequest,
+        encodeResponse,
+        options...,
+    ))
+
+    r.Methods("GET").Path("/videos/{id}/states").Handler(kitHttp.NewServer(
+        endpoints.GetStateHistory,
+        decodeGetStateHistoryRequest,
+        encodeResponse,
+        options...,
+    ))
+
+    // Webhooks
+    r.Methods("POST").Path("/webhooks").Handler(kitHttp.NewServer(
+        endpoints.CreateWebhook,
+        decodeCreateWebhookRequest,
+        encodeResponse,
+        options...,
+    ))
+
+    r.Methods("GET").Path("/webhooks").Handler(kitHttp.NewServer(
+        endpoints.GetWebhooks,
+        decodeEmptyRequest,
+        encodeResponse,
+        options...,
+    ))
+
+    r.Methods("DELETE").Path("/webhooks/{id}").Handler(kitHttp.NewServer(
+        endpoints.DeleteWebhook,
+        decodeWebhookRequest,
+        encodeResponse,
+        options...,
+    ))
+
+    r.Methods("GET").Path("/webhooks/{id}/deliveries").Handler(kitHttp.NewServer(
+        endpoints.GetDeliveries,
+        decodeWebhookRequest,
+        encodeResponse,
+        options...,
+    ))
+
+    // Alerts
+    r.Methods("POST").Path("/alerts/rules").Handler(kitHttp.NewServer(
+        endpoints.CreateAlertRule,
+        decodeCreateAlertRuleRequest,
+        encodeResponse,
+        options...,
+    ))
+
+    r.Methods("GET").Path("/alerts/rules").Handler(kitHttp.NewServer(
+        endpoints.GetAlertRules,
+        decodeEmptyRequest,
+        encodeResponse,
+        options...,
+    ))
+
+    r.Methods("DELETE").Path("/alerts/rules/{id}").Handler(kitHttp.NewServer(
+        endpoints.DeleteAlertRule,
+        decodeDeleteAlertRuleRequest,
+        encodeResponse,
+        options...,
+    ))
+
+    r.Methods("GET").Path("/alerts").Handler(kitHttp.NewServer(
+        endpoints.GetAlerts,
+        decodeGetAlertsRequest,
+        encodeResponse,
+        options...,
+    ))
+
+    r.Methods("GET").Path("/anomalies").Handler(kitHttp.NewServer(
+        endpoints.GetAnomalies,
+        decodeGetAnomaliesRequest,
+        encodeResponse,
+        options...,
+    ))
+
+    r.Methods("POST").Path("/campaigns").Handler(kitHttp.NewServer(
+        endpoints.CreateCampaign,
+        decodeCreateCampaignRequest,
+        encodeResponse,
+        options...,
+    ))
+
+    r.Methods("GET").Path("/campaigns").Handler(kitHttp.NewServer(
+        endpoints.GetCampaigns,
+        decodeEmptyRequest,
+        encodeResponse,
+        options...,
+    ))
+
+    r.Methods("GET").Path("/campaigns/{id}").Handler(kitHttp.NewServer(
+        endpoints.GetCampaign,
+        decodeCampaignRequest,
+        encodeResponse,
+        options...,
+    ))
+
+    r.Methods("DELETE").Path("/campaigns/{id}").Handler(kitHttp.NewServer(
+        endpoints.DeleteCampaign,
+        decodeCampaignRequest,
+        encodeResponse,
+        options...,
+    ))
+
+    r.Methods("POST").Path("/campaigns/{id}/videos").Handler(kitHttp.NewServer(
+        endpoints.AddCampaignVideos,
+        decodeAddCampaignVideosRequest,
+        encodeResponse,
+        options...,
+    ))
+
+    r.Methods("DELETE").Path("/campaigns/{id}/videos/{video_id}").Handler(kitHttp.NewServer(
+        endpoints.RemoveCampaignVideo,
+        decodeCampaignRequest,
+        encodeResponse,
+        options...,
+    ))
+
+    // Warehouse export; runs can outlast the server's write timeout
+    r.Methods("POST").Path("/exports/parquet").Handler(withoutWriteDeadline(kitHttp.NewServer(
+        endpoints.ExportParquet,
+        decodeExportParquetRequest,
+        encodeResponse,
+        options...,
+    )))
+
+    // Retention: GET reports what a run would do, POST applies it
+    r.Methods("GET").Path("/retention/report").Handler(kitHttp.NewServer(
+        endpoints.Retention,
+        decodeRetentionReportRequest,
+        encodeResponse,
+        options...,
+    ))
+
+    r.Methods("POST").Path("/retention/run").Handler(kitHttp.NewServer(
+        endpoints.Retention,
+        decodeRetentionRunRequest,
+        encodeResponse,
+        options...,
+    ))
+
+    // Prometheus scrape target, served from the default registry the
+    // metrics are created in
+    r.Methods("GET").Path("/metrics").Handler(promhttp.Handler())
+
     return r
 }
 
 func decodeRegisterVideoRequest(_ context.Context, r *http.Request) (interface{}, error) {
     var req endpoint.RegisterVideoRequest
     if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-        return nil, err
+        return nil, badRequest(err)
+    }
+    return req, nil
+}
+
+// decodeRegisterVideosRequest accepts a JSON array of registrations, a
+// text/csv body or a multipart form with the CSV in a "file" field
+func decodeRegisterVideosRequest(_ context.Context, r *http.Request) (interface{}, error) {
+    var req endpoint.RegisterVideosRequest
+    r.Body = http.MaxBytesReader(nil, r.Body, maxBulkUploadBytes)
+
+    mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+    switch mediaType {
+    case "text/csv":
+        videos, err := parseRegistrationCSV(r.Body)
+        if err != nil {
+            return nil, badRequest(err)
+        }
+        req.Videos = videos
+    case "multipart/form-data":
+        file, _, err := r.FormFile("file")
+        if err != nil {
+            return nil, badRequest(fmt.Errorf("missing CSV file: %v", err))
+        }
+        defer file.Close()
+        videos, err := parseRegistrationCSV(file)
+        if err != nil {
+            return nil, badRequest(err)
+        }
+        req.Videos = videos
+    default:
+        if err := json.NewDecoder(r.Body).Decode(&req.Videos); err != nil {
+            return nil, badRequest(err)
+        }
+    }
+
+    if len(req.Videos) == 0 {
+        return nil, badRequest(fmt.Errorf("no videos to register"))
+    }
+    return req, nil
+}
+
+// parseRegistrationCSV reads rows with a header naming the columns
+// platform, video_id, url, username and tag (in any order)
+func parseRegistrationCSV(body io.Reader) ([]service.VideoRegistration, error) {
+    reader := csv.NewReader(body)
+    reader.FieldsPerRecord = -1
+    reader.TrimLeadingSpace = true
+
+    header, err := reader.Read()
+    if err != nil {
+        return nil, fmt.Errorf("invalid CSV header: %v", err)
+    }
+
+    columns := make(map[string]int)
+    for i, name := range header {
+        columns[strings.ToLower(strings.TrimSpace(name))] = i
+    }
+    _, hasURL := columns["url"]
+    if _, ok := columns["platform"]; !ok && !hasURL {
+        return nil, fmt.Errorf("CSV header must include a platform column")
+    }
+    if _, ok := columns["video_id"]; !ok && !hasURL {
+        return nil, fmt.Errorf("CSV header must include a video_id or url column")
+    }
+
+    field := func(record []string, name string) string {
+        i, ok := columns[name]
+        if !ok || i >= len(record) {
+            return ""
+        }
+        return strings.TrimSpace(record[i])
+    }
+
+    var videos []service.VideoRegistration
+    for {
+        record, err := reader.Read()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return nil, fmt.Errorf("invalid CSV: %v", err)
+        }
+
+        videos = append(videos, service.VideoRegistration{
+            Platform: field(record, "platform"),
+            VideoID:  field(record, "video_id"),
+            URL:      field(record, "url"),
+            Username: field(record, "username"),
+            Tag:      field(record, "tag"),
+        })
+    }
+    return videos, nil
+}
+
+func decodeTrackChannelRequest(_ context.Context, r *http.Request) (interface{}, error) {
+    var req endpoint.TrackChannelRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        return nil, badRequest(err)
     }
     return req, nil
 }
 
-func decodeGetStatsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+func decodeTrackAccountRequest(_ context.Context, r *http.Request) (interface{}, error) {
+    var req endpoint.TrackAccountRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        return nil, badRequest(err)
+    }
+    return req, nil
+}
+
+func decodeRetentionReportRequest(_ context.Context, _ *http.Request) (interface{}, error) {
+    return endpoint.RetentionRequest{DryRun: true}, nil
+}
+
+func decodeRetentionRunRequest(_ context.Context, r *http.Request) (interface{}, error) {
+    return endpoint.RetentionRequest{DryRun: r.URL.Query().Get("dry_run") == "true"}, nil
+}
+
+// decodeExportParquetRequest reads the optional name and full flag from the
+// query string
+func decodeExportParquetRequest(_ context.Context, r *http.Request) (interface{}, error) {
+    return endpoint.ExportParquetRequest{
+        Name: r.URL.Query().Get("name"),
+        Full: r.URL.Query().Get("full") == "true",
+    }, nil
+}
+
+// withoutWriteDeadline lifts the write deadline for long running requests
+func withoutWriteDeadline(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        http.NewResponseController(w).SetWriteDeadline(time.Time{})
+        next.ServeHTTP(w, r)
+    })
+}
+
+func decodeEmptyRequest(_ context.Context, _ *http.Request) (interface{}, error) {
+    return nil, nil
+}
+
+func decodeGetStatsRequest(ctx context.Context, r *http.Request) (interface{}, error) {
     var req endpoint.GetStatsRequest
     req.VideoID = r.URL.Query().Get("video_id")
-    
+    req.Stream = exportFormat(ctx) != ""
+
+    from, to, err := parseTimeRange(r)
+    if err != nil {
+        return nil, err
+    }
+    req.From, req.To = from, to
+
+    req.Metrics, err = service.ParseMetricKinds(r.URL.Query().Get("metrics"))
+    if err != nil {
+        return nil, err
+    }
+
+    // Bucketed series are gap filled unless fill=false
+    req.Interval = r.URL.Query().Get("interval")
+    req.Agg = r.URL.Query().Get("agg")
+    req.Fill = r.URL.Query().Get("fill") != "false"
+
+    // exclude_flagged=true leaves out samples marked by the anomaly detector
+    req.ExcludeFlagged = r.URL.Query().Get("exclude_flagged") == "true"
+
+    // expand=<duration> repeats collapsed samples at that step
+    if expand := r.URL.Query().Get("expand"); expand != "" {
+        req.Expand, err = time.ParseDuration(expand)
+        if err != nil {
+            return nil, badRequest(err)
+        }
+        if err := service.CheckExpand(req.Expand, req.From, req.To); err != nil {
+            return nil, err
+        }
+    }
+
+    return req, nil
+}
+
+func decodeGetAccountStatsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+    var req endpoint.GetAccountStatsRequest
+    req.AccountID = mux.Vars(r)["id"]
+
+    from, to, err := parseTimeRange(r)
+    if err != nil {
+        return nil, err
+    }
+    req.From, req.To = from, to
+
+    return req, nil
+}
+
+func decodeCreateAlertRuleRequest(_ context.Context, r *http.Request) (interface{}, error) {
+    var req endpoint.CreateAlertRuleRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        return nil, badRequest(err)
+    }
+    return req, nil
+}
+
+func decodeDeleteAlertRuleRequest(_ context.Context, r *http.Request) (interface{}, error) {
+    return endpoint.DeleteAlertRuleRequest{ID: mux.Vars(r)["id"]}, nil
+}
+
+func decodeGetAnomaliesRequest(_ context.Context, r *http.Request) (interface{}, error) {
+    req := endpoint.GetAnomaliesRequest{VideoID: r.URL.Query().Get("video_id")}
+    if limit := r.URL.Query().Get("limit"); limit != "" {
+        n, err := strconv.Atoi(limit)
+        if err != nil {
+            return nil, badRequest(err)
+        }
+        req.Limit = n
+    }
+    return req, nil
+}
+
+func decodeCreateCampaignRequest(_ context.Context, r *http.Request) (interface{}, error) {
+    var req endpoint.CreateCampaignRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        return nil, badRequest(err)
+    }
+    return req, nil
+}
+
+// decodeCampaignRequest reads the campaign ID, the member video ID when the
+// route has one and the report interval
+func decodeCampaignRequest(_ context.Context, r *http.Request) (interface{}, error) {
+    vars := mux.Vars(r)
+    return endpoint.CampaignRequest{
+        ID:       vars["id"],
+        VideoID:  vars["video_id"],
+        Interval: r.URL.Query().Get("interval"),
+    }, nil
+}
+
+func decodeAddCampaignVideosRequest(_ context.Context, r *http.Request) (interface{}, error) {
+    var req endpoint.AddCampaignVideosRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        return nil, badRequest(err)
+    }
+    req.ID = mux.Vars(r)["id"]
+    return req, nil
+}
+
+func decodeGetAlertsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+    req := endpoint.GetAlertsRequest{State: r.URL.Query().Get("state")}
+    if limit := r.URL.Query().Get("limit"); limit != "" {
+        n, err := strconv.Atoi(limit)
+        if err != nil {
+            return nil, badRequest(err)
+        }
+        req.Limit = n
+    }
+    return req, nil
+}
+
+func decodeCreateWebhookRequest(_ context.Context, r *http.Request) (interface{}, error) {
+    var req endpoint.CreateWebhookRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        return nil, badRequest(err)
+    }
+    return req, nil
+}
+
+// decodeWebhookRequest reads the webhook ID and the optional limit of the
+// delivery log
+func decodeWebhookRequest(_ context.Context, r *http.Request) (interface{}, error) {
+    req := endpoint.WebhookRequest{ID: mux.Vars(r)["id"]}
+    if limit := r.URL.Query().Get("limit"); limit != "" {
+        n, err := strconv.Atoi(limit)
+        if err != nil {
+            return nil, badRequest(err)
+        }
+        req.Limit = n
+    }
+    return req, nil
+}
+
+func decodeGetMilestonesRequest(_ context.Context, r *http.Request) (interface{}, error) {
+    return endpoint.GetMilestonesRequest{VideoID: mux.Vars(r)["id"]}, nil
+}
+
+// decodeGetForecastRequest reads the optional target=<count> and
+// deadline=<RFC3339> parameters; metric defaults to views
+func decodeGetForecastRequest(_ context.Context, r *http.Request) (interface{}, error) {
+    req := endpoint.GetForecastRequest{VideoID: mux.Vars(r)["id"]}
+
+    query := r.URL.Query()
+    if query.Get("target") == "" && query.Get("deadline") == "" {
+        return req, nil
+    }
+
+    target, err := strconv.Atoi(query.Get("target"))
+    if err != nil {
+        return nil, badRequest(fmt.Errorf("target must be a whole number"))
+    }
+    deadline, err := time.Parse(time.RFC3339, query.Get("deadline"))
+    if err != nil {
+        return nil, badRequest(fmt.Errorf("deadline must be an RFC3339 timestamp"))
+    }
+    metric := query.Get("metric")
+    if metric == "" {
+        metric = "views"
+    }
+
+    req.Target = &service.ForecastTarget{Metric: metric, Target: target, Deadline: deadline}
+    return req, nil
+}
+
+func decodeGetStateHistoryRequest(_ context.Context, r *http.Request) (interface{}, error) {
+    return endpoint.GetStateHistoryRequest{VideoID: mux.Vars(r)["id"]}, nil
+}
+
+// decodeVideoTagsRequest reads the video ID, the tag to remove from the
+// path, or the tags to add from the body
+func decodeVideoTagsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+    vars := mux.Vars(r)
+    req := endpoint.VideoTagsRequest{Tag: vars["tag"]}
+    if r.Method == http.MethodPost {
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+            return nil, badRequest(err)
+        }
+    }
+    req.VideoID = vars["id"]
+    return req, nil
+}
+
+// decodeGetTagStatsRequest reads the tag, the time range and the same
+// interval, agg and exclude_flagged options as a video's stats
+func decodeGetTagStatsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+    from, to, err := parseTimeRange(r)
+    if err != nil {
+        return nil, err
+    }
+    query := r.URL.Query()
+    return endpoint.GetTagStatsRequest{
+        Tag:            mux.Vars(r)["tag"],
+        From:           from,
+        To:             to,
+        Interval:       query.Get("interval"),
+        Agg:            query.Get("agg"),
+        ExcludeFlagged: query.Get("exclude_flagged") == "true",
+    }, nil
+}
+
+// decodeGetLeaderboardRequest reads metric, window (a duration such as 24h,
+// or whole days such as 7d), an optional RFC3339 end of the window,
+// platform, tag, min_views and limit
+func decodeGetLeaderboardRequest(_ context.Context, r *http.Request) (interface{}, error) {
+    query := r.URL.Query()
+    req := endpoint.GetLeaderboardRequest{
+        Metric:   query.Get("metric"),
+        Platform: query.Get("platform"),
+        Tag:      query.Get("tag"),
+    }
+
+    if window := query.Get("window"); window != "" {
+        d, err := parseWindow(window)
+        if err != nil {
+            return nil, badRequest(err)
+        }
+        req.Window = d
+    }
+    if to := query.Get("to"); to != "" {
+        t, err := time.Parse(time.RFC3339, to)
+        if err != nil {
+            return nil, badRequest(err)
+        }
+        req.To = t
+    }
+    for name, dest := range map[string]*int{"min_views": &req.MinViews, "limit": &req.Limit} {
+        if value := query.Get(name); value != "" {
+            n, err := strconv.Atoi(value)
+            if err != nil {
+                return nil, badRequest(fmt.Errorf("invalid %s: %v", name, err))
+            }
+            *dest = n
+        }
+    }
+    return req, nil
+}
+
+// videoFilter reads the platform, tag, account_id and state filters
+func videoFilter(r *http.Request) repository.VideoFilter {
+    query := r.URL.Query()
+    return repository.VideoFilter{
+        Platform:  query.Get("platform"),
+        Tag:       query.Get("tag"),
+        AccountID: query.Get("account_id"),
+        State:     query.Get("state"),
+    }
+}
+
+func decodeListVideosRequest(_ context.Context, r *http.Request) (interface{}, error) {
+    return endpoint.ListVideosRequest{
+        Filter:    videoFilter(r),
+        Benchmark: r.URL.Query().Get("benchmark"),
+        Metric:    r.URL.Query().Get("metric"),
+    }, nil
+}
+
+func decodeGetBenchmarkRequest(_ context.Context, r *http.Request) (interface{}, error) {
+    query := r.URL.Query()
+    req := endpoint.GetBenchmarkRequest{Cohort: videoFilter(r), Metric: query.Get("metric")}
+    req.Cohort.State = ""
+
+    for name, dest := range map[string]*time.Duration{"step": &req.Step, "max_age": &req.MaxAge} {
+        if value := query.Get(name); value != "" {
+            d, err := parseWindow(value)
+            if err != nil {
+                return nil, badRequest(fmt.Errorf("invalid %s: %v", name, err))
+            }
+            *dest = d
+        }
+    }
+    return req, nil
+}
+
+// decodeCompareVideosRequest reads the comma-separated videos, align,
+// normalize, and the step and max_age windows
+func decodeCompareVideosRequest(_ context.Context, r *http.Request) (interface{}, error) {
+    query := r.URL.Query()
+    var req endpoint.CompareVideosRequest
+    for _, id := range strings.Split(query.Get("videos"), ",") {
+        if id = strings.TrimSpace(id); id != "" {
+            req.VideoIDs = append(req.VideoIDs, id)
+        }
+    }
+    req.Options.Align = query.Get("align")
+    req.Options.Normalize = query.Get("normalize")
+
+    for name, dest := range map[string]*time.Duration{"step": &req.Options.Step, "max_age": &req.Options.MaxAge} {
+        if value := query.Get(name); value != "" {
+            d, err := parseWindow(value)
+            if err != nil {
+                return nil, badRequest(fmt.Errorf("invalid %s: %v", name, err))
+            }
+            *dest = d
+        }
+    }
+    return req, nil
+}
+
+// parseWindow accepts Go durations and whole days ("7d")
+func parseWindow(value string) (time.Duration, error) {
+    if days, ok := strings.CutSuffix(value, "d"); ok {
+        n, err := strconv.Atoi(days)
+        if err != nil || n <= 0 {
+            return 0, fmt.Errorf("invalid window: %s", value)
+        }
+        return time.Duration(n) * 24 * time.Hour, nil
+    }
+    d, err := time.ParseDuration(value)
+    if err != nil || d <= 0 {
+        return 0, fmt.Errorf("invalid window: %s", value)
+    }
+    return d, nil
+}
+
+// decodeGetMetadataRequest reads the optional RFC3339 at parameter; without
+// it the full version history is returned
+func decodeGetMetadataRequest(_ context.Context, r *http.Request) (interface{}, error) {
+    req := endpoint.GetMetadataRequest{VideoID: mux.Vars(r)["id"]}
+
+    if atStr := r.URL.Query().Get("at"); atStr != "" {
+        at, err := time.Parse(time.RFC3339, atStr)
+        if err != nil {
+            return nil, badRequest(err)
+        }
+        req.At = &at
+    }
+    return req, nil
+}
+
+// parseTimeRange reads the RFC3339 from/to query parameters, defaulting to
+// the last 7 days
+func parseTimeRange(r *http.Request) (time.Time, time.Time, error) {
+    var from, to time.Time
+
     // Parse from date (default to 7 days ago)
     fromStr := r.URL.Query().Get("from")
     if fromStr == "" {
-        req.From = time.Now().AddDate(0, 0, -7)
+        from = time.Now().AddDate(0, 0, -7)
     } else {
-        from, err := time.Parse(time.RFC3339, fromStr)
+        parsed, err := time.Parse(time.RFC3339, fromStr)
         if err != nil {
-            return nil, err
+            return from, to, badRequest(err)
         }
-        req.From = from
+        from = parsed
     }
     
     // Parse to date (default to now)
     toStr := r.URL.Query().Get("to")
     if toStr == "" {
-        req.To = time.Now()
+        to = time.Now()
     } else {
-        to, err := time.Parse(time.RFC3339, toStr)
+        parsed, err := time.Parse(time.RFC3339, toStr)
         if err != nil {
-            return nil, err
+            return from, to, badRequest(err)
         }
-        req.To = to
+        to = parsed
     }
     
-    return req, nil
+    return from, to, nil
 }
 
 func encodeResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+    if f, ok := response.(kitEndpoint.Failer); ok && f.Failed() != nil {
+        encodeError(ctx, f.Failed(), w)
+        return nil
+    }
+    // Tables are exported as CSV, NDJSON or xlsx when asked for
+    if done, err := encodeExport(ctx, w, response); done {
+        return err
+    }
     w.Header().Set("Content-Type", "application/json; charset=utf-8")
+    if sc, ok := response.(kitHttp.StatusCoder); ok {
+        w.WriteHeader(sc.StatusCode())
+    }
     return json.NewEncoder(w).Encode(response)
 }
 
+// errorBody is the envelope every failed request is answered with
+type errorBody struct {
+    Error errorDetail `json:"error"`
+}
+
+type errorDetail struct {
+    Code    string `json:"code"`
+    Message string `json:"message"`
+}
+
 func encodeError(_ context.Context, err error, w http.ResponseWriter) {
+    code := service.ErrorCode(err)
     w.Header().Set("Content-Type", "application/json; charset=utf-8")
-    w.WriteHeader(http.StatusInternalServerError)
-    json.NewEncoder(w).Encode(map[string]interface{}{
-        "error": err.Error(),
+    w.WriteHeader(errorStatus(code))
+    json.NewEncoder(w).Encode(errorBody{
+        Error: errorDetail{Code: code, Message: err.Error()},
     })
-}
\ No newline at end of file
+}
+
+// errorStatus maps service error codes to HTTP statuses
+func errorStatus(code string) int {
+    switch code {
+    case service.CodeValidation:
+        return http.StatusBadRequest
+    case service.CodeNotFound:
+        return http.StatusNotFound
+    case service.CodeDuplicate:
+        return http.StatusConflict
+    case service.CodeUpstream:
+        return http.StatusBadGateway
+    default:
+        return http.StatusInternalServerError
+    }
+}
+
+// badRequest marks a decoding failure as a validation error
+func badRequest(err error) error {
+    return service.Errorf(service.CodeValidation, "invalid request: %w", err)
+}
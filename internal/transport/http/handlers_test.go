@@ -0,0 +1,198 @@
+package http
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "mime/multipart"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "video-stats-tracker/internal/endpoint"
+    "video-stats-tracker/internal/repository"
+    "video-stats-tracker/internal/service"
+)
+
+func TestParseRegistrationCSV(t *testing.T) {
+    tests := []struct {
+        name string
+        body string
+        want []service.VideoRegistration
+        err  string
+    }{
+        {"columns in any order", "tag,Video_ID , platform\nlaunch,dQw4w9WgXcQ,youtube\n",
+            []service.VideoRegistration{{Platform: "youtube", VideoID: "dQw4w9WgXcQ", Tag: "launch"}}, ""},
+        {"short rows leave fields empty", "platform,video_id,username,tag\ninstagram,1784,bluebottle\nyoutube\n",
+            []service.VideoRegistration{{Platform: "instagram", VideoID: "1784", Username: "bluebottle"}, {Platform: "youtube"}}, ""},
+        {"links only", "url\nhttps://youtu.be/dQw4w9WgXcQ\n",
+            []service.VideoRegistration{{URL: "https://youtu.be/dQw4w9WgXcQ"}}, ""},
+        {"header only", "platform,video_id\n", nil, ""},
+        {"no platform column", "video_id,tag\nabc,x\n", nil, "platform column"},
+        {"no video column", "platform,tag\nyoutube,x\n", nil, "video_id or url column"},
+        {"empty body", "", nil, "invalid CSV header"},
+        {"broken quoting", "platform,video_id\n\"youtube,abc\n", nil, "invalid CSV"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, err := parseRegistrationCSV(strings.NewReader(tt.body))
+            if tt.err != "" {
+                if err == nil || !strings.Contains(err.Error(), tt.err) {
+                    t.Fatalf("err = %v, want %q", err, tt.err)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            if len(got) != len(tt.want) {
+                t.Fatalf("got %+v, want %+v", got, tt.want)
+            }
+            for i := range tt.want {
+                if got[i] != tt.want[i] {
+                    t.Errorf("row %d = %+v, want %+v", i, got[i], tt.want[i])
+                }
+            }
+        })
+    }
+}
+
+func TestDecodeRegisterVideosRequest(t *testing.T) {
+    csvBody := "platform,video_id\nyoutube,dQw4w9WgXcQ\n"
+
+    var form bytes.Buffer
+    writer := multipart.NewWriter(&form)
+    file, _ := writer.CreateFormFile("file", "campaign.csv")
+    file.Write([]byte(csvBody))
+    writer.Close()
+
+    tests := []struct {
+        name        string
+        contentType string
+        body        string
+        rows        int
+        fails       bool
+    }{
+        {"csv body", "text/csv; charset=utf-8", csvBody, 1, false},
+        {"multipart upload", writer.FormDataContentType(), form.String(), 1, false},
+        {"json array", "application/json", `[{"platform":"youtube","video_id":"a"},{"url":"https://youtu.be/dQw4w9WgXcQ"}]`, 2, false},
+        {"no rows", "text/csv", "platform,video_id\n", 0, true},
+        {"multipart without file", "multipart/form-data; boundary=x", "--x--\r\n", 0, true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            r := httptest.NewRequest("POST", "/track-videos", strings.NewReader(tt.body))
+            r.Header.Set("Content-Type", tt.contentType)
+            req, err := decodeRegisterVideosRequest(context.Background(), r)
+            if tt.fails {
+                if err == nil {
+                    t.Fatal("want an error")
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            if videos := req.(endpoint.RegisterVideosRequest).Videos; len(videos) != tt.rows {
+                t.Errorf("got %d rows, want %d", len(videos), tt.rows)
+            }
+        })
+    }
+}
+
+// registerServer answers /track-video with the given error, or the created
+// video without one
+func registerServer(err error) *httptest.Server {
+    endpoints := endpoint.Endpoints{
+        RegisterVideo: func(ctx context.Context, request interface{}) (interface{}, error) {
+            req := request.(endpoint.RegisterVideoRequest)
+            if err != nil {
+                return endpoint.RegisterVideoResponse{Err: err}, nil
+            }
+            return endpoint.RegisterVideoResponse{Video: &repository.Video{ID: "1", Platform: req.Platform, VideoID: req.VideoID}}, nil
+        },
+    }
+    return httptest.NewServer(NewHTTPHandler(endpoints))
+}
+
+func TestErrorResponses(t *testing.T) {
+    tests := []struct {
+        name    string
+        err     error
+        body    string
+        status  int
+        code    string
+        message string
+    }{
+        {"validation", service.Errorf(service.CodeValidation, "video_id is required"), "", http.StatusBadRequest, service.CodeValidation, "video_id is required"},
+        {"undecodable body", nil, "{", http.StatusBadRequest, service.CodeValidation, "invalid request"},
+        {"duplicate", service.Errorf(service.CodeDuplicate, "video already being tracked"), "", http.StatusConflict, service.CodeDuplicate, "video already being tracked"},
+        {"not found", service.Errorf(service.CodeNotFound, "youtube video not found: abc"), "", http.StatusNotFound, service.CodeNotFound, "youtube video not found: abc"},
+        {"upstream", service.Errorf(service.CodeUpstream, "youtube lookup failed: %w", errors.New("quota")), "", http.StatusBadGateway, service.CodeUpstream, "youtube lookup failed: quota"},
+        {"wrapped service error", fmt.Errorf("registering: %w", service.Errorf(service.CodeNotFound, "gone")), "", http.StatusNotFound, service.CodeNotFound, "registering: gone"},
+        {"plain error", errors.New("database is locked"), "", http.StatusInternalServerError, service.CodeInternal, "database is locked"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            server := registerServer(tt.err)
+            defer server.Close()
+
+            body := tt.body
+            if body == "" {
+                body = `{"platform":"youtube","video_id":"abc"}`
+            }
+            resp, err := http.Post(server.URL+"/track-video", "application/json", strings.NewReader(body))
+            if err != nil {
+                t.Fatal(err)
+            }
+            defer resp.Body.Close()
+
+            if resp.StatusCode != tt.status {
+                t.Errorf("status = %d, want %d", resp.StatusCode, tt.status)
+            }
+            if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+                t.Errorf("content type = %q, want JSON", ct)
+            }
+            var envelope struct {
+                Error struct {
+                    Code    string `json:"code"`
+                    Message string `json:"message"`
+                } `json:"error"`
+            }
+            if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+                t.Fatalf("decoding envelope: %v", err)
+            }
+            if envelope.Error.Code != tt.code || !strings.HasPrefix(envelope.Error.Message, tt.message) {
+                t.Errorf("error = %+v, want %s %q", envelope.Error, tt.code, tt.message)
+            }
+        })
+    }
+}
+
+func TestRegisterVideoCreated(t *testing.T) {
+    server := registerServer(nil)
+    defer server.Close()
+
+    resp, err := http.Post(server.URL+"/track-video", "application/json", strings.NewReader(`{"platform":"youtube","video_id":"abc"}`))
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusCreated {
+        t.Errorf("status = %d, want 201", resp.StatusCode)
+    }
+    var video repository.Video
+    if err := json.NewDecoder(resp.Body).Decode(&video); err != nil {
+        t.Fatal(err)
+    }
+    if video.ID != "1" || video.VideoID != "abc" {
+        t.Errorf("got %+v, want the created video", video)
+    }
+}
@@ -3,35 +3,84 @@ package worker
 import (
 	"context"
 	"log"
+	"sync"
 	"time"
 
+	"video-stats-tracker/internal/platform"
 	"video-stats-tracker/internal/repository"
 	"video-stats-tracker/internal/service"
 
+	"github.com/go-kit/kit/metrics"
 	"github.com/robfig/cron/v3"
 )
 
+// QueuePoll is the queue of videos the running poll has left, reported
+// next to the service's queues
+const QueuePoll = "poll"
+
 type Poller struct {
     service    service.Service
     cron       *cron.Cron
     viralVideos map[string]time.Time // Track viral videos and their detection time
+    viralMu     sync.Mutex
+    duration    metrics.Histogram
+    queueDepth  metrics.Gauge
+}
+
+// Option configures optional poller behavior
+type Option func(*Poller)
+
+// WithInstrumentation observes the duration of every job run, labeled by
+// job, and sets the depth of the poll queue while videos are polled
+func WithInstrumentation(duration metrics.Histogram, queueDepth metrics.Gauge) Option {
+    return func(p *Poller) {
+        p.duration = duration
+        p.queueDepth = queueDepth
+    }
 }
 
-func NewPoller(service service.Service) *Poller {
-    return &Poller{
+func NewPoller(service service.Service, opts ...Option) *Poller {
+    p := &Poller{
         service:     service,
         cron:        cron.New(),
         viralVideos: make(map[string]time.Time),
     }
+    for _, opt := range opts {
+        opt(p)
+    }
+    return p
 }
 
 func (p *Poller) Start() {
-    // Regular polling every hour
-    p.cron.AddFunc("@every 2m", p.pollAllVideos)
+    // Runs that skip a beat rather than overlap, which would store samples
+    // twice or post events twice
+    skipIfRunning := cron.NewChain(cron.SkipIfStillRunning(cron.DefaultLogger))
+
+    // Regular polling every hour. A run over many Instagram posts can
+    // outlast the interval.
+    p.cron.AddJob("@every 2m", skipIfRunning.Then(cron.FuncJob(p.timed("videos", p.pollAllVideos))))
     
     // Viral detection polling every 5 minutes
-    p.cron.AddFunc("@every 1m", p.pollViralVideos)
+    p.cron.AddFunc("@every 1m", p.timed("viral", p.pollViralVideos))
+
+    // Discover new uploads of tracked channels and accounts
+    p.cron.AddFunc("@every 15m", p.timed("accounts", p.syncTrackedAccounts))
+
+    // Audience metrics of tracked accounts change slowly
+    p.cron.AddFunc("@every 1h", p.timed("account_stats", p.pollAccountStats))
+
+    // Downsample and purge old stats
+    p.cron.AddFunc("@every 6h", p.timed("retention", p.applyRetention))
+
+    // Trim the webhook delivery log
+    p.cron.AddFunc("@every 6h", p.timed("webhook_purge", p.purgeWebhookDeliveries))
+
+    // Post queued webhook events and retry failed deliveries
+    p.cron.AddJob("@every 30s", skipIfRunning.Then(cron.FuncJob(p.timed("webhooks", p.deliverWebhooks))))
     
+    // Record milestones crossed before they were tracked or configured
+    go p.timed("milestone_backfill", p.backfillMilestones)()
+
     p.cron.Start()
     log.Println("Polling worker started")
 }
@@ -41,16 +90,42 @@ func (p *Poller) Stop() {
     log.Println("Polling worker stopped")
 }
 
+// timed wraps a job so each run's duration is observed
+func (p *Poller) timed(job string, run func()) func() {
+    return func() {
+        begin := time.Now()
+        run()
+        if p.duration != nil {
+            p.duration.With("job", job).Observe(time.Since(begin).Seconds())
+        }
+    }
+}
+
+func (p *Poller) setQueueDepth(videos int) {
+    if p.queueDepth != nil {
+        p.queueDepth.With("queue", QueuePoll).Set(float64(videos))
+    }
+}
+
 func (p *Poller) pollAllVideos() {
-    ctx := context.Background()
+    // Tracked posts of one Instagram account share its media pages
+    ctx := platform.WithMediaCache(context.Background())
     
     videos, err := p.service.GetAllVideos(ctx)
     if err != nil {
         log.Printf("Error fetching videos: %v", err)
         return
     }
+    defer p.setQueueDepth(0)
 
-    for _, video := range videos {
+    // Rules rarely change; one load serves the whole run
+    rules, err := p.service.GetAlertRules(ctx)
+    if err != nil {
+        log.Printf("Error fetching alert rules: %v", err)
+    }
+
+    for i, video := range videos {
+        p.setQueueDepth(len(videos) - i)
         if err := p.service.UpdateVideoStats(ctx, &video); err != nil {
             log.Printf("Error updating stats for video %s: %v", video.VideoID, err)
             continue
@@ -58,11 +133,74 @@ func (p *Poller) pollAllVideos() {
         
         // Check for viral condition (simplified)
         p.checkViralCondition(ctx, &video)
+
+        if err := p.service.EvaluateAlerts(ctx, &video, rules); err != nil {
+            log.Printf("Error evaluating alerts for video %s: %v", video.VideoID, err)
+        }
+    }
+}
+
+func (p *Poller) syncTrackedAccounts() {
+    ctx := context.Background()
+
+    if err := p.service.SyncTrackedAccounts(ctx); err != nil {
+        log.Printf("Error syncing tracked accounts: %v", err)
+    }
+}
+
+func (p *Poller) pollAccountStats() {
+    ctx := context.Background()
+
+    if err := p.service.UpdateAccountStats(ctx); err != nil {
+        log.Printf("Error updating account stats: %v", err)
+    }
+}
+
+func (p *Poller) applyRetention() {
+    ctx := context.Background()
+
+    report, err := p.service.ApplyRetention(ctx, false)
+    if err != nil {
+        log.Printf("Error applying retention: %v", err)
+        return
+    }
+    log.Printf("Retention: rolled up %d raw samples and %d hourly buckets, purged %d daily buckets",
+        report.RawRolledUp, report.HourlyRolledUp, report.DailyPurged)
+}
+
+func (p *Poller) deliverWebhooks() {
+    ctx := context.Background()
+
+    if err := p.service.DeliverWebhooks(ctx); err != nil {
+        log.Printf("Error delivering webhooks: %v", err)
+    }
+}
+
+func (p *Poller) backfillMilestones() {
+    ctx := context.Background()
+
+    if err := p.service.BackfillMilestones(ctx); err != nil {
+        log.Printf("Error backfilling milestones: %v", err)
+    }
+}
+
+func (p *Poller) purgeWebhookDeliveries() {
+    ctx := context.Background()
+
+    purged, err := p.service.PurgeWebhookDeliveries(ctx)
+    if err != nil {
+        log.Printf("Error purging webhook deliveries: %v", err)
+        return
+    }
+    if purged > 0 {
+        log.Printf("Purged %d old webhook deliveries", purged)
     }
 }
 
 func (p *Poller) pollViralVideos() {
    // ctx := context.Background()
+    p.viralMu.Lock()
+    defer p.viralMu.Unlock()
     
     // Poll only viral videos more frequently
     for videoID := range p.viralVideos {
@@ -78,9 +216,17 @@ func (p *Poller) pollViralVideos() {
 }
 
 func (p *Poller) checkViralCondition(ctx context.Context, video *repository.Video) {
-    // Simplified viral detection - in real implementation, compare with previous stats
-    log.Printf("Checking viral condition for video: %s", video.VideoID)
-    
-    // Example: Mark as viral (you'd implement proper spike detection here)
-    p.viralVideos[video.VideoID] = time.Now()
+    viral, err := p.service.DetectViral(ctx, video)
+    if err != nil {
+        log.Printf("Error checking viral condition for video %s: %v", video.VideoID, err)
+        return
+    }
+    if viral {
+        p.viralMu.Lock()
+        defer p.viralMu.Unlock()
+        if _, ok := p.viralVideos[video.VideoID]; !ok {
+            log.Printf("Viral video detected: %s", video.VideoID)
+            p.viralVideos[video.VideoID] = time.Now()
+        }
+    }
 }
\ No newline at end of file